@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wfunc/gameserver/config"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/services"
+)
+
+// retentionPolicy 由配置生成游戏记录的保留策略
+func retentionPolicy(cfg *config.Config) services.RetentionPolicy {
+	policy := services.RetentionPolicy{
+		DefaultDays: cfg.Retention.DefaultDays,
+		GameDays:    make(map[string]int),
+	}
+	for gameType, gameCfg := range cfg.Games {
+		if gameCfg.RetentionDays != nil {
+			policy.GameDays[gameType] = *gameCfg.RetentionDays
+		}
+	}
+	return policy
+}
+
+// runArchive 执行 archive 子命令：
+//
+//	archive run                立即归档超过保留期的游戏记录
+//	archive restore <file>...  将归档文件中的记录写回数据库
+func runArchive(archiver *services.ArchiveService, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: archive run|restore <file>...")
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "run":
+		archived, err := archiver.Archive(ctx)
+		logger.Log.Infof("Archived %d game records", archived)
+		return err
+	case "restore":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: archive restore <file>...")
+		}
+		for _, path := range args[1:] {
+			restored, skipped, err := archiver.Restore(ctx, path)
+			logger.Log.Infof("Restored %d game records from %s (%d already present)", restored, path, skipped)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown archive command %q", args[0])
+	}
+}
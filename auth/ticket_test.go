@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyTicket(t *testing.T) {
+	secret := []byte("shared secret")
+	now := time.Unix(1700000000, 0)
+	ticket := SignTicket(secret, 42, now.Add(time.Hour))
+
+	if userID, err := VerifyTicket(secret, ticket, now); err != nil || userID != 42 {
+		t.Fatalf("Expected user 42, got %d (%v)", userID, err)
+	}
+
+	forged := strings.Replace(ticket, "42.", "43.", 1)
+	tests := []struct {
+		name   string
+		secret []byte
+		ticket string
+		now    time.Time
+		err    error
+	}{
+		{"forged user", secret, forged, now, ErrInvalidTicket},
+		{"wrong secret", []byte("other"), ticket, now, ErrInvalidTicket},
+		{"no secret", nil, SignTicket(nil, 42, now.Add(time.Hour)), now, ErrInvalidTicket},
+		{"malformed", secret, "42", now, ErrInvalidTicket},
+		{"expired", secret, ticket, now.Add(time.Hour), ErrTicketExpired},
+	}
+	for _, tt := range tests {
+		if _, err := VerifyTicket(tt.secret, tt.ticket, tt.now); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
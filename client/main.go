@@ -15,7 +15,9 @@ import (
 )
 
 const (
+	MsgTypeAuth         = 2
 	MsgTypeCreateRoom   = 103
+	MsgTypeReady        = 109
 	MsgTypePlayerAction = 202
 )
 
@@ -63,6 +65,18 @@ func main() {
 		}
 	}()
 
+	// Log in first; spins are paid with the player's coins. GAME_TICKET is a ticket
+	// from the access layer, otherwise the server must trust client user IDs
+	auth := map[string]interface{}{"user_id": 1}
+	if ticket := os.Getenv("GAME_TICKET"); ticket != "" {
+		auth = map[string]interface{}{"ticket": ticket}
+	}
+	authData, _ := json.Marshal(auth)
+	if err := send(c, MsgTypeAuth, authData); err != nil {
+		log.Println("Write error:", err)
+		return
+	}
+
 	// Send Create Room message automatically
 	log.Println("Sending Create Room request...")
 	if err := send(c, MsgTypeCreateRoom, []byte{}); err != nil {
@@ -70,7 +84,7 @@ func main() {
 		return
 	}
 
-	log.Println("Client started. Type 'spin' and press Enter to play.")
+	log.Println("Client started. Type 'ready' to start the game, then 'spin' (or 'free spin' to use a free spin ticket) to play.")
 
 	// Write loop
 	reader := bufio.NewReader(os.Stdin)
@@ -94,8 +108,20 @@ func main() {
 			text, _ := reader.ReadString('\n')
 			text = strings.TrimSpace(text)
 
-			if text == "spin" {
+			if text == "ready" {
+				readyData, _ := json.Marshal(map[string]bool{"ready": true})
+				if err := send(c, MsgTypeReady, readyData); err != nil {
+					log.Println("Write error:", err)
+					return
+				}
+				log.Println("-> SENT: ready")
+			}
+
+			if text == "spin" || text == "free spin" {
 				action := map[string]string{"type": "spin"}
+				if text == "free spin" {
+					action["item"] = "free_spin_ticket"
+				}
 				actionData, _ := json.Marshal(action)
 				if err := send(c, MsgTypePlayerAction, actionData); err != nil {
 					log.Println("Write error:", err)
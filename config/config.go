@@ -1,21 +1,135 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
+	Server    ServerConfig          `mapstructure:"server"`
+	Database  DatabaseConfig        `mapstructure:"database"`
+	Events    EventsConfig          `mapstructure:"events"`
+	Retention RetentionConfig       `mapstructure:"retention"`
+	Player    PlayerConfig          `mapstructure:"player"`
+	Jackpot   *JackpotConfig        `mapstructure:"jackpot"` // 老虎机累积奖池，未填写时使用默认设置
+	Items     map[string]ItemConfig `mapstructure:"items"`   // 物品目录，按物品 ID
+	Games     map[string]GameConfig `mapstructure:"games"`   // 按游戏类型覆盖游戏模块的默认参数
 }
 
 type ServerConfig struct {
-	HTTPAddress string `mapstructure:"http_address"`
-	RPCAddress  string `mapstructure:"rpc_address"`
+	HTTPAddress    string `mapstructure:"http_address"`
+	RPCAddress     string `mapstructure:"rpc_address"`
+	MetricsAddress string `mapstructure:"metrics_address"` // 为空时不单独启动指标服务
+	// AuthSecret 与接入层共享的登录票据签名密钥，为空时不能以票据登录
+	AuthSecret string `mapstructure:"auth_secret"`
+	// TrustClientUserID 直接信任客户端传入的 user_id，只用于本地调试
+	TrustClientUserID bool `mapstructure:"trust_client_user_id"`
+	// AllowedOrigins 除同源外允许建立 WebSocket 连接的浏览器来源
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+}
+
+// GameConfig 单个游戏类型的节奏参数，未填写的字段使用游戏模块的默认值
+type GameConfig struct {
+	TickInterval   time.Duration   `mapstructure:"tick_interval"`
+	WaitingTime    time.Duration   `mapstructure:"waiting_time"` // 满足开局条件后的倒计时
+	RoundDuration  time.Duration   `mapstructure:"round_duration"`
+	StartMode      string          `mapstructure:"start_mode"` // all_ready 或 min_players
+	MinPlayers     int             `mapstructure:"min_players"`
+	TurnTimeout    time.Duration   `mapstructure:"turn_timeout"`    // 回合制游戏中每次行动的时限，超时由服务器代为行动
+	SettlementTime time.Duration   `mapstructure:"settlement_time"` // 一局结束后展示结算结果的时长，0 表示直接回到等待
+	RetentionDays  *int            `mapstructure:"retention_days"`  // 游戏记录保留天数，未填写时使用 retention.default_days，0 表示永久保留
+	Paytable       *PaytableConfig `mapstructure:"paytable"`        // 老虎机赔付表，未填写时使用默认赔付表
+	Table          *TableConfig    `mapstructure:"table"`           // 德州扑克的盲注和带入，未填写时使用默认值
+	SicBo          *SicBoConfig    `mapstructure:"sic_bo"`          // 骰宝赔付表，未填写时使用默认赔付表
+	Lockstep       *LockstepConfig `mapstructure:"lockstep"`        // 填写时以帧同步进行，帧间隔即 tick_interval
+}
+
+// PaytableConfig 老虎机赔付表
+type PaytableConfig struct {
+	Symbols int           `mapstructure:"symbols"` // 每个转轴上的符号数
+	Pays    map[int]int64 `mapstructure:"pays"`    // 三连的符号 -> 下注倍数
+	// JackpotSymbol 三连时另外赢得累积奖池的符号，未填写时没有奖池
+	JackpotSymbol *int `mapstructure:"jackpot_symbol"`
+	// Scatter 出现在任意转轴上即计数的分散符号，未填写时没有免费 spin
+	Scatter            *int        `mapstructure:"scatter"`
+	FreeSpins          map[int]int `mapstructure:"free_spins"`           // 分散符号个数 -> 奖励的免费 spin 次数
+	FreeSpinMultiplier int64       `mapstructure:"free_spin_multiplier"` // 免费 spin 派奖的倍数
+}
+
+// TableConfig 德州扑克牌桌
+type TableConfig struct {
+	SmallBlind int64 `mapstructure:"small_blind"`
+	BigBlind   int64 `mapstructure:"big_blind"`
+	BuyIn      int64 `mapstructure:"buy_in"` // 每手牌的带入筹码，结束时剩余的筹码退回
+}
+
+// SicBoConfig 骰宝赔付表，赔率为每 1 下注赢得的金额
+type SicBoConfig struct {
+	BigSmall    int64         `mapstructure:"big_small"`
+	Totals      map[int]int64 `mapstructure:"totals"` // 总点数 -> 赔率，未列出的总点数不能下注
+	AnyTriple   int64         `mapstructure:"any_triple"`
+	Triple      int64         `mapstructure:"triple"`
+	Double      int64         `mapstructure:"double"`
+	Combination int64         `mapstructure:"combination"`
+	Single      []int64       `mapstructure:"single"` // 指定点数出现一次、两次、三次的赔率
+}
+
+// LockstepConfig 帧同步，未填写的字段使用默认值
+type LockstepConfig struct {
+	InputDelay    int `mapstructure:"input_delay"`     // 输入未指定帧号时延后的帧数
+	MaxLateFrames int `mapstructure:"max_late_frames"` // 迟到不超过该帧数的输入并入当前帧
+	HistoryFrames int `mapstructure:"history_frames"`  // 保留供重连追帧的帧数
+}
+
+// JackpotConfig 累积奖池
+type JackpotConfig struct {
+	Contribution float64 `mapstructure:"contribution"` // 每次下注计入奖池的比例，例如 0.01
+	Seed         int64   `mapstructure:"seed"`         // 奖池创建时和被领取后的金额
 }
 
 type DatabaseConfig struct {
-	Postgres PostgresConfig `mapstructure:"postgres"`
+	Driver      string         `mapstructure:"driver"`       // postgres(默认，GORM)、pq(database/sql) 或 memory(内存，不持久化)
+	AutoMigrate bool           `mapstructure:"auto_migrate"` // 启动时执行未执行的迁移，生产环境应使用 migrate 命令
+	Postgres    PostgresConfig `mapstructure:"postgres"`
+}
+
+// EventsConfig 发件箱事件的投递目标，未配置的目标不启用
+type EventsConfig struct {
+	LogFile        string        `mapstructure:"log_file"`        // 事件按 JSON 行追加写入的文件
+	WebhookURL     string        `mapstructure:"webhook_url"`     // 事件 POST 的地址
+	WebhookTimeout time.Duration `mapstructure:"webhook_timeout"` // 单次 webhook 请求的超时时间
+}
+
+// RetentionConfig 游戏记录的保留和归档
+type RetentionConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Interval    time.Duration `mapstructure:"interval"`     // 归档任务的执行间隔
+	DefaultDays int           `mapstructure:"default_days"` // 游戏记录保留的天数，0 表示永久保留
+	ArchiveDir  string        `mapstructure:"archive_dir"`  // 归档文件的根目录
+}
+
+// PlayerConfig 新玩家的初始资料和对局经验，未填写的字段使用默认值
+type PlayerConfig struct {
+	StartingCoins *int64           `mapstructure:"starting_coins"` // 首次登录时发放的金币，未填写时使用默认值，0 表示不发放
+	ExpPerRound   int              `mapstructure:"exp_per_round"`  // 每参与一局获得的经验
+	ExpPerWin     int              `mapstructure:"exp_per_win"`    // 赢得一局额外获得的经验
+	Levels        LevelCurveConfig `mapstructure:"levels"`
+}
+
+// LevelCurveConfig 从 n 级升到 n+1 级需要 base_exp * growth^(n-1) 经验
+type LevelCurveConfig struct {
+	BaseExp  int     `mapstructure:"base_exp"`
+	Growth   float64 `mapstructure:"growth"`
+	MaxLevel int     `mapstructure:"max_level"`
+}
+
+// ItemConfig 物品目录中的一种物品
+type ItemConfig struct {
+	Name      string                 `mapstructure:"name"`
+	Stackable bool                   `mapstructure:"stackable"`
+	Lifetime  time.Duration          `mapstructure:"lifetime"` // 发放后的有效期，0 表示永不过期
+	Effects   map[string]interface{} `mapstructure:"effects"`  // 使用效果，例如 spin_bet
 }
 
 type PostgresConfig struct {
@@ -0,0 +1,174 @@
+// events/dispatcher.go
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+const (
+	// dispatchInterval 发件箱为空时两次领取之间的间隔
+	dispatchInterval = time.Second
+	// dispatchBatchSize 每次领取的事件数
+	dispatchBatchSize = 100
+	// dispatchLease 领取的事件在该时间内不会被其他节点领取，至少为投递两个事件的最长时间。
+	// 一批事件在租约内投递不完时，剩余的事件留到租约到期后重新领取
+	dispatchLease = time.Minute
+	// deliverTimeout 单个事件投递给一个 Sink 的超时时间
+	deliverTimeout = 10 * time.Second
+	// maxDeliveryAttempts 投递失败达到该次数后事件转为死信
+	maxDeliveryAttempts = 10
+	// retryDelay 第一次重试前的等待时间，之后每次翻倍，最长 maxRetryDelay
+	retryDelay    = time.Second
+	maxRetryDelay = 10 * time.Minute
+)
+
+// Dispatcher 从发件箱领取事件并投递给所有 Sink，全部成功后删除事件，
+// 否则按指数退避重试，超过次数后转为死信。多个节点可以同时运行 Dispatcher
+type Dispatcher struct {
+	db             persistence.Database
+	sinks          []Sink
+	interval       time.Duration
+	lease          time.Duration
+	deliverTimeout time.Duration
+	maxAttempts    int
+	retryDelay     time.Duration
+	stop           chan struct{}
+	done           chan struct{}
+	startOnce      sync.Once
+	closeOnce      sync.Once
+}
+
+// NewDispatcher 创建事件投递器，调用 Start 后开始投递
+func NewDispatcher(db persistence.Database, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		db:             db,
+		sinks:          sinks,
+		interval:       dispatchInterval,
+		lease:          dispatchLease,
+		deliverTimeout: deliverTimeout,
+		maxAttempts:    maxDeliveryAttempts,
+		retryDelay:     retryDelay,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+// AddSink 添加投递目标，只能在 Start 之前调用
+func (d *Dispatcher) AddSink(sink Sink) {
+	d.sinks = append(d.sinks, sink)
+}
+
+// Start 启动投递协程
+func (d *Dispatcher) Start() {
+	d.startOnce.Do(func() {
+		go d.run()
+	})
+}
+
+// Close 停止投递并等待当前一批事件处理完毕，未投递的事件留在发件箱中
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() {
+		close(d.stop)
+		// 未启动时没有投递协程
+		d.startOnce.Do(func() { close(d.done) })
+		<-d.done
+	})
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	for {
+		claimed, err := d.dispatchBatch(context.Background())
+		if err != nil {
+			logger.Log.Errorf("Failed to dispatch outbox events: %v", err)
+		}
+
+		// 领满一批说明可能还有积压，立即继续
+		wait := d.interval
+		if claimed == dispatchBatchSize {
+			wait = 0
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// dispatchBatch 领取并投递一批事件，返回领取的事件数。
+// 租约内来不及再投递一个事件时停止，剩余的事件租约到期后重新领取，不会与其他节点重复投递
+func (d *Dispatcher) dispatchBatch(ctx context.Context) (int, error) {
+	// 投递一个事件的最长时间
+	perEvent := d.deliverTimeout * time.Duration(len(d.sinks))
+	lease := d.lease
+	if lease < 2*perEvent {
+		lease = 2 * perEvent
+	}
+	deadline := time.Now().Add(lease - perEvent)
+
+	events, err := d.db.Outbox().ClaimEvents(ctx, dispatchBatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range events {
+		if time.Now().After(deadline) {
+			logger.Log.Warnf("Outbox lease running out, leaving %d events for the next claim", len(events)-i)
+			return len(events), nil
+		}
+		if err := d.dispatch(ctx, &events[i]); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// dispatch 将事件投递给所有 Sink 并记录结果，只有记录结果失败时返回错误
+func (d *Dispatcher) dispatch(ctx context.Context, event *models.OutboxEvent) error {
+	var failures []string
+	for _, sink := range d.sinks {
+		deliverCtx, cancel := context.WithTimeout(ctx, d.deliverTimeout)
+		err := sink.Deliver(deliverCtx, event)
+		cancel()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", sink.Name(), err))
+		}
+	}
+
+	outbox := d.db.Outbox()
+	if len(failures) == 0 {
+		return outbox.DeleteEvent(ctx, event.ID)
+	}
+
+	lastError := strings.Join(failures, "; ")
+	attempts := event.Attempts + 1
+	if attempts >= d.maxAttempts {
+		logger.Log.Errorf("Outbox event %d (%s) dead-lettered after %d attempts: %s", event.ID, event.Type, attempts, lastError)
+		return outbox.DeadLetterEvent(ctx, event.ID, lastError)
+	}
+
+	delay := d.backoff(attempts)
+	logger.Log.Warnf("Failed to deliver outbox event %d (%s), attempt %d, retrying in %v: %s", event.ID, event.Type, attempts, delay, lastError)
+	return outbox.RetryEvent(ctx, event.ID, delay, lastError)
+}
+
+// backoff 返回第 attempts 次失败后的重试等待时间
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
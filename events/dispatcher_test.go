@@ -0,0 +1,202 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	os.Exit(m.Run())
+}
+
+// recordingSink records delivered events and fails while failing is set.
+type recordingSink struct {
+	delivered []models.OutboxEvent
+	failing   bool
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Deliver(ctx context.Context, event *models.OutboxEvent) error {
+	if s.failing {
+		return errors.New("unavailable")
+	}
+	s.delivered = append(s.delivered, *event)
+	return nil
+}
+
+func newTestDispatcher(t *testing.T, sinks ...Sink) (*Dispatcher, *persistence.Memory) {
+	t.Helper()
+	db := persistence.NewMemory()
+	d := NewDispatcher(db, sinks...)
+	d.retryDelay = 0
+	return d, db
+}
+
+func TestAppend_RolledBackWithTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := persistence.NewMemory()
+
+	err := db.Transaction(ctx, func(tx persistence.Tx) error {
+		if err := Append(ctx, tx, TypeCoinsChanged, "1", CoinsChanged{UserID: 1, Delta: 10}); err != nil {
+			return err
+		}
+		return errors.New("state change failed")
+	})
+	if err == nil {
+		t.Fatal("Expected the transaction to fail")
+	}
+
+	if pending, _ := db.Outbox().ClaimEvents(ctx, 10, time.Minute); len(pending) != 0 {
+		t.Errorf("Expected no event after rollback, got %+v", pending)
+	}
+}
+
+func TestDispatcher_DeliversAndDeletes(t *testing.T) {
+	ctx := context.Background()
+	sink := &recordingSink{}
+	d, db := newTestDispatcher(t, sink)
+
+	Append(ctx, db, TypePlayerJoined, "room_1", PlayerJoined{RoomID: "room_1", UserID: 7})
+	Append(ctx, db, TypeCoinsChanged, "7", CoinsChanged{UserID: 7, Delta: -10})
+
+	if _, err := d.dispatchBatch(ctx); err != nil {
+		t.Fatalf("Failed to dispatch: %v", err)
+	}
+	if len(sink.delivered) != 2 || sink.delivered[0].Type != TypePlayerJoined || sink.delivered[1].Type != TypeCoinsChanged {
+		t.Fatalf("Expected both events in order, got %+v", sink.delivered)
+	}
+
+	// 投递成功的事件已删除，即使租约到期也不会再次投递
+	if pending, _ := db.Outbox().ClaimEvents(ctx, 10, 0); len(pending) != 0 {
+		t.Errorf("Expected delivered events to be deleted, got %+v", pending)
+	}
+}
+
+func TestDispatcher_RetriesThenDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	sink := &recordingSink{failing: true}
+	d, db := newTestDispatcher(t, sink)
+	d.maxAttempts = 3
+
+	Append(ctx, db, TypeRoundSettled, "room_1", models.GameRecord{RoomID: "room_1"})
+
+	for i := 0; i < 2; i++ {
+		d.dispatchBatch(ctx)
+	}
+	if dead, _ := db.Outbox().ListDeadLetters(ctx, 0); len(dead) != 0 {
+		t.Fatalf("Expected the event to still be retried, got dead letters %+v", dead)
+	}
+
+	d.dispatchBatch(ctx)
+	dead, _ := db.Outbox().ListDeadLetters(ctx, 0)
+	if len(dead) != 1 || dead[0].Attempts != 3 || dead[0].LastError != "recording: unavailable" {
+		t.Fatalf("Expected one dead letter after 3 attempts, got %+v", dead)
+	}
+
+	// 死信不再投递
+	sink.failing = false
+	d.dispatchBatch(ctx)
+	if len(sink.delivered) != 0 {
+		t.Errorf("Expected dead letters not to be delivered, got %+v", sink.delivered)
+	}
+}
+
+// slowSink takes delay to deliver each event.
+type slowSink struct {
+	recordingSink
+	delay time.Duration
+}
+
+func (s *slowSink) Deliver(ctx context.Context, event *models.OutboxEvent) error {
+	time.Sleep(s.delay)
+	return s.recordingSink.Deliver(ctx, event)
+}
+
+func TestDispatcher_StopsBeforeLeaseExpires(t *testing.T) {
+	ctx := context.Background()
+	sink := &slowSink{delay: 20 * time.Millisecond}
+	d, db := newTestDispatcher(t, sink)
+	d.lease = 60 * time.Millisecond
+	d.deliverTimeout = 30 * time.Millisecond
+
+	for i := 0; i < 5; i++ {
+		Append(ctx, db, TypeCoinsChanged, "7", CoinsChanged{UserID: 7, Delta: int64(i)})
+	}
+	if claimed, err := d.dispatchBatch(ctx); err != nil || claimed != 5 {
+		t.Fatalf("Expected 5 claimed events, got %d (%v)", claimed, err)
+	}
+	delivered := len(sink.delivered)
+	if delivered == 0 || delivered == 5 {
+		t.Fatalf("Expected the batch to stop before its lease ran out, delivered %d", delivered)
+	}
+
+	// 剩余的事件在租约到期前不会被领取，到期后重新领取
+	if pending, _ := db.Outbox().ClaimEvents(ctx, 10, time.Minute); len(pending) != 0 {
+		t.Errorf("Expected the undelivered events to stay leased, got %d", len(pending))
+	}
+	time.Sleep(d.lease)
+	if pending, _ := db.Outbox().ClaimEvents(ctx, 10, time.Minute); len(pending) != 5-delivered {
+		t.Errorf("Expected %d events to be claimed again, got %d", 5-delivered, len(pending))
+	}
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := NewDispatcher(persistence.NewMemory())
+	if d.backoff(1) != time.Second || d.backoff(3) != 4*time.Second {
+		t.Errorf("Expected doubling delays, got %v and %v", d.backoff(1), d.backoff(3))
+	}
+	if d.backoff(100) != maxRetryDelay {
+		t.Errorf("Expected the delay to be capped at %v, got %v", maxRetryDelay, d.backoff(100))
+	}
+}
+
+func TestBus_RoutesByType(t *testing.T) {
+	bus := NewBus()
+	var coins, all int
+	bus.Subscribe(TypeCoinsChanged, func(ctx context.Context, event *models.OutboxEvent) error {
+		coins++
+		return nil
+	})
+	bus.Subscribe("", func(ctx context.Context, event *models.OutboxEvent) error {
+		all++
+		return nil
+	})
+
+	bus.Deliver(context.Background(), &models.OutboxEvent{Type: TypeCoinsChanged})
+	bus.Deliver(context.Background(), &models.OutboxEvent{Type: TypePlayerJoined})
+	if coins != 1 || all != 2 {
+		t.Errorf("Expected 1 coins.changed and 2 total deliveries, got %d and %d", coins, all)
+	}
+}
+
+func TestWebhookSink_StatusCodes(t *testing.T) {
+	status := http.StatusOK
+	var eventType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eventType = r.Header.Get("X-Event-Type")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, time.Second)
+	event := &models.OutboxEvent{ID: 1, Type: TypeRoundSettled, Payload: []byte(`{}`)}
+	if err := sink.Deliver(context.Background(), event); err != nil || eventType != TypeRoundSettled {
+		t.Errorf("Expected delivery to succeed with the event type header, got %v, %q", err, eventType)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := sink.Deliver(context.Background(), event); err == nil {
+		t.Error("Expected a non-2xx response to fail the delivery")
+	}
+}
@@ -0,0 +1,55 @@
+// Package events 领域事件的事务性发件箱。
+// 事件与产生它的状态变更通过同一个 persistence.Tx 写入 outbox_events 表，
+// 由 Dispatcher 从发件箱领取后投递给各个 Sink，保证至少投递一次。
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+// 事件类型
+const (
+	// TypeRoundSettled 一局结束，负载为 models.GameRecord
+	TypeRoundSettled = "round.settled"
+	// TypeCoinsChanged 玩家金币变动，负载为 CoinsChanged
+	TypeCoinsChanged = "coins.changed"
+	// TypePlayerJoined 玩家加入房间，负载为 PlayerJoined
+	TypePlayerJoined = "player.joined"
+	// TypeItemsChanged 玩家物品数量变动，负载为 models.ItemLedgerEntry
+	TypeItemsChanged = "items.changed"
+	// TypeJackpotWon 玩家赢得累积奖池，负载为 models.JackpotWin
+	TypeJackpotWon = "jackpot.won"
+)
+
+// CoinsChanged 金币变动事件的负载
+type CoinsChanged struct {
+	UserID  int64  `json:"user_id"`
+	Delta   int64  `json:"delta"`
+	Balance int64  `json:"balance"`
+	Reason  string `json:"reason"`
+}
+
+// PlayerJoined 玩家加入房间事件的负载
+type PlayerJoined struct {
+	RoomID    string `json:"room_id"`
+	GameType  string `json:"game_type"`
+	UserID    int64  `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+// Append 在 tx 中写入一个事件。与状态变更使用同一个 tx 时，两者一起提交或回滚
+func Append(ctx context.Context, tx persistence.Tx, eventType, key string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Outbox().AppendEvent(ctx, &models.OutboxEvent{
+		Type:    eventType,
+		Key:     key,
+		Payload: data,
+	})
+}
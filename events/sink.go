@@ -0,0 +1,140 @@
+// events/sink.go
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+// Sink 事件的投递目标。投递是至少一次的，同一个事件可能被投递多次，
+// 接收方应按事件 ID 去重
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, event *models.OutboxEvent) error
+}
+
+// LogSink 将事件以 JSON 行追加写入文件
+type LogSink struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// NewLogSink 打开(必要时创建)事件日志文件
+func NewLogSink(path string) (*LogSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &LogSink{file: file}, nil
+}
+
+func (s *LogSink) Name() string { return "log" }
+
+// Deliver 写入一行并刷到磁盘，写入成功才算投递成功
+func (s *LogSink) Deliver(ctx context.Context, event *models.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close 关闭事件日志文件
+func (s *LogSink) Close() error {
+	return s.file.Close()
+}
+
+// WebhookSink 将事件以 JSON POST 到指定地址，返回 2xx 视为投递成功
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink 创建 webhook 投递目标，timeout 为单次请求的超时时间
+func NewWebhookSink(url string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Deliver(ctx context.Context, event *models.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(event.ID, 10))
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Handler 进程内的事件订阅者
+type Handler func(ctx context.Context, event *models.OutboxEvent) error
+
+// Bus 将事件分发给进程内的订阅者。任一订阅者失败时整个事件会被重新投递，
+// 已成功的订阅者也会再次收到
+type Bus struct {
+	handlers map[string][]Handler
+	mutex    sync.RWMutex
+}
+
+// NewBus 创建进程内事件总线
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe 订阅指定类型的事件，eventType 为空时订阅全部事件
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *Bus) Name() string { return "bus" }
+
+func (b *Bus) Deliver(ctx context.Context, event *models.OutboxEvent) error {
+	b.mutex.RLock()
+	handlers := append(append([]Handler(nil), b.handlers[event.Type]...), b.handlers[""]...)
+	b.mutex.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
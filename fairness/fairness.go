@@ -0,0 +1,144 @@
+// fairness/fairness.go
+// Package fairness 实现可证明公平的随机结果：开局前公布服务器种子的哈希，
+// 每次 spin 由玩家ID、客户端种子和服务端分配的 nonce 经 HMAC-SHA256 得出结果，一局结束后公开服务器种子，
+// 玩家和审计方可以离线用 Verify 校验游戏记录
+package fairness
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+// ResultKey 游戏记录 Result 中保存公平性证明的键
+const ResultKey = "fairness"
+
+var (
+	// ErrSeedMismatch 公开的服务器种子与开局前公布的哈希不符
+	ErrSeedMismatch = errors.New("server seed does not match its hash")
+	// ErrOutcomeMismatch 记录的结果与种子计算出的结果不符
+	ErrOutcomeMismatch = errors.New("outcome does not match seeds")
+	// ErrNoProof 游戏记录中没有公平性证明
+	ErrNoProof = errors.New("record has no fairness proof")
+)
+
+// Commitment 一局的服务器种子及其哈希，ServerSeed 在一局结束前不能发给客户端
+type Commitment struct {
+	ServerSeed string `json:"-"`
+	Hash       string `json:"server_seed_hash"`
+}
+
+// NewCommitment 生成新的随机服务器种子
+func NewCommitment() *Commitment {
+	seed := make([]byte, 32)
+	rand.Read(seed) // 读取失败时 crypto/rand 直接终止程序
+	return RestoreCommitment(hex.EncodeToString(seed))
+}
+
+// RestoreCommitment 用已有的服务器种子创建承诺，例如从房间快照恢复或重放一局时
+func RestoreCommitment(serverSeed string) *Commitment {
+	return &Commitment{ServerSeed: serverSeed, Hash: HashSeed(serverSeed)}
+}
+
+// HashSeed 返回服务器种子的 SHA-256 哈希(十六进制)
+func HashSeed(serverSeed string) string {
+	sum := sha256.Sum256([]byte(serverSeed))
+	return hex.EncodeToString(sum[:])
+}
+
+// Ints 返回 n 个 [0, max) 内的整数。每 4 字节摘要换算为 [0, 1) 的小数再乘以 max，
+// 一个摘要用完后 cursor 加一继续计算：HMAC-SHA256(serverSeed, "playerID:clientSeed:nonce:cursor")。
+// 玩家ID参与计算，其他玩家使用相同的客户端种子和 nonce 也得不到相同的结果
+func Ints(serverSeed, playerID, clientSeed string, nonce uint64, n, max int) []int {
+	ints := make([]int, 0, n)
+	for cursor := 0; len(ints) < n; cursor++ {
+		digest := digest(serverSeed, playerID, clientSeed, nonce, cursor)
+		for i := 0; i+4 <= len(digest) && len(ints) < n; i += 4 {
+			f := float64(binary.BigEndian.Uint32(digest[i:])) / (1 << 32)
+			ints = append(ints, int(f*float64(max)))
+		}
+	}
+	return ints
+}
+
+// StreamKey 由服务器种子派生随机数发生器的密钥，与公布的哈希无关，不能由哈希推算
+func StreamKey(serverSeed string) [32]byte {
+	var key [32]byte
+	mac := hmac.New(sha256.New, []byte(serverSeed))
+	mac.Write([]byte("stream"))
+	copy(key[:], mac.Sum(nil))
+	return key
+}
+
+func digest(serverSeed, playerID, clientSeed string, nonce uint64, cursor int) []byte {
+	mac := hmac.New(sha256.New, []byte(serverSeed))
+	mac.Write([]byte(playerID + ":" + clientSeed + ":" + strconv.FormatUint(nonce, 10) + ":" + strconv.Itoa(cursor)))
+	return mac.Sum(nil)
+}
+
+// Spin 一次随机结果及其输入
+type Spin struct {
+	PlayerID   string `json:"player_id"`
+	ClientSeed string `json:"client_seed"`
+	Nonce      uint64 `json:"nonce"`
+	Outcome    []int  `json:"outcome"`
+}
+
+// Proof 一局结束后公开的公平性证明，Range 为每个结果的取值范围
+type Proof struct {
+	ServerSeed     string `json:"server_seed"`
+	ServerSeedHash string `json:"server_seed_hash"`
+	Range          int    `json:"range"`
+	Spins          []Spin `json:"spins"`
+}
+
+// Verify 校验服务器种子与哈希相符，且每次结果都能由种子重新算出
+func Verify(proof *Proof) error {
+	if HashSeed(proof.ServerSeed) != proof.ServerSeedHash {
+		return ErrSeedMismatch
+	}
+	for i, spin := range proof.Spins {
+		expected := Ints(proof.ServerSeed, spin.PlayerID, spin.ClientSeed, spin.Nonce, len(spin.Outcome), proof.Range)
+		for j := range expected {
+			if expected[j] != spin.Outcome[j] {
+				return fmt.Errorf("spin %d (nonce %d): %w", i, spin.Nonce, ErrOutcomeMismatch)
+			}
+		}
+	}
+	return nil
+}
+
+// ProofFromRecord 从游戏记录中取出公平性证明，记录可以来自数据库或归档文件
+func ProofFromRecord(record *models.GameRecord) (*Proof, error) {
+	raw, ok := record.Result[ResultKey]
+	if !ok || raw == nil {
+		return nil, ErrNoProof
+	}
+	// 从数据库读出的记录中证明是 map，重新编码后解析
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	proof := &Proof{}
+	if err := json.Unmarshal(data, proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// VerifyRecord 校验一条游戏记录中的公平性证明
+func VerifyRecord(record *models.GameRecord) (*Proof, error) {
+	proof, err := ProofFromRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	return proof, Verify(proof)
+}
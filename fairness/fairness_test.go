@@ -0,0 +1,85 @@
+package fairness
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+func TestInts_Deterministic(t *testing.T) {
+	a := Ints("server", "p1", "client", 1, 20, 8)
+	b := Ints("server", "p1", "client", 1, 20, 8)
+	if len(a) != 20 {
+		t.Fatalf("Expected 20 ints across several digests, got %d", len(a))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("Expected the same seeds to give the same outcome, got %v and %v", a, b)
+		}
+		if a[i] < 0 || a[i] >= 8 {
+			t.Fatalf("Expected ints in [0, 8), got %v", a)
+		}
+	}
+
+	c := Ints("server", "p1", "client", 2, 20, 8)
+	same := true
+	for i := range a {
+		same = same && a[i] == c[i]
+	}
+	if same {
+		t.Errorf("Expected a different nonce to give a different outcome")
+	}
+
+	// 其他玩家重复使用相同的客户端种子和 nonce 得到不同的结果
+	d := Ints("server", "p2", "client", 1, 20, 8)
+	same = true
+	for i := range a {
+		same = same && a[i] == d[i]
+	}
+	if same {
+		t.Errorf("Expected a different player to give a different outcome")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	commitment := NewCommitment()
+	proof := &Proof{
+		ServerSeed:     commitment.ServerSeed,
+		ServerSeedHash: commitment.Hash,
+		Range:          8,
+		Spins: []Spin{
+			{PlayerID: "p1", ClientSeed: "lucky", Nonce: 1, Outcome: Ints(commitment.ServerSeed, "p1", "lucky", 1, 3, 8)},
+			{PlayerID: "p1", ClientSeed: "lucky", Nonce: 2, Outcome: Ints(commitment.ServerSeed, "p1", "lucky", 2, 3, 8)},
+		},
+	}
+	if err := Verify(proof); err != nil {
+		t.Fatalf("Expected proof to verify, got %v", err)
+	}
+
+	// 结果经 JSON 保存到游戏记录后仍然可以校验
+	data, _ := json.Marshal(map[string]interface{}{ResultKey: proof})
+	record := &models.GameRecord{}
+	json.Unmarshal(data, &record.Result)
+	if _, err := VerifyRecord(record); err != nil {
+		t.Errorf("Expected record to verify, got %v", err)
+	}
+
+	proof.Spins[1].PlayerID = "p2"
+	if err := Verify(proof); !errors.Is(err, ErrOutcomeMismatch) {
+		t.Errorf("Expected ErrOutcomeMismatch for a spin claimed by another player, got %v", err)
+	}
+	proof.Spins[1].PlayerID = "p1"
+	proof.Spins[1].Outcome = []int{7, 7, 7}
+	if err := Verify(proof); !errors.Is(err, ErrOutcomeMismatch) {
+		t.Errorf("Expected ErrOutcomeMismatch for a forged outcome, got %v", err)
+	}
+	proof.ServerSeed = "other"
+	if err := Verify(proof); err != ErrSeedMismatch {
+		t.Errorf("Expected ErrSeedMismatch for a swapped seed, got %v", err)
+	}
+	if _, err := VerifyRecord(&models.GameRecord{}); err != ErrNoProof {
+		t.Errorf("Expected ErrNoProof, got %v", err)
+	}
+}
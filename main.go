@@ -1,10 +1,23 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/wfunc/gameserver/config"
+	"github.com/wfunc/gameserver/events"
 	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/monitor"
 	"github.com/wfunc/gameserver/persistence"
 	"github.com/wfunc/gameserver/server"
+	"github.com/wfunc/gameserver/services"
+	"github.com/wfunc/gameserver/state"
+	"github.com/wfunc/gameserver/timer"
 )
 
 func main() {
@@ -17,25 +30,270 @@ func main() {
 		logger.Log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Apply per-game overrides on top of the game modules' defaults
+	for gameType, gameCfg := range cfg.Games {
+		state.SetGameConfig(gameType, state.GameConfig{
+			TickInterval:  gameCfg.TickInterval,
+			RoundDuration: gameCfg.RoundDuration,
+			StartRule: state.StartRule{
+				Mode:       state.StartMode(gameCfg.StartMode),
+				MinPlayers: gameCfg.MinPlayers,
+				Countdown:  gameCfg.WaitingTime,
+			},
+			TurnTimeout:    gameCfg.TurnTimeout,
+			SettlementTime: gameCfg.SettlementTime,
+			Lockstep:       lockstepConfig(gameCfg.Lockstep),
+		})
+	}
+
+	// Slot machine paytable; the default paytable is used when none is configured
+	paytable, err := slotPaytable(cfg.Games["slot_machine"])
+	if err != nil {
+		logger.Log.Fatalf("Invalid slot machine paytable: %v", err)
+	}
+	state.RegisterGameModule(&state.SlotMachine{Paytable: paytable})
+
+	// Hold'em blinds and buy-in; the defaults are used when none are configured
+	holdem := holdemModule(cfg.Games["holdem"])
+	if err := holdem.Validate(); err != nil {
+		logger.Log.Fatalf("Invalid holdem table: %v", err)
+	}
+	state.RegisterGameModule(holdem)
+
+	// Sic Bo paytable; the default paytable is used when none is configured
+	sicBo, err := sicBoPaytable(cfg.Games["sic_bo"])
+	if err != nil {
+		logger.Log.Fatalf("Invalid sic bo paytable: %v", err)
+	}
+	state.RegisterGameModule(&state.SicBo{Paytable: sicBo})
+
+	// Paytable simulation: gameserver simulate [spins] [seed]
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		if err := runSimulate(paytable, os.Args[2:]); err != nil {
+			logger.Log.Fatalf("Simulation failed: %v", err)
+		}
+		return
+	}
+
+	// Schema migrations: gameserver migrate up|down [steps]|to <version>|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg.Database, os.Args[2:]); err != nil {
+			logger.Log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// Offline fairness verification: gameserver verify <file>...
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		catalog := services.NewItemCatalog(services.DefaultItems()...)
+		if len(cfg.Items) > 0 {
+			catalog = itemCatalog(cfg.Items)
+		}
+		if err := runVerify(catalog, os.Args[2:]); err != nil {
+			logger.Log.Fatalf("Verification failed: %v", err)
+		}
+		return
+	}
+
+	if cfg.Database.AutoMigrate && usesPostgres(cfg.Database) {
+		if err := runMigrate(cfg.Database, []string{"up"}); err != nil {
+			logger.Log.Fatalf("Migration failed: %v", err)
+		}
+	}
+
 	// Initialize Database
-	db, err := persistence.NewGormPostgreSQL(
-		cfg.Database.Postgres.Host,
-		cfg.Database.Postgres.Port,
-		cfg.Database.Postgres.User,
-		cfg.Database.Postgres.Password,
-		cfg.Database.Postgres.DBName,
-	)
+	db, err := openDatabase(cfg.Database)
 	if err != nil {
 		logger.Log.Fatalf("Failed to connect to database: %v", err)
 	}
-	logger.Log.Info("Database connection successful.")
+	logger.Log.Infof("Database connection successful (driver: %s).", cfg.Database.Driver)
+
+	// Game record retention: gameserver archive run|restore <file>...
+	archiver := services.NewArchiveService(db, retentionPolicy(cfg), cfg.Retention.ArchiveDir)
+	if len(os.Args) > 1 && os.Args[1] == "archive" {
+		if err := runArchive(archiver, os.Args[2:]); err != nil {
+			logger.Log.Fatalf("Archive command failed: %v", err)
+		}
+		return
+	}
+	if cfg.Retention.Enabled {
+		interval := cfg.Retention.Interval
+		if interval <= 0 {
+			interval = 24 * time.Hour
+		}
+		archiver.Schedule(timer.NewTimerManager(), interval)
+		logger.Log.Infof("Archiving expired game records every %v to %s", interval, cfg.Retention.ArchiveDir)
+	}
 
 	// Initialize Game Server
 	gameServer := server.NewGameServer(cfg.Server.HTTPAddress, cfg.Server.RPCAddress, db)
 
-	// Start Server
+	// Login tickets signed by the access layer; trusting client user IDs is for local play only
+	gameServer.SetAuth(cfg.Server.AuthSecret, cfg.Server.TrustClientUserID)
+	gameServer.SetAllowedOrigins(cfg.Server.AllowedOrigins)
+	if cfg.Server.TrustClientUserID {
+		logger.Log.Warn("Trusting client user IDs without a ticket, do not use in production.")
+	} else if cfg.Server.AuthSecret == "" {
+		logger.Log.Warn("No auth secret configured, clients cannot log in.")
+	}
+
+	// Initialize Monitor
+	mon := monitor.NewMonitor("gameserver")
+	if cfg.Server.MetricsAddress != "" {
+		mon.StartServer(cfg.Server.MetricsAddress)
+	}
+	gameServer.SetMonitor(mon)
+	mon.SetTheoreticalRTP("slot_machine", paytable.TheoreticalRTP())
+
+	// Starting coins and the experience/level curve for player profiles
+	gameServer.SetProfileSettings(profileSettings(cfg.Player))
+
+	// Progressive jackpot shared by all slot rooms
+	if cfg.Jackpot != nil {
+		settings := services.JackpotSettings{Contribution: cfg.Jackpot.Contribution, Seed: cfg.Jackpot.Seed}
+		if err := settings.Validate(); err != nil {
+			logger.Log.Fatalf("Invalid jackpot settings: %v", err)
+		}
+		gameServer.SetJackpotSettings(settings)
+	}
+
+	// Item catalog; the built-in items are used when none are configured
+	if len(cfg.Items) > 0 {
+		gameServer.SetItemCatalog(itemCatalog(cfg.Items))
+	}
+
+	// Event sinks for the transactional outbox
+	if err := addEventSinks(gameServer, cfg.Events); err != nil {
+		logger.Log.Fatalf("Failed to set up event sinks: %v", err)
+	}
+
+	// Start Server; on SIGINT/SIGTERM stop accepting connections and flush queued writes before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	logger.Log.Infof("Starting game server on %s", cfg.Server.HTTPAddress)
-	if err := gameServer.Start(); err != nil {
-		logger.Log.Fatalf("Failed to start server: %v", err)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- gameServer.Start() }()
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			logger.Log.Fatalf("Failed to start server: %v", err)
+		}
+	case <-ctx.Done():
+		logger.Log.Info("Shutting down game server")
+		gameServer.Shutdown()
+		logger.Log.Info("Game server stopped")
+	}
+}
+
+// openDatabase 按配置的驱动创建数据库，driver 为空时使用 postgres
+func openDatabase(cfg config.DatabaseConfig) (persistence.Database, error) {
+	pg := cfg.Postgres
+	switch cfg.Driver {
+	case "", "postgres":
+		return persistence.NewGormPostgreSQL(pg.Host, pg.Port, pg.User, pg.Password, pg.DBName)
+	case "pq":
+		return persistence.NewPostgreSQL(pg.Host, pg.Port, pg.User, pg.Password, pg.DBName)
+	case "memory":
+		logger.Log.Warn("Using in-memory database, data is lost on exit.")
+		return persistence.NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+}
+
+// profileSettings 将配置转换为玩家资料设置
+func profileSettings(cfg config.PlayerConfig) services.ProfileSettings {
+	return services.ProfileSettings{
+		StartingCoins: cfg.StartingCoins,
+		ExpPerRound:   cfg.ExpPerRound,
+		ExpPerWin:     cfg.ExpPerWin,
+		Curve: services.LevelCurve{
+			BaseExp:  cfg.Levels.BaseExp,
+			Growth:   cfg.Levels.Growth,
+			MaxLevel: cfg.Levels.MaxLevel,
+		},
+	}
+}
+
+// holdemModule 由配置生成德州扑克模块，未配置的盲注和带入使用默认值
+func holdemModule(cfg config.GameConfig) *state.Holdem {
+	if cfg.Table == nil {
+		return &state.Holdem{}
+	}
+	return &state.Holdem{
+		SmallBlind: cfg.Table.SmallBlind,
+		BigBlind:   cfg.Table.BigBlind,
+		BuyIn:      cfg.Table.BuyIn,
+	}
+}
+
+// sicBoPaytable 由配置生成骰宝赔付表，未配置时使用默认赔付表
+func sicBoPaytable(cfg config.GameConfig) (*state.SicBoPaytable, error) {
+	if cfg.SicBo == nil {
+		return state.DefaultSicBoPaytable(), nil
+	}
+	if len(cfg.SicBo.Single) != 3 {
+		return nil, fmt.Errorf("sic bo single odds need 3 entries, got %d", len(cfg.SicBo.Single))
+	}
+	paytable := &state.SicBoPaytable{
+		BigSmall:    cfg.SicBo.BigSmall,
+		Totals:      cfg.SicBo.Totals,
+		AnyTriple:   cfg.SicBo.AnyTriple,
+		Triple:      cfg.SicBo.Triple,
+		Double:      cfg.SicBo.Double,
+		Combination: cfg.SicBo.Combination,
+		Single:      [3]int64(cfg.SicBo.Single),
+	}
+	if err := paytable.Validate(); err != nil {
+		return nil, err
+	}
+	return paytable, nil
+}
+
+// lockstepConfig 由配置生成帧同步参数，未配置时返回 nil，游戏不使用帧同步
+func lockstepConfig(cfg *config.LockstepConfig) *state.LockstepConfig {
+	if cfg == nil {
+		return nil
+	}
+	return &state.LockstepConfig{
+		InputDelay:    cfg.InputDelay,
+		MaxLateFrames: cfg.MaxLateFrames,
+		HistoryFrames: cfg.HistoryFrames,
+	}
+}
+
+// itemCatalog 由配置生成物品目录
+func itemCatalog(items map[string]config.ItemConfig) *services.ItemCatalog {
+	defs := make([]models.ItemDef, 0, len(items))
+	for id, item := range items {
+		defs = append(defs, models.ItemDef{
+			ID:        id,
+			Name:      item.Name,
+			Stackable: item.Stackable,
+			Lifetime:  item.Lifetime,
+			Effects:   item.Effects,
+		})
+	}
+	return services.NewItemCatalog(defs...)
+}
+
+// addEventSinks 按配置添加发件箱事件的投递目标
+func addEventSinks(gameServer *server.GameServer, cfg config.EventsConfig) error {
+	if cfg.LogFile != "" {
+		sink, err := events.NewLogSink(cfg.LogFile)
+		if err != nil {
+			return err
+		}
+		gameServer.AddEventSink(sink)
+	}
+	if cfg.WebhookURL != "" {
+		timeout := cfg.WebhookTimeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		gameServer.AddEventSink(events.NewWebhookSink(cfg.WebhookURL, timeout))
 	}
+	return nil
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/wfunc/gameserver/config"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+// usesPostgres 配置的驱动是否使用 PostgreSQL，内存数据库没有表结构需要迁移
+func usesPostgres(cfg config.DatabaseConfig) bool {
+	return cfg.Driver != "memory"
+}
+
+// runMigrate 执行 migrate 子命令：
+//
+//	migrate up              执行全部未执行的迁移
+//	migrate down [steps]    回滚最近的 steps 个迁移，默认 1 个
+//	migrate to <version>    迁移到指定版本
+//	migrate status          显示当前版本和最新版本
+func runMigrate(cfg config.DatabaseConfig, args []string) error {
+	if !usesPostgres(cfg) {
+		logger.Log.Infof("Database driver %q has no schema, nothing to migrate.", cfg.Driver)
+		return nil
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|to <version>|status")
+	}
+
+	pg := cfg.Postgres
+	migrator, err := persistence.NewMigrator(pg.Host, pg.Port, pg.User, pg.Password, pg.DBName)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+	var done []persistence.Migration
+	switch args[0] {
+	case "up":
+		done, err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+		}
+		done, err = migrator.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: migrate to <version>")
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		done, err = migrator.To(ctx, version)
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+
+	for _, m := range done {
+		logger.Log.Infof("Migrated %d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Log.Infof("Schema version %d (latest %d)", version, persistence.LatestSchemaVersion())
+	return nil
+}
@@ -2,6 +2,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -13,33 +14,190 @@ type PlayerData struct {
 	Experience int                    `json:"experience"`
 	Coins      int64                  `json:"coins"`
 	Items      map[string]interface{} `json:"items"`
+	Version    int64                  `json:"version"` // 每次写入加一，用于检测其他节点的并发修改
 	CreatedAt  time.Time              `json:"created_at"`
 	UpdatedAt  time.Time              `json:"updated_at"`
 }
 
-// GameRecord 游戏记录模型
+// GameRecord 游戏记录模型，每局结束时生成
 type GameRecord struct {
+	ID        int64                  `json:"id,omitempty"`       // 保存后由数据库生成
+	RoundID   string                 `json:"round_id,omitempty"` // 一局的唯一标识，同一局重复保存时只保留一条
 	RoomID    string                 `json:"room_id"`
 	GameType  string                 `json:"game_type"`
 	Players   []PlayerInfo           `json:"players"`
 	Result    map[string]interface{} `json:"result"`
+	StartTime time.Time              `json:"start_time"`
+	EndTime   time.Time              `json:"end_time"`
+	Duration  int                    `json:"duration"` // 游戏时长(秒)
 	CreatedAt time.Time              `json:"created_at"`
 }
 
+// 一局的输赢结果
+const (
+	OutcomeWin  = "win"
+	OutcomeLose = "lose"
+	OutcomeDraw = "draw"
+)
+
 // PlayerInfo 玩家信息（用于游戏记录）
 type PlayerInfo struct {
 	UserID  int64  `json:"user_id"`
 	Name    string `json:"name"`
 	Outcome string `json:"outcome"` // win/lose/draw
 	Points  int    `json:"points"`
+	Bet     int64  `json:"bet"`    // 本局总下注
+	Payout  int64  `json:"payout"` // 本局总派奖
 }
 
-// RoomState 房间状态模型
+// OutcomeOf 根据下注和派奖判断输赢，派奖多于下注为赢
+func OutcomeOf(bet, payout int64) string {
+	switch {
+	case payout > bet:
+		return OutcomeWin
+	case payout < bet:
+		return OutcomeLose
+	default:
+		return OutcomeDraw
+	}
+}
+
+// RoomState 房间状态模型，Snapshot 为房间快照的原始 JSON
 type RoomState struct {
 	RoomID    string                 `json:"room_id"`
 	GameType  string                 `json:"game_type"`
 	State     string                 `json:"state"`
 	Players   map[string]interface{} `json:"players"`
+	Snapshot  json.RawMessage        `json:"snapshot,omitempty"`
 	CreatedAt time.Time              `json:"created_at"`
 	UpdatedAt time.Time              `json:"updated_at"`
 }
+
+// PlayerStats 玩家统计信息
+type PlayerStats struct {
+	TotalGames int   `json:"total_games"`
+	Wins       int   `json:"wins"`
+	Losses     int   `json:"losses"`
+	TotalCoins int64 `json:"total_coins"` // 对局中累计的净输赢
+	PlayTime   int   `json:"play_time"`   // 总游戏时长(分钟)
+}
+
+// CoinLedgerEntry 金币流水，每次金币变动记录一条
+type CoinLedgerEntry struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Delta     int64     `json:"delta"`
+	Balance   int64     `json:"balance"` // 变动后的余额
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ItemDef 物品目录中的一种物品，来自配置文件
+type ItemDef struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Stackable bool                   `json:"stackable"`          // 可堆叠的物品累加在同一格，否则每个物品单独一格
+	Lifetime  time.Duration          `json:"lifetime,omitempty"` // 发放后的有效期，0 表示永不过期
+	Effects   map[string]interface{} `json:"effects,omitempty"`  // 使用效果，由使用物品的游戏解释
+}
+
+// EffectInt 返回整数类型的效果值，不存在或不是数字时返回 0
+func (d ItemDef) EffectInt(name string) int64 {
+	switch v := d.Effects[name].(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	}
+	return 0
+}
+
+// InventoryItem 玩家背包中的一格物品
+type InventoryItem struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	ItemID    string     `json:"item_id"`
+	Quantity  int64      `json:"quantity"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // 为空表示永不过期
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Expired 判断物品在 now 时是否已过期
+func (i InventoryItem) Expired(now time.Time) bool {
+	return i.ExpiresAt != nil && !i.ExpiresAt.After(now)
+}
+
+// ItemLedgerEntry 物品流水，每次物品数量变动记录一条
+type ItemLedgerEntry struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ItemID    string    `json:"item_id"`
+	Delta     int64     `json:"delta"`
+	Quantity  int64     `json:"quantity"` // 变动后玩家持有该物品的总数
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JackpotWin 一次累积奖池的中奖记录
+type JackpotWin struct {
+	ID        int64     `json:"id"`
+	Pool      string    `json:"pool"`
+	UserID    int64     `json:"user_id"`
+	RoomID    string    `json:"room_id"`
+	Amount    int64     `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GameConfig 保存在数据库中的游戏配置
+type GameConfig struct {
+	GameType  string                 `json:"game_type"`
+	Config    map[string]interface{} `json:"config"`
+	Enabled   bool                   `json:"enabled"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// OutboxEvent 待投递给外部系统的领域事件，与对应的状态变更在同一事务中写入发件箱
+type OutboxEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Key       string          `json:"key"` // 事件所属的对象，例如房间 ID 或用户 ID
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"` // 已失败的投递次数
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// GameHistoryQuery 查询玩家历史对局的条件，GameType 和时间范围为空时不过滤
+type GameHistoryQuery struct {
+	UserID   int64     `json:"user_id"`
+	GameType string    `json:"game_type,omitempty"`
+	From     time.Time `json:"from,omitempty"` // 对局结束时间不早于 From
+	To       time.Time `json:"to,omitempty"`   // 对局结束时间早于 To
+	Cursor   string    `json:"cursor,omitempty"`
+	Limit    int       `json:"limit,omitempty"`
+}
+
+// GameHistoryEntry 玩家的一局历史对局
+type GameHistoryEntry struct {
+	RecordID  int64                  `json:"record_id"`
+	RoomID    string                 `json:"room_id"`
+	GameType  string                 `json:"game_type"`
+	Outcome   string                 `json:"outcome"`
+	Bet       int64                  `json:"bet"`
+	Payout    int64                  `json:"payout"`
+	Result    map[string]interface{} `json:"result"`
+	StartTime time.Time              `json:"start_time"`
+	EndTime   time.Time              `json:"end_time"`
+	Duration  int                    `json:"duration"`
+}
+
+// GameHistoryPage 一页历史对局，按结束时间从新到旧排列，NextCursor 为空表示没有更多
+type GameHistoryPage struct {
+	Entries    []GameHistoryEntry `json:"entries"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
@@ -16,6 +16,13 @@ type Metrics struct {
 	ActiveRooms      prometheus.Gauge
 	MessagesReceived prometheus.Counter
 	MessageLatency   prometheus.Histogram
+	RoomMailboxDepth prometheus.Histogram
+	RoomMailboxFull  prometheus.Counter
+	RoomTickOverruns prometheus.Counter
+	GameWagers       *prometheus.CounterVec
+	GameBets         *prometheus.CounterVec
+	GamePayouts      *prometheus.CounterVec
+	GameRTP          *prometheus.GaugeVec
 }
 
 func NewMetrics(namespace string) *Metrics {
@@ -41,6 +48,42 @@ func NewMetrics(namespace string) *Metrics {
 			Help:      "Message processing latency",
 			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 10),
 		}),
+		RoomMailboxDepth: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "room_mailbox_depth",
+			Help:      "Number of messages queued in a room mailbox when one is dequeued",
+			Buckets:   []float64{0, 1, 2, 4, 8, 16, 32, 64, 128, 256},
+		}),
+		RoomMailboxFull: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "room_mailbox_full_total",
+			Help:      "Total number of messages rejected because a room mailbox was full",
+		}),
+		RoomTickOverruns: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "room_tick_overruns_total",
+			Help:      "Total number of room ticks that took longer than the tick interval",
+		}),
+		GameWagers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "game_wagers_total",
+			Help:      "Total number of settled wagers, such as slot spins",
+		}, []string{"game_type"}),
+		GameBets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "game_bet_coins_total",
+			Help:      "Total coins wagered, counting item spins at their bet value",
+		}, []string{"game_type"}),
+		GamePayouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "game_payout_coins_total",
+			Help:      "Total coins paid out; divided by bet coins this gives the live return to player",
+		}, []string{"game_type"}),
+		GameRTP: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "game_theoretical_rtp",
+			Help:      "Theoretical return to player of the configured paytable",
+		}, []string{"game_type"}),
 	}
 
 	prometheus.MustRegister(
@@ -48,6 +91,13 @@ func NewMetrics(namespace string) *Metrics {
 		m.ActiveRooms,
 		m.MessagesReceived,
 		m.MessageLatency,
+		m.RoomMailboxDepth,
+		m.RoomMailboxFull,
+		m.RoomTickOverruns,
+		m.GameWagers,
+		m.GameBets,
+		m.GamePayouts,
+		m.GameRTP,
 	)
 
 	return m
@@ -106,3 +156,30 @@ func (m *Monitor) IncMessagesReceived() {
 func (m *Monitor) ObserveMessageLatency(duration time.Duration) {
 	m.metrics.MessageLatency.Observe(duration.Seconds())
 }
+
+// ObserveMailboxDepth 记录房间 mailbox 的排队长度
+func (m *Monitor) ObserveMailboxDepth(depth int) {
+	m.metrics.RoomMailboxDepth.Observe(float64(depth))
+}
+
+// IncMailboxFull 记录一次因 mailbox 已满被拒绝的消息
+func (m *Monitor) IncMailboxFull() {
+	m.metrics.RoomMailboxFull.Inc()
+}
+
+// IncTickOverrun 记录一次超时的房间心跳
+func (m *Monitor) IncTickOverrun() {
+	m.metrics.RoomTickOverruns.Inc()
+}
+
+// ObserveWager 记录一次下注和派奖
+func (m *Monitor) ObserveWager(gameType string, bet, payout int64) {
+	m.metrics.GameWagers.WithLabelValues(gameType).Inc()
+	m.metrics.GameBets.WithLabelValues(gameType).Add(float64(bet))
+	m.metrics.GamePayouts.WithLabelValues(gameType).Add(float64(payout))
+}
+
+// SetTheoreticalRTP 设置一种游戏的理论返奖率，与实际返奖率比较用于告警
+func (m *Monitor) SetTheoreticalRTP(gameType string, rtp float64) {
+	m.metrics.GameRTP.WithLabelValues(gameType).Set(rtp)
+}
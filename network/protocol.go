@@ -1,15 +1,38 @@
 package network
 
 const (
-	MsgTypeHeartbeat   = 1
-	MsgTypeJoinRoom    = 101
-	MsgTypeLeaveRoom   = 102
-	MsgTypeCreateRoom  = 103
-	MsgTypeGameAction  = 201
-	MsgTypePlayerAction = 202
-	MsgTypeRoomState   = 301
-	MsgTypePlayerState = 302
-	MsgTypeGameStart   = 303
-	MsgTypeGameSync    = 304
-	MsgTypeGameEnd     = 305
+	MsgTypeHeartbeat     = 1
+	MsgTypeAuth          = 2
+	MsgTypeJoinRoom      = 101
+	MsgTypeLeaveRoom     = 102
+	MsgTypeCreateRoom    = 103
+	MsgTypeKickPlayer    = 104
+	MsgTypeLockRoom      = 105
+	MsgTypeRoomSettings  = 106
+	MsgTypeStartGame     = 107
+	MsgTypeHostChanged   = 108
+	MsgTypeReady         = 109
+	MsgTypeChangeSeat    = 110
+	MsgTypeCountdown     = 111
+	MsgTypeGameAction    = 201
+	MsgTypePlayerAction  = 202
+	MsgTypeRoomState     = 301
+	MsgTypePlayerState   = 302
+	MsgTypeGameStart     = 303
+	MsgTypeGameSync      = 304
+	MsgTypeGameEnd       = 305
+	MsgTypeSubStateEnter = 306
+	MsgTypeSubStateExit  = 307
+	MsgTypeTurnChange    = 308
+	MsgTypePrivateState  = 309
+	MsgTypeFrame         = 310
+	MsgTypeFrameHistory  = 311
+	MsgTypeStateUpdate   = 312
+	MsgTypeGameHistory   = 401
+	MsgTypeGetProfile    = 402
+	MsgTypeUpdateProfile = 403
+	MsgTypeLevelUp       = 404
+	MsgTypeInventory     = 405
+	MsgTypeJackpot       = 406
+	MsgTypeError         = 999
 )
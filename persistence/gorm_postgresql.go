@@ -2,25 +2,30 @@
 package persistence
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"os"
+	"sort"
 	"time"
 
+	"github.com/wfunc/gameserver/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
-// GormPostgreSQL 使用GORM的PostgreSQL实现
+// GormPostgreSQL 使用GORM的PostgreSQL实现。事务中的 GormPostgreSQL 共享同一个 *gorm.DB 事务
 type GormPostgreSQL struct {
 	db *gorm.DB
 }
 
+var _ Database = (*GormPostgreSQL)(nil)
+
 // NewGormPostgreSQL 创建GORM PostgreSQL数据库连接
 func NewGormPostgreSQL(host string, port int, user, password, dbname string) (*GormPostgreSQL, error) {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname)
+	dsn := postgresDSN(host, port, user, password, dbname)
 
 	// 配置GORM日志
 	gormLogger := logger.New(
@@ -50,195 +55,1022 @@ func NewGormPostgreSQL(host string, port int, user, password, dbname string) (*G
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	// 自动迁移表结构
-	if err := autoMigrate(db); err != nil {
+	// 表结构由 migrate 命令维护，这里只检查版本
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := checkSchema(ctx, sqlDB); err != nil {
+		sqlDB.Close()
 		return nil, err
 	}
 
 	return &GormPostgreSQL{db: db}, nil
 }
 
-// 定义GORM模型
+// 定义GORM模型，只描述列的映射，表结构由 migrations 目录中的迁移定义
 type PlayerModel struct {
-	ID        uint                   `gorm:"primaryKey"`
-	UserID    int64                  `gorm:"uniqueIndex;not null"`
-	Data      map[string]interface{} `gorm:"type:jsonb"`
+	ID         uint                   `gorm:"primaryKey"`
+	UserID     int64                  `gorm:"not null"`
+	Name       string                 `gorm:"not null;default:''"`
+	Level      int                    `gorm:"default:1"`
+	Experience int                    `gorm:"default:0"`
+	Coins      int64                  `gorm:"default:0"`
+	Items      map[string]interface{} `gorm:"type:jsonb;serializer:json"`
+	Version    int64                  `gorm:"default:0"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (PlayerModel) TableName() string { return "players" }
+
+// CoinLedgerModel 金币流水
+type CoinLedgerModel struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    int64  `gorm:"not null"`
+	Delta     int64  `gorm:"not null"`
+	Balance   int64  `gorm:"not null"`
+	Reason    string `gorm:"not null;default:''"`
+	CreatedAt time.Time
+}
+
+func (CoinLedgerModel) TableName() string { return "coin_ledger" }
+
+// InventoryItemModel 玩家背包中的一格物品
+type InventoryItemModel struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    int64  `gorm:"not null"`
+	ItemID    string `gorm:"not null"`
+	Quantity  int64  `gorm:"not null"`
+	ExpiresAt *time.Time
 	CreatedAt time.Time
+}
+
+func (InventoryItemModel) TableName() string { return "inventory_items" }
+
+// ItemLedgerModel 物品流水
+type ItemLedgerModel struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    int64  `gorm:"not null"`
+	ItemID    string `gorm:"not null"`
+	Delta     int64  `gorm:"not null"`
+	Quantity  int64  `gorm:"not null"`
+	Reason    string `gorm:"not null;default:''"`
+	CreatedAt time.Time
+}
+
+func (ItemLedgerModel) TableName() string { return "item_ledger" }
+
+// JackpotModel 累积奖池
+type JackpotModel struct {
+	Pool      string `gorm:"primaryKey"`
+	Amount    int64  `gorm:"not null"`
 	UpdatedAt time.Time
 }
 
+func (JackpotModel) TableName() string { return "jackpots" }
+
+// JackpotWinModel 累积奖池的中奖记录
+type JackpotWinModel struct {
+	ID        uint   `gorm:"primaryKey"`
+	Pool      string `gorm:"not null"`
+	UserID    int64  `gorm:"not null"`
+	RoomID    string `gorm:"not null;default:''"`
+	Amount    int64  `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+func (JackpotWinModel) TableName() string { return "jackpot_wins" }
+
 type GameRecordModel struct {
 	ID        uint                   `gorm:"primaryKey"`
-	RoomID    string                 `gorm:"index;not null"`
+	RoundID   *string                `gorm:"uniqueIndex"` // 一局的唯一标识，旧记录为 NULL
+	RoomID    string                 `gorm:"not null"`
 	GameType  string                 `gorm:"not null"`
-	Players   map[string]interface{} `gorm:"type:jsonb"`
-	Result    map[string]interface{} `gorm:"type:jsonb"`
+	Players   map[string]interface{} `gorm:"type:jsonb;serializer:json"`
+	Result    map[string]interface{} `gorm:"type:jsonb;serializer:json"`
+	StartTime time.Time
+	EndTime   time.Time
+	Duration  int `gorm:"default:0"` // 游戏时长(秒)
 	CreatedAt time.Time
 }
 
+func (GameRecordModel) TableName() string { return "game_records" }
+
+// GameRecordPlayerModel 游戏记录按玩家建立的索引，用于查询玩家的历史对局和统计
+type GameRecordPlayerModel struct {
+	RecordID uint   `gorm:"primaryKey;autoIncrement:false"`
+	UserID   int64  `gorm:"primaryKey;autoIncrement:false"`
+	GameType string `gorm:"not null"`
+	Outcome  string `gorm:"not null"`
+	Bet      int64  `gorm:"default:0"`
+	Payout   int64  `gorm:"default:0"`
+	EndTime  time.Time
+}
+
+func (GameRecordPlayerModel) TableName() string { return "game_record_players" }
+
 type RoomModel struct {
 	ID        uint                   `gorm:"primaryKey"`
-	RoomID    string                 `gorm:"uniqueIndex;not null"`
+	RoomID    string                 `gorm:"not null"`
 	GameType  string                 `gorm:"not null"`
 	State     string                 `gorm:"not null"`
-	Players   map[string]interface{} `gorm:"type:jsonb"`
+	Players   map[string]interface{} `gorm:"type:jsonb;serializer:json"`
+	Snapshot  []byte                 `gorm:"type:jsonb"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
-// autoMigrate 自动迁移表结构
-func autoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&PlayerModel{},
-		&GameRecordModel{},
-		&RoomModel{},
-	)
+func (RoomModel) TableName() string { return "rooms" }
+
+// GameConfigModel 游戏配置
+type GameConfigModel struct {
+	ID        uint                   `gorm:"primaryKey"`
+	GameType  string                 `gorm:"not null"`
+	Config    map[string]interface{} `gorm:"type:jsonb;serializer:json;not null"`
+	Enabled   bool                   `gorm:"default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (GameConfigModel) TableName() string { return "game_configs" }
+
+// OutboxEventModel 发件箱中的事件
+type OutboxEventModel struct {
+	ID            uint      `gorm:"primaryKey"`
+	EventType     string    `gorm:"not null"`
+	EventKey      string    `gorm:"not null;default:''"`
+	Payload       []byte    `gorm:"type:jsonb;not null"`
+	Attempts      int       `gorm:"not null;default:0"`
+	LastError     string    `gorm:"not null;default:''"`
+	Dead          bool      `gorm:"not null;default:false"`
+	NextAttemptAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	CreatedAt     time.Time
 }
 
-// SavePlayerData 保存玩家数据
-func (p *GormPostgreSQL) SavePlayerData(playerID int64, data interface{}) error {
-	playerData, ok := data.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid player data type")
+func (OutboxEventModel) TableName() string { return "outbox_events" }
+
+func (p *GormPostgreSQL) Players() PlayerRepository         { return gormPlayers{p.db} }
+func (p *GormPostgreSQL) Wallet() WalletRepository          { return gormWallet{p.db} }
+func (p *GormPostgreSQL) Inventory() InventoryRepository    { return gormInventory{p.db} }
+func (p *GormPostgreSQL) Jackpots() JackpotRepository       { return gormJackpots{p.db} }
+func (p *GormPostgreSQL) GameRecords() GameRecordRepository { return gormGameRecords{p.db} }
+func (p *GormPostgreSQL) Rooms() RoomRepository             { return gormRooms{p.db} }
+func (p *GormPostgreSQL) Configs() ConfigRepository         { return gormConfigs{p.db} }
+func (p *GormPostgreSQL) Outbox() OutboxRepository          { return gormOutbox{p.db} }
+
+// Transaction 在一个事务中执行 fn，fn 中的仓库共享同一个事务
+func (p *GormPostgreSQL) Transaction(ctx context.Context, fn func(tx Tx) error) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormPostgreSQL{db: tx})
+	})
+}
+
+// Close 关闭数据库连接
+func (p *GormPostgreSQL) Close() error {
+	sqlDB, err := p.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// gormError 将 gorm 的错误转换为包内定义的错误
+func gormError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrRecordNotFound
 	}
+	return err
+}
 
-	// 使用UPSERT操作
+type gormPlayers struct{ db *gorm.DB }
+
+func (r gormPlayers) GetPlayer(ctx context.Context, userID int64) (*models.PlayerData, error) {
 	var player PlayerModel
-	result := p.db.Where("user_id = ?", playerID).First(&player)
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&player).Error; err != nil {
+		return nil, gormError(err)
+	}
+	return &models.PlayerData{
+		UserID:     player.UserID,
+		Name:       player.Name,
+		Level:      player.Level,
+		Experience: player.Experience,
+		Coins:      player.Coins,
+		Items:      player.Items,
+		Version:    player.Version,
+		CreatedAt:  player.CreatedAt,
+		UpdatedAt:  player.UpdatedAt,
+	}, nil
+}
 
-	if result.Error == gorm.ErrRecordNotFound {
-		// 创建新记录
-		player = PlayerModel{
-			UserID: playerID,
-			Data:   playerData,
-		}
-		return p.db.Create(&player).Error
-	} else if result.Error != nil {
+func (r gormPlayers) SavePlayer(ctx context.Context, player *models.PlayerData) error {
+	model := PlayerModel{
+		UserID:     player.UserID,
+		Name:       player.Name,
+		Level:      player.Level,
+		Experience: player.Experience,
+		Coins:      player.Coins,
+		Items:      player.Items,
+	}
+	// 已存在时只更新资料，不覆盖金币
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: append(clause.AssignmentColumns([]string{"name", "level", "experience", "items", "updated_at"}),
+			clause.Assignment{Column: clause.Column{Name: "version"}, Value: gorm.Expr("players.version + 1")}),
+	}).Create(&model).Error
+}
+
+func (r gormPlayers) CreatePlayer(ctx context.Context, player *models.PlayerData) (bool, error) {
+	model := PlayerModel{
+		UserID:     player.UserID,
+		Name:       player.Name,
+		Level:      player.Level,
+		Experience: player.Experience,
+		Items:      player.Items,
+	}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&model)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r gormPlayers) UpdatePlayer(ctx context.Context, player *models.PlayerData) error {
+	// Select 使零值字段也被更新，Items 仍经过 json 序列化
+	result := r.db.WithContext(ctx).Model(&PlayerModel{}).
+		Where("user_id = ? AND version = ?", player.UserID, player.Version).
+		Select("name", "level", "experience", "items", "version", "updated_at").
+		Updates(&PlayerModel{
+			Name:       player.Name,
+			Level:      player.Level,
+			Experience: player.Experience,
+			Items:      player.Items,
+			Version:    player.Version + 1,
+			UpdatedAt:  time.Now(),
+		})
+	if result.Error != nil {
 		return result.Error
 	}
+	if result.RowsAffected == 0 {
+		return r.versionError(ctx, player.UserID)
+	}
+	player.Version++
+	return nil
+}
+
+// versionError 区分条件更新没有命中的原因：玩家不存在或版本已被修改
+func (r gormPlayers) versionError(ctx context.Context, userID int64) error {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&PlayerModel{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrRecordNotFound
+	}
+	return ErrVersionConflict
+}
+
+func (r gormPlayers) GetPlayerStats(ctx context.Context, userID int64) (*models.PlayerStats, error) {
+	var stats models.PlayerStats
 
-	// 更新现有记录
-	player.Data = playerData
-	player.UpdatedAt = time.Now()
-	return p.db.Save(&player).Error
+	// 使用玩家索引统计，避免扫描 players 列
+	err := r.db.WithContext(ctx).Raw(
+		`
+        SELECT
+            COUNT(*) as total_games,
+            COALESCE(SUM(CASE WHEN p.outcome = 'win' THEN 1 ELSE 0 END), 0) as wins,
+            COALESCE(SUM(CASE WHEN p.outcome = 'lose' THEN 1 ELSE 0 END), 0) as losses,
+            COALESCE(SUM(p.payout - p.bet), 0) as total_coins,
+            COALESCE(SUM(r.duration), 0) / 60 as play_time
+        FROM game_record_players p
+        JOIN game_records r ON r.id = p.record_id
+        WHERE p.user_id = ?`,
+		userID,
+	).Scan(&stats).Error
+
+	return &stats, err
 }
 
-// LoadPlayerData 加载玩家数据
-func (p *GormPostgreSQL) LoadPlayerData(playerID int64, result interface{}) error {
+type gormWallet struct{ db *gorm.DB }
+
+func (r gormWallet) GetBalance(ctx context.Context, userID int64) (int64, error) {
 	var player PlayerModel
-	if err := p.db.Where("user_id = ?", playerID).First(&player).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return ErrRecordNotFound
+	if err := r.db.WithContext(ctx).Select("coins").Where("user_id = ?", userID).First(&player).Error; err != nil {
+		return 0, gormError(err)
+	}
+	return player.Coins, nil
+}
+
+func (r gormWallet) AddCoins(ctx context.Context, userID, delta int64, reason string) (int64, error) {
+	var balance int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var player PlayerModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).First(&player).Error; err != nil {
+			return gormError(err)
+		}
+
+		balance = player.Coins + delta
+		if balance < 0 {
+			return ErrInsufficientCoins
+		}
+		if err := tx.Model(&player).Updates(map[string]interface{}{
+			"coins":   balance,
+			"version": gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&CoinLedgerModel{
+			UserID:  userID,
+			Delta:   delta,
+			Balance: balance,
+			Reason:  reason,
+		}).Error
+	})
+	return balance, err
+}
+
+func (r gormWallet) ListLedger(ctx context.Context, userID int64, limit int) ([]models.CoinLedgerEntry, error) {
+	var rows []CoinLedgerModel
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).
+		Order("id DESC").Limit(ledgerLimit(limit)).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]models.CoinLedgerEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, models.CoinLedgerEntry{
+			ID:        int64(row.ID),
+			UserID:    row.UserID,
+			Delta:     row.Delta,
+			Balance:   row.Balance,
+			Reason:    row.Reason,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	return entries, nil
+}
+
+type gormInventory struct{ db *gorm.DB }
+
+func (r gormInventory) ListItems(ctx context.Context, userID int64) ([]models.InventoryItem, error) {
+	var rows []InventoryItemModel
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("expires_at, id").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return inventoryItemsFromModels(rows), nil
+}
+
+func (r gormInventory) GrantItem(ctx context.Context, item *models.InventoryItem, stack bool, reason string) (*models.ItemLedgerEntry, error) {
+	granted := item.Quantity
+	var entry *models.ItemLedgerEntry
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var model InventoryItemModel
+		found := false
+		if stack {
+			query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND item_id = ?", item.UserID, item.ItemID)
+			if item.ExpiresAt == nil {
+				query = query.Where("expires_at IS NULL")
+			} else {
+				query = query.Where("expires_at = ?", *item.ExpiresAt)
+			}
+			res := query.Order("id").Limit(1).Find(&model)
+			if res.Error != nil {
+				return res.Error
+			}
+			found = res.RowsAffected > 0
+		}
+
+		if found {
+			model.Quantity += item.Quantity
+			if err := tx.Model(&model).Update("quantity", model.Quantity).Error; err != nil {
+				return err
+			}
+		} else {
+			model = InventoryItemModel{
+				UserID:    item.UserID,
+				ItemID:    item.ItemID,
+				Quantity:  item.Quantity,
+				ExpiresAt: item.ExpiresAt,
+			}
+			if err := tx.Create(&model).Error; err != nil {
+				return err
+			}
 		}
+		item.ID = int64(model.ID)
+		item.Quantity = model.Quantity
+		item.CreatedAt = model.CreatedAt
+
+		var err error
+		entry, err = gormAppendItemLedger(tx, item.UserID, item.ItemID, granted, reason)
 		return err
+	})
+	return entry, err
+}
+
+func (r gormInventory) ConsumeItem(ctx context.Context, userID int64, itemID string, quantity int64, now time.Time, reason string) (*models.ItemLedgerEntry, error) {
+	var entry *models.ItemLedgerEntry
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var rows []InventoryItemModel
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND item_id = ? AND (expires_at IS NULL OR expires_at > ?)", userID, itemID, now).
+			Order("expires_at, id").Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		remaining := quantity
+		for _, row := range rows {
+			if remaining == 0 {
+				break
+			}
+			used := min(row.Quantity, remaining)
+			remaining -= used
+			if used == row.Quantity {
+				err = tx.Delete(&InventoryItemModel{}, row.ID).Error
+			} else {
+				err = tx.Model(&row).Update("quantity", gorm.Expr("quantity - ?", used)).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if remaining > 0 {
+			return ErrInsufficientItems
+		}
+
+		entry, err = gormAppendItemLedger(tx, userID, itemID, -quantity, reason)
+		return err
+	})
+	return entry, err
+}
+
+func (r gormInventory) ExpireItems(ctx context.Context, now time.Time, limit int) ([]models.ItemLedgerEntry, error) {
+	var entries []models.ItemLedgerEntry
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var expired []InventoryItemModel
+		err := tx.Raw(`
+            DELETE FROM inventory_items
+            WHERE id IN (
+                SELECT id FROM inventory_items
+                WHERE expires_at <= ?
+                ORDER BY id LIMIT ?
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING *`, now, limit).Scan(&expired).Error
+		if err != nil {
+			return err
+		}
+
+		for _, row := range expired {
+			entry, err := gormAppendItemLedger(tx, row.UserID, row.ItemID, -row.Quantity, ItemExpiredReason)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, *entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (r gormInventory) ListItemLedger(ctx context.Context, userID int64, limit int) ([]models.ItemLedgerEntry, error) {
+	var rows []ItemLedgerModel
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).
+		Order("id DESC").Limit(ledgerLimit(limit)).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]models.ItemLedgerEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, itemLedgerFromModel(row))
+	}
+	return entries, nil
+}
+
+type gormJackpots struct{ db *gorm.DB }
+
+func (r gormJackpots) GetJackpot(ctx context.Context, pool string) (int64, error) {
+	var jackpot JackpotModel
+	if err := r.db.WithContext(ctx).Where("pool = ?", pool).First(&jackpot).Error; err != nil {
+		return 0, gormError(err)
 	}
+	return jackpot.Amount, nil
+}
+
+func (r gormJackpots) ContributeJackpot(ctx context.Context, pool string, amount, seed int64) (int64, error) {
+	jackpot := JackpotModel{Pool: pool, Amount: seed + amount}
+	err := r.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "pool"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"amount":     gorm.Expr("jackpots.amount + ?", amount),
+				"updated_at": gorm.Expr("CURRENT_TIMESTAMP"),
+			}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "amount"}}},
+	).Create(&jackpot).Error
+	return jackpot.Amount, err
+}
+
+func (r gormJackpots) ClaimJackpot(ctx context.Context, pool string, seed, userID int64, roomID string) (*models.JackpotWin, error) {
+	var win *models.JackpotWin
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&JackpotModel{Pool: pool, Amount: seed}).Error
+		if err != nil {
+			return err
+		}
+
+		var jackpot JackpotModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("pool = ?", pool).First(&jackpot).Error; err != nil {
+			return gormError(err)
+		}
+		if err := tx.Model(&jackpot).Update("amount", seed).Error; err != nil {
+			return err
+		}
 
-	// 将数据转换为目标类型
-	data, ok := result.(*map[string]interface{})
-	if ok {
-		*data = player.Data
+		row := JackpotWinModel{Pool: pool, UserID: userID, RoomID: roomID, Amount: jackpot.Amount}
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+		entry := jackpotWinFromModel(row)
+		win = &entry
 		return nil
+	})
+	return win, err
+}
+
+func (r gormJackpots) ListJackpotWins(ctx context.Context, pool string, limit int) ([]models.JackpotWin, error) {
+	var rows []JackpotWinModel
+	err := r.db.WithContext(ctx).Where("pool = ?", pool).
+		Order("id DESC").Limit(ledgerLimit(limit)).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	wins := make([]models.JackpotWin, 0, len(rows))
+	for _, row := range rows {
+		wins = append(wins, jackpotWinFromModel(row))
+	}
+	return wins, nil
+}
+
+func jackpotWinFromModel(row JackpotWinModel) models.JackpotWin {
+	return models.JackpotWin{
+		ID:        int64(row.ID),
+		Pool:      row.Pool,
+		UserID:    row.UserID,
+		RoomID:    row.RoomID,
+		Amount:    row.Amount,
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+// gormAppendItemLedger 写入一条物品流水，数量为变动后玩家持有该物品的总数
+func gormAppendItemLedger(tx *gorm.DB, userID int64, itemID string, delta int64, reason string) (*models.ItemLedgerEntry, error) {
+	var total int64
+	err := tx.Model(&InventoryItemModel{}).Where("user_id = ? AND item_id = ?", userID, itemID).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&total).Error
+	if err != nil {
+		return nil, err
+	}
+
+	row := ItemLedgerModel{UserID: userID, ItemID: itemID, Delta: delta, Quantity: total, Reason: reason}
+	if err := tx.Create(&row).Error; err != nil {
+		return nil, err
 	}
+	entry := itemLedgerFromModel(row)
+	return &entry, nil
+}
 
-	return fmt.Errorf("invalid result type")
+func itemLedgerFromModel(row ItemLedgerModel) models.ItemLedgerEntry {
+	return models.ItemLedgerEntry{
+		ID:        int64(row.ID),
+		UserID:    row.UserID,
+		ItemID:    row.ItemID,
+		Delta:     row.Delta,
+		Quantity:  row.Quantity,
+		Reason:    row.Reason,
+		CreatedAt: row.CreatedAt,
+	}
 }
 
+func inventoryItemsFromModels(rows []InventoryItemModel) []models.InventoryItem {
+	items := make([]models.InventoryItem, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, models.InventoryItem{
+			ID:        int64(row.ID),
+			UserID:    row.UserID,
+			ItemID:    row.ItemID,
+			Quantity:  row.Quantity,
+			ExpiresAt: row.ExpiresAt,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	return items
+}
+
+type gormGameRecords struct{ db *gorm.DB }
+
 // SaveGameRecord 保存游戏记录
-func (p *GormPostgreSQL) SaveGameRecord(record interface{}) error {
-	recordData, ok := record.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid game record type")
+func (r gormGameRecords) SaveGameRecord(ctx context.Context, record *models.GameRecord) error {
+	players, err := recordPlayers(record)
+	if err != nil {
+		return err
+	}
+	result, err := recordResult(record)
+	if err != nil {
+		return err
 	}
 
 	gameRecord := GameRecordModel{
-		RoomID:   recordData["room_id"].(string),
-		GameType: recordData["game_type"].(string),
-		Players:  recordData["players"].(map[string]interface{}),
-		Result:   recordData["result"].(map[string]interface{}),
+		RoundID:   roundID(record),
+		RoomID:    record.RoomID,
+		GameType:  record.GameType,
+		Players:   players,
+		Result:    result,
+		StartTime: record.StartTime,
+		EndTime:   record.EndTime,
+		Duration:  record.Duration,
+		CreatedAt: record.CreatedAt,
 	}
 
-	return p.db.Create(&gameRecord).Error
+	// 记录和玩家索引在同一个事务中写入，同一局已保存过时不插入
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&gameRecord)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDuplicateRecord
+		}
+		record.ID = int64(gameRecord.ID)
+		return createRecordPlayers(tx, gameRecord.ID, record)
+	})
 }
 
-// SaveRoomState 保存房间状态
-func (p *GormPostgreSQL) SaveRoomState(roomID, gameType, state string, players interface{}) error {
-	playersData, ok := players.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid players data type")
+// roundID 返回记录的 RoundID 列，没有时为 NULL
+func roundID(record *models.GameRecord) *string {
+	if record.RoundID == "" {
+		return nil
 	}
+	return &record.RoundID
+}
 
-	var room RoomModel
-	result := p.db.Where("room_id = ?", roomID).First(&room)
-
-	if result.Error == gorm.ErrRecordNotFound {
-		// 创建新记录
-		room = RoomModel{
-			RoomID:   roomID,
-			GameType: gameType,
-			State:    state,
-			Players:  playersData,
-		}
-		return p.db.Create(&room).Error
-	} else if result.Error != nil {
-		return result.Error
+// createRecordPlayers 写入游戏记录的玩家索引
+func createRecordPlayers(tx *gorm.DB, recordID uint, record *models.GameRecord) error {
+	var index []GameRecordPlayerModel
+	for _, info := range indexedPlayers(record) {
+		index = append(index, GameRecordPlayerModel{
+			RecordID: recordID,
+			UserID:   info.UserID,
+			GameType: record.GameType,
+			Outcome:  info.Outcome,
+			Bet:      info.Bet,
+			Payout:   info.Payout,
+			EndTime:  record.EndTime,
+		})
+	}
+	if len(index) == 0 {
+		return nil
 	}
+	return tx.Create(&index).Error
+}
 
-	// 更新现有记录
-	room.State = state
-	room.Players = playersData
-	room.UpdatedAt = time.Now()
-	return p.db.Save(&room).Error
+func (r gormGameRecords) ListGameTypes(ctx context.Context) ([]string, error) {
+	var gameTypes []string
+	err := r.db.WithContext(ctx).Model(&GameRecordModel{}).Distinct("game_type").Order("game_type").Pluck("game_type", &gameTypes).Error
+	return gameTypes, err
 }
 
-// LoadRoomState 加载房间状态
-func (p *GormPostgreSQL) LoadRoomState(roomID string, result interface{}) error {
-	var room RoomModel
-	if err := p.db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return ErrRecordNotFound
+func (r gormGameRecords) ListGameRecordsBefore(ctx context.Context, gameType string, before time.Time, limit int) ([]*models.GameRecord, error) {
+	var rows []GameRecordModel
+	err := r.db.WithContext(ctx).Raw(`
+        SELECT id, round_id, room_id, game_type, players, result,
+               COALESCE(start_time, created_at) AS start_time,
+               COALESCE(end_time, created_at) AS end_time,
+               COALESCE(duration, 0) AS duration,
+               created_at
+        FROM game_records
+        WHERE game_type = ? AND created_at < ?
+        ORDER BY id
+        LIMIT ?`, gameType, before, limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*models.GameRecord, 0, len(rows))
+	for _, row := range rows {
+		players, err := playersFromColumn(row.Players)
+		if err != nil {
+			return nil, err
 		}
-		return err
+		record := &models.GameRecord{
+			ID:        int64(row.ID),
+			RoomID:    row.RoomID,
+			GameType:  row.GameType,
+			Players:   players,
+			Result:    row.Result,
+			StartTime: row.StartTime,
+			EndTime:   row.EndTime,
+			Duration:  row.Duration,
+			CreatedAt: row.CreatedAt,
+		}
+		if row.RoundID != nil {
+			record.RoundID = *row.RoundID
+		}
+		records = append(records, record)
 	}
+	return records, nil
+}
 
-	// 将数据转换为目标类型
-	data, ok := result.(*map[string]interface{})
-	if ok {
-		*data = room.Players
+func (r gormGameRecords) DeleteGameRecords(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
 		return nil
 	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("record_id IN ?", ids).Delete(&GameRecordPlayerModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&GameRecordModel{}).Error
+	})
+}
+
+func (r gormGameRecords) RestoreGameRecord(ctx context.Context, record *models.GameRecord) (bool, error) {
+	players, err := recordPlayers(record)
+	if err != nil {
+		return false, err
+	}
+	result, err := recordResult(record)
+	if err != nil {
+		return false, err
+	}
+
+	gameRecord := GameRecordModel{
+		ID:        uint(record.ID),
+		RoundID:   roundID(record),
+		RoomID:    record.RoomID,
+		GameType:  record.GameType,
+		Players:   players,
+		Result:    result,
+		StartTime: record.StartTime,
+		EndTime:   record.EndTime,
+		Duration:  record.Duration,
+		CreatedAt: record.CreatedAt,
+	}
+
+	restored := false
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&gameRecord)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		restored = true
 
-	return fmt.Errorf("invalid result type")
+		// 推进序列，避免之后新插入的记录与写回的 ID 冲突
+		err := tx.Exec(`
+            SELECT setval(pg_get_serial_sequence('game_records', 'id'), ?)
+            WHERE ? > COALESCE(pg_sequence_last_value(pg_get_serial_sequence('game_records', 'id')::regclass), 0)`,
+			record.ID, record.ID).Error
+		if err != nil {
+			return err
+		}
+		return createRecordPlayers(tx, gameRecord.ID, record)
+	})
+	return restored, err
 }
 
-// Close 关闭数据库连接
-func (p *GormPostgreSQL) Close() error {
-	sqlDB, err := p.db.DB()
+// QueryGameHistory 按玩家索引查询历史对局，按结束时间从新到旧分页
+func (r gormGameRecords) QueryGameHistory(ctx context.Context, query *models.GameHistoryQuery) (*models.GameHistoryPage, error) {
+	cursor, err := decodeHistoryCursor(query.Cursor)
 	if err != nil {
+		return nil, err
+	}
+	limit := historyLimit(query.Limit)
+
+	tx := r.db.WithContext(ctx).Table("game_record_players AS p").
+		Select("p.record_id, r.room_id, p.game_type, p.outcome, p.bet, p.payout, r.result, r.start_time, p.end_time, r.duration").
+		Joins("JOIN game_records AS r ON r.id = p.record_id").
+		Where("p.user_id = ?", query.UserID)
+	if query.GameType != "" {
+		tx = tx.Where("p.game_type = ?", query.GameType)
+	}
+	if !query.From.IsZero() {
+		tx = tx.Where("p.end_time >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		tx = tx.Where("p.end_time < ?", query.To)
+	}
+	if cursor != nil {
+		tx = tx.Where("(p.end_time, p.record_id) < (?, ?)", cursor.EndTime, cursor.RecordID)
+	}
+
+	var rows []struct {
+		RecordID  int64
+		RoomID    string
+		GameType  string
+		Outcome   string
+		Bet       int64
+		Payout    int64
+		Result    map[string]interface{} `gorm:"serializer:json"`
+		StartTime time.Time
+		EndTime   time.Time
+		Duration  int
+	}
+	if err := tx.Order("p.end_time DESC, p.record_id DESC").Limit(limit + 1).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	entries := make([]models.GameHistoryEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, models.GameHistoryEntry{
+			RecordID:  row.RecordID,
+			RoomID:    row.RoomID,
+			GameType:  row.GameType,
+			Outcome:   row.Outcome,
+			Bet:       row.Bet,
+			Payout:    row.Payout,
+			Result:    row.Result,
+			StartTime: row.StartTime,
+			EndTime:   row.EndTime,
+			Duration:  row.Duration,
+		})
+	}
+	return historyPage(entries, limit), nil
+}
+
+type gormRooms struct{ db *gorm.DB }
+
+// SaveRoomState 保存房间状态，已存在时覆盖
+func (r gormRooms) SaveRoomState(ctx context.Context, state *models.RoomState) error {
+	room := RoomModel{
+		RoomID:   state.RoomID,
+		GameType: state.GameType,
+		State:    state.State,
+		Players:  state.Players,
+		Snapshot: state.Snapshot,
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"state", "players", "snapshot", "updated_at"}),
+	}).Create(&room).Error
+}
+
+// LoadRoomState 加载房间状态
+func (r gormRooms) LoadRoomState(ctx context.Context, roomID string) (*models.RoomState, error) {
+	var room RoomModel
+	if err := r.db.WithContext(ctx).Where("room_id = ?", roomID).First(&room).Error; err != nil {
+		return nil, gormError(err)
+	}
+	return &models.RoomState{
+		RoomID:    room.RoomID,
+		GameType:  room.GameType,
+		State:     room.State,
+		Players:   room.Players,
+		Snapshot:  room.Snapshot,
+		CreatedAt: room.CreatedAt,
+		UpdatedAt: room.UpdatedAt,
+	}, nil
+}
+
+// ListRoomIDs 列出所有保存了状态的房间
+func (r gormRooms) ListRoomIDs(ctx context.Context) ([]string, error) {
+	var roomIDs []string
+	err := r.db.WithContext(ctx).Model(&RoomModel{}).Order("updated_at").Pluck("room_id", &roomIDs).Error
+	return roomIDs, err
+}
+
+// DeleteRoomState 删除房间状态
+func (r gormRooms) DeleteRoomState(ctx context.Context, roomID string) error {
+	return r.db.WithContext(ctx).Where("room_id = ?", roomID).Delete(&RoomModel{}).Error
+}
+
+type gormConfigs struct{ db *gorm.DB }
+
+func (r gormConfigs) GetGameConfig(ctx context.Context, gameType string) (*models.GameConfig, error) {
+	var config GameConfigModel
+	if err := r.db.WithContext(ctx).Where("game_type = ?", gameType).First(&config).Error; err != nil {
+		return nil, gormError(err)
+	}
+	return gameConfigFromModel(config), nil
+}
+
+func (r gormConfigs) SaveGameConfig(ctx context.Context, config *models.GameConfig) error {
+	model := GameConfigModel{
+		GameType: config.GameType,
+		Config:   config.Config,
+		Enabled:  config.Enabled,
+	}
+	if model.Config == nil {
+		model.Config = map[string]interface{}{}
+	}
+	// Enabled 显式写入，避免 false 被 default:true 覆盖
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "game_type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"config", "enabled", "updated_at"}),
+	}).Select("*").Omit("id").Create(&model).Error
+}
+
+func (r gormConfigs) ListGameConfigs(ctx context.Context) ([]*models.GameConfig, error) {
+	var rows []GameConfigModel
+	if err := r.db.WithContext(ctx).Order("game_type").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	configs := make([]*models.GameConfig, 0, len(rows))
+	for _, row := range rows {
+		configs = append(configs, gameConfigFromModel(row))
+	}
+	return configs, nil
+}
+
+func gameConfigFromModel(model GameConfigModel) *models.GameConfig {
+	return &models.GameConfig{
+		GameType:  model.GameType,
+		Config:    model.Config,
+		Enabled:   model.Enabled,
+		UpdatedAt: model.UpdatedAt,
+	}
+}
+
+type gormOutbox struct{ db *gorm.DB }
+
+func (r gormOutbox) AppendEvent(ctx context.Context, event *models.OutboxEvent) error {
+	model := OutboxEventModel{
+		EventType: event.Type,
+		EventKey:  event.Key,
+		Payload:   event.Payload,
+	}
+	if err := r.db.WithContext(ctx).Omit("next_attempt_at").Create(&model).Error; err != nil {
 		return err
 	}
-	return sqlDB.Close()
+	event.ID = int64(model.ID)
+	event.CreatedAt = model.CreatedAt
+	return nil
 }
 
-// 添加事务支持
-func (p *GormPostgreSQL) Transaction(fn func(tx *gorm.DB) error) error {
-	return p.db.Transaction(fn)
+// ClaimEvents 使用 SKIP LOCKED，多个节点同时领取时不会拿到同一个事件
+func (r gormOutbox) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	var rows []OutboxEventModel
+	err := r.db.WithContext(ctx).Raw(`
+        UPDATE outbox_events
+        SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => ?)
+        WHERE id IN (
+            SELECT id FROM outbox_events
+            WHERE NOT dead AND next_attempt_at <= CURRENT_TIMESTAMP
+            ORDER BY id
+            LIMIT ?
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING *`, lease.Seconds(), limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	return outboxEventsFromModels(rows), nil
 }
 
-// 添加高级查询方法
-func (p *GormPostgreSQL) GetPlayerStats(userID int64) (map[string]interface{}, error) {
-	var stats map[string]interface{}
+func (r gormOutbox) DeleteEvent(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Delete(&OutboxEventModel{}, id).Error
+}
 
-	// 示例：使用原生SQL查询
-	err := p.db.Raw(
-		`
-        SELECT 
-            COUNT(*) as total_games,
-            SUM(CASE WHEN result->>'outcome' = 'win' THEN 1 ELSE 0 END) as wins,
-            SUM(CASE WHEN result->>'outcome' = 'lose' THEN 1 ELSE 0 END) as losses
-        FROM game_records 
-        WHERE players @> ?`,
-		fmt.Sprintf(`{"%d": {}}`, userID),
-	).Scan(&stats).Error
+func (r gormOutbox) RetryEvent(ctx context.Context, id int64, delay time.Duration, lastError string) error {
+	return r.db.WithContext(ctx).Model(&OutboxEventModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      lastError,
+		"next_attempt_at": gorm.Expr("CURRENT_TIMESTAMP + make_interval(secs => ?)", delay.Seconds()),
+	}).Error
+}
+
+func (r gormOutbox) DeadLetterEvent(ctx context.Context, id int64, lastError string) error {
+	return r.db.WithContext(ctx).Model(&OutboxEventModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": lastError,
+		"dead":       true,
+	}).Error
+}
+
+func (r gormOutbox) ListDeadLetters(ctx context.Context, limit int) ([]models.OutboxEvent, error) {
+	var rows []OutboxEventModel
+	err := r.db.WithContext(ctx).Where("dead").Order("id DESC").Limit(deadLetterLimit(limit)).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return outboxEventsFromModels(rows), nil
+}
 
-	return stats, err
-}
\ No newline at end of file
+func outboxEventsFromModels(rows []OutboxEventModel) []models.OutboxEvent {
+	events := make([]models.OutboxEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, models.OutboxEvent{
+			ID:        int64(row.ID),
+			Type:      row.EventType,
+			Key:       row.EventKey,
+			Payload:   row.Payload,
+			Attempts:  row.Attempts,
+			LastError: row.LastError,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	return events
+}
@@ -2,24 +2,343 @@
 package persistence
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
-	"gorm.io/gorm"
+	"github.com/wfunc/gameserver/models"
 )
 
-// Database 数据库接口
+// Database 数据库接口，按业务划分为多个仓库，所有方法都接受 context 用于取消和超时
 type Database interface {
-	SavePlayerData(playerID int64, data interface{}) error
-	LoadPlayerData(playerID int64, result interface{}) error
-	SaveGameRecord(record interface{}) error
-	SaveRoomState(roomID, gameType, state string, players interface{}) error
-	LoadRoomState(roomID string, result interface{}) error
-	Transaction(fn func(tx *gorm.DB) error) error
-	GetPlayerStats(userID int64) (map[string]interface{}, error)
+	Tx
+	// Transaction 在一个事务中执行 fn，fn 返回错误时回滚
+	Transaction(ctx context.Context, fn func(tx Tx) error) error
 	Close() error
 }
 
+// Tx 一组共享同一个连接或事务的仓库
+type Tx interface {
+	Players() PlayerRepository
+	Wallet() WalletRepository
+	Inventory() InventoryRepository
+	Jackpots() JackpotRepository
+	GameRecords() GameRecordRepository
+	Rooms() RoomRepository
+	Configs() ConfigRepository
+	Outbox() OutboxRepository
+}
+
+// PlayerRepository 玩家资料
+type PlayerRepository interface {
+	// GetPlayer 不存在时返回 ErrRecordNotFound
+	GetPlayer(ctx context.Context, userID int64) (*models.PlayerData, error)
+	// SavePlayer 创建或更新玩家资料。金币只在创建时写入，之后只能通过 WalletRepository 变动
+	SavePlayer(ctx context.Context, player *models.PlayerData) error
+	// CreatePlayer 创建玩家资料，已存在时不做修改并返回 false。金币从 0 开始，初始金币应通过 WalletRepository 发放
+	CreatePlayer(ctx context.Context, player *models.PlayerData) (bool, error)
+	// UpdatePlayer 仅当数据库中的版本仍为 player.Version 时更新资料，成功后 player.Version 加一。
+	// 版本不一致时返回 ErrVersionConflict，不存在时返回 ErrRecordNotFound
+	UpdatePlayer(ctx context.Context, player *models.PlayerData) error
+	GetPlayerStats(ctx context.Context, userID int64) (*models.PlayerStats, error)
+}
+
+// WalletRepository 玩家金币，每次变动都写入 coin_ledger 流水
+type WalletRepository interface {
+	GetBalance(ctx context.Context, userID int64) (int64, error)
+	// AddCoins 原子地增减金币并返回变动后的余额，余额不足时返回 ErrInsufficientCoins。
+	// 金币变动同样会增加玩家的版本
+	AddCoins(ctx context.Context, userID, delta int64, reason string) (int64, error)
+	// ListLedger 按时间从新到旧返回最近的流水
+	ListLedger(ctx context.Context, userID int64, limit int) ([]models.CoinLedgerEntry, error)
+}
+
+// InventoryRepository 玩家背包，每次物品数量变动都写入 item_ledger 流水。
+// 流水中的数量为变动后玩家持有该物品的总数，包括已过期但尚未清理的物品
+type InventoryRepository interface {
+	// ListItems 返回玩家的全部物品，包括已过期但尚未清理的，按过期时间从早到晚，永不过期的排在最后
+	ListItems(ctx context.Context, userID int64) ([]models.InventoryItem, error)
+	// GrantItem 发放物品，stack 为 true 时并入同一物品中过期时间相同的一格，否则新占一格
+	GrantItem(ctx context.Context, item *models.InventoryItem, stack bool, reason string) (*models.ItemLedgerEntry, error)
+	// ConsumeItem 消耗 quantity 个在 now 时未过期的物品，优先消耗最早过期的，
+	// 数量不足时返回 ErrInsufficientItems
+	ConsumeItem(ctx context.Context, userID int64, itemID string, quantity int64, now time.Time, reason string) (*models.ItemLedgerEntry, error)
+	// ExpireItems 删除最多 limit 格在 now 之前过期的物品并写入流水，返回写入的流水
+	ExpireItems(ctx context.Context, now time.Time, limit int) ([]models.ItemLedgerEntry, error)
+	// ListItemLedger 按时间从新到旧返回最近的物品流水
+	ListItemLedger(ctx context.Context, userID int64, limit int) ([]models.ItemLedgerEntry, error)
+}
+
+// JackpotRepository 多个房间共享的累积奖池，每个奖池以名字区分
+type JackpotRepository interface {
+	// GetJackpot 返回奖池当前的金额，奖池尚未创建时返回 ErrRecordNotFound
+	GetJackpot(ctx context.Context, pool string) (int64, error)
+	// ContributeJackpot 原子地向奖池加入 amount 并返回加入后的金额，奖池不存在时以 seed 为初始金额创建
+	ContributeJackpot(ctx context.Context, pool string, amount, seed int64) (int64, error)
+	// ClaimJackpot 原子地领取整个奖池并重置为 seed，写入中奖记录。
+	// 并发领取同一奖池时只有先锁住奖池的一方得到累积的金额，之后的一方得到重置后的金额
+	ClaimJackpot(ctx context.Context, pool string, seed, userID int64, roomID string) (*models.JackpotWin, error)
+	// ListJackpotWins 按时间从新到旧返回最近的中奖记录
+	ListJackpotWins(ctx context.Context, pool string, limit int) ([]models.JackpotWin, error)
+}
+
+// GameRecordRepository 游戏记录
+type GameRecordRepository interface {
+	// SaveGameRecord 保存记录并建立玩家索引，保存后设置 record.ID。
+	// 相同 RoundID 的记录已存在时不做修改并返回 ErrDuplicateRecord
+	SaveGameRecord(ctx context.Context, record *models.GameRecord) error
+	QueryGameHistory(ctx context.Context, query *models.GameHistoryQuery) (*models.GameHistoryPage, error)
+	// ListGameTypes 返回有游戏记录的全部游戏类型
+	ListGameTypes(ctx context.Context) ([]string, error)
+	// ListGameRecordsBefore 按 ID 顺序返回 gameType 中创建时间早于 before 的最多 limit 条记录，用于归档
+	ListGameRecordsBefore(ctx context.Context, gameType string, before time.Time, limit int) ([]*models.GameRecord, error)
+	// DeleteGameRecords 删除记录及其玩家索引
+	DeleteGameRecords(ctx context.Context, ids []int64) error
+	// RestoreGameRecord 按原 ID 写回归档的记录并重建玩家索引，记录已存在时不做修改并返回 false
+	RestoreGameRecord(ctx context.Context, record *models.GameRecord) (bool, error)
+}
+
+// RoomRepository 房间状态和快照
+type RoomRepository interface {
+	SaveRoomState(ctx context.Context, state *models.RoomState) error
+	// LoadRoomState 不存在时返回 ErrRecordNotFound
+	LoadRoomState(ctx context.Context, roomID string) (*models.RoomState, error)
+	ListRoomIDs(ctx context.Context) ([]string, error)
+	DeleteRoomState(ctx context.Context, roomID string) error
+}
+
+// ConfigRepository 保存在数据库中的游戏配置
+type ConfigRepository interface {
+	// GetGameConfig 不存在时返回 ErrRecordNotFound
+	GetGameConfig(ctx context.Context, gameType string) (*models.GameConfig, error)
+	SaveGameConfig(ctx context.Context, config *models.GameConfig) error
+	ListGameConfigs(ctx context.Context) ([]*models.GameConfig, error)
+}
+
+// OutboxRepository 事务性发件箱。事件与状态变更通过同一个 Tx 写入，由 events.Dispatcher 至少投递一次
+type OutboxRepository interface {
+	AppendEvent(ctx context.Context, event *models.OutboxEvent) error
+	// ClaimEvents 按写入顺序领取最多 limit 个到期的事件，lease 内不会再被领取。
+	// 领取后既未删除也未重试的事件(例如进程崩溃)在租约到期后重新投递
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	// DeleteEvent 投递成功后删除事件
+	DeleteEvent(ctx context.Context, id int64) error
+	// RetryEvent 记录一次失败的投递，事件在 delay 后重新可领取
+	RetryEvent(ctx context.Context, id int64, delay time.Duration, lastError string) error
+	// DeadLetterEvent 将事件转为死信，不再投递
+	DeadLetterEvent(ctx context.Context, id int64, lastError string) error
+	// ListDeadLetters 按 ID 从新到旧返回死信
+	ListDeadLetters(ctx context.Context, limit int) ([]models.OutboxEvent, error)
+}
+
 // 错误定义
 var (
-	ErrRecordNotFound = fmt.Errorf("record not found")
+	ErrRecordNotFound    = fmt.Errorf("record not found")
+	ErrInvalidCursor     = fmt.Errorf("invalid cursor")
+	ErrInsufficientCoins = fmt.Errorf("insufficient coins")
+	ErrVersionConflict   = fmt.Errorf("version conflict")
+	ErrInsufficientItems = fmt.Errorf("insufficient items")
+	ErrDuplicateRecord   = fmt.Errorf("duplicate record")
 )
+
+// ItemExpiredReason 物品过期清理时写入流水的原因
+const ItemExpiredReason = "expired"
+
+// DefaultCoins 新玩家的初始金币
+const DefaultCoins = 1000
+
+// DefaultLedgerLimit 查询金币流水的默认条数
+const DefaultLedgerLimit = 50
+
+// DefaultDeadLetterLimit 查询死信的默认条数
+const DefaultDeadLetterLimit = 100
+
+// 历史对局分页大小
+const (
+	DefaultHistoryLimit = 20
+	MaxHistoryLimit     = 100
+)
+
+// toJSONMap 将任意可序列化的值转换为 map，便于写入 jsonb 列
+func toJSONMap(value interface{}) (map[string]interface{}, error) {
+	if data, ok := value.(map[string]interface{}); ok {
+		return data, nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	// 使用 json.Number 保留整数精度，例如 user_id
+	var data map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// recordPlayers 将游戏记录的玩家列表按 user_id 建立索引写入 players 列，
+// 未登录的玩家没有 user_id，使用 guest_<序号> 作为键
+func recordPlayers(record *models.GameRecord) (map[string]interface{}, error) {
+	players := make(map[string]interface{}, len(record.Players))
+	for i, info := range mergeUserPlayers(record.Players) {
+		player, err := toJSONMap(info)
+		if err != nil {
+			return nil, err
+		}
+		key := "guest_" + strconv.Itoa(i)
+		if info.UserID != 0 {
+			key = strconv.FormatInt(info.UserID, 10)
+		}
+		players[key] = player
+	}
+	return players, nil
+}
+
+// playersFromColumn 将 players 列还原为玩家列表，按键排序使结果稳定
+func playersFromColumn(players map[string]interface{}) ([]models.PlayerInfo, error) {
+	raw, err := json.Marshal(players)
+	if err != nil {
+		return nil, err
+	}
+	var byKey map[string]models.PlayerInfo
+	if err := json.Unmarshal(raw, &byKey); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	infos := make([]models.PlayerInfo, 0, len(keys))
+	for _, key := range keys {
+		infos = append(infos, byKey[key])
+	}
+	return infos, nil
+}
+
+// recordResult 返回游戏记录的结算结果，result 列不允许为空
+func recordResult(record *models.GameRecord) (map[string]interface{}, error) {
+	if record.Result == nil {
+		return map[string]interface{}{}, nil
+	}
+	return toJSONMap(record.Result)
+}
+
+// mergeUserPlayers 合并同一用户的多条玩家信息(例如同一用户的多个连接)，
+// 保证每个 user_id 在记录和索引中只出现一次
+func mergeUserPlayers(players []models.PlayerInfo) []models.PlayerInfo {
+	merged := make([]models.PlayerInfo, 0, len(players))
+	index := make(map[int64]int)
+	for _, info := range players {
+		i, exists := index[info.UserID]
+		if info.UserID == 0 || !exists {
+			if info.UserID != 0 {
+				index[info.UserID] = len(merged)
+			}
+			merged = append(merged, info)
+			continue
+		}
+		merged[i].Points += info.Points
+		merged[i].Bet += info.Bet
+		merged[i].Payout += info.Payout
+		merged[i].Outcome = models.OutcomeOf(merged[i].Bet, merged[i].Payout)
+	}
+	return merged
+}
+
+// indexedPlayers 返回需要写入 game_record_players 索引的玩家，未登录的玩家不建立索引
+func indexedPlayers(record *models.GameRecord) []models.PlayerInfo {
+	var players []models.PlayerInfo
+	for _, info := range mergeUserPlayers(record.Players) {
+		if info.UserID != 0 {
+			players = append(players, info)
+		}
+	}
+	return players
+}
+
+// historyLimit 返回有效的分页大小
+func historyLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		return MaxHistoryLimit
+	}
+	return limit
+}
+
+// historyCursor 历史对局的翻页位置，按 (end_time, record_id) 从新到旧翻页
+type historyCursor struct {
+	EndTime  time.Time
+	RecordID int64
+}
+
+func encodeHistoryCursor(entry models.GameHistoryEntry) string {
+	raw := fmt.Sprintf("%d:%d", entry.EndTime.UnixNano(), entry.RecordID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeHistoryCursor 解析翻页位置，空字符串表示从第一页开始
+func decodeHistoryCursor(cursor string) (*historyCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	recordID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &historyCursor{EndTime: time.Unix(0, nanos), RecordID: recordID}, nil
+}
+
+// historyPage 查询时多取一条用于判断是否还有下一页，entries 最多 limit+1 条
+func historyPage(entries []models.GameHistoryEntry, limit int) *models.GameHistoryPage {
+	page := &models.GameHistoryPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = encodeHistoryCursor(page.Entries[limit-1])
+	}
+	if page.Entries == nil {
+		page.Entries = []models.GameHistoryEntry{}
+	}
+	return page
+}
+
+// ledgerLimit 返回有效的流水查询条数
+func ledgerLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLedgerLimit
+	}
+	return limit
+}
+
+// deadLetterLimit 返回有效的死信查询条数
+func deadLetterLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultDeadLetterLimit
+	}
+	return limit
+}
@@ -0,0 +1,60 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+func TestHistoryCursor_RoundTrip(t *testing.T) {
+	entry := models.GameHistoryEntry{RecordID: 42, EndTime: time.Unix(1700000000, 123456000)}
+	cursor, err := decodeHistoryCursor(encodeHistoryCursor(entry))
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if cursor.RecordID != 42 || !cursor.EndTime.Equal(entry.EndTime) {
+		t.Errorf("Cursor did not round trip, got %+v", cursor)
+	}
+
+	if cursor, err := decodeHistoryCursor(""); cursor != nil || err != nil {
+		t.Errorf("Expected an empty cursor to start from the first page, got %+v, %v", cursor, err)
+	}
+	if _, err := decodeHistoryCursor("not-a-cursor"); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestHistoryPage(t *testing.T) {
+	entries := []models.GameHistoryEntry{{RecordID: 3}, {RecordID: 2}, {RecordID: 1}}
+
+	page := historyPage(entries, 2)
+	if len(page.Entries) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected a full page with a next cursor, got %d entries and cursor %q", len(page.Entries), page.NextCursor)
+	}
+	cursor, _ := decodeHistoryCursor(page.NextCursor)
+	if cursor.RecordID != 2 {
+		t.Errorf("Expected the cursor to point at the last returned record, got %d", cursor.RecordID)
+	}
+
+	page = historyPage(entries, 3)
+	if len(page.Entries) != 3 || page.NextCursor != "" {
+		t.Errorf("Expected the last page without a cursor, got %d entries and cursor %q", len(page.Entries), page.NextCursor)
+	}
+}
+
+func TestIndexedPlayers_MergesUsersAndSkipsGuests(t *testing.T) {
+	record := &models.GameRecord{Players: []models.PlayerInfo{
+		{UserID: 7, Bet: 10, Payout: 0, Outcome: models.OutcomeLose},
+		{UserID: 0, Bet: 10, Payout: 100, Outcome: models.OutcomeWin},
+		{UserID: 7, Bet: 10, Payout: 100, Outcome: models.OutcomeWin},
+	}}
+
+	players := indexedPlayers(record)
+	if len(players) != 1 {
+		t.Fatalf("Expected one indexed player, got %d", len(players))
+	}
+	if players[0].Bet != 20 || players[0].Payout != 100 || players[0].Outcome != models.OutcomeWin {
+		t.Errorf("Unexpected merged player: %+v", players[0])
+	}
+}
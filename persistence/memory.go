@@ -0,0 +1,1024 @@
+// persistence/memory.go
+package persistence
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+// Memory 内存数据库实现，用于测试和无数据库的本地运行，进程退出后数据丢失。
+// 事务在数据副本上执行，成功后整体替换，失败时丢弃副本实现回滚。
+// 事务期间持有数据库锁，fn 中只能通过 tx 访问数据，直接使用外层 Memory 会死锁。
+type Memory struct {
+	data  *memoryData
+	mutex *sync.Mutex // 事务中的 Memory 为 nil，由外层事务持有锁
+}
+
+var _ Database = (*Memory)(nil)
+
+// memoryData 内存中的全部数据，保存的都是副本，读写时不共享调用方的对象
+type memoryData struct {
+	players       map[int64]models.PlayerData
+	ledger        []models.CoinLedgerEntry
+	inventory     []models.InventoryItem
+	itemLedger    []models.ItemLedgerEntry
+	jackpots      map[string]int64
+	jackpotWins   []models.JackpotWin
+	records       []memoryRecord
+	recordPlayers []memoryRecordPlayer
+	rooms         map[string]models.RoomState
+	configs       map[string]models.GameConfig
+	outbox        []memoryOutboxEvent
+	nextID        int64
+}
+
+type memoryRecord struct {
+	id     int64
+	record models.GameRecord
+}
+
+type memoryRecordPlayer struct {
+	recordID int64
+	info     models.PlayerInfo
+	gameType string
+	endTime  time.Time
+}
+
+type memoryOutboxEvent struct {
+	event       models.OutboxEvent
+	dead        bool
+	nextAttempt time.Time
+}
+
+// NewMemory 创建一个空的内存数据库
+func NewMemory() *Memory {
+	return &Memory{
+		data: &memoryData{
+			players:  make(map[int64]models.PlayerData),
+			jackpots: make(map[string]int64),
+			rooms:    make(map[string]models.RoomState),
+			configs:  make(map[string]models.GameConfig),
+		},
+		mutex: &sync.Mutex{},
+	}
+}
+
+// clone 复制数据用于事务，保存的都是值，复制 map 和切片即可
+func (d *memoryData) clone() *memoryData {
+	c := &memoryData{
+		players:       make(map[int64]models.PlayerData, len(d.players)),
+		ledger:        append([]models.CoinLedgerEntry(nil), d.ledger...),
+		inventory:     append([]models.InventoryItem(nil), d.inventory...),
+		itemLedger:    append([]models.ItemLedgerEntry(nil), d.itemLedger...),
+		jackpots:      make(map[string]int64, len(d.jackpots)),
+		jackpotWins:   append([]models.JackpotWin(nil), d.jackpotWins...),
+		records:       append([]memoryRecord(nil), d.records...),
+		recordPlayers: append([]memoryRecordPlayer(nil), d.recordPlayers...),
+		rooms:         make(map[string]models.RoomState, len(d.rooms)),
+		configs:       make(map[string]models.GameConfig, len(d.configs)),
+		outbox:        append([]memoryOutboxEvent(nil), d.outbox...),
+		nextID:        d.nextID,
+	}
+	for k, v := range d.players {
+		c.players[k] = v
+	}
+	for k, v := range d.jackpots {
+		c.jackpots[k] = v
+	}
+	for k, v := range d.rooms {
+		c.rooms[k] = v
+	}
+	for k, v := range d.configs {
+		c.configs[k] = v
+	}
+	return c
+}
+
+func (d *memoryData) newID() int64 {
+	d.nextID++
+	return d.nextID
+}
+
+// access 检查 context 并加锁，返回解锁函数
+func (m *Memory) access(ctx context.Context) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m.mutex == nil {
+		return func() {}, nil
+	}
+	m.mutex.Lock()
+	return m.mutex.Unlock, nil
+}
+
+func (m *Memory) Players() PlayerRepository         { return memoryPlayers{m} }
+func (m *Memory) Wallet() WalletRepository          { return memoryWallet{m} }
+func (m *Memory) Inventory() InventoryRepository    { return memoryInventory{m} }
+func (m *Memory) Jackpots() JackpotRepository       { return memoryJackpots{m} }
+func (m *Memory) GameRecords() GameRecordRepository { return memoryGameRecords{m} }
+func (m *Memory) Rooms() RoomRepository             { return memoryRooms{m} }
+func (m *Memory) Configs() ConfigRepository         { return memoryConfigs{m} }
+func (m *Memory) Outbox() OutboxRepository          { return memoryOutbox{m} }
+
+// Transaction 在数据副本上执行 fn，fn 返回错误时丢弃副本
+func (m *Memory) Transaction(ctx context.Context, fn func(tx Tx) error) error {
+	unlock, err := m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tx := &Memory{data: m.data.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.data = tx.data
+	return nil
+}
+
+// Close 内存数据库无需释放资源
+func (m *Memory) Close() error {
+	return nil
+}
+
+// copyMap 浅拷贝 jsonb 列对应的 map，避免调用方修改已保存的数据
+func copyMap(src map[string]interface{}) map[string]interface{} {
+	if src == nil {
+		return nil
+	}
+	dst := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+type memoryPlayers struct{ m *Memory }
+
+func (r memoryPlayers) GetPlayer(ctx context.Context, userID int64) (*models.PlayerData, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	player, exists := r.m.data.players[userID]
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+	player.Items = copyMap(player.Items)
+	return &player, nil
+}
+
+func (r memoryPlayers) SavePlayer(ctx context.Context, player *models.PlayerData) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	now := time.Now()
+	saved := *player
+	saved.Items = copyMap(player.Items)
+	saved.UpdatedAt = now
+	if saved.Level == 0 {
+		saved.Level = 1
+	}
+	// 已存在时只更新资料，不覆盖金币
+	if existing, exists := r.m.data.players[player.UserID]; exists {
+		saved.Coins = existing.Coins
+		saved.Version = existing.Version + 1
+		saved.CreatedAt = existing.CreatedAt
+	} else {
+		saved.Version = 0
+		saved.CreatedAt = now
+	}
+	r.m.data.players[player.UserID] = saved
+	return nil
+}
+
+func (r memoryPlayers) CreatePlayer(ctx context.Context, player *models.PlayerData) (bool, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if _, exists := r.m.data.players[player.UserID]; exists {
+		return false, nil
+	}
+	now := time.Now()
+	saved := *player
+	saved.Items = copyMap(player.Items)
+	saved.Coins = 0
+	saved.Version = 0
+	saved.CreatedAt = now
+	saved.UpdatedAt = now
+	if saved.Level == 0 {
+		saved.Level = 1
+	}
+	r.m.data.players[player.UserID] = saved
+	return true, nil
+}
+
+func (r memoryPlayers) UpdatePlayer(ctx context.Context, player *models.PlayerData) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	existing, exists := r.m.data.players[player.UserID]
+	if !exists {
+		return ErrRecordNotFound
+	}
+	if existing.Version != player.Version {
+		return ErrVersionConflict
+	}
+
+	existing.Name = player.Name
+	existing.Level = player.Level
+	existing.Experience = player.Experience
+	existing.Items = copyMap(player.Items)
+	existing.Version++
+	existing.UpdatedAt = time.Now()
+	r.m.data.players[player.UserID] = existing
+	player.Version = existing.Version
+	return nil
+}
+
+func (r memoryPlayers) GetPlayerStats(ctx context.Context, userID int64) (*models.PlayerStats, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	durations := make(map[int64]int, len(r.m.data.records))
+	for _, record := range r.m.data.records {
+		durations[record.id] = record.record.Duration
+	}
+
+	stats := &models.PlayerStats{}
+	seconds := 0
+	for _, entry := range r.m.data.recordPlayers {
+		if entry.info.UserID != userID {
+			continue
+		}
+		stats.TotalGames++
+		switch entry.info.Outcome {
+		case models.OutcomeWin:
+			stats.Wins++
+		case models.OutcomeLose:
+			stats.Losses++
+		}
+		stats.TotalCoins += entry.info.Payout - entry.info.Bet
+		seconds += durations[entry.recordID]
+	}
+	stats.PlayTime = seconds / 60
+	return stats, nil
+}
+
+type memoryWallet struct{ m *Memory }
+
+func (r memoryWallet) GetBalance(ctx context.Context, userID int64) (int64, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	player, exists := r.m.data.players[userID]
+	if !exists {
+		return 0, ErrRecordNotFound
+	}
+	return player.Coins, nil
+}
+
+func (r memoryWallet) AddCoins(ctx context.Context, userID, delta int64, reason string) (int64, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	player, exists := r.m.data.players[userID]
+	if !exists {
+		return 0, ErrRecordNotFound
+	}
+	balance := player.Coins + delta
+	if balance < 0 {
+		return 0, ErrInsufficientCoins
+	}
+
+	now := time.Now()
+	player.Coins = balance
+	player.Version++
+	player.UpdatedAt = now
+	r.m.data.players[userID] = player
+	r.m.data.ledger = append(r.m.data.ledger, models.CoinLedgerEntry{
+		ID:        r.m.data.newID(),
+		UserID:    userID,
+		Delta:     delta,
+		Balance:   balance,
+		Reason:    reason,
+		CreatedAt: now,
+	})
+	return balance, nil
+}
+
+func (r memoryWallet) ListLedger(ctx context.Context, userID int64, limit int) ([]models.CoinLedgerEntry, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	limit = ledgerLimit(limit)
+	entries := []models.CoinLedgerEntry{}
+	for i := len(r.m.data.ledger) - 1; i >= 0 && len(entries) < limit; i-- {
+		if entry := r.m.data.ledger[i]; entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+type memoryInventory struct{ m *Memory }
+
+func (r memoryInventory) ListItems(ctx context.Context, userID int64) ([]models.InventoryItem, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	items := []models.InventoryItem{}
+	for _, item := range r.m.data.inventory {
+		if item.UserID == userID {
+			items = append(items, item)
+		}
+	}
+	sortInventory(items)
+	return items, nil
+}
+
+func (r memoryInventory) GrantItem(ctx context.Context, item *models.InventoryItem, stack bool, reason string) (*models.ItemLedgerEntry, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	granted := item.Quantity
+	index := -1
+	if stack {
+		for i, existing := range r.m.data.inventory {
+			if existing.UserID == item.UserID && existing.ItemID == item.ItemID && sameExpiry(existing.ExpiresAt, item.ExpiresAt) {
+				index = i
+				break
+			}
+		}
+	}
+
+	if index >= 0 {
+		r.m.data.inventory[index].Quantity += granted
+		*item = r.m.data.inventory[index]
+	} else {
+		item.ID = r.m.data.newID()
+		item.CreatedAt = time.Now()
+		r.m.data.inventory = append(r.m.data.inventory, *item)
+	}
+	return r.m.data.appendItemLedger(item.UserID, item.ItemID, granted, reason), nil
+}
+
+func (r memoryInventory) ConsumeItem(ctx context.Context, userID int64, itemID string, quantity int64, now time.Time, reason string) (*models.ItemLedgerEntry, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var usable []models.InventoryItem
+	available := int64(0)
+	for _, item := range r.m.data.inventory {
+		if item.UserID == userID && item.ItemID == itemID && !item.Expired(now) {
+			usable = append(usable, item)
+			available += item.Quantity
+		}
+	}
+	if available < quantity {
+		return nil, ErrInsufficientItems
+	}
+	sortInventory(usable)
+
+	used := make(map[int64]int64)
+	remaining := quantity
+	for _, item := range usable {
+		if remaining == 0 {
+			break
+		}
+		used[item.ID] = min(item.Quantity, remaining)
+		remaining -= used[item.ID]
+	}
+
+	inventory := r.m.data.inventory[:0]
+	for _, item := range r.m.data.inventory {
+		item.Quantity -= used[item.ID]
+		if item.Quantity > 0 {
+			inventory = append(inventory, item)
+		}
+	}
+	r.m.data.inventory = inventory
+	return r.m.data.appendItemLedger(userID, itemID, -quantity, reason), nil
+}
+
+func (r memoryInventory) ExpireItems(ctx context.Context, now time.Time, limit int) ([]models.ItemLedgerEntry, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var expired []models.InventoryItem
+	inventory := r.m.data.inventory[:0]
+	for _, item := range r.m.data.inventory {
+		if item.Expired(now) && len(expired) < limit {
+			expired = append(expired, item)
+			continue
+		}
+		inventory = append(inventory, item)
+	}
+	r.m.data.inventory = inventory
+
+	var entries []models.ItemLedgerEntry
+	for _, item := range expired {
+		entries = append(entries, *r.m.data.appendItemLedger(item.UserID, item.ItemID, -item.Quantity, ItemExpiredReason))
+	}
+	return entries, nil
+}
+
+func (r memoryInventory) ListItemLedger(ctx context.Context, userID int64, limit int) ([]models.ItemLedgerEntry, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	limit = ledgerLimit(limit)
+	entries := []models.ItemLedgerEntry{}
+	for i := len(r.m.data.itemLedger) - 1; i >= 0 && len(entries) < limit; i-- {
+		if entry := r.m.data.itemLedger[i]; entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+type memoryJackpots struct{ m *Memory }
+
+func (r memoryJackpots) GetJackpot(ctx context.Context, pool string) (int64, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	amount, exists := r.m.data.jackpots[pool]
+	if !exists {
+		return 0, ErrRecordNotFound
+	}
+	return amount, nil
+}
+
+func (r memoryJackpots) ContributeJackpot(ctx context.Context, pool string, amount, seed int64) (int64, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	total, exists := r.m.data.jackpots[pool]
+	if !exists {
+		total = seed
+	}
+	total += amount
+	r.m.data.jackpots[pool] = total
+	return total, nil
+}
+
+func (r memoryJackpots) ClaimJackpot(ctx context.Context, pool string, seed, userID int64, roomID string) (*models.JackpotWin, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	amount, exists := r.m.data.jackpots[pool]
+	if !exists {
+		amount = seed
+	}
+	r.m.data.jackpots[pool] = seed
+	win := models.JackpotWin{
+		ID:        r.m.data.newID(),
+		Pool:      pool,
+		UserID:    userID,
+		RoomID:    roomID,
+		Amount:    amount,
+		CreatedAt: time.Now(),
+	}
+	r.m.data.jackpotWins = append(r.m.data.jackpotWins, win)
+	return &win, nil
+}
+
+func (r memoryJackpots) ListJackpotWins(ctx context.Context, pool string, limit int) ([]models.JackpotWin, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	limit = ledgerLimit(limit)
+	wins := []models.JackpotWin{}
+	for i := len(r.m.data.jackpotWins) - 1; i >= 0 && len(wins) < limit; i-- {
+		if win := r.m.data.jackpotWins[i]; win.Pool == pool {
+			wins = append(wins, win)
+		}
+	}
+	return wins, nil
+}
+
+// appendItemLedger 写入一条物品流水，数量为变动后玩家持有该物品的总数
+func (d *memoryData) appendItemLedger(userID int64, itemID string, delta int64, reason string) *models.ItemLedgerEntry {
+	total := int64(0)
+	for _, item := range d.inventory {
+		if item.UserID == userID && item.ItemID == itemID {
+			total += item.Quantity
+		}
+	}
+	entry := models.ItemLedgerEntry{
+		ID:        d.newID(),
+		UserID:    userID,
+		ItemID:    itemID,
+		Delta:     delta,
+		Quantity:  total,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	d.itemLedger = append(d.itemLedger, entry)
+	return &entry
+}
+
+// sortInventory 按过期时间从早到晚排序，永不过期的排在最后，与 PostgreSQL 的 ORDER BY expires_at, id 一致
+func sortInventory(items []models.InventoryItem) {
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i].ExpiresAt, items[j].ExpiresAt
+		if !sameExpiry(a, b) {
+			return b == nil || (a != nil && a.Before(*b))
+		}
+		return items[i].ID < items[j].ID
+	})
+}
+
+func sameExpiry(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+type memoryGameRecords struct{ m *Memory }
+
+func (r memoryGameRecords) SaveGameRecord(ctx context.Context, record *models.GameRecord) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if r.m.data.hasRound(record.RoundID) {
+		return ErrDuplicateRecord
+	}
+	record.ID = r.m.data.newID()
+	r.m.data.addRecord(record)
+	return nil
+}
+
+// hasRound 判断 roundID 的记录是否已保存，没有 roundID 的记录不会重复
+func (d *memoryData) hasRound(roundID string) bool {
+	if roundID == "" {
+		return false
+	}
+	for _, entry := range d.records {
+		if entry.record.RoundID == roundID {
+			return true
+		}
+	}
+	return false
+}
+
+// addRecord 保存记录的副本并建立玩家索引，record.ID 需已设置
+func (d *memoryData) addRecord(record *models.GameRecord) {
+	saved := *record
+	saved.Players = append([]models.PlayerInfo(nil), record.Players...)
+	saved.Result = copyMap(record.Result)
+	d.records = append(d.records, memoryRecord{id: record.ID, record: saved})
+	for _, info := range indexedPlayers(record) {
+		d.recordPlayers = append(d.recordPlayers, memoryRecordPlayer{
+			recordID: record.ID,
+			info:     info,
+			gameType: record.GameType,
+			endTime:  record.EndTime,
+		})
+	}
+}
+
+func (r memoryGameRecords) ListGameTypes(ctx context.Context) ([]string, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	seen := make(map[string]bool)
+	var gameTypes []string
+	for _, record := range r.m.data.records {
+		if !seen[record.record.GameType] {
+			seen[record.record.GameType] = true
+			gameTypes = append(gameTypes, record.record.GameType)
+		}
+	}
+	sort.Strings(gameTypes)
+	return gameTypes, nil
+}
+
+func (r memoryGameRecords) ListGameRecordsBefore(ctx context.Context, gameType string, before time.Time, limit int) ([]*models.GameRecord, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var records []*models.GameRecord
+	for _, entry := range r.m.data.records {
+		if entry.record.GameType != gameType || !entry.record.CreatedAt.Before(before) {
+			continue
+		}
+		record := entry.record
+		record.Players = append([]models.PlayerInfo(nil), entry.record.Players...)
+		record.Result = copyMap(entry.record.Result)
+		records = append(records, &record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+func (r memoryGameRecords) DeleteGameRecords(ctx context.Context, ids []int64) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	deleted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	var records []memoryRecord
+	for _, entry := range r.m.data.records {
+		if !deleted[entry.id] {
+			records = append(records, entry)
+		}
+	}
+	var recordPlayers []memoryRecordPlayer
+	for _, entry := range r.m.data.recordPlayers {
+		if !deleted[entry.recordID] {
+			recordPlayers = append(recordPlayers, entry)
+		}
+	}
+	r.m.data.records, r.m.data.recordPlayers = records, recordPlayers
+	return nil
+}
+
+func (r memoryGameRecords) RestoreGameRecord(ctx context.Context, record *models.GameRecord) (bool, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	for _, entry := range r.m.data.records {
+		if entry.id == record.ID {
+			return false, nil
+		}
+	}
+	if r.m.data.hasRound(record.RoundID) {
+		return false, nil
+	}
+	r.m.data.addRecord(record)
+	if record.ID > r.m.data.nextID {
+		r.m.data.nextID = record.ID
+	}
+	return true, nil
+}
+
+func (r memoryGameRecords) QueryGameHistory(ctx context.Context, query *models.GameHistoryQuery) (*models.GameHistoryPage, error) {
+	cursor, err := decodeHistoryCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	limit := historyLimit(query.Limit)
+
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	records := make(map[int64]models.GameRecord, len(r.m.data.records))
+	for _, record := range r.m.data.records {
+		records[record.id] = record.record
+	}
+
+	var entries []models.GameHistoryEntry
+	for _, entry := range r.m.data.recordPlayers {
+		if entry.info.UserID != query.UserID ||
+			(query.GameType != "" && entry.gameType != query.GameType) ||
+			(!query.From.IsZero() && entry.endTime.Before(query.From)) ||
+			(!query.To.IsZero() && !entry.endTime.Before(query.To)) {
+			continue
+		}
+		if cursor != nil && !historyBefore(entry.endTime, entry.recordID, cursor) {
+			continue
+		}
+
+		record := records[entry.recordID]
+		entries = append(entries, models.GameHistoryEntry{
+			RecordID:  entry.recordID,
+			RoomID:    record.RoomID,
+			GameType:  entry.gameType,
+			Outcome:   entry.info.Outcome,
+			Bet:       entry.info.Bet,
+			Payout:    entry.info.Payout,
+			Result:    copyMap(record.Result),
+			StartTime: record.StartTime,
+			EndTime:   entry.endTime,
+			Duration:  record.Duration,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].EndTime.Equal(entries[j].EndTime) {
+			return entries[i].EndTime.After(entries[j].EndTime)
+		}
+		return entries[i].RecordID > entries[j].RecordID
+	})
+	if len(entries) > limit+1 {
+		entries = entries[:limit+1]
+	}
+	return historyPage(entries, limit), nil
+}
+
+// historyBefore 判断 (endTime, recordID) 是否排在翻页位置之后，与 SQL 的行比较一致
+func historyBefore(endTime time.Time, recordID int64, cursor *historyCursor) bool {
+	if endTime.Equal(cursor.EndTime) {
+		return recordID < cursor.RecordID
+	}
+	return endTime.Before(cursor.EndTime)
+}
+
+type memoryRooms struct{ m *Memory }
+
+func (r memoryRooms) SaveRoomState(ctx context.Context, state *models.RoomState) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	now := time.Now()
+	saved := *state
+	saved.Players = copyMap(state.Players)
+	saved.Snapshot = append([]byte(nil), state.Snapshot...)
+	saved.CreatedAt = now
+	if existing, exists := r.m.data.rooms[state.RoomID]; exists {
+		saved.CreatedAt = existing.CreatedAt
+	}
+	saved.UpdatedAt = now
+	r.m.data.rooms[state.RoomID] = saved
+	return nil
+}
+
+func (r memoryRooms) LoadRoomState(ctx context.Context, roomID string) (*models.RoomState, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	state, exists := r.m.data.rooms[roomID]
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+	state.Players = copyMap(state.Players)
+	state.Snapshot = append([]byte(nil), state.Snapshot...)
+	return &state, nil
+}
+
+func (r memoryRooms) ListRoomIDs(ctx context.Context) ([]string, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	states := make([]models.RoomState, 0, len(r.m.data.rooms))
+	for _, state := range r.m.data.rooms {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].UpdatedAt.Before(states[j].UpdatedAt) })
+
+	roomIDs := make([]string, 0, len(states))
+	for _, state := range states {
+		roomIDs = append(roomIDs, state.RoomID)
+	}
+	return roomIDs, nil
+}
+
+func (r memoryRooms) DeleteRoomState(ctx context.Context, roomID string) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(r.m.data.rooms, roomID)
+	return nil
+}
+
+type memoryConfigs struct{ m *Memory }
+
+func (r memoryConfigs) GetGameConfig(ctx context.Context, gameType string) (*models.GameConfig, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	config, exists := r.m.data.configs[gameType]
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+	config.Config = copyMap(config.Config)
+	return &config, nil
+}
+
+func (r memoryConfigs) SaveGameConfig(ctx context.Context, config *models.GameConfig) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	saved := *config
+	saved.Config = copyMap(config.Config)
+	if saved.Config == nil {
+		saved.Config = map[string]interface{}{}
+	}
+	saved.UpdatedAt = time.Now()
+	r.m.data.configs[config.GameType] = saved
+	return nil
+}
+
+func (r memoryConfigs) ListGameConfigs(ctx context.Context) ([]*models.GameConfig, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	configs := make([]*models.GameConfig, 0, len(r.m.data.configs))
+	for _, config := range r.m.data.configs {
+		config.Config = copyMap(config.Config)
+		configs = append(configs, &config)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].GameType < configs[j].GameType })
+	return configs, nil
+}
+
+type memoryOutbox struct{ m *Memory }
+
+func (r memoryOutbox) AppendEvent(ctx context.Context, event *models.OutboxEvent) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	now := time.Now()
+	event.ID = r.m.data.newID()
+	event.CreatedAt = now
+	saved := *event
+	saved.Payload = append([]byte(nil), event.Payload...)
+	r.m.data.outbox = append(r.m.data.outbox, memoryOutboxEvent{event: saved, nextAttempt: now})
+	return nil
+}
+
+func (r memoryOutbox) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	now := time.Now()
+	events := []models.OutboxEvent{}
+	for i := range r.m.data.outbox {
+		if len(events) >= limit {
+			break
+		}
+		entry := &r.m.data.outbox[i]
+		if entry.dead || entry.nextAttempt.After(now) {
+			continue
+		}
+		entry.nextAttempt = now.Add(lease)
+		events = append(events, entry.event)
+	}
+	return events, nil
+}
+
+func (r memoryOutbox) DeleteEvent(ctx context.Context, id int64) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i, entry := range r.m.data.outbox {
+		if entry.event.ID == id {
+			r.m.data.outbox = append(r.m.data.outbox[:i:i], r.m.data.outbox[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r memoryOutbox) RetryEvent(ctx context.Context, id int64, delay time.Duration, lastError string) error {
+	return r.update(ctx, id, func(entry *memoryOutboxEvent) {
+		entry.event.Attempts++
+		entry.event.LastError = lastError
+		entry.nextAttempt = time.Now().Add(delay)
+	})
+}
+
+func (r memoryOutbox) DeadLetterEvent(ctx context.Context, id int64, lastError string) error {
+	return r.update(ctx, id, func(entry *memoryOutboxEvent) {
+		entry.event.Attempts++
+		entry.event.LastError = lastError
+		entry.dead = true
+	})
+}
+
+func (r memoryOutbox) ListDeadLetters(ctx context.Context, limit int) ([]models.OutboxEvent, error) {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	limit = deadLetterLimit(limit)
+	events := []models.OutboxEvent{}
+	for i := len(r.m.data.outbox) - 1; i >= 0 && len(events) < limit; i-- {
+		if entry := r.m.data.outbox[i]; entry.dead {
+			events = append(events, entry.event)
+		}
+	}
+	return events, nil
+}
+
+// update 修改指定的事件，事件不存在时忽略
+func (r memoryOutbox) update(ctx context.Context, id int64, fn func(entry *memoryOutboxEvent)) error {
+	unlock, err := r.m.access(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range r.m.data.outbox {
+		if r.m.data.outbox[i].event.ID == id {
+			fn(&r.m.data.outbox[i])
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+func newMemoryWithPlayer(t *testing.T, userID, coins int64) *Memory {
+	t.Helper()
+	db := NewMemory()
+	err := db.Players().SavePlayer(context.Background(), &models.PlayerData{UserID: userID, Name: "alice", Coins: coins})
+	if err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+	return db
+}
+
+func TestMemory_SavePlayerKeepsCoins(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryWithPlayer(t, 1, 500)
+
+	if err := db.Players().SavePlayer(ctx, &models.PlayerData{UserID: 1, Name: "bob", Coins: 99999}); err != nil {
+		t.Fatalf("Failed to update player: %v", err)
+	}
+	player, err := db.Players().GetPlayer(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to load player: %v", err)
+	}
+	if player.Name != "bob" || player.Coins != 500 || player.Level != 1 {
+		t.Errorf("Expected the profile to change but not the coins, got %+v", player)
+	}
+
+	if _, err := db.Players().GetPlayer(ctx, 2); err != ErrRecordNotFound {
+		t.Errorf("Expected ErrRecordNotFound for a missing player, got %v", err)
+	}
+}
+
+func TestMemory_CreatePlayerOnlyOnce(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryWithPlayer(t, 1, 500)
+
+	created, err := db.Players().CreatePlayer(ctx, &models.PlayerData{UserID: 1, Name: "bob"})
+	if err != nil || created {
+		t.Fatalf("Expected the existing player to be kept, got %v, %v", created, err)
+	}
+	if player, _ := db.Players().GetPlayer(ctx, 1); player.Name != "alice" || player.Coins != 500 {
+		t.Errorf("Expected the existing profile to be unchanged, got %+v", player)
+	}
+
+	created, err = db.Players().CreatePlayer(ctx, &models.PlayerData{UserID: 2, Name: "carol", Coins: 99999})
+	if err != nil || !created {
+		t.Fatalf("Expected a new player, got %v, %v", created, err)
+	}
+	if player, _ := db.Players().GetPlayer(ctx, 2); player.Coins != 0 || player.Level != 1 {
+		t.Errorf("Expected a new player at level 1 with no coins, got %+v", player)
+	}
+}
+
+func TestMemory_Wallet(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryWithPlayer(t, 1, 100)
+
+	balance, err := db.Wallet().AddCoins(ctx, 1, -30, "bet")
+	if err != nil || balance != 70 {
+		t.Fatalf("Expected balance 70, got %d, %v", balance, err)
+	}
+	if _, err := db.Wallet().AddCoins(ctx, 1, -71, "bet"); err != ErrInsufficientCoins {
+		t.Errorf("Expected ErrInsufficientCoins, got %v", err)
+	}
+	if _, err := db.Wallet().AddCoins(ctx, 1, 50, "payout"); err != nil {
+		t.Fatalf("Failed to add coins: %v", err)
+	}
+
+	ledger, err := db.Wallet().ListLedger(ctx, 1, 0)
+	if err != nil {
+		t.Fatalf("Failed to list ledger: %v", err)
+	}
+	if len(ledger) != 2 || ledger[0].Reason != "payout" || ledger[0].Balance != 120 || ledger[1].Delta != -30 {
+		t.Errorf("Unexpected ledger: %+v", ledger)
+	}
+}
+
+func TestMemory_TransactionRollback(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryWithPlayer(t, 1, 100)
+	errAbort := errors.New("abort")
+
+	err := db.Transaction(ctx, func(tx Tx) error {
+		if _, err := tx.Wallet().AddCoins(ctx, 1, 50, "bonus"); err != nil {
+			return err
+		}
+		// 事务内可以读到未提交的修改
+		if balance, _ := tx.Wallet().GetBalance(ctx, 1); balance != 150 {
+			t.Errorf("Expected the transaction to see balance 150, got %d", balance)
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Expected the transaction error to be returned, got %v", err)
+	}
+
+	balance, _ := db.Wallet().GetBalance(ctx, 1)
+	ledger, _ := db.Wallet().ListLedger(ctx, 1, 0)
+	if balance != 100 || len(ledger) != 0 {
+		t.Errorf("Expected the transaction to roll back, got balance %d and %d ledger entries", balance, len(ledger))
+	}
+
+	err = db.Transaction(ctx, func(tx Tx) error {
+		_, err := tx.Wallet().AddCoins(ctx, 1, 50, "bonus")
+		return err
+	})
+	if balance, _ := db.Wallet().GetBalance(ctx, 1); err != nil || balance != 150 {
+		t.Errorf("Expected the transaction to commit, got balance %d, %v", balance, err)
+	}
+}
+
+func TestMemory_CanceledContext(t *testing.T) {
+	db := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := db.Players().GetPlayer(ctx, 1); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMemory_GameHistoryAndStats(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemory()
+	start := time.Unix(1700000000, 0)
+
+	for i := 0; i < 5; i++ {
+		gameType := "slot_machine"
+		if i == 4 {
+			gameType = "poker"
+		}
+		record := &models.GameRecord{
+			RoomID:    "room_1",
+			GameType:  gameType,
+			StartTime: start.Add(time.Duration(i) * time.Minute),
+			EndTime:   start.Add(time.Duration(i)*time.Minute + 30*time.Second),
+			Duration:  30,
+			Players: []models.PlayerInfo{
+				{UserID: 7, Bet: 10, Payout: int64(i % 2 * 100), Outcome: models.OutcomeOf(10, int64(i%2*100))},
+				{UserID: 8, Bet: 10, Outcome: models.OutcomeLose},
+			},
+		}
+		if err := db.GameRecords().SaveGameRecord(ctx, record); err != nil {
+			t.Fatalf("Failed to save record: %v", err)
+		}
+	}
+
+	query := &models.GameHistoryQuery{UserID: 7, GameType: "slot_machine", Limit: 3}
+	page, err := db.GameRecords().QueryGameHistory(ctx, query)
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+	if len(page.Entries) != 3 || page.NextCursor == "" || !page.Entries[0].EndTime.After(page.Entries[1].EndTime) {
+		t.Fatalf("Expected a first page of 3 newest rounds, got %+v", page)
+	}
+
+	query.Cursor = page.NextCursor
+	page, err = db.GameRecords().QueryGameHistory(ctx, query)
+	if err != nil {
+		t.Fatalf("Failed to query the second page: %v", err)
+	}
+	if len(page.Entries) != 1 || page.NextCursor != "" || page.Entries[0].StartTime != start {
+		t.Errorf("Expected the oldest round on the last page, got %+v", page)
+	}
+
+	stats, err := db.Players().GetPlayerStats(ctx, 7)
+	if err != nil {
+		t.Fatalf("Failed to load stats: %v", err)
+	}
+	if stats.TotalGames != 5 || stats.Wins != 2 || stats.Losses != 3 || stats.TotalCoins != 150 || stats.PlayTime != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,289 @@
+// persistence/migrate.go
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles 版本化的表结构迁移，文件名为 <版本>_<名称>.up.sql / .down.sql。
+// 两个 PostgreSQL 实现共用这一份表结构，新的表结构改动只能以新迁移的形式加入
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID 迁移时持有的 PostgreSQL advisory lock，防止多个进程同时迁移
+const migrationLockID = 7209341
+
+// ErrSchemaOutdated 数据库表结构版本低于当前程序需要的版本
+var ErrSchemaOutdated = errors.New("database schema is outdated")
+
+// Migration 一个版本化的表结构迁移
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations 返回按版本升序排列的全部迁移
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+// LatestSchemaVersion 当前程序需要的表结构版本
+func LatestSchemaVersion() int {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// loadMigrations 读取 dir 下的迁移文件。版本号必须从 1 开始连续，且每个版本都有 up 和 down
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: file name must end with .up.sql or .down.sql", file)
+		}
+
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		versionPart, name, ok := strings.Cut(base, "_")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("migration %s: file name must be <version>_<name>", file)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", file, versionPart)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, missing version %d", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrator 在 PostgreSQL 上执行表结构迁移，已执行的版本记录在 schema_version 表中
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator 创建迁移器，连接参数与 NewPostgreSQL 相同
+func NewMigrator(host string, port int, user, password, dbname string) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("postgres", postgresDSN(host, port, user, password, dbname))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Close 关闭迁移器的数据库连接
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// Version 返回数据库当前的表结构版本，未迁移过的数据库为 0
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, m.db)
+}
+
+// Up 执行全部未执行的迁移，返回执行的迁移
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, len(m.migrations))
+}
+
+// Down 回滚最近的 steps 个迁移，返回回滚的迁移
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	current, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	target := current - steps
+	if target < 0 {
+		target = 0
+	}
+	return m.To(ctx, target)
+}
+
+// To 将表结构迁移到 target 版本，target 高于当前版本时向上迁移，低于时回滚。
+// 每个迁移在单独的事务中执行，失败时停在上一个成功的版本
+func (m *Migrator) To(ctx context.Context, target int) ([]Migration, error) {
+	if target < 0 || target > len(m.migrations) {
+		return nil, fmt.Errorf("target version %d out of range [0, %d]", target, len(m.migrations))
+	}
+
+	// advisory lock 属于会话，加锁、迁移和解锁必须在同一个连接上
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_version (
+            version INT PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+        )
+    `); err != nil {
+		return nil, err
+	}
+
+	current, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if current > len(m.migrations) {
+		return nil, fmt.Errorf("database schema version %d is newer than the latest known migration %d", current, len(m.migrations))
+	}
+
+	var done []Migration
+	for current < target {
+		next := m.migrations[current]
+		if err := applyMigration(ctx, conn, next.Up,
+			"INSERT INTO schema_version (version, name) VALUES ($1, $2)", next.Version, next.Name); err != nil {
+			return done, fmt.Errorf("migrate up to %d_%s: %w", next.Version, next.Name, err)
+		}
+		done = append(done, next)
+		current++
+	}
+	for current > target {
+		last := m.migrations[current-1]
+		if err := applyMigration(ctx, conn, last.Down,
+			"DELETE FROM schema_version WHERE version = $1", last.Version); err != nil {
+			return done, fmt.Errorf("migrate down from %d_%s: %w", last.Version, last.Name, err)
+		}
+		done = append(done, last)
+		current--
+	}
+	return done, nil
+}
+
+// applyMigration 在一个事务中执行迁移脚本并更新 schema_version
+func applyMigration(ctx context.Context, conn *sql.Conn, script, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaVersion 读取 schema_version 中最大的版本，表不存在时为 0
+func schemaVersion(ctx context.Context, exec sqlExecutor) (int, error) {
+	var exists bool
+	if err := exec.QueryRowContext(ctx,
+		"SELECT to_regclass('schema_version') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	if err := exec.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// checkSchema 确认数据库已迁移到当前程序需要的版本，数据库实现在建立连接时调用
+func checkSchema(ctx context.Context, db *sql.DB) error {
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if latest := LatestSchemaVersion(); version < latest {
+		return fmt.Errorf("%w: database is at version %d, this build needs %d; run `gameserver migrate up`",
+			ErrSchemaOutdated, version, latest)
+	}
+	return nil
+}
+
+// postgresDSN 拼接 PostgreSQL 连接串
+func postgresDSN(host string, port int, user, password, dbname string) string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		host, port, user, password, dbname)
+}
@@ -0,0 +1,103 @@
+package persistence
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrations_Embedded(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Expected at least one migration")
+	}
+	if LatestSchemaVersion() != migrations[len(migrations)-1].Version {
+		t.Errorf("Expected latest version %d, got %d", migrations[len(migrations)-1].Version, LatestSchemaVersion())
+	}
+
+	// 所有仓库用到的表都必须由迁移创建
+	var up strings.Builder
+	for _, m := range migrations {
+		up.WriteString(m.Up)
+	}
+	for _, table := range []string{"players", "coin_ledger", "game_records", "game_record_players", "rooms", "game_configs"} {
+		if !strings.Contains(up.String(), "CREATE TABLE IF NOT EXISTS "+table+" ") {
+			t.Errorf("Expected a migration to create table %s", table)
+		}
+	}
+}
+
+func TestLoadMigrations_Validation(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql": file("CREATE TABLE a (id INT);"),
+			},
+			want: "must have both up and down",
+		},
+		{
+			name: "gap in versions",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql":   file("CREATE TABLE a (id INT);"),
+				"m/0001_init.down.sql": file("DROP TABLE a;"),
+				"m/0003_more.up.sql":   file("CREATE TABLE b (id INT);"),
+				"m/0003_more.down.sql": file("DROP TABLE b;"),
+			},
+			want: "missing version 2",
+		},
+		{
+			name: "bad file name",
+			files: fstest.MapFS{
+				"m/init.up.sql": file("CREATE TABLE a (id INT);"),
+			},
+			want: "file name must be <version>_<name>",
+		},
+		{
+			name: "conflicting names",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql":    file("CREATE TABLE a (id INT);"),
+				"m/0001_other.down.sql": file("DROP TABLE a;"),
+			},
+			want: "conflicting names",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadMigrations_Order(t *testing.T) {
+	files := fstest.MapFS{
+		"m/0002_second.up.sql":   {Data: []byte("up 2")},
+		"m/0002_second.down.sql": {Data: []byte("down 2")},
+		"m/0001_first.up.sql":    {Data: []byte("up 1")},
+		"m/0001_first.down.sql":  {Data: []byte("down 1")},
+	}
+
+	migrations, err := loadMigrations(files, "m")
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Name != "second" {
+		t.Fatalf("Expected migrations in version order, got %+v", migrations)
+	}
+	if migrations[1].Up != "up 2" || migrations[1].Down != "down 2" {
+		t.Errorf("Expected up and down scripts to be paired, got %+v", migrations[1])
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS rooms;
+DROP TABLE IF EXISTS game_records;
+DROP TABLE IF EXISTS players;
@@ -0,0 +1,32 @@
+-- 初始表结构：玩家、游戏记录和房间
+CREATE TABLE IF NOT EXISTS players (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT UNIQUE NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS game_records (
+    id BIGSERIAL PRIMARY KEY,
+    room_id VARCHAR(255) NOT NULL,
+    game_type VARCHAR(100) NOT NULL,
+    players JSONB NOT NULL,
+    result JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id BIGSERIAL PRIMARY KEY,
+    room_id VARCHAR(255) UNIQUE NOT NULL,
+    game_type VARCHAR(100) NOT NULL,
+    state VARCHAR(50) NOT NULL,
+    players JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_players_user_id ON players(user_id);
+CREATE INDEX IF NOT EXISTS idx_game_records_room_id ON game_records(room_id);
+CREATE INDEX IF NOT EXISTS idx_game_records_created_at ON game_records(created_at);
+CREATE INDEX IF NOT EXISTS idx_rooms_room_id ON rooms(room_id);
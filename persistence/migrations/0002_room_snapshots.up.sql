@@ -0,0 +1,2 @@
+-- 房间快照，用于重启后恢复房间
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS snapshot JSONB;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS game_record_players;
+ALTER TABLE game_records DROP COLUMN IF EXISTS duration;
+ALTER TABLE game_records DROP COLUMN IF EXISTS end_time;
+ALTER TABLE game_records DROP COLUMN IF EXISTS start_time;
@@ -0,0 +1,17 @@
+-- 游戏记录的时间列，以及按玩家查询历史对局和统计的索引表
+ALTER TABLE game_records ADD COLUMN IF NOT EXISTS start_time TIMESTAMPTZ;
+ALTER TABLE game_records ADD COLUMN IF NOT EXISTS end_time TIMESTAMPTZ;
+ALTER TABLE game_records ADD COLUMN IF NOT EXISTS duration INT DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS game_record_players (
+    record_id BIGINT NOT NULL REFERENCES game_records(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    game_type VARCHAR(100) NOT NULL,
+    outcome VARCHAR(10) NOT NULL,
+    bet BIGINT DEFAULT 0,
+    payout BIGINT DEFAULT 0,
+    end_time TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (record_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_record_players_user_time ON game_record_players(user_id, end_time, record_id);
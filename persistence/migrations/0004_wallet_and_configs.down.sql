@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS game_configs;
+DROP TABLE IF EXISTS coin_ledger;
+UPDATE players SET data = '{}'::jsonb WHERE data IS NULL;
+ALTER TABLE players ALTER COLUMN data SET NOT NULL;
+ALTER TABLE players DROP COLUMN IF EXISTS items;
+ALTER TABLE players DROP COLUMN IF EXISTS coins;
+ALTER TABLE players DROP COLUMN IF EXISTS experience;
+ALTER TABLE players DROP COLUMN IF EXISTS level;
+ALTER TABLE players DROP COLUMN IF EXISTS name;
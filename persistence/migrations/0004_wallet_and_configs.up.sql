@@ -0,0 +1,27 @@
+-- 玩家资料列、金币流水和游戏配置，旧的 players.data 列不再使用
+ALTER TABLE players ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '';
+ALTER TABLE players ADD COLUMN IF NOT EXISTS level INT DEFAULT 1;
+ALTER TABLE players ADD COLUMN IF NOT EXISTS experience INT DEFAULT 0;
+ALTER TABLE players ADD COLUMN IF NOT EXISTS coins BIGINT DEFAULT 0;
+ALTER TABLE players ADD COLUMN IF NOT EXISTS items JSONB;
+ALTER TABLE players ALTER COLUMN data DROP NOT NULL;
+
+CREATE TABLE IF NOT EXISTS coin_ledger (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    delta BIGINT NOT NULL,
+    balance BIGINT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS game_configs (
+    id BIGSERIAL PRIMARY KEY,
+    game_type VARCHAR(100) UNIQUE NOT NULL,
+    config JSONB NOT NULL,
+    enabled BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_coin_ledger_user_id ON coin_ledger(user_id);
@@ -0,0 +1,2 @@
+-- 玩家版本号，写回缓存用它检测其他节点的并发修改
+ALTER TABLE players ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_game_records_type_created;
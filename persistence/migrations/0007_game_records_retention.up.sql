@@ -0,0 +1,2 @@
+-- 按游戏类型和创建时间查找需要归档的游戏记录
+CREATE INDEX IF NOT EXISTS idx_game_records_type_created ON game_records(game_type, created_at, id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS item_ledger;
+DROP TABLE IF EXISTS inventory_items;
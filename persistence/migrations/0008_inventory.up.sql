@@ -0,0 +1,23 @@
+-- 玩家背包和物品流水，取代 players.items 中无类型的物品数据
+CREATE TABLE IF NOT EXISTS inventory_items (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    item_id VARCHAR(100) NOT NULL,
+    quantity BIGINT NOT NULL CHECK (quantity > 0),
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS item_ledger (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    item_id VARCHAR(100) NOT NULL,
+    delta BIGINT NOT NULL,
+    quantity BIGINT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_items_user_item ON inventory_items(user_id, item_id);
+CREATE INDEX IF NOT EXISTS idx_inventory_items_expires_at ON inventory_items(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_item_ledger_user_id ON item_ledger(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS jackpot_wins;
+DROP TABLE IF EXISTS jackpots;
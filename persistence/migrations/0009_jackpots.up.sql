@@ -0,0 +1,17 @@
+-- 多个房间共享的累积奖池和中奖记录
+CREATE TABLE IF NOT EXISTS jackpots (
+    pool VARCHAR(100) PRIMARY KEY,
+    amount BIGINT NOT NULL CHECK (amount >= 0),
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS jackpot_wins (
+    id BIGSERIAL PRIMARY KEY,
+    pool VARCHAR(100) NOT NULL,
+    user_id BIGINT NOT NULL,
+    room_id VARCHAR(100) NOT NULL DEFAULT '',
+    amount BIGINT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jackpot_wins_pool ON jackpot_wins(pool, id);
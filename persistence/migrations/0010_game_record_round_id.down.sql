@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_game_records_round_id;
+ALTER TABLE game_records DROP COLUMN IF EXISTS round_id;
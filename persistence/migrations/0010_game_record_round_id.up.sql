@@ -0,0 +1,3 @@
+-- 一局的唯一标识，重试保存游戏记录时避免写入重复的记录
+ALTER TABLE game_records ADD COLUMN IF NOT EXISTS round_id VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_game_records_round_id ON game_records(round_id);
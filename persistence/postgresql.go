@@ -5,24 +5,35 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
-	// PostgreSQL 驱动
-	_ "github.com/lib/pq" // PostgreSQL 驱动
+	"github.com/wfunc/gameserver/models"
+
+	"github.com/lib/pq" // PostgreSQL 驱动
 )
 
-// PostgreSQL 数据库实现
+// sqlExecutor *sql.DB 和 *sql.Tx 共有的方法，仓库通过它在连接池或事务上执行 SQL
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// PostgreSQL 数据库实现。事务中的 PostgreSQL 的 exec 为 *sql.Tx
 type PostgreSQL struct {
-	db *sql.DB
+	db   *sql.DB
+	exec sqlExecutor
 }
 
+var _ Database = (*PostgreSQL)(nil)
+
 // NewPostgreSQL 创建 PostgreSQL 数据库连接
 func NewPostgreSQL(host string, port int, user, password, dbname string) (*PostgreSQL, error) {
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname)
-
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", postgresDSN(host, port, user, password, dbname))
 	if err != nil {
 		return nil, err
 	}
@@ -40,184 +51,958 @@ func NewPostgreSQL(host string, port int, user, password, dbname string) (*Postg
 	db.SetMaxIdleConns(25)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	// 初始化表结构
-	if err := initTables(db); err != nil {
+	// 表结构由 migrate 命令维护，这里只检查版本
+	if err := checkSchema(ctx, db); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &PostgreSQL{db: db}, nil
+	return &PostgreSQL{db: db, exec: db}, nil
 }
 
-// initTables 初始化数据库表结构
-func initTables(db *sql.DB) error {
-	// 创建玩家表
-	_, err := db.Exec(`
-        CREATE TABLE IF NOT EXISTS players (
-            id SERIAL PRIMARY KEY,
-            user_id BIGINT UNIQUE NOT NULL,
-            data JSONB NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        )
-    `)
+func (p *PostgreSQL) Players() PlayerRepository         { return sqlPlayers{p.exec} }
+func (p *PostgreSQL) Wallet() WalletRepository          { return sqlWallet{p.exec} }
+func (p *PostgreSQL) Inventory() InventoryRepository    { return sqlInventory{p.exec} }
+func (p *PostgreSQL) Jackpots() JackpotRepository       { return sqlJackpots{p.exec} }
+func (p *PostgreSQL) GameRecords() GameRecordRepository { return sqlGameRecords{p.exec} }
+func (p *PostgreSQL) Rooms() RoomRepository             { return sqlRooms{p.exec} }
+func (p *PostgreSQL) Configs() ConfigRepository         { return sqlConfigs{p.exec} }
+func (p *PostgreSQL) Outbox() OutboxRepository          { return sqlOutbox{p.exec} }
+
+// Transaction 在一个事务中执行 fn，fn 中的仓库共享同一个事务
+func (p *PostgreSQL) Transaction(ctx context.Context, fn func(tx Tx) error) error {
+	return withSQLTx(ctx, p.exec, func(tx sqlExecutor) error {
+		return fn(&PostgreSQL{db: p.db, exec: tx})
+	})
+}
+
+// Close 关闭数据库连接
+func (p *PostgreSQL) Close() error {
+	return p.db.Close()
+}
+
+// withSQLTx 在事务中执行 fn，exec 已经是事务时直接使用，不再开启新事务
+func withSQLTx(ctx context.Context, exec sqlExecutor, fn func(tx sqlExecutor) error) error {
+	db, ok := exec.(*sql.DB)
+	if !ok {
+		return fn(exec)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// 创建游戏记录表
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS game_records (
-            id SERIAL PRIMARY KEY,
-            room_id VARCHAR(255) NOT NULL,
-            game_type VARCHAR(100) NOT NULL,
-            players JSONB NOT NULL,
-            result JSONB NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        )
-    `)
-	if err != nil {
+	if err := fn(tx); err != nil {
 		return err
 	}
+	return tx.Commit()
+}
 
-	// 创建房间表
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS rooms (
-            id SERIAL PRIMARY KEY,
-            room_id VARCHAR(255) UNIQUE NOT NULL,
-            game_type VARCHAR(100) NOT NULL,
-            state VARCHAR(50) NOT NULL,
-            players JSONB NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        )
-    `)
+// sqlError 将 database/sql 的错误转换为包内定义的错误
+func sqlError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// scanJSON 将 JSONB 列解码到 dest，NULL 时保持零值
+func scanJSON(data []byte, dest interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+type sqlPlayers struct{ exec sqlExecutor }
+
+func (r sqlPlayers) GetPlayer(ctx context.Context, userID int64) (*models.PlayerData, error) {
+	player := &models.PlayerData{}
+	var items []byte
+	err := r.exec.QueryRowContext(ctx, `
+        SELECT user_id, name, level, experience, coins, items, version, created_at, updated_at
+        FROM players WHERE user_id = $1
+    `, userID).Scan(&player.UserID, &player.Name, &player.Level, &player.Experience,
+		&player.Coins, &items, &player.Version, &player.CreatedAt, &player.UpdatedAt)
 	if err != nil {
-		return err
+		return nil, sqlError(err)
 	}
+	if err := scanJSON(items, &player.Items); err != nil {
+		return nil, err
+	}
+	return player, nil
+}
 
-	// 创建索引以提高查询性能
-	_, err = db.Exec(`
-        CREATE INDEX IF NOT EXISTS idx_players_user_id ON players(user_id);
-        CREATE INDEX IF NOT EXISTS idx_game_records_room_id ON game_records(room_id);
-        CREATE INDEX IF NOT EXISTS idx_game_records_created_at ON game_records(created_at);
-        CREATE INDEX IF NOT EXISTS idx_rooms_room_id ON rooms(room_id);
-    `)
+func (r sqlPlayers) SavePlayer(ctx context.Context, player *models.PlayerData) error {
+	items, err := json.Marshal(player.Items)
+	if err != nil {
+		return err
+	}
+	level := player.Level
+	if level == 0 {
+		level = 1
+	}
 
+	// 已存在时只更新资料，不覆盖金币
+	_, err = r.exec.ExecContext(ctx, `
+        INSERT INTO players (user_id, name, level, experience, coins, items)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (user_id)
+        DO UPDATE SET name = $2, level = $3, experience = $4, items = $6,
+            version = players.version + 1, updated_at = CURRENT_TIMESTAMP
+    `, player.UserID, player.Name, level, player.Experience, player.Coins, items)
 	return err
 }
 
-// SavePlayerData 保存玩家数据
-func (p *PostgreSQL) SavePlayerData(playerID int64, data interface{}) error {
-	jsonData, err := json.Marshal(data)
+func (r sqlPlayers) CreatePlayer(ctx context.Context, player *models.PlayerData) (bool, error) {
+	items, err := json.Marshal(player.Items)
+	if err != nil {
+		return false, err
+	}
+	level := player.Level
+	if level == 0 {
+		level = 1
+	}
+
+	result, err := r.exec.ExecContext(ctx, `
+        INSERT INTO players (user_id, name, level, experience, coins, items)
+        VALUES ($1, $2, $3, $4, 0, $5)
+        ON CONFLICT (user_id) DO NOTHING
+    `, player.UserID, player.Name, level, player.Experience, items)
+	if err != nil {
+		return false, err
+	}
+	created, err := result.RowsAffected()
+	return created > 0, err
+}
+
+func (r sqlPlayers) UpdatePlayer(ctx context.Context, player *models.PlayerData) error {
+	items, err := json.Marshal(player.Items)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	result, err := r.exec.ExecContext(ctx, `
+        UPDATE players
+        SET name = $2, level = $3, experience = $4, items = $5,
+            version = version + 1, updated_at = CURRENT_TIMESTAMP
+        WHERE user_id = $1 AND version = $6
+    `, player.UserID, player.Name, player.Level, player.Experience, items, player.Version)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return r.versionError(ctx, player.UserID)
+	}
+	player.Version++
+	return nil
+}
 
-	// 使用 UPSERT 操作 (PostgreSQL 9.5+)
-	query := `
-        INSERT INTO players (user_id, data) 
-        VALUES ($1, $2)
-        ON CONFLICT (user_id) 
-        DO UPDATE SET data = $2, updated_at = CURRENT_TIMESTAMP
-    `
+// versionError 区分条件更新没有命中的原因：玩家不存在或版本已被修改
+func (r sqlPlayers) versionError(ctx context.Context, userID int64) error {
+	var exists bool
+	err := r.exec.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM players WHERE user_id = $1)`, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrRecordNotFound
+	}
+	return ErrVersionConflict
+}
 
-	_, err = p.db.ExecContext(ctx, query, playerID, jsonData)
-	return err
+func (r sqlPlayers) GetPlayerStats(ctx context.Context, userID int64) (*models.PlayerStats, error) {
+	stats := &models.PlayerStats{}
+
+	// 使用玩家索引统计，避免扫描 players 列
+	err := r.exec.QueryRowContext(ctx, `
+        SELECT
+            COUNT(*),
+            COALESCE(SUM(CASE WHEN p.outcome = 'win' THEN 1 ELSE 0 END), 0),
+            COALESCE(SUM(CASE WHEN p.outcome = 'lose' THEN 1 ELSE 0 END), 0),
+            COALESCE(SUM(p.payout - p.bet), 0),
+            COALESCE(SUM(r.duration), 0) / 60
+        FROM game_record_players p
+        JOIN game_records r ON r.id = p.record_id
+        WHERE p.user_id = $1
+    `, userID).Scan(&stats.TotalGames, &stats.Wins, &stats.Losses, &stats.TotalCoins, &stats.PlayTime)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
 }
 
-// LoadPlayerData 加载玩家数据
-func (p *PostgreSQL) LoadPlayerData(playerID int64, result interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+type sqlWallet struct{ exec sqlExecutor }
 
-	var data []byte
-	query := `SELECT data FROM players WHERE user_id = $1`
-	err := p.db.QueryRowContext(ctx, query, playerID).Scan(&data)
+func (r sqlWallet) GetBalance(ctx context.Context, userID int64) (int64, error) {
+	var coins int64
+	err := r.exec.QueryRowContext(ctx, `SELECT coins FROM players WHERE user_id = $1`, userID).Scan(&coins)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return ErrRecordNotFound
+		return 0, sqlError(err)
+	}
+	return coins, nil
+}
+
+func (r sqlWallet) AddCoins(ctx context.Context, userID, delta int64, reason string) (int64, error) {
+	var balance int64
+	err := withSQLTx(ctx, r.exec, func(tx sqlExecutor) error {
+		var coins int64
+		err := tx.QueryRowContext(ctx, `SELECT coins FROM players WHERE user_id = $1 FOR UPDATE`, userID).Scan(&coins)
+		if err != nil {
+			return sqlError(err)
 		}
+
+		balance = coins + delta
+		if balance < 0 {
+			return ErrInsufficientCoins
+		}
+		_, err = tx.ExecContext(ctx, `
+            UPDATE players SET coins = $2, version = version + 1, updated_at = CURRENT_TIMESTAMP
+            WHERE user_id = $1
+        `, userID, balance)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO coin_ledger (user_id, delta, balance, reason) VALUES ($1, $2, $3, $4)
+        `, userID, delta, balance, reason)
 		return err
+	})
+	return balance, err
+}
+
+func (r sqlWallet) ListLedger(ctx context.Context, userID int64, limit int) ([]models.CoinLedgerEntry, error) {
+	rows, err := r.exec.QueryContext(ctx, `
+        SELECT id, user_id, delta, balance, reason, created_at
+        FROM coin_ledger WHERE user_id = $1
+        ORDER BY id DESC LIMIT $2
+    `, userID, ledgerLimit(limit))
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return json.Unmarshal(data, result)
+	entries := []models.CoinLedgerEntry{}
+	for rows.Next() {
+		var entry models.CoinLedgerEntry
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Delta, &entry.Balance, &entry.Reason, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
 }
 
-// SaveGameRecord 保存游戏记录
-func (p *PostgreSQL) SaveGameRecord(record interface{}) error {
-	// 根据实际记录结构实现
-	// 这里假设 record 是一个包含房间ID、游戏类型、玩家信息和结果的结构体
-	jsonData, err := json.Marshal(record)
+type sqlInventory struct{ exec sqlExecutor }
+
+func (r sqlInventory) ListItems(ctx context.Context, userID int64) ([]models.InventoryItem, error) {
+	rows, err := r.exec.QueryContext(ctx, `
+        SELECT id, user_id, item_id, quantity, expires_at, created_at
+        FROM inventory_items WHERE user_id = $1
+        ORDER BY expires_at, id
+    `, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return scanInventoryItems(rows)
+}
 
-	// 将记录解析为map以提取字段
-	var recordMap map[string]interface{}
-	if err := json.Unmarshal(jsonData, &recordMap); err != nil {
+func (r sqlInventory) GrantItem(ctx context.Context, item *models.InventoryItem, stack bool, reason string) (*models.ItemLedgerEntry, error) {
+	var entry *models.ItemLedgerEntry
+	err := withSQLTx(ctx, r.exec, func(tx sqlExecutor) error {
+		err := sql.ErrNoRows
+		if stack {
+			err = tx.QueryRowContext(ctx, `
+                UPDATE inventory_items SET quantity = quantity + $4
+                WHERE id = (
+                    SELECT id FROM inventory_items
+                    WHERE user_id = $1 AND item_id = $2 AND expires_at IS NOT DISTINCT FROM $3
+                    ORDER BY id LIMIT 1 FOR UPDATE
+                )
+                RETURNING id, quantity, created_at
+            `, item.UserID, item.ItemID, item.ExpiresAt, item.Quantity).Scan(&item.ID, &item.Quantity, &item.CreatedAt)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			err = tx.QueryRowContext(ctx, `
+                INSERT INTO inventory_items (user_id, item_id, quantity, expires_at)
+                VALUES ($1, $2, $3, $4)
+                RETURNING id, created_at
+            `, item.UserID, item.ItemID, item.Quantity, item.ExpiresAt).Scan(&item.ID, &item.CreatedAt)
+		}
+		if err != nil {
+			return err
+		}
+		entry, err = appendItemLedger(ctx, tx, item.UserID, item.ItemID, item.Quantity, reason)
 		return err
+	})
+	return entry, err
+}
+
+func (r sqlInventory) ConsumeItem(ctx context.Context, userID int64, itemID string, quantity int64, now time.Time, reason string) (*models.ItemLedgerEntry, error) {
+	var entry *models.ItemLedgerEntry
+	err := withSQLTx(ctx, r.exec, func(tx sqlExecutor) error {
+		rows, err := tx.QueryContext(ctx, `
+            SELECT id, user_id, item_id, quantity, expires_at, created_at
+            FROM inventory_items
+            WHERE user_id = $1 AND item_id = $2 AND (expires_at IS NULL OR expires_at > $3)
+            ORDER BY expires_at, id
+            FOR UPDATE
+        `, userID, itemID, now)
+		if err != nil {
+			return err
+		}
+		items, err := scanInventoryItems(rows)
+		if err != nil {
+			return err
+		}
+
+		remaining := quantity
+		for _, item := range items {
+			if remaining == 0 {
+				break
+			}
+			used := min(item.Quantity, remaining)
+			remaining -= used
+			if used == item.Quantity {
+				_, err = tx.ExecContext(ctx, `DELETE FROM inventory_items WHERE id = $1`, item.ID)
+			} else {
+				_, err = tx.ExecContext(ctx, `UPDATE inventory_items SET quantity = quantity - $2 WHERE id = $1`, item.ID, used)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if remaining > 0 {
+			return ErrInsufficientItems
+		}
+
+		entry, err = appendItemLedger(ctx, tx, userID, itemID, -quantity, reason)
+		return err
+	})
+	return entry, err
+}
+
+func (r sqlInventory) ExpireItems(ctx context.Context, now time.Time, limit int) ([]models.ItemLedgerEntry, error) {
+	var entries []models.ItemLedgerEntry
+	err := withSQLTx(ctx, r.exec, func(tx sqlExecutor) error {
+		rows, err := tx.QueryContext(ctx, `
+            DELETE FROM inventory_items
+            WHERE id IN (
+                SELECT id FROM inventory_items
+                WHERE expires_at <= $1
+                ORDER BY id LIMIT $2
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING id, user_id, item_id, quantity, expires_at, created_at
+        `, now, limit)
+		if err != nil {
+			return err
+		}
+		expired, err := scanInventoryItems(rows)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range expired {
+			entry, err := appendItemLedger(ctx, tx, item.UserID, item.ItemID, -item.Quantity, ItemExpiredReason)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, *entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (r sqlInventory) ListItemLedger(ctx context.Context, userID int64, limit int) ([]models.ItemLedgerEntry, error) {
+	rows, err := r.exec.QueryContext(ctx, `
+        SELECT id, user_id, item_id, delta, quantity, reason, created_at
+        FROM item_ledger WHERE user_id = $1
+        ORDER BY id DESC LIMIT $2
+    `, userID, ledgerLimit(limit))
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	entries := []models.ItemLedgerEntry{}
+	for rows.Next() {
+		var entry models.ItemLedgerEntry
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.ItemID, &entry.Delta, &entry.Quantity, &entry.Reason, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
 
-	query := `
-        INSERT INTO game_records (room_id, game_type, players, result) 
-        VALUES ($1, $2, $3, $4)
-    `
+type sqlJackpots struct{ exec sqlExecutor }
 
-	_, err = p.db.ExecContext(ctx, query,
-		recordMap["room_id"],
-		recordMap["game_type"],
-		recordMap["players"],
-		recordMap["result"])
+func (r sqlJackpots) GetJackpot(ctx context.Context, pool string) (int64, error) {
+	var amount int64
+	err := r.exec.QueryRowContext(ctx, `SELECT amount FROM jackpots WHERE pool = $1`, pool).Scan(&amount)
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	return amount, nil
+}
 
-	return err
+func (r sqlJackpots) ContributeJackpot(ctx context.Context, pool string, amount, seed int64) (int64, error) {
+	var total int64
+	err := r.exec.QueryRowContext(ctx, `
+        INSERT INTO jackpots (pool, amount) VALUES ($1, $3 + $2)
+        ON CONFLICT (pool) DO UPDATE SET amount = jackpots.amount + $2, updated_at = CURRENT_TIMESTAMP
+        RETURNING amount
+    `, pool, amount, seed).Scan(&total)
+	return total, err
 }
 
-// SaveRoomState 保存房间状态
-func (p *PostgreSQL) SaveRoomState(roomID, gameType, state string, players interface{}) error {
+func (r sqlJackpots) ClaimJackpot(ctx context.Context, pool string, seed, userID int64, roomID string) (*models.JackpotWin, error) {
+	win := &models.JackpotWin{Pool: pool, UserID: userID, RoomID: roomID}
+	err := withSQLTx(ctx, r.exec, func(tx sqlExecutor) error {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO jackpots (pool, amount) VALUES ($1, $2) ON CONFLICT (pool) DO NOTHING
+        `, pool, seed)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, `SELECT amount FROM jackpots WHERE pool = $1 FOR UPDATE`, pool).Scan(&win.Amount)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+            UPDATE jackpots SET amount = $2, updated_at = CURRENT_TIMESTAMP WHERE pool = $1
+        `, pool, seed)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, `
+            INSERT INTO jackpot_wins (pool, user_id, room_id, amount) VALUES ($1, $2, $3, $4)
+            RETURNING id, created_at
+        `, pool, userID, roomID, win.Amount).Scan(&win.ID, &win.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return win, nil
+}
+
+func (r sqlJackpots) ListJackpotWins(ctx context.Context, pool string, limit int) ([]models.JackpotWin, error) {
+	rows, err := r.exec.QueryContext(ctx, `
+        SELECT id, pool, user_id, room_id, amount, created_at
+        FROM jackpot_wins WHERE pool = $1
+        ORDER BY id DESC LIMIT $2
+    `, pool, ledgerLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wins := []models.JackpotWin{}
+	for rows.Next() {
+		var win models.JackpotWin
+		if err := rows.Scan(&win.ID, &win.Pool, &win.UserID, &win.RoomID, &win.Amount, &win.CreatedAt); err != nil {
+			return nil, err
+		}
+		wins = append(wins, win)
+	}
+	return wins, rows.Err()
+}
+
+// appendItemLedger 写入一条物品流水，数量为变动后玩家持有该物品的总数
+func appendItemLedger(ctx context.Context, tx sqlExecutor, userID int64, itemID string, delta int64, reason string) (*models.ItemLedgerEntry, error) {
+	entry := &models.ItemLedgerEntry{UserID: userID, ItemID: itemID, Delta: delta, Reason: reason}
+	err := tx.QueryRowContext(ctx, `
+        INSERT INTO item_ledger (user_id, item_id, delta, quantity, reason)
+        VALUES ($1, $2, $3,
+            (SELECT COALESCE(SUM(quantity), 0) FROM inventory_items WHERE user_id = $1 AND item_id = $2), $4)
+        RETURNING id, quantity, created_at
+    `, userID, itemID, delta, reason).Scan(&entry.ID, &entry.Quantity, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func scanInventoryItems(rows *sql.Rows) ([]models.InventoryItem, error) {
+	defer rows.Close()
+	items := []models.InventoryItem{}
+	for rows.Next() {
+		var item models.InventoryItem
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&item.ID, &item.UserID, &item.ItemID, &item.Quantity, &expiresAt, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			item.ExpiresAt = &expiresAt.Time
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+type sqlGameRecords struct{ exec sqlExecutor }
+
+// SaveGameRecord 保存游戏记录
+func (r sqlGameRecords) SaveGameRecord(ctx context.Context, record *models.GameRecord) error {
+	players, err := recordPlayers(record)
+	if err != nil {
+		return err
+	}
+	result, err := recordResult(record)
+	if err != nil {
+		return err
+	}
 	playersJSON, err := json.Marshal(players)
 	if err != nil {
 		return err
 	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// 记录和玩家索引在同一个事务中写入
+	return withSQLTx(ctx, r.exec, func(tx sqlExecutor) error {
+		// 同一局已保存过时不插入，RETURNING 没有结果
+		query := `
+            INSERT INTO game_records (round_id, room_id, game_type, players, result, start_time, end_time, duration, created_at)
+            VALUES (NULLIF($1, ''), $2, $3, $4, $5, $6, $7, $8, $9)
+            ON CONFLICT (round_id) DO NOTHING
+            RETURNING id
+        `
+
+		var recordID int64
+		err := tx.QueryRowContext(ctx, query,
+			record.RoundID,
+			record.RoomID,
+			record.GameType,
+			playersJSON,
+			resultJSON,
+			record.StartTime,
+			record.EndTime,
+			record.Duration,
+			record.CreatedAt).Scan(&recordID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDuplicateRecord
+		}
+		if err != nil {
+			return err
+		}
+		record.ID = recordID
+		return insertRecordPlayers(ctx, tx, recordID, record)
+	})
+}
+
+// insertRecordPlayers 写入游戏记录的玩家索引
+func insertRecordPlayers(ctx context.Context, tx sqlExecutor, recordID int64, record *models.GameRecord) error {
+	for _, info := range indexedPlayers(record) {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO game_record_players (record_id, user_id, game_type, outcome, bet, payout, end_time)
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+        `, recordID, info.UserID, record.GameType, info.Outcome, info.Bet, info.Payout, record.EndTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r sqlGameRecords) ListGameTypes(ctx context.Context) ([]string, error) {
+	rows, err := r.exec.QueryContext(ctx, `SELECT DISTINCT game_type FROM game_records ORDER BY game_type`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gameTypes []string
+	for rows.Next() {
+		var gameType string
+		if err := rows.Scan(&gameType); err != nil {
+			return nil, err
+		}
+		gameTypes = append(gameTypes, gameType)
+	}
+	return gameTypes, rows.Err()
+}
+
+func (r sqlGameRecords) ListGameRecordsBefore(ctx context.Context, gameType string, before time.Time, limit int) ([]*models.GameRecord, error) {
+	rows, err := r.exec.QueryContext(ctx, `
+        SELECT id, COALESCE(round_id, ''), room_id, game_type, players, result,
+               COALESCE(start_time, created_at), COALESCE(end_time, created_at), COALESCE(duration, 0), created_at
+        FROM game_records
+        WHERE game_type = $1 AND created_at < $2
+        ORDER BY id
+        LIMIT $3
+    `, gameType, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*models.GameRecord
+	for rows.Next() {
+		record := &models.GameRecord{}
+		var players, result []byte
+		if err := rows.Scan(&record.ID, &record.RoundID, &record.RoomID, &record.GameType, &players, &result,
+			&record.StartTime, &record.EndTime, &record.Duration, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		var byKey map[string]interface{}
+		if err := scanJSON(players, &byKey); err != nil {
+			return nil, err
+		}
+		if record.Players, err = playersFromColumn(byKey); err != nil {
+			return nil, err
+		}
+		if err := scanJSON(result, &record.Result); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (r sqlGameRecords) DeleteGameRecords(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return withSQLTx(ctx, r.exec, func(tx sqlExecutor) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM game_record_players WHERE record_id = ANY($1)`, pq.Array(ids)); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM game_records WHERE id = ANY($1)`, pq.Array(ids))
+		return err
+	})
+}
+
+func (r sqlGameRecords) RestoreGameRecord(ctx context.Context, record *models.GameRecord) (bool, error) {
+	players, err := recordPlayers(record)
+	if err != nil {
+		return false, err
+	}
+	result, err := recordResult(record)
+	if err != nil {
+		return false, err
+	}
+	playersJSON, err := json.Marshal(players)
+	if err != nil {
+		return false, err
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return false, err
+	}
+
+	restored := false
+	err = withSQLTx(ctx, r.exec, func(tx sqlExecutor) error {
+		res, err := tx.ExecContext(ctx, `
+            INSERT INTO game_records (id, round_id, room_id, game_type, players, result, start_time, end_time, duration, created_at)
+            VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9, $10)
+            ON CONFLICT DO NOTHING
+        `, record.ID, record.RoundID, record.RoomID, record.GameType, playersJSON, resultJSON,
+			record.StartTime, record.EndTime, record.Duration, record.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if inserted, err := res.RowsAffected(); err != nil || inserted == 0 {
+			return err
+		}
+		restored = true
+
+		// 推进序列，避免之后新插入的记录与写回的 ID 冲突
+		if _, err := tx.ExecContext(ctx, `
+            SELECT setval(pg_get_serial_sequence('game_records', 'id'), $1)
+            WHERE $1 > COALESCE(pg_sequence_last_value(pg_get_serial_sequence('game_records', 'id')::regclass), 0)
+        `, record.ID); err != nil {
+			return err
+		}
+		return insertRecordPlayers(ctx, tx, record.ID, record)
+	})
+	return restored, err
+}
+
+// QueryGameHistory 按玩家索引查询历史对局，按结束时间从新到旧分页
+func (r sqlGameRecords) QueryGameHistory(ctx context.Context, query *models.GameHistoryQuery) (*models.GameHistoryPage, error) {
+	cursor, err := decodeHistoryCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	limit := historyLimit(query.Limit)
+
+	var where []string
+	var args []interface{}
+	addCondition := func(condition string, values ...interface{}) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		where = append(where, condition)
+	}
+	addCondition("p.user_id = ?", query.UserID)
+	if query.GameType != "" {
+		addCondition("p.game_type = ?", query.GameType)
+	}
+	if !query.From.IsZero() {
+		addCondition("p.end_time >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		addCondition("p.end_time < ?", query.To)
+	}
+	if cursor != nil {
+		addCondition("(p.end_time, p.record_id) < (?, ?)", cursor.EndTime, cursor.RecordID)
+	}
+	args = append(args, limit+1)
+
+	rows, err := r.exec.QueryContext(ctx, `
+        SELECT p.record_id, r.room_id, p.game_type, p.outcome, p.bet, p.payout, r.result,
+               COALESCE(r.start_time, r.created_at), p.end_time, COALESCE(r.duration, 0)
+        FROM game_record_players p
+        JOIN game_records r ON r.id = p.record_id
+        WHERE `+strings.Join(where, " AND ")+`
+        ORDER BY p.end_time DESC, p.record_id DESC
+        LIMIT `+fmt.Sprintf("$%d", len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.GameHistoryEntry
+	for rows.Next() {
+		var entry models.GameHistoryEntry
+		var result []byte
+		if err := rows.Scan(&entry.RecordID, &entry.RoomID, &entry.GameType, &entry.Outcome,
+			&entry.Bet, &entry.Payout, &result, &entry.StartTime, &entry.EndTime, &entry.Duration); err != nil {
+			return nil, err
+		}
+		if err := scanJSON(result, &entry.Result); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return historyPage(entries, limit), nil
+}
+
+type sqlRooms struct{ exec sqlExecutor }
+
+// SaveRoomState 保存房间状态，已存在时覆盖
+func (r sqlRooms) SaveRoomState(ctx context.Context, state *models.RoomState) error {
+	playersJSON, err := json.Marshal(state.Players)
+	if err != nil {
+		return err
+	}
+	var snapshot interface{}
+	if len(state.Snapshot) > 0 {
+		snapshot = []byte(state.Snapshot)
+	}
 
 	query := `
-        INSERT INTO rooms (room_id, game_type, state, players) 
-        VALUES ($1, $2, $3, $4)
-        ON CONFLICT (room_id) 
-        DO UPDATE SET state = $3, players = $4, updated_at = CURRENT_TIMESTAMP
+        INSERT INTO rooms (room_id, game_type, state, players, snapshot)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (room_id)
+        DO UPDATE SET state = $3, players = $4, snapshot = $5, updated_at = CURRENT_TIMESTAMP
     `
 
-	_, err = p.db.ExecContext(ctx, query, roomID, gameType, state, playersJSON)
+	_, err = r.exec.ExecContext(ctx, query, state.RoomID, state.GameType, state.State, playersJSON, snapshot)
 	return err
 }
 
 // LoadRoomState 加载房间状态
-func (p *PostgreSQL) LoadRoomState(roomID string, result interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (r sqlRooms) LoadRoomState(ctx context.Context, roomID string) (*models.RoomState, error) {
+	state := &models.RoomState{}
+	var players, snapshot []byte
+	err := r.exec.QueryRowContext(ctx, `
+        SELECT room_id, game_type, state, players, snapshot, created_at, updated_at
+        FROM rooms WHERE room_id = $1
+    `, roomID).Scan(&state.RoomID, &state.GameType, &state.State, &players, &snapshot, &state.CreatedAt, &state.UpdatedAt)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	if err := scanJSON(players, &state.Players); err != nil {
+		return nil, err
+	}
+	state.Snapshot = snapshot
+	return state, nil
+}
 
-	var data []byte
-	query := `SELECT players FROM rooms WHERE room_id = $1`
-	err := p.db.QueryRowContext(ctx, query, roomID).Scan(&data)
+// ListRoomIDs 列出所有保存了状态的房间
+func (r sqlRooms) ListRoomIDs(ctx context.Context) ([]string, error) {
+	rows, err := r.exec.QueryContext(ctx, `SELECT room_id FROM rooms ORDER BY updated_at`)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return ErrRecordNotFound
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roomIDs []string
+	for rows.Next() {
+		var roomID string
+		if err := rows.Scan(&roomID); err != nil {
+			return nil, err
 		}
+		roomIDs = append(roomIDs, roomID)
+	}
+	return roomIDs, rows.Err()
+}
+
+// DeleteRoomState 删除房间状态
+func (r sqlRooms) DeleteRoomState(ctx context.Context, roomID string) error {
+	_, err := r.exec.ExecContext(ctx, `DELETE FROM rooms WHERE room_id = $1`, roomID)
+	return err
+}
+
+type sqlConfigs struct{ exec sqlExecutor }
+
+func (r sqlConfigs) GetGameConfig(ctx context.Context, gameType string) (*models.GameConfig, error) {
+	config := &models.GameConfig{}
+	var data []byte
+	err := r.exec.QueryRowContext(ctx, `
+        SELECT game_type, config, enabled, updated_at FROM game_configs WHERE game_type = $1
+    `, gameType).Scan(&config.GameType, &data, &config.Enabled, &config.UpdatedAt)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	if err := scanJSON(data, &config.Config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (r sqlConfigs) SaveGameConfig(ctx context.Context, config *models.GameConfig) error {
+	values := config.Config
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(data, result)
+	_, err = r.exec.ExecContext(ctx, `
+        INSERT INTO game_configs (game_type, config, enabled)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (game_type)
+        DO UPDATE SET config = $2, enabled = $3, updated_at = CURRENT_TIMESTAMP
+    `, config.GameType, data, config.Enabled)
+	return err
 }
 
-// Close 关闭数据库连接
-func (p *PostgreSQL) Close() error {
-	return p.db.Close()
+func (r sqlConfigs) ListGameConfigs(ctx context.Context) ([]*models.GameConfig, error) {
+	rows, err := r.exec.QueryContext(ctx, `
+        SELECT game_type, config, enabled, updated_at FROM game_configs ORDER BY game_type
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs []*models.GameConfig
+	for rows.Next() {
+		config := &models.GameConfig{}
+		var data []byte
+		if err := rows.Scan(&config.GameType, &data, &config.Enabled, &config.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := scanJSON(data, &config.Config); err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, rows.Err()
+}
+
+type sqlOutbox struct{ exec sqlExecutor }
+
+func (r sqlOutbox) AppendEvent(ctx context.Context, event *models.OutboxEvent) error {
+	return r.exec.QueryRowContext(ctx, `
+        INSERT INTO outbox_events (event_type, event_key, payload)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at
+    `, event.Type, event.Key, []byte(event.Payload)).Scan(&event.ID, &event.CreatedAt)
+}
+
+// ClaimEvents 使用 SKIP LOCKED，多个节点同时领取时不会拿到同一个事件
+func (r sqlOutbox) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	rows, err := r.exec.QueryContext(ctx, `
+        UPDATE outbox_events
+        SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+        WHERE id IN (
+            SELECT id FROM outbox_events
+            WHERE NOT dead AND next_attempt_at <= CURRENT_TIMESTAMP
+            ORDER BY id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, event_type, event_key, payload, attempts, last_error, created_at
+    `, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanOutboxEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r sqlOutbox) DeleteEvent(ctx context.Context, id int64) error {
+	_, err := r.exec.ExecContext(ctx, `DELETE FROM outbox_events WHERE id = $1`, id)
+	return err
+}
+
+func (r sqlOutbox) RetryEvent(ctx context.Context, id int64, delay time.Duration, lastError string) error {
+	_, err := r.exec.ExecContext(ctx, `
+        UPDATE outbox_events
+        SET attempts = attempts + 1, last_error = $2,
+            next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+        WHERE id = $1
+    `, id, lastError, delay.Seconds())
+	return err
+}
+
+func (r sqlOutbox) DeadLetterEvent(ctx context.Context, id int64, lastError string) error {
+	_, err := r.exec.ExecContext(ctx, `
+        UPDATE outbox_events SET attempts = attempts + 1, last_error = $2, dead = TRUE WHERE id = $1
+    `, id, lastError)
+	return err
+}
+
+func (r sqlOutbox) ListDeadLetters(ctx context.Context, limit int) ([]models.OutboxEvent, error) {
+	rows, err := r.exec.QueryContext(ctx, `
+        SELECT id, event_type, event_key, payload, attempts, last_error, created_at
+        FROM outbox_events WHERE dead
+        ORDER BY id DESC LIMIT $1
+    `, deadLetterLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEvents(rows)
+}
+
+// scanOutboxEvents 读取发件箱查询的结果并关闭 rows
+func scanOutboxEvents(rows *sql.Rows) ([]models.OutboxEvent, error) {
+	defer rows.Close()
+
+	events := []models.OutboxEvent{}
+	for rows.Next() {
+		var event models.OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.Type, &event.Key, &payload,
+			&event.Attempts, &event.LastError, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	return events, rows.Err()
 }
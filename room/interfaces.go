@@ -1,7 +1,25 @@
 package room
 
+import "github.com/wfunc/gameserver/models"
+
 // Broadcaster defines the interface for broadcasting messages to a room.
 // This is defined here to break the import cycle between room and broadcast.
 type Broadcaster interface {
 	BroadcastToRoom(roomID string, msgID uint16, data []byte) error
 }
+
+// Metrics receives measurements from the room loop.
+// monitor.Monitor implements it; a nil Metrics disables collection.
+type Metrics interface {
+	ObserveMailboxDepth(depth int)
+	IncMailboxFull()
+	IncTickOverrun()
+	ObserveWager(gameType string, bet, payout int64)
+}
+
+// GameRecorder persists the record of a finished round. Implementations must not
+// block the room loop; services.GameRecordService queues records and saves them
+// asynchronously.
+type GameRecorder interface {
+	RecordGame(record *models.GameRecord)
+}
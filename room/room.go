@@ -2,9 +2,13 @@
 package room
 
 import (
+	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/network"
 	"github.com/wfunc/gameserver/session"
 	"github.com/wfunc/gameserver/state"
 )
@@ -19,6 +23,29 @@ const (
 	StatusSettlement
 )
 
+// 房间操作相关错误
+var (
+	ErrRoomFull       = errors.New("room is full")
+	ErrRoomLocked     = errors.New("room is locked")
+	ErrPlayerKicked   = errors.New("player was kicked from this room")
+	ErrNotHost        = errors.New("only the host can do this")
+	ErrPlayerNotFound = errors.New("player not in room")
+	ErrNotWaiting     = errors.New("room is not waiting for players")
+	ErrInvalidSetting = errors.New("invalid room setting")
+	ErrSeatTaken      = errors.New("seat is taken")
+	ErrMailboxFull    = errors.New("room is busy, try again later")
+	ErrRoomClosed     = errors.New("room is closed")
+)
+
+// mailboxSize 每个房间待处理消息的上限，超出后新消息被拒绝
+const mailboxSize = 256
+
+// RoomSettings 房主在等待阶段可以修改的房间设置，零值字段表示不修改
+type RoomSettings struct {
+	Name       string `json:"name,omitempty"`
+	MaxPlayers int    `json:"max_players,omitempty"`
+}
+
 // Room 是游戏房间的核心结构
 type Room struct {
 	ID           string
@@ -27,28 +54,69 @@ type Room struct {
 	MaxPlayers   int
 	Status       RoomStatus
 	Players      map[string]*session.Session // sessionID -> session
+	HostID       string                      // 房主的 sessionID
+	Locked       bool                        // 锁定后不允许新玩家加入
+	Seats        []string                    // 座位号 -> sessionID，空字符串表示空位
 	StateMachine state.StateMachine
 	CreatedAt    time.Time
-	GameData     interface{} // 游戏特定数据
-	broadcaster  Broadcaster // Use the interface, not the concrete type
+	GameData     interface{}              // 游戏特定数据
+	broadcaster  Broadcaster              // Use the interface, not the concrete type
+	joinOrder    []string                 // 按加入顺序排列的 sessionID，用于房主转移
+	kickedIDs    map[string]bool          // 被踢出的 sessionID
+	kickedUsers  map[int64]bool           // 被踢出的 UserID，防止换连接重新加入
+	config       state.GameConfig         // 游戏节奏参数和开局规则
+	reserved     map[int64]MemberSnapshot // 从快照恢复、尚未重连的成员，按 UserID 保留座位
 	statusMutex  sync.RWMutex
 	playerMutex  sync.RWMutex
+	deps         roomDeps
+	snapshots    snapshotter
 	ticker       *time.Ticker
+	mailbox      chan func()
 	closeChan    chan bool
 }
 
+// roomDeps 房间使用的外部服务，由 Manager 注入，为 nil 的服务表示不启用
+type roomDeps struct {
+	metrics  Metrics
+	store    SnapshotStore
+	recorder GameRecorder
+	economy  state.Economy
+	jackpot  state.Jackpot
+	seeds    func(roomID string) string
+}
+
 // NewRoom 创建一个新房间
 func NewRoom(id, name, gameType string, maxPlayers int, broadcaster Broadcaster) *Room {
+	return newRoom(id, name, gameType, maxPlayers, broadcaster, roomDeps{})
+}
+
+// newRoom 创建并启动房间
+func newRoom(id, name, gameType string, maxPlayers int, broadcaster Broadcaster, deps roomDeps) *Room {
+	room := buildRoom(id, name, gameType, maxPlayers, broadcaster, deps)
+	room.start()
+	return room
+}
+
+// buildRoom 创建处于等待状态的房间，但不启动主循环
+func buildRoom(id, name, gameType string, maxPlayers int, broadcaster Broadcaster, deps roomDeps) *Room {
 	room := &Room{
-		ID:           id,
-		Name:         name,
-		GameType:     gameType,
-		MaxPlayers:   maxPlayers,
-		Status:       StatusIdle,
-		Players:      make(map[string]*session.Session),
-		CreatedAt:    time.Now(),
-		closeChan:    make(chan bool),
-		broadcaster:  broadcaster,
+		ID:          id,
+		Name:        name,
+		GameType:    gameType,
+		MaxPlayers:  maxPlayers,
+		Status:      StatusIdle,
+		Players:     make(map[string]*session.Session),
+		kickedIDs:   make(map[string]bool),
+		Seats:       make([]string, maxPlayers),
+		kickedUsers: make(map[int64]bool),
+		reserved:    make(map[int64]MemberSnapshot),
+		config:      state.GetGameConfig(gameType),
+		CreatedAt:   time.Now(),
+		mailbox:     make(chan func(), mailboxSize),
+		closeChan:   make(chan bool),
+		broadcaster: broadcaster,
+		deps:        deps,
+		snapshots:   snapshotter{store: deps.store},
 	}
 
 	// 初始化状态机，将房间自身(room)作为上下文传入
@@ -56,13 +124,15 @@ func NewRoom(id, name, gameType string, maxPlayers int, broadcaster Broadcaster)
 	room.StateMachine = state.NewBaseStateMachine(initialState)
 	room.SetStatus(StatusWaiting)
 
-	// 启动房间心跳
-	room.ticker = time.NewTicker(100 * time.Millisecond) // 10 FPS
-	go room.loop()
-
 	return room
 }
 
+// start 启动房间心跳和主循环
+func (r *Room) start() {
+	r.ticker = time.NewTicker(r.GetGameConfig().TickInterval)
+	go r.loop()
+}
+
 // --- 实现 state.RoomContext 接口 ---
 
 // GetID 返回房间ID
@@ -77,6 +147,8 @@ func (r *Room) GetGameType() string {
 
 // GetMaxPlayers returns the maximum number of players in the room.
 func (r *Room) GetMaxPlayers() int {
+	r.playerMutex.RLock()
+	defer r.playerMutex.RUnlock()
 	return r.MaxPlayers
 }
 
@@ -93,9 +165,68 @@ func (r *Room) GetPlayers() map[string]state.Player {
 	return players
 }
 
-// ChangeState 改变房间的状态机状态
+// GetGameConfig 返回房间的游戏节奏参数
+func (r *Room) GetGameConfig() state.GameConfig {
+	r.statusMutex.RLock()
+	defer r.statusMutex.RUnlock()
+	return r.config
+}
+
+// RecordGame 将一局的游戏记录交给记录器保存，未设置记录器时丢弃
+func (r *Room) RecordGame(record *models.GameRecord) {
+	if r.deps.recorder != nil {
+		r.deps.recorder.RecordGame(record)
+	}
+}
+
+// Economy 返回结算金币和物品的经济系统，未设置时为 nil
+func (r *Room) Economy() state.Economy {
+	return r.deps.economy
+}
+
+// Jackpot 返回多个房间共享的累积奖池，未设置时为 nil
+func (r *Room) Jackpot() state.Jackpot {
+	return r.deps.jackpot
+}
+
+// ObserveWager 将游戏内的一次下注和派奖计入房间指标
+func (r *Room) ObserveWager(bet, payout int64) {
+	if r.deps.metrics != nil {
+		r.deps.metrics.ObserveWager(r.GameType, bet, payout)
+	}
+}
+
+// RoundSeed 返回下一局的种子，未设置种子来源时返回空字符串，由 GamingState 随机生成
+func (r *Room) RoundSeed() string {
+	if r.deps.seeds == nil {
+		return ""
+	}
+	return r.deps.seeds(r.ID)
+}
+
+// SetStartRule 设置开局规则，下一次进入等待状态时生效
+func (r *Room) SetStartRule(rule state.StartRule) {
+	r.statusMutex.Lock()
+	defer r.statusMutex.Unlock()
+	r.config.StartRule = rule
+}
+
+// ChangeState 改变房间的状态机状态，并同步房间的业务状态
 func (r *Room) ChangeState(newState state.State) error {
-	return r.StateMachine.ChangeState(newState)
+	if err := r.StateMachine.ChangeState(newState); err != nil {
+		return err
+	}
+
+	switch newState.GetID() {
+	case "waiting":
+		r.SetStatus(StatusWaiting)
+	case "gaming", "lockstep":
+		r.SetStatus(StatusGaming)
+	case "settlement":
+		r.SetStatus(StatusSettlement)
+	}
+	r.saveSnapshot()
+	return nil
 }
 
 // Broadcast sends a message to all players in the room.
@@ -103,31 +234,440 @@ func (r *Room) Broadcast(msgID uint16, data []byte) error {
 	return r.broadcaster.BroadcastToRoom(r.ID, msgID, data)
 }
 
+// SendToPlayer 只向房间内的一个玩家发送消息
+func (r *Room) SendToPlayer(playerID string, msgID uint16, data []byte) error {
+	player, exists := r.GetPlayer(playerID)
+	if !exists {
+		return ErrPlayerNotFound
+	}
+	return player.Send(msgID, data)
+}
+
 // --- 房间核心逻辑 ---
 
 // AddPlayer 添加一个玩家到房间
 func (r *Room) AddPlayer(s *session.Session) bool {
+	return r.Join(s) == nil
+}
+
+// Join 添加一个玩家到房间并分配编号最小的空座位，失败时返回具体原因。
+// 空房间的第一个玩家（即创建者）成为房主。
+func (r *Room) Join(s *session.Session) error {
+	return r.exec(func() error { return r.join(s) })
+}
+
+func (r *Room) join(s *session.Session) error {
 	r.playerMutex.Lock()
-	defer r.playerMutex.Unlock()
+	if err := r.canJoin(s); err != nil {
+		r.playerMutex.Unlock()
+		return err
+	}
 
-	if len(r.Players) >= r.MaxPlayers {
-		return false
+	userID := s.GetUserID()
+	member, rejoining := r.reserved[userID]
+	if userID == 0 {
+		rejoining = false
 	}
+	delete(r.reserved, userID)
 
 	r.Players[s.ID] = s
+	r.joinOrder = append(r.joinOrder, s.ID)
+	if rejoining && member.Seat >= 0 && member.Seat < len(r.Seats) && r.Seats[member.Seat] == "" {
+		r.Seats[member.Seat] = s.ID
+	} else {
+		for seat, id := range r.Seats {
+			if id == "" && !r.isSeatReserved(seat) {
+				r.Seats[seat] = s.ID
+				break
+			}
+		}
+	}
 	s.RoomID = r.ID
-	return true
+
+	// 恢复的房主重连后重新获得房主身份
+	hostChanged := rejoining && member.Host && r.HostID != "" && r.HostID != s.ID
+	if r.HostID == "" || (rejoining && member.Host) {
+		r.HostID = s.ID
+	}
+	r.playerMutex.Unlock()
+
+	r.notifyPlayerListener(s, true)
+	if hostChanged {
+		r.notifyHostChanged(s.ID)
+	}
+	r.notifyRoomState()
+	r.saveSnapshot()
+	return nil
+}
+
+// canJoin 检查玩家能否加入，调用方需持有 playerMutex
+func (r *Room) canJoin(s *session.Session) error {
+	userID := s.GetUserID()
+	if r.kickedIDs[s.ID] || (userID != 0 && r.kickedUsers[userID]) {
+		return ErrPlayerKicked
+	}
+	// 重连的成员不受锁定和保留座位限制
+	if _, rejoining := r.reserved[userID]; rejoining && userID != 0 {
+		return nil
+	}
+	if r.Locked {
+		return ErrRoomLocked
+	}
+	if len(r.Players)+len(r.reserved) >= r.MaxPlayers {
+		return ErrRoomFull
+	}
+	return nil
+}
+
+// isSeatReserved 判断座位是否为尚未重连的成员保留，调用方需持有 playerMutex
+func (r *Room) isSeatReserved(seat int) bool {
+	for _, member := range r.reserved {
+		if member.Seat == seat {
+			return true
+		}
+	}
+	return false
 }
 
-// RemovePlayer 从房间移除一个玩家
+// RemovePlayer 从房间移除一个玩家，房主离开时自动转移给最早加入的玩家
 func (r *Room) RemovePlayer(sessionID string) {
+	r.exec(func() error {
+		r.removePlayer(sessionID)
+		return nil
+	})
+}
+
+func (r *Room) removePlayer(sessionID string) {
+	r.playerMutex.Lock()
+	player, exists := r.Players[sessionID]
+	if !exists {
+		r.playerMutex.Unlock()
+		return
+	}
+
+	player.RoomID = ""
+	delete(r.Players, sessionID)
+	for i, id := range r.joinOrder {
+		if id == sessionID {
+			r.joinOrder = append(r.joinOrder[:i], r.joinOrder[i+1:]...)
+			break
+		}
+	}
+	for seat, id := range r.Seats {
+		if id == sessionID {
+			r.Seats[seat] = ""
+		}
+	}
+
+	hostChanged := false
+	if r.HostID == sessionID {
+		r.HostID = ""
+		if len(r.joinOrder) > 0 {
+			r.HostID = r.joinOrder[0]
+		}
+		hostChanged = r.HostID != ""
+	}
+	newHost := r.HostID
+	r.playerMutex.Unlock()
+
+	// 回调和广播需要再次获取 playerMutex，必须在解锁后进行
+	r.notifyPlayerListener(player, false)
+	if hostChanged {
+		r.notifyHostChanged(newHost)
+	}
+	r.notifyRoomState()
+	r.saveSnapshot()
+}
+
+// GetSeat 返回玩家的座位号，不在座位上时返回 -1
+func (r *Room) GetSeat(sessionID string) int {
+	r.playerMutex.RLock()
+	defer r.playerMutex.RUnlock()
+
+	for seat, id := range r.Seats {
+		if id == sessionID {
+			return seat
+		}
+	}
+	return -1
+}
+
+// ChangeSeat 玩家在等待阶段换到一个空座位
+func (r *Room) ChangeSeat(sessionID string, seat int) error {
+	return r.exec(func() error { return r.changeSeat(sessionID, seat) })
+}
+
+func (r *Room) changeSeat(sessionID string, seat int) error {
+	if r.GetStatus() != StatusWaiting {
+		return ErrNotWaiting
+	}
+
 	r.playerMutex.Lock()
-	defer r.playerMutex.Unlock()
+	if _, exists := r.Players[sessionID]; !exists {
+		r.playerMutex.Unlock()
+		return ErrPlayerNotFound
+	}
+	if seat < 0 || seat >= len(r.Seats) {
+		r.playerMutex.Unlock()
+		return ErrInvalidSetting
+	}
+	if r.Seats[seat] == sessionID {
+		r.playerMutex.Unlock()
+		return nil
+	}
+	if r.Seats[seat] != "" || r.isSeatReserved(seat) {
+		r.playerMutex.Unlock()
+		return ErrSeatTaken
+	}
+
+	for i, id := range r.Seats {
+		if id == sessionID {
+			r.Seats[i] = ""
+		}
+	}
+	r.Seats[seat] = sessionID
+	r.playerMutex.Unlock()
+
+	r.notifyRoomState()
+	r.saveSnapshot()
+	return nil
+}
+
+// SetReady 玩家在等待阶段准备或取消准备
+func (r *Room) SetReady(sessionID string, ready bool) error {
+	return r.exec(func() error { return r.setReady(sessionID, ready) })
+}
+
+func (r *Room) setReady(sessionID string, ready bool) error {
+	player, exists := r.GetPlayer(sessionID)
+	if !exists {
+		return ErrPlayerNotFound
+	}
 
-	if player, exists := r.Players[sessionID]; exists {
-		player.RoomID = ""
-		delete(r.Players, sessionID)
+	waitingState, ok := r.StateMachine.GetCurrentState().(*state.WaitingState)
+	if !ok {
+		return ErrNotWaiting
 	}
+	waitingState.SetReady(player, ready)
+	return nil
+}
+
+// GetHostID 返回房主的 sessionID
+func (r *Room) GetHostID() string {
+	r.playerMutex.RLock()
+	defer r.playerMutex.RUnlock()
+	return r.HostID
+}
+
+// IsHost 判断指定 session 是否为房主
+func (r *Room) IsHost(sessionID string) bool {
+	return sessionID != "" && r.GetHostID() == sessionID
+}
+
+// PlayerCount 返回房间当前人数
+func (r *Room) PlayerCount() int {
+	r.playerMutex.RLock()
+	defer r.playerMutex.RUnlock()
+	return len(r.Players)
+}
+
+// IsLocked 返回房间是否已锁定
+func (r *Room) IsLocked() bool {
+	r.playerMutex.RLock()
+	defer r.playerMutex.RUnlock()
+	return r.Locked
+}
+
+// --- 房主权限 ---
+
+// KickPlayer 房主将玩家踢出房间，被踢玩家之后不能再加入该房间
+func (r *Room) KickPlayer(hostID, targetID string) (*session.Session, error) {
+	var target *session.Session
+	err := r.exec(func() (err error) {
+		target, err = r.kickPlayer(hostID, targetID)
+		return err
+	})
+	return target, err
+}
+
+func (r *Room) kickPlayer(hostID, targetID string) (*session.Session, error) {
+	if !r.IsHost(hostID) {
+		return nil, ErrNotHost
+	}
+	if hostID == targetID {
+		return nil, ErrInvalidSetting
+	}
+
+	r.playerMutex.Lock()
+	target, exists := r.Players[targetID]
+	if !exists {
+		r.playerMutex.Unlock()
+		return nil, ErrPlayerNotFound
+	}
+	r.kickedIDs[targetID] = true
+	if userID := target.GetUserID(); userID != 0 {
+		r.kickedUsers[userID] = true
+	}
+	r.playerMutex.Unlock()
+
+	r.removePlayer(targetID)
+	return target, nil
+}
+
+// Authenticate 在房间协程中绑定房间内玩家登录的用户ID。
+// 该用户曾被踢出本房间时将玩家移出房间并返回 ErrPlayerKicked，避免匿名加入后再登录回到房间
+func (r *Room) Authenticate(s *session.Session, userID int64) error {
+	return r.exec(func() error { return r.authenticate(s, userID) })
+}
+
+func (r *Room) authenticate(s *session.Session, userID int64) error {
+	r.playerMutex.Lock()
+	_, inRoom := r.Players[s.ID]
+	kicked := inRoom && userID != 0 && r.kickedUsers[userID]
+	if kicked {
+		r.kickedIDs[s.ID] = true
+	}
+	r.playerMutex.Unlock()
+
+	if kicked {
+		r.removePlayer(s.ID)
+	}
+	s.SetUserID(userID)
+	if kicked {
+		return ErrPlayerKicked
+	}
+	return nil
+}
+
+// SetLocked 房主锁定或解锁房间
+func (r *Room) SetLocked(hostID string, locked bool) error {
+	return r.exec(func() error { return r.setLocked(hostID, locked) })
+}
+
+func (r *Room) setLocked(hostID string, locked bool) error {
+	if !r.IsHost(hostID) {
+		return ErrNotHost
+	}
+
+	r.playerMutex.Lock()
+	r.Locked = locked
+	r.playerMutex.Unlock()
+
+	r.saveSnapshot()
+	return nil
+}
+
+// UpdateSettings 房主在等待阶段修改房间设置
+func (r *Room) UpdateSettings(hostID string, settings RoomSettings) error {
+	return r.exec(func() error { return r.updateSettings(hostID, settings) })
+}
+
+func (r *Room) updateSettings(hostID string, settings RoomSettings) error {
+	if !r.IsHost(hostID) {
+		return ErrNotHost
+	}
+	if r.GetStatus() != StatusWaiting {
+		return ErrNotWaiting
+	}
+
+	r.playerMutex.Lock()
+	if settings.MaxPlayers < 0 || (settings.MaxPlayers > 0 && settings.MaxPlayers < len(r.Players)) {
+		r.playerMutex.Unlock()
+		return ErrInvalidSetting
+	}
+	if settings.Name != "" {
+		r.Name = settings.Name
+	}
+	if settings.MaxPlayers > 0 {
+		r.MaxPlayers = settings.MaxPlayers
+		r.resizeSeats(settings.MaxPlayers)
+	}
+	r.playerMutex.Unlock()
+
+	r.saveSnapshot()
+	return nil
+}
+
+// resizeSeats 调整座位数量，缩小时把超出范围的玩家移到空座位上，调用方需持有 playerMutex
+func (r *Room) resizeSeats(size int) {
+	seats := make([]string, size)
+	var displaced []string
+	for seat, id := range r.Seats {
+		if id == "" {
+			continue
+		}
+		if seat < size {
+			seats[seat] = id
+		} else {
+			displaced = append(displaced, id)
+		}
+	}
+	for seat := range seats {
+		if len(displaced) == 0 {
+			break
+		}
+		if seats[seat] == "" {
+			seats[seat] = displaced[0]
+			displaced = displaced[1:]
+		}
+	}
+	r.Seats = seats
+}
+
+// StartGame 房主跳过等待，提前开始游戏
+func (r *Room) StartGame(hostID string) error {
+	return r.exec(func() error { return r.startGame(hostID) })
+}
+
+func (r *Room) startGame(hostID string) error {
+	if !r.IsHost(hostID) {
+		return ErrNotHost
+	}
+
+	waitingState, ok := r.StateMachine.GetCurrentState().(*state.WaitingState)
+	if !ok {
+		return ErrNotWaiting
+	}
+	return waitingState.StartGame()
+}
+
+// notifyPlayerListener 通知当前状态玩家进出房间
+func (r *Room) notifyPlayerListener(player state.Player, joined bool) {
+	listener, ok := r.StateMachine.GetCurrentState().(state.PlayerListener)
+	if !ok {
+		return
+	}
+	if joined {
+		listener.OnPlayerJoin(player)
+	} else {
+		listener.OnPlayerLeave(player)
+	}
+}
+
+// notifyRoomState 广播房间信息和座位表
+func (r *Room) notifyRoomState() {
+	r.playerMutex.RLock()
+	data, err := json.Marshal(map[string]interface{}{
+		"room_id":     r.ID,
+		"name":        r.Name,
+		"host_id":     r.HostID,
+		"max_players": r.MaxPlayers,
+		"locked":      r.Locked,
+		"seats":       r.Seats,
+	})
+	r.playerMutex.RUnlock()
+	if err != nil {
+		return
+	}
+	r.Broadcast(network.MsgTypeRoomState, data)
+}
+
+func (r *Room) notifyHostChanged(hostID string) {
+	data, err := json.Marshal(map[string]string{"host_id": hostID})
+	if err != nil {
+		return
+	}
+	r.Broadcast(network.MsgTypeHostChanged, data)
 }
 
 // GetPlayer 获取单个玩家
@@ -165,12 +705,34 @@ func (r *Room) GetStatus() RoomStatus {
 	return r.Status
 }
 
-// loop 是房间的主循环，定时驱动状态更新
+// loop 是房间的主循环，也是唯一修改房间和状态机的协程：
+// 心跳、玩家动作、进出房间都在这里串行执行，游戏代码因此不需要加锁
 func (r *Room) loop() {
+	snapshotTicker := time.NewTicker(snapshotInterval)
+	defer snapshotTicker.Stop()
+	// 配置由 statusMutex 保护，心跳间隔在房间协程中读取，变化后在这里重置心跳
+	tickInterval := r.GetGameConfig().TickInterval
+
 	for {
 		select {
 		case <-r.ticker.C:
+			start := time.Now()
 			r.Update()
+			if time.Since(start) > tickInterval && r.deps.metrics != nil {
+				r.deps.metrics.IncTickOverrun()
+			}
+		case <-snapshotTicker.C:
+			r.expireReservations()
+			r.saveSnapshot()
+		case fn := <-r.mailbox:
+			if r.deps.metrics != nil {
+				r.deps.metrics.ObserveMailboxDepth(len(r.mailbox))
+			}
+			fn()
+			if interval := r.GetGameConfig().TickInterval; interval != tickInterval {
+				tickInterval = interval
+				r.ticker.Reset(interval)
+			}
 		case <-r.closeChan:
 			r.ticker.Stop()
 			return
@@ -178,6 +740,56 @@ func (r *Room) loop() {
 	}
 }
 
+// post 把 fn 投递到房间协程执行，mailbox 已满时立即失败而不是阻塞调用方
+func (r *Room) post(fn func()) error {
+	select {
+	case <-r.closeChan:
+		return ErrRoomClosed
+	default:
+	}
+
+	select {
+	case r.mailbox <- fn:
+		return nil
+	default:
+		if r.deps.metrics != nil {
+			r.deps.metrics.IncMailboxFull()
+		}
+		return ErrMailboxFull
+	}
+}
+
+// exec 把 fn 投递到房间协程并等待其执行完毕，返回 fn 的结果。
+// 不能在房间协程内调用，否则会死锁；房间协程内请直接调用对应的小写方法。
+func (r *Room) exec(fn func() error) error {
+	var err error
+	done := make(chan struct{})
+	if postErr := r.post(func() {
+		err = fn()
+		close(done)
+	}); postErr != nil {
+		return postErr
+	}
+
+	select {
+	case <-done:
+		return err
+	case <-r.closeChan:
+		return ErrRoomClosed
+	}
+}
+
+// HandleAction 把玩家动作交给当前状态处理，在房间协程中执行
+func (r *Room) HandleAction(player state.Player, actionData []byte) error {
+	return r.exec(func() error {
+		currentState := r.StateMachine.GetCurrentState()
+		if currentState == nil {
+			return ErrNotWaiting
+		}
+		return currentState.HandleAction(player, actionData)
+	})
+}
+
 // Update 由主循环调用，驱动状态机更新
 func (r *Room) Update() {
 	if r.StateMachine != nil {
@@ -198,6 +810,7 @@ func (r *Room) Close() {
 // Manager 管理所有房间
 type Manager struct {
 	rooms map[string]*Room
+	deps  roomDeps
 	mutex sync.RWMutex
 }
 
@@ -213,11 +826,47 @@ func (m *Manager) CreateRoom(id, name, gameType string, maxPlayers int, broadcas
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	room := NewRoom(id, name, gameType, maxPlayers, broadcaster)
+	room := newRoom(id, name, gameType, maxPlayers, broadcaster, m.deps)
 	m.rooms[id] = room
 	return room
 }
 
+// SetMetrics 设置房间指标收集器，对之后创建的房间生效
+func (m *Manager) SetMetrics(metrics Metrics) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deps.metrics = metrics
+}
+
+// SetGameRecorder 设置游戏记录器，对之后创建的房间生效
+func (m *Manager) SetGameRecorder(recorder GameRecorder) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deps.recorder = recorder
+}
+
+// SetEconomy 设置房间内游戏结算金币和物品的经济系统，对之后创建的房间生效
+func (m *Manager) SetEconomy(economy state.Economy) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deps.economy = economy
+}
+
+// SetJackpot 设置房间共享的累积奖池，对之后创建的房间生效
+func (m *Manager) SetJackpot(jackpot state.Jackpot) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deps.jackpot = jackpot
+}
+
+// SetSeedSource 设置每局种子的来源，用于测试或复现一局，对之后创建的房间生效。
+// 生产环境不应设置，否则开局前公布的种子哈希失去意义
+func (m *Manager) SetSeedSource(seeds func(roomID string) string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deps.seeds = seeds
+}
+
 // RemoveRoom 从管理器中移除并关闭一个房间
 func (m *Manager) RemoveRoom(id string) {
 	m.mutex.Lock()
@@ -225,6 +874,7 @@ func (m *Manager) RemoveRoom(id string) {
 
 	if room, exists := m.rooms[id]; exists {
 		room.Close()
+		room.deleteSnapshot()
 		delete(m.rooms, id)
 	}
 }
@@ -238,15 +888,29 @@ func (m *Manager) GetRoom(id string) (*Room, bool) {
 	return room, exists
 }
 
+// RoomIDs 返回某个游戏类型的所有房间ID
+func (m *Manager) RoomIDs(gameType string) []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var ids []string
+	for id, room := range m.rooms {
+		if room.GameType == gameType {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 // FindAvailableRoom 查找一个可用的房间
 func (m *Manager) FindAvailableRoom() *Room {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
 	for _, room := range m.rooms {
-		if len(room.Players) < room.MaxPlayers && room.Status == StatusWaiting {
+		if room.PlayerCount() < room.GetMaxPlayers() && room.GetStatus() == StatusWaiting && !room.IsLocked() {
 			return room
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -2,11 +2,13 @@ package room
 
 import (
 	"net"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/wfunc/gameserver/network"
 	"github.com/wfunc/gameserver/session"
+	"github.com/wfunc/gameserver/state"
 )
 
 // MockBroadcaster is a test double for the Broadcaster interface.
@@ -118,3 +120,271 @@ func TestRoom_RemovePlayer(t *testing.T) {
 		t.Error("Player was not correctly removed from the room's player map")
 	}
 }
+
+func TestRoom_HostAssignedToCreator(t *testing.T) {
+	room := NewRoom("test_room_5", "Host Test", "test_game", 4, &MockBroadcaster{})
+	defer room.Close()
+
+	creator := newTestSession("creator")
+	guest := newTestSession("guest")
+	room.AddPlayer(creator)
+	room.AddPlayer(guest)
+
+	if !room.IsHost(creator.GetID()) {
+		t.Errorf("Expected creator to be host, got %q", room.GetHostID())
+	}
+	if room.IsHost(guest.GetID()) {
+		t.Error("Guest should not be host")
+	}
+}
+
+func TestRoom_HostTransferOnLeave(t *testing.T) {
+	room := NewRoom("test_room_6", "Host Transfer Test", "test_game", 4, &MockBroadcaster{})
+	defer room.Close()
+
+	host := newTestSession("host")
+	second := newTestSession("second")
+	third := newTestSession("third")
+	room.AddPlayer(host)
+	room.AddPlayer(second)
+	room.AddPlayer(third)
+
+	room.RemovePlayer(host.GetID())
+	if room.GetHostID() != second.GetID() {
+		t.Errorf("Expected host to transfer to the earliest remaining player %q, got %q", second.GetID(), room.GetHostID())
+	}
+
+	room.RemovePlayer(second.GetID())
+	room.RemovePlayer(third.GetID())
+	if room.GetHostID() != "" {
+		t.Errorf("Expected empty room to have no host, got %q", room.GetHostID())
+	}
+}
+
+func TestRoom_KickPlayer(t *testing.T) {
+	room := NewRoom("test_room_7", "Kick Test", "test_game", 4, &MockBroadcaster{})
+	defer room.Close()
+
+	host := newTestSession("host")
+	guest := newTestSession("guest")
+	guest.SetUserID(42)
+	room.AddPlayer(host)
+	room.AddPlayer(guest)
+
+	if _, err := room.KickPlayer(guest.GetID(), host.GetID()); err != ErrNotHost {
+		t.Errorf("Expected ErrNotHost when a guest kicks, got %v", err)
+	}
+
+	if _, err := room.KickPlayer(host.GetID(), guest.GetID()); err != nil {
+		t.Fatalf("Host failed to kick guest: %v", err)
+	}
+	if _, exists := room.GetPlayer(guest.GetID()); exists {
+		t.Error("Kicked player should be removed from the room")
+	}
+
+	if err := room.Join(guest); err != ErrPlayerKicked {
+		t.Errorf("Expected ErrPlayerKicked on rejoin, got %v", err)
+	}
+
+	// 同一用户换一个连接也不能重新加入
+	reconnected := newTestSession("guest_reconnected")
+	reconnected.SetUserID(42)
+	if err := room.Join(reconnected); err != ErrPlayerKicked {
+		t.Errorf("Expected ErrPlayerKicked for the same user on a new session, got %v", err)
+	}
+}
+
+func TestRoom_KickedUserAuthenticatesInRoom(t *testing.T) {
+	room := NewRoom("test_room_kick_auth", "Kick Test", "test_game", 4, &MockBroadcaster{})
+	defer room.Close()
+
+	host := newTestSession("host")
+	guest := newTestSession("guest")
+	guest.SetUserID(42)
+	room.AddPlayer(host)
+	room.AddPlayer(guest)
+	if _, err := room.KickPlayer(host.GetID(), guest.GetID()); err != nil {
+		t.Fatalf("Host failed to kick guest: %v", err)
+	}
+
+	// 被踢的用户以匿名连接加入后再登录，被移出房间
+	anonymous := newTestSession("anonymous")
+	if err := room.Join(anonymous); err != nil {
+		t.Fatalf("Anonymous session failed to join: %v", err)
+	}
+	if err := room.Authenticate(anonymous, 42); err != ErrPlayerKicked {
+		t.Errorf("Expected ErrPlayerKicked when the kicked user logs in, got %v", err)
+	}
+	if _, exists := room.GetPlayer(anonymous.GetID()); exists || anonymous.RoomID != "" {
+		t.Error("Expected the kicked user to be removed from the room")
+	}
+	if anonymous.GetUserID() != 42 {
+		t.Errorf("Expected the session to stay logged in, got user %d", anonymous.GetUserID())
+	}
+
+	other := newTestSession("other")
+	room.AddPlayer(other)
+	if err := room.Authenticate(other, 7); err != nil || other.GetUserID() != 7 {
+		t.Errorf("Expected other users to log in inside the room, got %v (user %d)", err, other.GetUserID())
+	}
+}
+
+func TestRoom_LockAndSettings(t *testing.T) {
+	room := NewRoom("test_room_8", "Lock Test", "test_game", 4, &MockBroadcaster{})
+	defer room.Close()
+
+	host := newTestSession("host")
+	guest := newTestSession("guest")
+	room.AddPlayer(host)
+	room.AddPlayer(guest)
+
+	if err := room.SetLocked(guest.GetID(), true); err != ErrNotHost {
+		t.Errorf("Expected ErrNotHost when a guest locks the room, got %v", err)
+	}
+	if err := room.SetLocked(host.GetID(), true); err != nil {
+		t.Fatalf("Host failed to lock room: %v", err)
+	}
+	if err := room.Join(newTestSession("late")); err != ErrRoomLocked {
+		t.Errorf("Expected ErrRoomLocked, got %v", err)
+	}
+
+	if err := room.UpdateSettings(host.GetID(), RoomSettings{MaxPlayers: 1}); err != ErrInvalidSetting {
+		t.Errorf("Expected ErrInvalidSetting when shrinking below player count, got %v", err)
+	}
+	if err := room.UpdateSettings(host.GetID(), RoomSettings{Name: "Renamed", MaxPlayers: 6}); err != nil {
+		t.Fatalf("Host failed to update settings: %v", err)
+	}
+	if room.Name != "Renamed" || room.GetMaxPlayers() != 6 {
+		t.Errorf("Settings not applied: name=%q max=%d", room.Name, room.GetMaxPlayers())
+	}
+}
+
+func TestRoom_SeatAssignment(t *testing.T) {
+	room := NewRoom("test_room_9", "Seat Test", "test_game", 3, &MockBroadcaster{})
+	defer room.Close()
+
+	p1 := newTestSession("p1")
+	p2 := newTestSession("p2")
+	p3 := newTestSession("p3")
+	room.AddPlayer(p1)
+	room.AddPlayer(p2)
+
+	if room.GetSeat(p1.GetID()) != 0 || room.GetSeat(p2.GetID()) != 1 {
+		t.Fatalf("Expected seats 0 and 1, got %d and %d", room.GetSeat(p1.GetID()), room.GetSeat(p2.GetID()))
+	}
+
+	room.RemovePlayer(p1.GetID())
+	room.AddPlayer(p3)
+	if room.GetSeat(p3.GetID()) != 0 {
+		t.Errorf("Expected new player to take the freed seat 0, got %d", room.GetSeat(p3.GetID()))
+	}
+
+	if err := room.ChangeSeat(p2.GetID(), 0); err != ErrSeatTaken {
+		t.Errorf("Expected ErrSeatTaken, got %v", err)
+	}
+	if err := room.ChangeSeat(p2.GetID(), 2); err != nil {
+		t.Fatalf("ChangeSeat failed: %v", err)
+	}
+	if room.GetSeat(p2.GetID()) != 2 {
+		t.Errorf("Expected p2 in seat 2, got %d", room.GetSeat(p2.GetID()))
+	}
+
+	// 缩小房间时超出范围的玩家被移到空座位
+	if err := room.UpdateSettings(p2.GetID(), RoomSettings{MaxPlayers: 2}); err != nil {
+		t.Fatalf("UpdateSettings failed: %v", err)
+	}
+	if room.GetSeat(p2.GetID()) != 1 {
+		t.Errorf("Expected p2 to move to seat 1 after shrinking, got %d", room.GetSeat(p2.GetID()))
+	}
+}
+
+func TestRoom_SetReady(t *testing.T) {
+	room := NewRoom("test_room_10", "Ready Test", "test_game", 2, &MockBroadcaster{})
+	defer room.Close()
+
+	p1 := newTestSession("p1")
+	room.AddPlayer(p1)
+
+	if err := room.SetReady("stranger", true); err != ErrPlayerNotFound {
+		t.Errorf("Expected ErrPlayerNotFound, got %v", err)
+	}
+	if err := room.SetReady(p1.GetID(), true); err != nil {
+		t.Fatalf("SetReady failed: %v", err)
+	}
+}
+
+// countingState counts actions without any locking; the room loop must serialize access.
+type countingState struct {
+	state.RoomStateBase
+	actions int
+}
+
+func (c *countingState) HandleAction(player state.Player, actionData []byte) error {
+	c.actions++
+	return nil
+}
+
+func TestRoom_MailboxSerializesActions(t *testing.T) {
+	room := NewRoom("test_room_11", "Mailbox Test", "test_game", 4, &MockBroadcaster{})
+	defer room.Close()
+
+	counter := &countingState{RoomStateBase: state.RoomStateBase{ID: "counting", Room: room}}
+	room.exec(func() error { return room.ChangeState(counter) })
+
+	player := newTestSession("p1")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if err := room.HandleAction(player, []byte(`{}`)); err != nil {
+					t.Errorf("HandleAction failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var actions int
+	room.exec(func() error {
+		actions = counter.actions
+		return nil
+	})
+	if actions != 200 {
+		t.Errorf("Expected 200 actions to be processed, got %d", actions)
+	}
+}
+
+func TestRoom_MailboxFull(t *testing.T) {
+	room := NewRoom("test_room_12", "Mailbox Full Test", "test_game", 4, &MockBroadcaster{})
+	defer room.Close()
+
+	// 阻塞房间协程，让后续消息只能排队
+	started := make(chan struct{})
+	release := make(chan struct{})
+	room.post(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	for i := 0; i < mailboxSize; i++ {
+		if err := room.post(func() {}); err != nil {
+			t.Fatalf("Post %d failed before the mailbox was full: %v", i, err)
+		}
+	}
+	if err := room.post(func() {}); err != ErrMailboxFull {
+		t.Errorf("Expected ErrMailboxFull, got %v", err)
+	}
+}
+
+func TestRoom_ClosedRejectsMessages(t *testing.T) {
+	room := NewRoom("test_room_13", "Closed Test", "test_game", 4, &MockBroadcaster{})
+	room.Close()
+
+	if err := room.Join(newTestSession("p1")); err != ErrRoomClosed {
+		t.Errorf("Expected ErrRoomClosed, got %v", err)
+	}
+}
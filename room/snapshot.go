@@ -0,0 +1,282 @@
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/state"
+)
+
+// SnapshotVersion 当前快照格式的版本号，格式不兼容地变化时递增
+const SnapshotVersion = 1
+
+const (
+	// snapshotInterval 房间定期保存快照的间隔
+	snapshotInterval = 10 * time.Second
+	// reconnectGrace 恢复的房间为尚未重连的成员保留座位的时长
+	reconnectGrace = 2 * time.Minute
+)
+
+// SnapshotStore 保存和加载房间快照，由持久化层实现
+type SnapshotStore interface {
+	SaveSnapshot(snapshot *Snapshot) error
+	LoadSnapshots() ([]*Snapshot, error)
+	DeleteSnapshot(roomID string) error
+}
+
+// MemberSnapshot 快照中的一个房间成员，只有已登录(UserID 非零)的玩家可以在重启后找回
+type MemberSnapshot struct {
+	UserID int64 `json:"user_id"`
+	Seat   int   `json:"seat"`
+	Host   bool  `json:"host"`
+}
+
+// Snapshot 房间的持久化快照
+type Snapshot struct {
+	Version       int                  `json:"version"`
+	Seq           int64                `json:"seq"` // 单调递增，防止旧快照覆盖新快照
+	RoomID        string               `json:"room_id"`
+	Name          string               `json:"name"`
+	GameType      string               `json:"game_type"`
+	MaxPlayers    int                  `json:"max_players"`
+	Locked        bool                 `json:"locked"`
+	Members       []MemberSnapshot     `json:"members"`
+	KickedUsers   []int64              `json:"kicked_users,omitempty"`
+	StateID       string               `json:"state_id"`
+	RemainingTime time.Duration        `json:"remaining_time,omitempty"`
+	GameData      json.RawMessage      `json:"game_data,omitempty"`
+	Round         *state.RoundSnapshot `json:"round,omitempty"` // 本局尚未公开的种子和动作记录，只保存在服务端
+	SavedAt       time.Time            `json:"saved_at"`
+}
+
+// snapshotter 负责房间快照的异步保存，保证旧快照不会覆盖新快照、删除后不会再写入
+type snapshotter struct {
+	store       SnapshotStore
+	seq         int64 // 只在房间协程中递增
+	savedSeq    int64
+	deleted     bool
+	onIdle      func()    // 恢复的房间在宽限期内无人重连时调用
+	reserveTill time.Time // 保留座位的截止时间
+	mutex       sync.Mutex
+}
+
+// snapshot 生成房间当前的快照，必须在房间协程中调用
+func (r *Room) snapshot() (*Snapshot, error) {
+	r.snapshots.seq++
+	snapshot := &Snapshot{
+		Version:  SnapshotVersion,
+		Seq:      r.snapshots.seq,
+		RoomID:   r.ID,
+		GameType: r.GameType,
+		SavedAt:  time.Now(),
+	}
+
+	r.playerMutex.RLock()
+	snapshot.Name = r.Name
+	snapshot.MaxPlayers = r.MaxPlayers
+	snapshot.Locked = r.Locked
+	for seat, id := range r.Seats {
+		if player, exists := r.Players[id]; exists && player.GetUserID() != 0 {
+			snapshot.Members = append(snapshot.Members, MemberSnapshot{
+				UserID: player.GetUserID(),
+				Seat:   seat,
+				Host:   id == r.HostID,
+			})
+		}
+	}
+	// 尚未重连的成员继续保留，连续重启也不会丢失
+	for _, member := range r.reserved {
+		snapshot.Members = append(snapshot.Members, member)
+	}
+	for userID := range r.kickedUsers {
+		snapshot.KickedUsers = append(snapshot.KickedUsers, userID)
+	}
+	r.playerMutex.RUnlock()
+
+	currentState := r.StateMachine.GetCurrentState()
+	snapshot.StateID = currentState.GetID()
+	if gamingState, ok := currentState.(*state.GamingState); ok {
+		snapshot.RemainingTime = gamingState.RemainingTime
+		data, err := json.Marshal(gamingState.GameData)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.GameData = data
+		if snapshot.Round, err = gamingState.RoundSnapshot(); err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// saveSnapshot 在房间协程中生成快照并异步保存，不阻塞房间循环
+func (r *Room) saveSnapshot() {
+	if r.snapshots.store == nil {
+		return
+	}
+
+	snapshot, err := r.snapshot()
+	if err != nil {
+		logger.Log.Errorf("Room %s failed to build snapshot: %v", r.ID, err)
+		return
+	}
+
+	go func() {
+		r.snapshots.mutex.Lock()
+		defer r.snapshots.mutex.Unlock()
+
+		if r.snapshots.deleted || snapshot.Seq <= r.snapshots.savedSeq {
+			return
+		}
+		if err := r.snapshots.store.SaveSnapshot(snapshot); err != nil {
+			logger.Log.Errorf("Room %s failed to save snapshot: %v", r.ID, err)
+			return
+		}
+		r.snapshots.savedSeq = snapshot.Seq
+	}()
+}
+
+// Checkpoint 立即保存房间快照，由游戏模块在房间协程中调用
+func (r *Room) Checkpoint() {
+	r.saveSnapshot()
+}
+
+// deleteSnapshot 删除房间的快照，之后不再保存
+func (r *Room) deleteSnapshot() {
+	if r.snapshots.store == nil {
+		return
+	}
+
+	r.snapshots.mutex.Lock()
+	defer r.snapshots.mutex.Unlock()
+
+	r.snapshots.deleted = true
+	if err := r.snapshots.store.DeleteSnapshot(r.ID); err != nil {
+		logger.Log.Errorf("Room %s failed to delete snapshot: %v", r.ID, err)
+	}
+}
+
+// expireReservations 宽限期过后释放未重连成员的座位，房间仍然无人时通知管理器回收
+func (r *Room) expireReservations() {
+	if r.snapshots.reserveTill.IsZero() || time.Now().Before(r.snapshots.reserveTill) {
+		return
+	}
+	r.snapshots.reserveTill = time.Time{}
+
+	r.playerMutex.Lock()
+	r.reserved = make(map[int64]MemberSnapshot)
+	empty := len(r.Players) == 0
+	r.playerMutex.Unlock()
+
+	if empty && r.snapshots.onIdle != nil {
+		logger.Log.Infof("Restored room %s was not rejoined within %v, removing", r.ID, reconnectGrace)
+		go r.snapshots.onIdle()
+	}
+}
+
+// HasReservation 判断房间是否为该用户保留了座位
+func (r *Room) HasReservation(userID int64) bool {
+	r.playerMutex.RLock()
+	defer r.playerMutex.RUnlock()
+	_, exists := r.reserved[userID]
+	return userID != 0 && exists
+}
+
+// restoreRoom 根据快照重建房间。成员按 UserID 保留座位直到重连或宽限期结束，
+// 进行中的游戏从快照的状态和游戏数据继续，无法继续时由游戏模块退还已扣除的下注。
+// 结算阶段的派奖和游戏记录在进入前已经完成，帧同步的一局不涉及金币，两者都回到等待状态
+func restoreRoom(snapshot *Snapshot, broadcaster Broadcaster, deps roomDeps, onIdle func()) (*Room, error) {
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+	if snapshot.MaxPlayers <= 0 {
+		return nil, fmt.Errorf("invalid max players %d", snapshot.MaxPlayers)
+	}
+
+	room := buildRoom(snapshot.RoomID, snapshot.Name, snapshot.GameType, snapshot.MaxPlayers, broadcaster, deps)
+	room.Locked = snapshot.Locked
+	for _, userID := range snapshot.KickedUsers {
+		room.kickedUsers[userID] = true
+	}
+	for _, member := range snapshot.Members {
+		room.reserved[member.UserID] = member
+	}
+	room.snapshots.seq = snapshot.Seq
+	room.snapshots.savedSeq = snapshot.Seq
+	room.snapshots.reserveTill = time.Now().Add(reconnectGrace)
+	room.snapshots.onIdle = onIdle
+
+	if snapshot.StateID == "gaming" {
+		config := room.GetGameConfig()
+		gamingState := state.NewRestoredGamingState(room, config.RoundDuration, snapshot.RemainingTime, snapshot.GameData, snapshot.Round)
+		room.StateMachine = state.NewBaseStateMachine(gamingState)
+		room.SetStatus(StatusGaming)
+		// 立即覆盖旧快照，作废并退还过的一局不会在下次重启时再次退还
+		room.saveSnapshot()
+	} else if snapshot.StateID != "waiting" {
+		logger.Log.Warnf("Room %s dropped its %s round on restore", snapshot.RoomID, snapshot.StateID)
+	}
+
+	room.start()
+	return room, nil
+}
+
+// SetSnapshotStore 设置房间快照存储，对之后创建的房间生效
+func (m *Manager) SetSnapshotStore(store SnapshotStore) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deps.store = store
+}
+
+// Restore 从快照存储重建所有房间，返回成功恢复的房间数量
+func (m *Manager) Restore(broadcaster Broadcaster) (int, error) {
+	m.mutex.RLock()
+	deps := m.deps
+	m.mutex.RUnlock()
+
+	if deps.store == nil {
+		return 0, nil
+	}
+
+	snapshots, err := deps.store.LoadSnapshots()
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, snapshot := range snapshots {
+		if _, exists := m.GetRoom(snapshot.RoomID); exists {
+			continue
+		}
+
+		// 房间恢复时会广播游戏状态，广播需要查询管理器，因此不能持有 m.mutex
+		roomID := snapshot.RoomID
+		room, err := restoreRoom(snapshot, broadcaster, deps, func() { m.RemoveRoom(roomID) })
+		if err != nil {
+			logger.Log.Warnf("Skipping snapshot of room %s: %v", snapshot.RoomID, err)
+			continue
+		}
+
+		m.mutex.Lock()
+		m.rooms[room.ID] = room
+		m.mutex.Unlock()
+		restored++
+	}
+	return restored, nil
+}
+
+// FindReservedRoom 查找为该用户保留了座位的房间
+func (m *Manager) FindReservedRoom(userID int64) *Room {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, room := range m.rooms {
+		if room.HasReservation(userID) {
+			return room
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package room
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/fairness"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/state"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	os.Exit(m.Run())
+}
+
+// memorySnapshotStore is an in-memory SnapshotStore for tests.
+type memorySnapshotStore struct {
+	snapshots map[string]*Snapshot
+	mutex     sync.Mutex
+}
+
+func newMemorySnapshotStore() *memorySnapshotStore {
+	return &memorySnapshotStore{snapshots: make(map[string]*Snapshot)}
+}
+
+func (s *memorySnapshotStore) SaveSnapshot(snapshot *Snapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snapshots[snapshot.RoomID] = snapshot
+	return nil
+}
+
+func (s *memorySnapshotStore) LoadSnapshots() ([]*Snapshot, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshots := make([]*Snapshot, 0, len(s.snapshots))
+	for _, snapshot := range s.snapshots {
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+func (s *memorySnapshotStore) DeleteSnapshot(roomID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.snapshots, roomID)
+	return nil
+}
+
+func (s *memorySnapshotStore) get(roomID string) *Snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.snapshots[roomID]
+}
+
+// waitForSnapshot waits for the asynchronous save to reach the store.
+func waitForSnapshot(t *testing.T, store *memorySnapshotStore, roomID string, ready func(*Snapshot) bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if snapshot := store.get(roomID); snapshot != nil && ready(snapshot) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected snapshot of room %s was not saved", roomID)
+}
+
+func TestManager_SnapshotAndRestore(t *testing.T) {
+	store := newMemorySnapshotStore()
+	manager := NewRoomManager()
+	manager.SetSnapshotStore(store)
+
+	room := manager.CreateRoom("snapshot_room", "Snapshot Test", "test_game", 4, &MockBroadcaster{})
+	host := newTestSession("host")
+	host.SetUserID(1)
+	guest := newTestSession("guest")
+	guest.SetUserID(2)
+	room.AddPlayer(host)
+	room.AddPlayer(guest)
+	room.ChangeSeat(guest.GetID(), 3)
+	room.SetLocked(host.GetID(), true)
+	waitForSnapshot(t, store, room.ID, func(snapshot *Snapshot) bool {
+		return len(snapshot.Members) == 2 && snapshot.Locked
+	})
+	room.Close()
+
+	// 模拟重启：新的管理器从同一个存储恢复房间
+	restarted := NewRoomManager()
+	restarted.SetSnapshotStore(store)
+	restored, err := restarted.Restore(&MockBroadcaster{})
+	if err != nil || restored != 1 {
+		t.Fatalf("Expected 1 restored room, got %d (err: %v)", restored, err)
+	}
+
+	restoredRoom := restarted.FindReservedRoom(2)
+	if restoredRoom == nil || restoredRoom.ID != "snapshot_room" {
+		t.Fatal("Expected the guest's seat to be reserved in the restored room")
+	}
+	defer restoredRoom.Close()
+	if !restoredRoom.IsLocked() {
+		t.Error("Expected the lock setting to survive a restart")
+	}
+
+	// 锁定的房间不接受新玩家，但重连的成员可以回到原来的座位
+	if err := restoredRoom.Join(newTestSession("stranger")); err != ErrRoomLocked {
+		t.Errorf("Expected ErrRoomLocked for a new player, got %v", err)
+	}
+	guestAgain := newTestSession("guest_again")
+	guestAgain.SetUserID(2)
+	if err := restoredRoom.Join(guestAgain); err != nil {
+		t.Fatalf("Reserved member failed to rejoin: %v", err)
+	}
+	if restoredRoom.GetSeat(guestAgain.GetID()) != 3 {
+		t.Errorf("Expected guest back in seat 3, got %d", restoredRoom.GetSeat(guestAgain.GetID()))
+	}
+
+	hostAgain := newTestSession("host_again")
+	hostAgain.SetUserID(1)
+	if err := restoredRoom.Join(hostAgain); err != nil {
+		t.Fatalf("Reserved host failed to rejoin: %v", err)
+	}
+	if !restoredRoom.IsHost(hostAgain.GetID()) {
+		t.Errorf("Expected the original host to reclaim host, got %q", restoredRoom.GetHostID())
+	}
+}
+
+func TestManager_RestoreGamingState(t *testing.T) {
+	gameData, _ := json.Marshal(&state.SlotData{Reels: [3]int{1, 2, 3}, SpinCount: 7, SeedHash: fairness.HashSeed("server_seed")})
+	store := newMemorySnapshotStore()
+	store.SaveSnapshot(&Snapshot{
+		Version:       SnapshotVersion,
+		RoomID:        "gaming_room",
+		Name:          "Gaming",
+		GameType:      "slot_machine",
+		MaxPlayers:    4,
+		Members:       []MemberSnapshot{{UserID: 9, Seat: 0, Host: true}},
+		StateID:       "gaming",
+		RemainingTime: time.Hour,
+		GameData:      gameData,
+		Round:         &state.RoundSnapshot{Seed: "server_seed"},
+	})
+	store.SaveSnapshot(&Snapshot{Version: SnapshotVersion + 1, RoomID: "future_room", MaxPlayers: 4})
+
+	manager := NewRoomManager()
+	manager.SetSnapshotStore(store)
+	restored, err := manager.Restore(&MockBroadcaster{})
+	if err != nil || restored != 1 {
+		t.Fatalf("Expected only the supported snapshot to be restored, got %d (err: %v)", restored, err)
+	}
+
+	room, _ := manager.GetRoom("gaming_room")
+	defer room.Close()
+	if room.GetStatus() != StatusGaming {
+		t.Fatalf("Expected restored room to be gaming, got %v", room.GetStatus())
+	}
+
+	var spinCount int
+	var serverSeed string
+	room.exec(func() error {
+		gamingState := room.StateMachine.GetCurrentState().(*state.GamingState)
+		spinCount = gamingState.GameData.(*state.SlotData).SpinCount
+		serverSeed = gamingState.Fairness.ServerSeed
+		return nil
+	})
+	if spinCount != 7 {
+		t.Errorf("Expected spin count 7 to be restored, got %d", spinCount)
+	}
+	// 恢复后继续使用已公布哈希的服务器种子
+	if serverSeed != "server_seed" {
+		t.Errorf("Expected the server seed to be restored, got %q", serverSeed)
+	}
+}
@@ -1,10 +1,12 @@
 package rpc
 
 import (
+	"context"
 	"net"
 	"net/rpc"
 
 	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
 	"github.com/wfunc/gameserver/services"
 )
 
@@ -59,11 +61,12 @@ func (s *Server) Stop() {
 // GameService is the struct that exposes RPC methods.
 type GameService struct {
 	playerService *services.PlayerService
+	inventory     *services.InventoryService
 }
 
 // NewGameService creates a new GameService.
-func NewGameService(ps *services.PlayerService) *GameService {
-	return &GameService{playerService: ps}
+func NewGameService(ps *services.PlayerService, inventory *services.InventoryService) *GameService {
+	return &GameService{playerService: ps, inventory: inventory}
 }
 
 // GetPlayerWithStats is an RPC method to get player data.
@@ -78,10 +81,55 @@ type GetPlayerReply struct {
 }
 
 func (gs *GameService) GetPlayerWithStats(args *GetPlayerArgs, reply *GetPlayerReply) error {
-	data, err := gs.playerService.GetPlayerWithStats(args.UserID)
+	data, err := gs.playerService.GetPlayerWithStats(context.Background(), args.UserID)
 	if err != nil {
 		return err
 	}
 	reply.Data = data
 	return nil
-}
\ No newline at end of file
+}
+
+// GetGameHistoryArgs 查询玩家历史对局的参数，供客服等后台系统使用
+type GetGameHistoryArgs struct {
+	Query models.GameHistoryQuery
+}
+
+type GetGameHistoryReply struct {
+	Page *models.GameHistoryPage
+}
+
+// GetGameHistory is an RPC method to page through a player's past rounds.
+func (gs *GameService) GetGameHistory(args *GetGameHistoryArgs, reply *GetGameHistoryReply) error {
+	page, err := gs.playerService.GetGameHistory(context.Background(), &args.Query)
+	if err != nil {
+		return err
+	}
+	reply.Page = page
+	return nil
+}
+
+// GrantItemArgs 发放物品的参数，供运营后台、活动等系统使用
+type GrantItemArgs struct {
+	UserID   int64
+	ItemID   string
+	Quantity int64
+	Reason   string
+}
+
+type GrantItemReply struct {
+	Items []models.InventoryItem // 发放后玩家未过期的物品
+}
+
+// GrantItem is an RPC method to grant items to a player.
+func (gs *GameService) GrantItem(args *GrantItemArgs, reply *GrantItemReply) error {
+	ctx := context.Background()
+	if err := gs.inventory.Grant(ctx, args.UserID, args.ItemID, args.Quantity, args.Reason); err != nil {
+		return err
+	}
+	items, err := gs.inventory.ListItems(ctx, args.UserID)
+	if err != nil {
+		return err
+	}
+	reply.Items = items
+	return nil
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/network"
+	"github.com/wfunc/gameserver/session"
+)
+
+// economyTimeout 房间协程中一次金币或物品结算的超时时间
+const economyTimeout = 2 * time.Second
+
+// roomEconomy 实现 state.Economy，金币经由玩家缓存修改，物品经由背包服务修改
+type roomEconomy struct{ s *GameServer }
+
+func (e roomEconomy) Wager(userID, amount int64, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), economyTimeout)
+	defer cancel()
+	_, err := e.s.playerCache.AddCoins(ctx, userID, -amount, reason)
+	return err
+}
+
+func (e roomEconomy) Payout(userID, amount int64, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), economyTimeout)
+	defer cancel()
+	_, err := e.s.playerCache.AddCoins(ctx, userID, amount, reason)
+	return err
+}
+
+func (e roomEconomy) Balance(userID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), economyTimeout)
+	defer cancel()
+	return e.s.playerCache.Balance(ctx, userID)
+}
+
+func (e roomEconomy) Item(itemID string) (models.ItemDef, bool) {
+	return e.s.inventory.Catalog().Get(itemID)
+}
+
+func (e roomEconomy) ConsumeItem(userID int64, itemID, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), economyTimeout)
+	defer cancel()
+	_, err := e.s.inventory.Consume(ctx, userID, itemID, 1, reason)
+	return err
+}
+
+// handleInventory 返回当前登录用户未过期的物品和物品目录
+func (s *GameServer) handleInventory(session *session.Session, packet *network.Packet) {
+	if session.GetUserID() == 0 {
+		s.sendError(session, packet.MsgID, errNotAuthenticated)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	items, err := s.inventory.ListItems(ctx, session.GetUserID())
+	if err != nil {
+		logger.Log.Warnf("User %d failed to list inventory: %v", session.GetUserID(), err)
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"items":   items,
+		"catalog": s.inventory.Catalog().List(),
+	})
+	session.Send(network.MsgTypeInventory, data)
+}
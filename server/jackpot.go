@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/network"
+	"github.com/wfunc/gameserver/session"
+	"github.com/wfunc/gameserver/state"
+)
+
+const (
+	// jackpotBroadcastInterval 检查奖池金额并向老虎机房间广播的间隔
+	jackpotBroadcastInterval = time.Second
+	// jackpotWinsLimit 查询奖池时返回的最近中奖记录数
+	jackpotWinsLimit = 10
+)
+
+// jackpotMessage 奖池金额的广播，有人中奖时带上中奖记录
+type jackpotMessage struct {
+	Pool   string              `json:"pool"`
+	Amount int64               `json:"amount"`
+	Winner *models.JackpotWin  `json:"winner,omitempty"`
+	Wins   []models.JackpotWin `json:"wins,omitempty"`
+}
+
+// roomJackpot 实现 state.Jackpot，奖池由奖池服务保存在数据库中，各房间共享
+type roomJackpot struct{ s *GameServer }
+
+func (j roomJackpot) Contribute(pool string, bet int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), economyTimeout)
+	defer cancel()
+	return j.s.jackpots.Contribute(ctx, pool, bet)
+}
+
+func (j roomJackpot) Claim(pool string, userID int64, roomID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), economyTimeout)
+	defer cancel()
+	win, err := j.s.jackpots.Claim(ctx, pool, userID, roomID)
+	if err != nil {
+		return 0, err
+	}
+	// 在房间协程之外广播，避免与房间管理器的锁互相等待
+	go j.s.broadcastJackpot(pool, win)
+	return win.Amount, nil
+}
+
+// scheduleJackpotBroadcast 定期向老虎机房间广播变化后的奖池金额
+func (s *GameServer) scheduleJackpotBroadcast() int64 {
+	return s.timers.AddTimer(jackpotBroadcastInterval, jackpotBroadcastInterval, func() {
+		s.broadcastJackpot(state.SlotJackpotPool, nil)
+	})
+}
+
+// broadcastJackpot 向使用该奖池的所有房间广播奖池金额，没有中奖且金额未变化时不广播
+func (s *GameServer) broadcastJackpot(pool string, winner *models.JackpotWin) {
+	s.jackpotMutex.Lock()
+	defer s.jackpotMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	amount, err := s.jackpots.Amount(ctx, pool)
+	if err != nil {
+		logger.Log.Errorf("Failed to read %s jackpot: %v", pool, err)
+		return
+	}
+	if shown, ok := s.jackpotShown[pool]; ok && shown == amount && winner == nil {
+		return
+	}
+	s.jackpotShown[pool] = amount
+
+	data, _ := json.Marshal(jackpotMessage{Pool: pool, Amount: amount, Winner: winner})
+	for _, roomID := range s.roomManager.RoomIDs(pool) {
+		if err := s.broadcaster.BroadcastToRoom(roomID, network.MsgTypeJackpot, data); err != nil {
+			logger.Log.Warnf("Failed to broadcast jackpot to room %s: %v", roomID, err)
+		}
+	}
+}
+
+// handleJackpot 返回老虎机奖池当前的金额和最近的中奖记录
+func (s *GameServer) handleJackpot(session *session.Session, packet *network.Packet) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	pool := state.SlotJackpotPool
+	amount, err := s.jackpots.Amount(ctx, pool)
+	if err != nil {
+		logger.Log.Warnf("Failed to read %s jackpot: %v", pool, err)
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+	wins, err := s.jackpots.ListWins(ctx, pool, jackpotWinsLimit)
+	if err != nil {
+		logger.Log.Warnf("Failed to list %s jackpot wins: %v", pool, err)
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+
+	data, _ := json.Marshal(jackpotMessage{Pool: pool, Amount: amount, Wins: wins})
+	session.Send(network.MsgTypeJackpot, data)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/network"
+	"github.com/wfunc/gameserver/services"
+	"github.com/wfunc/gameserver/session"
+)
+
+// handleGetProfile 返回当前登录用户的资料、对局统计和等级进度
+func (s *GameServer) handleGetProfile(session *session.Session, packet *network.Packet) {
+	if session.GetUserID() == 0 {
+		s.sendError(session, packet.MsgID, errNotAuthenticated)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	profile, err := s.profileService.GetProfile(ctx, session.GetUserID())
+	if err != nil {
+		logger.Log.Warnf("User %d failed to get profile: %v", session.GetUserID(), err)
+		s.sendError(session, packet.MsgID, errNoProfile)
+		return
+	}
+
+	data, _ := json.Marshal(profile)
+	session.Send(network.MsgTypeGetProfile, data)
+}
+
+// handleUpdateProfile 修改当前登录用户的资料，目前只能修改名字
+func (s *GameServer) handleUpdateProfile(session *session.Session, packet *network.Packet) {
+	if session.GetUserID() == 0 {
+		s.sendError(session, packet.MsgID, errNotAuthenticated)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(packet.Data, &req); err != nil {
+		s.sendError(session, packet.MsgID, errInvalidRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	profile, err := s.profileService.UpdateProfile(ctx, session.GetUserID(), req.Name)
+	if errors.Is(err, services.ErrInvalidName) {
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+	if err != nil {
+		logger.Log.Warnf("User %d failed to update profile: %v", session.GetUserID(), err)
+		s.sendError(session, packet.MsgID, errNoProfile)
+		return
+	}
+
+	data, _ := json.Marshal(profile)
+	session.Send(network.MsgTypeUpdateProfile, data)
+}
+
+// roundRecorder 保存每局的游戏记录，并在后台为参与的玩家发放经验
+type roundRecorder struct{ s *GameServer }
+
+func (r roundRecorder) RecordGame(record *models.GameRecord) {
+	r.s.recordService.RecordGame(record)
+	r.s.awards.Add(1)
+	go r.s.awardExperience(record)
+}
+
+// awardExperience 为一局的玩家增加经验，升级的玩家收到 MsgTypeLevelUp 通知
+func (s *GameServer) awardExperience(record *models.GameRecord) {
+	defer s.awards.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	levelUps, err := s.profileService.AwardRound(ctx, record)
+	if err != nil {
+		logger.Log.Errorf("Failed to award experience for room %s: %v", record.RoomID, err)
+	}
+
+	for _, change := range levelUps {
+		logger.Log.Infof("User %d reached level %d", change.UserID, change.Level)
+		data, _ := json.Marshal(change)
+		for _, sess := range s.sessionManager.GetByUserID(change.UserID) {
+			sess.Send(network.MsgTypeLevelUp, data)
+		}
+	}
+}
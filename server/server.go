@@ -1,53 +1,124 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/rpc"
+	"net/url"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/wfunc/gameserver/auth"
 	"github.com/wfunc/gameserver/broadcast"
+	"github.com/wfunc/gameserver/events"
 	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/monitor"
 	"github.com/wfunc/gameserver/network"
 	"github.com/wfunc/gameserver/persistence"
 	"github.com/wfunc/gameserver/room"
 	"github.com/wfunc/gameserver/services"
 	"github.com/wfunc/gameserver/session"
+	"github.com/wfunc/gameserver/state"
+	"github.com/wfunc/gameserver/timer"
 	gameserver_rpc "github.com/wfunc/gameserver/rpc"
 )
 
+const (
+	// requestTimeout 处理一个客户端请求时访问数据库的超时时间
+	requestTimeout = 5 * time.Second
+	// itemExpireInterval 清理过期物品的间隔
+	itemExpireInterval = time.Minute
+	// shutdownTimeout 关闭时等待进行中的 HTTP 请求结束的时间
+	shutdownTimeout = 10 * time.Second
+)
+
+var (
+	errInvalidUserID    = errors.New("invalid user id")
+	errNotAuthenticated = errors.New("not authenticated")
+	errInvalidRequest   = errors.New("invalid request")
+	errNoProfile        = errors.New("failed to load profile")
+)
+
+// defaultGameType 创建房间时没有指定游戏类型的旧客户端使用的游戏
+const defaultGameType = "slot_machine"
+
 type GameServer struct {
 	addr           string
+	httpServer     *http.Server
 	upgrader       websocket.Upgrader
+	authSecret     []byte   // 登录票据的签名密钥
+	trustUserID    bool     // 直接信任客户端传入的 user_id，只用于本地调试
+	allowedOrigins []string // 除同源外允许连接的浏览器来源
 	roomManager    *room.Manager
 	sessionManager *session.Manager
+	playerCache    *services.PlayerCache
 	playerService  *services.PlayerService
+	profileService *services.ProfileService
+	inventory      *services.InventoryService
+	jackpots       *services.JackpotService
+	recordService  *services.GameRecordService
+	db             persistence.Database
+	dispatcher     *events.Dispatcher
+	eventBus       *events.Bus
 	broadcaster    broadcast.Broadcaster
+	timers         *timer.TimerManager
+	expireTimer    int64
+	jackpotTimer   int64
+	jackpotShown   map[string]int64 // 每个奖池上一次广播的金额
+	jackpotMutex   sync.Mutex
 	rpcServer      *gameserver_rpc.Server
 	mutex          sync.Mutex
+	awards         sync.WaitGroup // 正在发放的对局经验
 	shutdownChan   chan struct{}
 }
 
 func NewGameServer(addr, rpcAddr string, db persistence.Database) *GameServer {
+	playerCache := services.NewPlayerCache(db)
 	s := &GameServer{
 		addr:           addr,
+		httpServer:     &http.Server{Addr: addr},
 		roomManager:    room.NewRoomManager(),
 		sessionManager: session.NewManager(),
-		playerService:  services.NewPlayerService(db),
+		playerCache:    playerCache,
+		playerService:  services.NewPlayerService(db, playerCache),
+		profileService: services.NewProfileService(db, playerCache, services.DefaultProfileSettings()),
+		inventory:      services.NewInventoryService(db, services.NewItemCatalog(services.DefaultItems()...)),
+		jackpots:       services.NewJackpotService(db, playerCache, services.DefaultJackpotSettings()),
+		jackpotShown:   make(map[string]int64),
+		timers:         timer.NewTimerManager(),
+		recordService:  services.NewGameRecordService(db),
+		db:             db,
+		dispatcher:     events.NewDispatcher(db),
+		eventBus:       events.NewBus(),
 		shutdownChan:   make(chan struct{}),
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // 允许所有跨域请求
-			},
-		},
 	}
+	s.upgrader.CheckOrigin = s.checkOrigin
+
+	// 进程内订阅者与其他投递目标一样经由发件箱收到事件
+	s.dispatcher.AddSink(s.eventBus)
 
 	// 初始化广播器
 	s.broadcaster = broadcast.NewRoomBroadcaster(s.roomManager, s.sessionManager)
 
+	// 每局结束时保存游戏记录并发放经验
+	s.roomManager.SetGameRecorder(roundRecorder{s})
+
+	// 房间内的游戏使用玩家的金币和物品结算
+	s.roomManager.SetEconomy(roomEconomy{s})
+
+	// 老虎机房间共享累积奖池
+	s.roomManager.SetJackpot(roomJackpot{s})
+
+	// 房间快照，Start 时从快照恢复重启前的房间
+	s.roomManager.SetSnapshotStore(newRoomSnapshotStore(db))
+
 	// 初始化RPC服务器
 	rpcServer, err := gameserver_rpc.NewServer(rpcAddr)
 	if err != nil {
@@ -56,23 +127,104 @@ func NewGameServer(addr, rpcAddr string, db persistence.Database) *GameServer {
 	s.rpcServer = rpcServer
 
 	// 注册RPC服务
-	gameService := gameserver_rpc.NewGameService(s.playerService)
+	gameService := gameserver_rpc.NewGameService(s.playerService, s.inventory)
 	rpc.Register(gameService)
 
 	return s
 }
 
+// SetMonitor 让服务器创建的房间上报指标
+func (s *GameServer) SetMonitor(m *monitor.Monitor) {
+	s.roomManager.SetMetrics(m)
+}
+
+// SetAuth 设置登录票据的签名密钥；trustClientUserID 为 true 时没有票据也接受客户端的 user_id，
+// 只用于本地调试。需在 Start 之前调用
+func (s *GameServer) SetAuth(secret string, trustClientUserID bool) {
+	s.authSecret = []byte(secret)
+	s.trustUserID = trustClientUserID
+}
+
+// SetAllowedOrigins 设置除同源外允许建立连接的浏览器来源，需在 Start 之前调用
+func (s *GameServer) SetAllowedOrigins(origins []string) {
+	s.allowedOrigins = origins
+}
+
+// SetProfileSettings 设置新玩家的初始资料和对局经验，需在 Start 之前调用
+func (s *GameServer) SetProfileSettings(settings services.ProfileSettings) {
+	s.profileService = services.NewProfileService(s.db, s.playerCache, settings)
+}
+
+// SetItemCatalog 设置物品目录，需在 Start 之前调用
+func (s *GameServer) SetItemCatalog(catalog *services.ItemCatalog) {
+	s.inventory.SetCatalog(catalog)
+}
+
+// SetJackpotSettings 设置累积奖池的抽成比例和初始金额，需在 Start 之前调用
+func (s *GameServer) SetJackpotSettings(settings services.JackpotSettings) {
+	s.jackpots = services.NewJackpotService(s.db, s.playerCache, settings)
+}
+
+// AddEventSink 添加发件箱事件的投递目标，需在 Start 之前调用
+func (s *GameServer) AddEventSink(sink events.Sink) {
+	s.dispatcher.AddSink(sink)
+}
+
+// EventBus 返回进程内的事件总线，用于订阅领域事件
+func (s *GameServer) EventBus() *events.Bus {
+	return s.eventBus
+}
+
 func (s *GameServer) Start() error {
+	// 恢复的房间立即开始运行，必须在所有设置完成后再恢复
+	restored, err := s.roomManager.Restore(s.broadcaster)
+	if err != nil {
+		logger.Log.Errorf("Failed to restore rooms: %v", err)
+	} else if restored > 0 {
+		logger.Log.Infof("Restored %d rooms from snapshots", restored)
+	}
+
 	go s.rpcServer.Start()
+	s.dispatcher.Start()
+	s.expireTimer = s.inventory.Schedule(s.timers, itemExpireInterval)
+	s.jackpotTimer = s.scheduleJackpotBroadcast()
 
 	http.HandleFunc("/ws", s.handleWebSocket)
 	logger.Log.Infof("Game server listening on %s", s.addr)
-	return http.ListenAndServe(s.addr, nil)
+	if err := s.httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
+// Shutdown 停止接收新连接，保存队列中的游戏记录、玩家资料和发件箱事件后返回，之后 Start 返回 nil
 func (s *GameServer) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		logger.Log.Warnf("Failed to shut down HTTP server: %v", err)
+	}
+
 	close(s.shutdownChan)
 	s.rpcServer.Stop()
+	s.timers.RemoveTimer(s.expireTimer)
+	s.timers.RemoveTimer(s.jackpotTimer)
+	s.recordService.Close()
+	s.awards.Wait()
+	s.playerCache.Close()
+	s.dispatcher.Close()
+}
+
+// checkOrigin 允许没有 Origin 的非浏览器客户端、同源请求和配置的来源
+func (s *GameServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return slices.Contains(s.allowedOrigins, origin)
 }
 
 func (s *GameServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -94,9 +246,8 @@ func (s *GameServer) handleConnection(conn *websocket.Conn) {
 	defer func() {
 		logger.Log.Infof("Connection closed from %s, session ID: %s", wsConn.RemoteAddr(), sess.GetID())
 		s.sessionManager.Remove(sess.GetID())
-		if sess.RoomID != "" {
-			s.roomManager.RemoveRoom(sess.RoomID)
-		}
+		s.leaveRoom(sess)
+		s.releasePlayer(sess)
 		wsConn.Close()
 	}()
 
@@ -118,23 +269,179 @@ func (s *GameServer) handlePacket(sess *session.Session, packet *network.Packet)
 	switch packet.MsgID {
 	case network.MsgTypeHeartbeat:
 		sess.LastActive = time.Now()
+	case network.MsgTypeAuth:
+		s.handleAuth(sess, packet)
 	case network.MsgTypeCreateRoom:
 		s.handleCreateRoom(sess, packet)
 	case network.MsgTypeJoinRoom:
 		s.handleJoinRoom(sess, packet)
 	case network.MsgTypeLeaveRoom:
 		s.handleLeaveRoom(sess, packet)
+	case network.MsgTypeKickPlayer:
+		s.handleKickPlayer(sess, packet)
+	case network.MsgTypeLockRoom:
+		s.handleLockRoom(sess, packet)
+	case network.MsgTypeRoomSettings:
+		s.handleRoomSettings(sess, packet)
+	case network.MsgTypeStartGame:
+		s.handleStartGame(sess, packet)
+	case network.MsgTypeReady:
+		s.handleReady(sess, packet)
+	case network.MsgTypeChangeSeat:
+		s.handleChangeSeat(sess, packet)
 	case network.MsgTypePlayerAction:
 		s.handleGameAction(sess, packet)
+	case network.MsgTypeGameHistory:
+		s.handleGameHistory(sess, packet)
+	case network.MsgTypeGetProfile:
+		s.handleGetProfile(sess, packet)
+	case network.MsgTypeUpdateProfile:
+		s.handleUpdateProfile(sess, packet)
+	case network.MsgTypeInventory:
+		s.handleInventory(sess, packet)
+	case network.MsgTypeJackpot:
+		s.handleJackpot(sess, packet)
 	default:
 		logger.Log.Infof("Unknown message type: %d", packet.MsgID)
 	}
 }
 
+// handleAuth 校验接入层签发的票据，绑定会话的用户身份并返回玩家资料，首次登录时自动创建资料。
+// 重启前所在的房间仍为其保留座位时自动重新加入。
+func (s *GameServer) handleAuth(session *session.Session, packet *network.Packet) {
+	var req struct {
+		Ticket string `json:"ticket"`
+		UserID int64  `json:"user_id"` // 只在信任客户端 user_id 的本地调试中使用
+	}
+	if err := json.Unmarshal(packet.Data, &req); err != nil {
+		s.sendError(session, packet.MsgID, errInvalidRequest)
+		return
+	}
+	switch {
+	case req.Ticket != "":
+		userID, err := auth.VerifyTicket(s.authSecret, req.Ticket, time.Now())
+		if err != nil {
+			s.sendError(session, packet.MsgID, err)
+			return
+		}
+		req.UserID = userID
+	case !s.trustUserID:
+		s.sendError(session, packet.MsgID, errNotAuthenticated)
+		return
+	case req.UserID <= 0:
+		s.sendError(session, packet.MsgID, errInvalidUserID)
+		return
+	}
+	player, err := s.loadPlayer(req.UserID)
+	if err != nil {
+		logger.Log.Errorf("Failed to load profile of user %d: %v", req.UserID, err)
+		s.sendError(session, packet.MsgID, errNoProfile)
+		return
+	}
+	previous := session.GetUserID()
+	if err := s.bindUser(session, req.UserID); err != nil && !errors.Is(err, room.ErrPlayerKicked) {
+		s.releaseUser(req.UserID)
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+	// 释放之前的引用，重复登录同一用户时引用数不变
+	s.releaseUser(previous)
+
+	resp := map[string]interface{}{"user_id": req.UserID, "player": player}
+	if session.RoomID == "" {
+		if r := s.roomManager.FindReservedRoom(req.UserID); r != nil {
+			if err := r.Join(session); err != nil {
+				logger.Log.Warnf("User %d failed to rejoin room %s: %v", req.UserID, r.GetID(), err)
+			} else {
+				logger.Log.Infof("User %d rejoined restored room %s", req.UserID, r.GetID())
+				resp["room_id"] = r.GetID()
+				s.playerJoined(r, session)
+			}
+		}
+	}
+
+	data, _ := json.Marshal(resp)
+	session.Send(network.MsgTypeAuth, data)
+}
+
+// loadPlayer 将登录玩家的资料载入缓存，首次登录的玩家先创建资料
+func (s *GameServer) loadPlayer(userID int64) (*models.PlayerData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	player, created, err := s.profileService.Login(ctx, userID)
+	if created {
+		logger.Log.Infof("Created profile for user %d", userID)
+	}
+	return player, err
+}
+
+// bindUser 绑定会话的用户。会话在房间中时由房间协程绑定，
+// 用户曾被踢出该房间时会话被移出房间并收到踢出通知，返回 room.ErrPlayerKicked
+func (s *GameServer) bindUser(session *session.Session, userID int64) error {
+	r, exists := s.roomManager.GetRoom(session.RoomID)
+	if session.RoomID == "" || !exists {
+		session.SetUserID(userID)
+		return nil
+	}
+
+	err := r.Authenticate(session, userID)
+	switch {
+	case errors.Is(err, room.ErrRoomClosed):
+		session.SetUserID(userID)
+		return nil
+	case errors.Is(err, room.ErrPlayerKicked):
+		logger.Log.Infof("User %d was kicked from room %s, removing session %s", userID, r.GetID(), session.GetID())
+		data, _ := json.Marshal(map[string]string{"room_id": r.GetID()})
+		session.Send(network.MsgTypeKickPlayer, data)
+		if r.PlayerCount() == 0 {
+			s.roomManager.RemoveRoom(r.GetID())
+		}
+	}
+	return err
+}
+
+// releasePlayer 会话下线或切换用户时释放缓存的玩家资料
+func (s *GameServer) releasePlayer(session *session.Session) {
+	s.releaseUser(session.GetUserID())
+}
+
+// releaseUser 释放 userID 缓存的玩家资料的一个引用，userID 为 0 时不做处理
+func (s *GameServer) releaseUser(userID int64) {
+	if userID == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := s.playerCache.Release(ctx, userID); err != nil {
+		logger.Log.Errorf("Failed to flush player %d: %v", userID, err)
+	}
+}
+
+// handleCreateRoom 创建 game_type 的房间并加入，max_players 为 0 时使用默认人数，超过游戏的上限时取上限
 func (s *GameServer) handleCreateRoom(session *session.Session, packet *network.Packet) {
+	var req struct {
+		GameType   string `json:"game_type"`
+		MaxPlayers int    `json:"max_players,omitempty"`
+	}
+	if len(packet.Data) > 0 {
+		if err := json.Unmarshal(packet.Data, &req); err != nil || req.MaxPlayers < 0 {
+			s.sendError(session, packet.MsgID, errInvalidRequest)
+			return
+		}
+	}
+	if req.GameType == "" {
+		req.GameType = defaultGameType
+	}
+	maxPlayers, err := state.RoomMaxPlayers(req.GameType, req.MaxPlayers)
+	if err != nil {
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+
 	roomID := uuid.New().String()
-	room := s.roomManager.CreateRoom(roomID, "New Room", "slot_machine", 4, s.broadcaster)
+	room := s.roomManager.CreateRoom(roomID, "New Room", req.GameType, maxPlayers, s.broadcaster)
 	room.AddPlayer(session)
+	s.playerJoined(room, session)
 
 	logger.Log.Infof("Session %s created room %s", session.GetID(), roomID)
 
@@ -155,17 +462,234 @@ func (s *GameServer) handleJoinRoom(session *session.Session, packet *network.Pa
 		return
 	}
 
-	if room.AddPlayer(session) {
-		logger.Log.Infof("Session %s joined room %s", session.GetID(), roomID)
-	} else {
-		// 房间已满
+	if err := room.Join(session); err != nil {
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+	s.playerJoined(room, session)
+	logger.Log.Infof("Session %s joined room %s", session.GetID(), roomID)
+}
+
+// playerJoined 向发件箱写入玩家加入房间的事件，写入失败只记录日志
+func (s *GameServer) playerJoined(r *room.Room, session *session.Session) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	err := events.Append(ctx, s.db, events.TypePlayerJoined, r.GetID(), events.PlayerJoined{
+		RoomID:    r.GetID(),
+		GameType:  r.GetGameType(),
+		UserID:    session.GetUserID(),
+		SessionID: session.GetID(),
+	})
+	if err != nil {
+		logger.Log.Errorf("Failed to record player joined event for room %s: %v", r.GetID(), err)
 	}
 }
 
 func (s *GameServer) handleLeaveRoom(session *session.Session, packet *network.Packet) {
-	if session.RoomID != "" {
-		s.roomManager.GetRoom(session.RoomID)
+	s.leaveRoom(session)
+}
+
+// leaveRoom 将玩家移出当前房间，房间空了则关闭
+func (s *GameServer) leaveRoom(session *session.Session) {
+	if session.RoomID == "" {
+		return
+	}
+
+	room, exists := s.roomManager.GetRoom(session.RoomID)
+	if !exists {
+		session.RoomID = ""
+		return
 	}
+
+	room.RemovePlayer(session.GetID())
+	logger.Log.Infof("Session %s left room %s", session.GetID(), room.GetID())
+	if room.PlayerCount() == 0 {
+		s.roomManager.RemoveRoom(room.GetID())
+	}
+}
+
+// currentRoom 返回玩家所在的房间，不在房间时回复错误
+func (s *GameServer) currentRoom(session *session.Session, msgID uint16) (*room.Room, bool) {
+	if session.RoomID == "" {
+		s.sendError(session, msgID, room.ErrPlayerNotFound)
+		return nil, false
+	}
+
+	r, exists := s.roomManager.GetRoom(session.RoomID)
+	if !exists {
+		s.sendError(session, msgID, room.ErrPlayerNotFound)
+		return nil, false
+	}
+	return r, true
+}
+
+func (s *GameServer) handleKickPlayer(session *session.Session, packet *network.Packet) {
+	var req struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := json.Unmarshal(packet.Data, &req); err != nil {
+		return
+	}
+
+	r, ok := s.currentRoom(session, packet.MsgID)
+	if !ok {
+		return
+	}
+
+	target, err := r.KickPlayer(session.GetID(), req.SessionID)
+	if err != nil {
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+	logger.Log.Infof("Host %s kicked session %s from room %s", session.GetID(), target.GetID(), r.GetID())
+
+	data, _ := json.Marshal(map[string]string{"room_id": r.GetID()})
+	target.Send(network.MsgTypeKickPlayer, data)
+}
+
+func (s *GameServer) handleLockRoom(session *session.Session, packet *network.Packet) {
+	var req struct {
+		Locked bool `json:"locked"`
+	}
+	if err := json.Unmarshal(packet.Data, &req); err != nil {
+		return
+	}
+
+	r, ok := s.currentRoom(session, packet.MsgID)
+	if !ok {
+		return
+	}
+
+	if err := r.SetLocked(session.GetID(), req.Locked); err != nil {
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+	logger.Log.Infof("Host %s set room %s locked=%v", session.GetID(), r.GetID(), req.Locked)
+}
+
+func (s *GameServer) handleRoomSettings(session *session.Session, packet *network.Packet) {
+	var settings room.RoomSettings
+	if err := json.Unmarshal(packet.Data, &settings); err != nil {
+		return
+	}
+
+	r, ok := s.currentRoom(session, packet.MsgID)
+	if !ok {
+		return
+	}
+
+	if err := r.UpdateSettings(session.GetID(), settings); err != nil {
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+
+	data, _ := json.Marshal(settings)
+	r.Broadcast(network.MsgTypeRoomSettings, data)
+}
+
+func (s *GameServer) handleStartGame(session *session.Session, packet *network.Packet) {
+	r, ok := s.currentRoom(session, packet.MsgID)
+	if !ok {
+		return
+	}
+
+	if err := r.StartGame(session.GetID()); err != nil {
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+	logger.Log.Infof("Host %s started the game in room %s", session.GetID(), r.GetID())
+}
+
+func (s *GameServer) handleReady(session *session.Session, packet *network.Packet) {
+	var req struct {
+		Ready bool `json:"ready"`
+	}
+	if err := json.Unmarshal(packet.Data, &req); err != nil {
+		return
+	}
+
+	r, ok := s.currentRoom(session, packet.MsgID)
+	if !ok {
+		return
+	}
+
+	if err := r.SetReady(session.GetID(), req.Ready); err != nil {
+		s.sendError(session, packet.MsgID, err)
+	}
+}
+
+func (s *GameServer) handleChangeSeat(session *session.Session, packet *network.Packet) {
+	var req struct {
+		Seat int `json:"seat"`
+	}
+	if err := json.Unmarshal(packet.Data, &req); err != nil {
+		return
+	}
+
+	r, ok := s.currentRoom(session, packet.MsgID)
+	if !ok {
+		return
+	}
+
+	if err := r.ChangeSeat(session.GetID(), req.Seat); err != nil {
+		s.sendError(session, packet.MsgID, err)
+	}
+}
+
+// handleGameHistory 查询当前登录用户的历史对局，from/to 为 Unix 秒，cursor 取自上一页的 next_cursor
+func (s *GameServer) handleGameHistory(session *session.Session, packet *network.Packet) {
+	if session.GetUserID() == 0 {
+		s.sendError(session, packet.MsgID, errNotAuthenticated)
+		return
+	}
+
+	var req struct {
+		GameType string `json:"game_type"`
+		From     int64  `json:"from"`
+		To       int64  `json:"to"`
+		Cursor   string `json:"cursor"`
+		Limit    int    `json:"limit"`
+	}
+	if len(packet.Data) > 0 {
+		if err := json.Unmarshal(packet.Data, &req); err != nil {
+			s.sendError(session, packet.MsgID, errInvalidRequest)
+			return
+		}
+	}
+
+	query := &models.GameHistoryQuery{
+		UserID:   session.GetUserID(),
+		GameType: req.GameType,
+		Cursor:   req.Cursor,
+		Limit:    req.Limit,
+	}
+	if req.From > 0 {
+		query.From = time.Unix(req.From, 0)
+	}
+	if req.To > 0 {
+		query.To = time.Unix(req.To, 0)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	page, err := s.playerService.GetGameHistory(ctx, query)
+	if err != nil {
+		logger.Log.Warnf("User %d failed to query game history: %v", session.GetUserID(), err)
+		s.sendError(session, packet.MsgID, err)
+		return
+	}
+
+	data, _ := json.Marshal(page)
+	session.Send(network.MsgTypeGameHistory, data)
+}
+
+// sendError 向客户端回复请求失败的原因
+func (s *GameServer) sendError(session *session.Session, msgID uint16, err error) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"msg_id": msgID,
+		"error":  err.Error(),
+	})
+	session.Send(network.MsgTypeError, data)
 }
 
 func (s *GameServer) handleGameAction(session *session.Session, packet *network.Packet) {
@@ -180,13 +704,8 @@ func (s *GameServer) handleGameAction(session *session.Session, packet *network.
 		return
 	}
 
-	currentState := room.StateMachine.GetCurrentState()
-	if currentState == nil {
-		logger.Log.Errorf("Room %s has a nil state", room.GetID())
-		return
-	}
-
-	if err := currentState.HandleAction(session, packet.Data); err != nil {
+	if err := room.HandleAction(session, packet.Data); err != nil {
 		logger.Log.Errorf("Error handling action in room %s: %v", room.GetID(), err)
+		s.sendError(session, packet.MsgID, err)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+	"github.com/wfunc/gameserver/room"
+)
+
+// roomSnapshotStore 将房间快照保存到数据库的 rooms 表
+type roomSnapshotStore struct {
+	db persistence.Database
+}
+
+func newRoomSnapshotStore(db persistence.Database) *roomSnapshotStore {
+	return &roomSnapshotStore{db: db}
+}
+
+func (s *roomSnapshotStore) SaveSnapshot(snapshot *room.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// 成员按 user_id 建立索引写入 players 列，便于查询
+	players := make(map[string]interface{}, len(snapshot.Members))
+	for _, member := range snapshot.Members {
+		players[strconv.FormatInt(member.UserID, 10)] = member
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return s.db.Rooms().SaveRoomState(ctx, &models.RoomState{
+		RoomID:   snapshot.RoomID,
+		GameType: snapshot.GameType,
+		State:    snapshot.StateID,
+		Players:  players,
+		Snapshot: data,
+	})
+}
+
+func (s *roomSnapshotStore) LoadSnapshots() ([]*room.Snapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	roomIDs, err := s.db.Rooms().ListRoomIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*room.Snapshot, 0, len(roomIDs))
+	for _, roomID := range roomIDs {
+		state, err := s.db.Rooms().LoadRoomState(ctx, roomID)
+		if err != nil {
+			logger.Log.Warnf("Failed to load snapshot of room %s: %v", roomID, err)
+			continue
+		}
+		snapshot := &room.Snapshot{}
+		if err := json.Unmarshal(state.Snapshot, snapshot); err != nil {
+			logger.Log.Warnf("Failed to decode snapshot of room %s: %v", roomID, err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+func (s *roomSnapshotStore) DeleteSnapshot(roomID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return s.db.Rooms().DeleteRoomState(ctx, roomID)
+}
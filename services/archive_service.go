@@ -0,0 +1,225 @@
+// services/archive_service.go
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+	"github.com/wfunc/gameserver/timer"
+)
+
+const (
+	// archiveBatchSize 每批从数据库移出的记录数
+	archiveBatchSize = 500
+	// archiveBatchTimeout 归档或恢复一批记录的超时时间
+	archiveBatchTimeout = time.Minute
+)
+
+// RetentionPolicy 游戏记录在数据库中保留的天数，0 表示永久保留
+type RetentionPolicy struct {
+	DefaultDays int
+	GameDays    map[string]int // 按游戏类型覆盖 DefaultDays
+}
+
+// Days 返回游戏类型的保留天数
+func (p RetentionPolicy) Days(gameType string) int {
+	if days, ok := p.GameDays[gameType]; ok {
+		return days
+	}
+	return p.DefaultDays
+}
+
+// ArchiveService 将超过保留期的游戏记录移出数据库，写入按游戏类型和月份划分的
+// gzip 压缩 JSON Lines 文件: <dir>/<game_type>/<YYYY-MM>.jsonl.gz。
+// 先写文件再删除记录，中途失败时同一条记录可能被归档两次，恢复时按 ID 去重
+type ArchiveService struct {
+	db      persistence.Database
+	policy  RetentionPolicy
+	dir     string
+	running sync.Mutex // 同一时间只执行一次归档
+	now     func() time.Time
+}
+
+// NewArchiveService 创建归档服务，dir 为归档文件的根目录
+func NewArchiveService(db persistence.Database, policy RetentionPolicy, dir string) *ArchiveService {
+	return &ArchiveService{db: db, policy: policy, dir: dir, now: time.Now}
+}
+
+// Schedule 使用定时器每隔 interval 执行一次归档，返回定时器 ID
+func (s *ArchiveService) Schedule(timers *timer.TimerManager, interval time.Duration) int64 {
+	return timers.AddTimer(interval, interval, func() {
+		// 上一次归档还没结束时跳过本次
+		if !s.running.TryLock() {
+			logger.Log.Warn("Previous game record archival still running, skipping")
+			return
+		}
+		defer s.running.Unlock()
+
+		archived, err := s.archive(context.Background())
+		if err != nil {
+			logger.Log.Errorf("Failed to archive game records: %v", err)
+		}
+		if archived > 0 {
+			logger.Log.Infof("Archived %d game records to %s", archived, s.dir)
+		}
+	})
+}
+
+// Archive 归档所有超过保留期的记录，返回归档的记录数
+func (s *ArchiveService) Archive(ctx context.Context) (int, error) {
+	s.running.Lock()
+	defer s.running.Unlock()
+	return s.archive(ctx)
+}
+
+func (s *ArchiveService) archive(ctx context.Context) (int, error) {
+	gameTypes, err := s.db.GameRecords().ListGameTypes(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, gameType := range gameTypes {
+		days := s.policy.Days(gameType)
+		if days <= 0 {
+			continue
+		}
+		before := s.now().AddDate(0, 0, -days)
+		archived, err := s.archiveGameType(ctx, gameType, before)
+		total += archived
+		if err != nil {
+			return total, fmt.Errorf("archive %s: %w", gameType, err)
+		}
+	}
+	return total, nil
+}
+
+// archiveGameType 分批归档一个游戏类型中创建时间早于 before 的记录
+func (s *ArchiveService) archiveGameType(ctx context.Context, gameType string, before time.Time) (int, error) {
+	total := 0
+	for {
+		batchCtx, cancel := context.WithTimeout(ctx, archiveBatchTimeout)
+		archived, err := s.archiveBatch(batchCtx, gameType, before)
+		cancel()
+		total += archived
+		if err != nil || archived < archiveBatchSize {
+			return total, err
+		}
+	}
+}
+
+func (s *ArchiveService) archiveBatch(ctx context.Context, gameType string, before time.Time) (int, error) {
+	records, err := s.db.GameRecords().ListGameRecordsBefore(ctx, gameType, before, archiveBatchSize)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+
+	byMonth := make(map[string][]*models.GameRecord)
+	for _, record := range records {
+		month := record.CreatedAt.UTC().Format("2006-01")
+		byMonth[month] = append(byMonth[month], record)
+	}
+	for month, monthRecords := range byMonth {
+		if err := appendArchive(s.archivePath(gameType, month), monthRecords); err != nil {
+			return 0, err
+		}
+	}
+
+	ids := make([]int64, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	if err := s.db.GameRecords().DeleteGameRecords(ctx, ids); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// archivePath 返回归档文件的路径，游戏类型中的路径分隔符等字符会被替换
+func (s *ArchiveService) archivePath(gameType, month string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, gameType)
+	return filepath.Join(s.dir, safe, month+".jsonl.gz")
+}
+
+// appendArchive 将记录作为一个新的 gzip 成员追加到归档文件末尾并刷到磁盘
+func appendArchive(path string, records []*models.GameRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gz)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Restore 将归档文件中的记录写回数据库，已存在的记录跳过，返回写回和跳过的记录数
+func (s *ArchiveService) Restore(ctx context.Context, path string) (restored, skipped int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	// 归档文件由多个 gzip 成员拼接而成，gzip.Reader 默认连续读取
+	gz, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer gz.Close()
+
+	decoder := json.NewDecoder(gz)
+	for {
+		var record models.GameRecord
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			return restored, skipped, nil
+		} else if err != nil {
+			return restored, skipped, fmt.Errorf("read %s: %w", path, err)
+		}
+		if record.ID == 0 {
+			return restored, skipped, fmt.Errorf("read %s: record without id", path)
+		}
+
+		recordCtx, cancel := context.WithTimeout(ctx, archiveBatchTimeout)
+		ok, err := s.db.GameRecords().RestoreGameRecord(recordCtx, &record)
+		cancel()
+		if err != nil {
+			return restored, skipped, err
+		}
+		if ok {
+			restored++
+		} else {
+			skipped++
+		}
+	}
+}
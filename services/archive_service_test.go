@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+func saveTestRecord(t *testing.T, db persistence.Database, gameType string, createdAt time.Time) *models.GameRecord {
+	t.Helper()
+	record := &models.GameRecord{
+		RoomID:    "room_1",
+		GameType:  gameType,
+		Players:   []models.PlayerInfo{{UserID: 1, Outcome: models.OutcomeWin}},
+		Result:    map[string]interface{}{"winner": "1"},
+		StartTime: createdAt,
+		EndTime:   createdAt,
+		CreatedAt: createdAt,
+	}
+	if err := db.GameRecords().SaveGameRecord(context.Background(), record); err != nil {
+		t.Fatalf("Failed to save game record: %v", err)
+	}
+	return record
+}
+
+func history(t *testing.T, db persistence.Database) []models.GameHistoryEntry {
+	t.Helper()
+	page, err := db.GameRecords().QueryGameHistory(context.Background(), &models.GameHistoryQuery{UserID: 1, Limit: 100})
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+	return page.Entries
+}
+
+func TestArchiveService_ArchiveAndRestore(t *testing.T) {
+	ctx := context.Background()
+	db := persistence.NewMemory()
+	dir := t.TempDir()
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	old := saveTestRecord(t, db, "slot", time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC))
+	saveTestRecord(t, db, "slot", now.AddDate(0, 0, -1))
+	saveTestRecord(t, db, "poker", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// poker 配置为 0，永久保留
+	archiver := NewArchiveService(db, RetentionPolicy{DefaultDays: 30, GameDays: map[string]int{"poker": 0}}, dir)
+	archiver.now = func() time.Time { return now }
+
+	archived, err := archiver.Archive(ctx)
+	if err != nil || archived != 1 {
+		t.Fatalf("Expected 1 archived record, got %d, %v", archived, err)
+	}
+	if entries := history(t, db); len(entries) != 2 {
+		t.Fatalf("Expected 2 records left in the database, got %+v", entries)
+	}
+
+	path := filepath.Join(dir, "slot", "2024-01.jsonl.gz")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected archive file %s: %v", path, err)
+	}
+
+	// 再次归档没有新的过期记录
+	if archived, err := archiver.Archive(ctx); err != nil || archived != 0 {
+		t.Fatalf("Expected nothing to archive, got %d, %v", archived, err)
+	}
+
+	restored, skipped, err := archiver.Restore(ctx, path)
+	if err != nil || restored != 1 || skipped != 0 {
+		t.Fatalf("Expected 1 restored record, got %d restored, %d skipped, %v", restored, skipped, err)
+	}
+	found := false
+	for _, entry := range history(t, db) {
+		if entry.RecordID == old.ID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected record %d to be restored with its id", old.ID)
+	}
+
+	// 已存在的记录不会重复写入
+	if restored, skipped, err := archiver.Restore(ctx, path); err != nil || restored != 0 || skipped != 1 {
+		t.Errorf("Expected the record to be skipped, got %d restored, %d skipped, %v", restored, skipped, err)
+	}
+
+	// 恢复后新保存的记录不会与恢复的 ID 冲突
+	if record := saveTestRecord(t, db, "slot", now); record.ID <= old.ID {
+		t.Errorf("Expected a new id after %d, got %d", old.ID, record.ID)
+	}
+}
+
+func TestArchiveService_AppendsToMonthlyFile(t *testing.T) {
+	ctx := context.Background()
+	db := persistence.NewMemory()
+	dir := t.TempDir()
+	now := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	archiver := NewArchiveService(db, RetentionPolicy{DefaultDays: 30}, dir)
+	archiver.now = func() time.Time { return now }
+
+	saveTestRecord(t, db, "slot", time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC))
+	archiver.Archive(ctx)
+	saveTestRecord(t, db, "slot", time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC))
+	archiver.Archive(ctx)
+
+	// 两次归档追加到同一个文件，恢复时两个 gzip 成员都能读出
+	restored, _, err := archiver.Restore(ctx, filepath.Join(dir, "slot", "2024-01.jsonl.gz"))
+	if err != nil || restored != 2 {
+		t.Errorf("Expected 2 restored records, got %d, %v", restored, err)
+	}
+}
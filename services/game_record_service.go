@@ -0,0 +1,121 @@
+// services/game_record_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wfunc/gameserver/events"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+const (
+	// recordQueueSize 等待保存的游戏记录上限，队列满时丢弃新记录
+	recordQueueSize = 1024
+	// recordMaxAttempts 保存一条记录的最大尝试次数
+	recordMaxAttempts = 5
+	// recordRetryDelay 第一次重试前的等待时间，之后每次翻倍
+	recordRetryDelay = 200 * time.Millisecond
+	// recordSaveTimeout 单次保存的超时时间
+	recordSaveTimeout = 5 * time.Second
+)
+
+// GameRecordService 在后台协程中异步保存游戏记录，保存失败时按指数退避重试。
+// 房间在每局结束时调用 RecordGame，不会被数据库阻塞。
+// 每条记录带有唯一的 RoundID，提交超时但实际已写入的记录重试时不会重复保存
+type GameRecordService struct {
+	db         persistence.Database
+	queue      chan *models.GameRecord
+	retryDelay time.Duration
+	retries    sync.WaitGroup // 等待重试的记录
+	closed     bool
+	mutex      sync.RWMutex
+	done       chan struct{}
+}
+
+// NewGameRecordService 创建游戏记录服务并启动保存协程
+func NewGameRecordService(db persistence.Database) *GameRecordService {
+	s := &GameRecordService{
+		db:         db,
+		queue:      make(chan *models.GameRecord, recordQueueSize),
+		retryDelay: recordRetryDelay,
+		done:       make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// RecordGame 将游戏记录加入保存队列，队列已满或服务已关闭时丢弃并记录日志
+func (s *GameRecordService) RecordGame(record *models.GameRecord) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.closed {
+		logger.Log.Warnf("Game record service closed, dropping record of room %s", record.RoomID)
+		return
+	}
+	if record.RoundID == "" {
+		record.RoundID = uuid.New().String()
+	}
+
+	select {
+	case s.queue <- record:
+	default:
+		logger.Log.Errorf("Game record queue full, dropping record of room %s", record.RoomID)
+	}
+}
+
+// Close 停止接收新记录，并等待队列中和等待重试的记录保存完毕
+func (s *GameRecordService) Close() {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+	<-s.done
+}
+
+func (s *GameRecordService) run() {
+	defer close(s.done)
+	for record := range s.queue {
+		s.save(record, 1, s.retryDelay)
+	}
+	s.retries.Wait()
+}
+
+// save 在一个事务中保存记录并写入 round.settled 事件。失败时由定时器在 delay 后重试，
+// 不阻塞队列中的其他记录，第 recordMaxAttempts 次失败后放弃
+func (s *GameRecordService) save(record *models.GameRecord, attempt int, delay time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), recordSaveTimeout)
+	err := s.db.Transaction(ctx, func(tx persistence.Tx) error {
+		if err := tx.GameRecords().SaveGameRecord(ctx, record); err != nil {
+			return err
+		}
+		return events.Append(ctx, tx, events.TypeRoundSettled, record.RoomID, record)
+	})
+	cancel()
+	if err == nil {
+		return
+	}
+	// 之前的尝试已经提交，记录和事件都已写入
+	if errors.Is(err, persistence.ErrDuplicateRecord) {
+		logger.Log.Infof("Game record %s of room %s was already saved", record.RoundID, record.RoomID)
+		return
+	}
+	if attempt >= recordMaxAttempts {
+		logger.Log.Errorf("Failed to save game record of room %s after %d attempts: %v", record.RoomID, attempt, err)
+		return
+	}
+	logger.Log.Warnf("Failed to save game record of room %s (attempt %d), retrying in %v: %v", record.RoomID, attempt, delay, err)
+	s.retries.Add(1)
+	time.AfterFunc(delay, func() {
+		defer s.retries.Done()
+		s.save(record, attempt+1, delay*2)
+	})
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/events"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	os.Exit(m.Run())
+}
+
+// flakyDatabase fails the first `failures` saves and records the rest.
+// Everything else, including the outbox, is served by an in-memory database.
+type flakyDatabase struct {
+	*persistence.Memory
+	persistence.GameRecordRepository
+	failures int
+	attempts int
+	saved    []*models.GameRecord
+	mutex    sync.Mutex
+}
+
+func newFlakyDatabase(failures int) *flakyDatabase {
+	return &flakyDatabase{Memory: persistence.NewMemory(), failures: failures}
+}
+
+func (db *flakyDatabase) GameRecords() persistence.GameRecordRepository { return db }
+
+func (db *flakyDatabase) Transaction(ctx context.Context, fn func(tx persistence.Tx) error) error {
+	return fn(db)
+}
+
+func (db *flakyDatabase) SaveGameRecord(ctx context.Context, record *models.GameRecord) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.attempts++
+	if db.attempts <= db.failures {
+		return errors.New("connection refused")
+	}
+	db.saved = append(db.saved, record)
+	return nil
+}
+
+func newTestRecordService(db persistence.Database) *GameRecordService {
+	s := NewGameRecordService(db)
+	s.retryDelay = time.Millisecond
+	return s
+}
+
+func TestGameRecordService_RetriesUntilSaved(t *testing.T) {
+	db := newFlakyDatabase(2)
+	s := newTestRecordService(db)
+	s.RecordGame(&models.GameRecord{RoomID: "room_1"})
+	s.Close()
+
+	if db.attempts != 3 || len(db.saved) != 1 {
+		t.Errorf("Expected the record to be saved on the third attempt, got %d attempts and %d saved", db.attempts, len(db.saved))
+	}
+	pending, _ := db.Outbox().ClaimEvents(context.Background(), 10, time.Minute)
+	if len(pending) != 1 || pending[0].Type != events.TypeRoundSettled || pending[0].Key != "room_1" {
+		t.Errorf("Expected one round.settled event for room_1, got %+v", pending)
+	}
+}
+
+func TestGameRecordService_GivesUpAfterMaxAttempts(t *testing.T) {
+	db := newFlakyDatabase(recordMaxAttempts + 1)
+	s := newTestRecordService(db)
+	s.RecordGame(&models.GameRecord{RoomID: "room_1"})
+	s.Close()
+
+	if db.attempts != recordMaxAttempts || len(db.saved) != 0 {
+		t.Errorf("Expected %d attempts and nothing saved, got %d attempts and %d saved", recordMaxAttempts, db.attempts, len(db.saved))
+	}
+}
+
+func TestGameRecordService_CloseDrainsQueue(t *testing.T) {
+	db := newFlakyDatabase(0)
+	s := newTestRecordService(db)
+	for i := 0; i < 10; i++ {
+		s.RecordGame(&models.GameRecord{RoomID: "room_1"})
+	}
+	s.Close()
+	// 关闭后的记录被丢弃而不是 panic
+	s.RecordGame(&models.GameRecord{RoomID: "room_1"})
+
+	if len(db.saved) != 10 {
+		t.Errorf("Expected all 10 queued records to be saved, got %d", len(db.saved))
+	}
+}
+
+// lostCommitDatabase commits the first `lost` transactions but reports a timeout,
+// as when the connection drops while waiting for the commit to be acknowledged.
+type lostCommitDatabase struct {
+	*persistence.Memory
+	lost int
+}
+
+func (db *lostCommitDatabase) Transaction(ctx context.Context, fn func(tx persistence.Tx) error) error {
+	err := db.Memory.Transaction(ctx, fn)
+	if err == nil && db.lost > 0 {
+		db.lost--
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func TestGameRecordService_RetryAfterLostCommitSavesOnce(t *testing.T) {
+	db := &lostCommitDatabase{Memory: persistence.NewMemory(), lost: 1}
+	s := newTestRecordService(db)
+	s.RecordGame(&models.GameRecord{RoomID: "room_1", GameType: "slot_machine", CreatedAt: time.Now()})
+	s.Close()
+
+	ctx := context.Background()
+	records, _ := db.GameRecords().ListGameRecordsBefore(ctx, "slot_machine", time.Now().Add(time.Hour), 10)
+	if len(records) != 1 || records[0].RoundID == "" {
+		t.Errorf("Expected the record to be saved once with a round ID, got %+v", records)
+	}
+	pending, _ := db.Outbox().ClaimEvents(ctx, 10, time.Minute)
+	if len(pending) != 1 {
+		t.Errorf("Expected a single round.settled event, got %d", len(pending))
+	}
+}
+
+func TestGameRecordService_RetryDoesNotBlockQueue(t *testing.T) {
+	db := newFlakyDatabase(1)
+	s := NewGameRecordService(db)
+	s.retryDelay = 50 * time.Millisecond
+	s.RecordGame(&models.GameRecord{RoomID: "room_1"})
+	s.RecordGame(&models.GameRecord{RoomID: "room_2"})
+	s.Close()
+
+	// room_1 等待重试时 room_2 先保存
+	if len(db.saved) != 2 || db.saved[0].RoomID != "room_2" || db.saved[1].RoomID != "room_1" {
+		t.Errorf("Expected room_2 to be saved while room_1 waits for its retry, got %d saved", len(db.saved))
+	}
+}
@@ -0,0 +1,232 @@
+// services/inventory_service.go
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wfunc/gameserver/events"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+	"github.com/wfunc/gameserver/timer"
+)
+
+const (
+	// maxGrantQuantity 一次发放的物品数量上限
+	maxGrantQuantity = 1000
+	// itemExpireBatchSize 每批清理的过期物品格数
+	itemExpireBatchSize = 500
+	// itemExpireTimeout 清理一批过期物品的超时时间
+	itemExpireTimeout = time.Minute
+)
+
+// ItemFreeSpinTicket 免费 spin 券，效果 spin_bet 为代替金币的下注额
+const ItemFreeSpinTicket = "free_spin_ticket"
+
+var (
+	// ErrUnknownItem 物品不在物品目录中
+	ErrUnknownItem = fmt.Errorf("unknown item")
+	// ErrInvalidQuantity 物品数量不是正数或超过上限
+	ErrInvalidQuantity = fmt.Errorf("quantity must be between 1 and %d", maxGrantQuantity)
+)
+
+// ItemCatalog 物品目录，启动后只读
+type ItemCatalog struct {
+	items map[string]models.ItemDef
+}
+
+// NewItemCatalog 创建物品目录，ID 重复时后者覆盖前者
+func NewItemCatalog(defs ...models.ItemDef) *ItemCatalog {
+	c := &ItemCatalog{items: make(map[string]models.ItemDef, len(defs))}
+	for _, def := range defs {
+		c.items[def.ID] = def
+	}
+	return c
+}
+
+// DefaultItems 返回没有配置物品目录时使用的物品
+func DefaultItems() []models.ItemDef {
+	return []models.ItemDef{{
+		ID:        ItemFreeSpinTicket,
+		Name:      "Free Spin Ticket",
+		Stackable: true,
+		Effects:   map[string]interface{}{"spin_bet": 10},
+	}}
+}
+
+// Get 返回物品定义
+func (c *ItemCatalog) Get(itemID string) (models.ItemDef, bool) {
+	def, ok := c.items[itemID]
+	return def, ok
+}
+
+// List 返回全部物品定义，按 ID 排序
+func (c *ItemCatalog) List() []models.ItemDef {
+	defs := make([]models.ItemDef, 0, len(c.items))
+	for _, def := range c.items {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].ID < defs[j].ID })
+	return defs
+}
+
+// InventoryService 玩家背包。物品的发放、消耗和过期都与 items.changed 事件在同一事务中写入，
+// 并像金币一样记入流水
+type InventoryService struct {
+	db      persistence.Database
+	catalog *ItemCatalog
+	running sync.Mutex // 同一时间只执行一次过期清理
+	now     func() time.Time
+}
+
+// NewInventoryService 创建背包服务
+func NewInventoryService(db persistence.Database, catalog *ItemCatalog) *InventoryService {
+	return &InventoryService{db: db, catalog: catalog, now: time.Now}
+}
+
+// SetCatalog 替换物品目录，需在开始处理请求之前调用
+func (s *InventoryService) SetCatalog(catalog *ItemCatalog) {
+	s.catalog = catalog
+}
+
+// Catalog 返回物品目录
+func (s *InventoryService) Catalog() *ItemCatalog {
+	return s.catalog
+}
+
+// ListItems 返回玩家未过期的物品
+func (s *InventoryService) ListItems(ctx context.Context, userID int64) ([]models.InventoryItem, error) {
+	items, err := s.db.Inventory().ListItems(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	usable := items[:0]
+	for _, item := range items {
+		if !item.Expired(now) {
+			usable = append(usable, item)
+		}
+	}
+	return usable, nil
+}
+
+// Grant 发放物品。有有效期的物品从发放时开始计时，不可堆叠的物品每个单独一格
+func (s *InventoryService) Grant(ctx context.Context, userID int64, itemID string, quantity int64, reason string) error {
+	def, ok := s.catalog.Get(itemID)
+	if !ok {
+		return ErrUnknownItem
+	}
+	if quantity <= 0 || quantity > maxGrantQuantity {
+		return ErrInvalidQuantity
+	}
+
+	var expiresAt *time.Time
+	if def.Lifetime > 0 {
+		expires := s.now().Add(def.Lifetime)
+		expiresAt = &expires
+	}
+
+	// 可堆叠的物品一次发放一格，否则每格一个
+	slots, perSlot := int64(1), quantity
+	if !def.Stackable {
+		slots, perSlot = quantity, 1
+	}
+	return s.db.Transaction(ctx, func(tx persistence.Tx) error {
+		for i := int64(0); i < slots; i++ {
+			item := &models.InventoryItem{UserID: userID, ItemID: itemID, Quantity: perSlot, ExpiresAt: expiresAt}
+			entry, err := tx.Inventory().GrantItem(ctx, item, def.Stackable, reason)
+			if err != nil {
+				return err
+			}
+			if err := appendItemsChanged(ctx, tx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Consume 消耗玩家 quantity 个未过期的物品并返回物品定义，数量不足时返回 persistence.ErrInsufficientItems
+func (s *InventoryService) Consume(ctx context.Context, userID int64, itemID string, quantity int64, reason string) (models.ItemDef, error) {
+	def, ok := s.catalog.Get(itemID)
+	if !ok {
+		return def, ErrUnknownItem
+	}
+	if quantity <= 0 || quantity > maxGrantQuantity {
+		return def, ErrInvalidQuantity
+	}
+
+	err := s.db.Transaction(ctx, func(tx persistence.Tx) error {
+		entry, err := tx.Inventory().ConsumeItem(ctx, userID, itemID, quantity, s.now(), reason)
+		if err != nil {
+			return err
+		}
+		return appendItemsChanged(ctx, tx, entry)
+	})
+	return def, err
+}
+
+// Schedule 使用定时器每隔 interval 清理一次过期物品，返回定时器 ID
+func (s *InventoryService) Schedule(timers *timer.TimerManager, interval time.Duration) int64 {
+	return timers.AddTimer(interval, interval, func() {
+		if !s.running.TryLock() {
+			return
+		}
+		defer s.running.Unlock()
+
+		expired, err := s.expireItems(context.Background())
+		if err != nil {
+			logger.Log.Errorf("Failed to expire items: %v", err)
+		}
+		if expired > 0 {
+			logger.Log.Infof("Expired %d inventory slots", expired)
+		}
+	})
+}
+
+// ExpireItems 删除所有已过期的物品并记入流水，返回清理的格数
+func (s *InventoryService) ExpireItems(ctx context.Context) (int, error) {
+	s.running.Lock()
+	defer s.running.Unlock()
+	return s.expireItems(ctx)
+}
+
+func (s *InventoryService) expireItems(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		batchCtx, cancel := context.WithTimeout(ctx, itemExpireTimeout)
+		expired := 0
+		err := s.db.Transaction(batchCtx, func(tx persistence.Tx) error {
+			entries, err := tx.Inventory().ExpireItems(batchCtx, s.now(), itemExpireBatchSize)
+			if err != nil {
+				return err
+			}
+			for i := range entries {
+				if err := appendItemsChanged(batchCtx, tx, &entries[i]); err != nil {
+					return err
+				}
+			}
+			expired = len(entries)
+			return nil
+		})
+		cancel()
+		if err != nil {
+			return total, err
+		}
+		total += expired
+		if expired < itemExpireBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// appendItemsChanged 在 tx 中写入物品变动事件
+func appendItemsChanged(ctx context.Context, tx persistence.Tx, entry *models.ItemLedgerEntry) error {
+	return events.Append(ctx, tx, events.TypeItemsChanged, strconv.FormatInt(entry.UserID, 10), entry)
+}
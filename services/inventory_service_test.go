@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/events"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+func newTestInventory(t *testing.T) (*InventoryService, persistence.Database) {
+	t.Helper()
+	db := persistence.NewMemory()
+	catalog := NewItemCatalog(append(DefaultItems(),
+		models.ItemDef{ID: "trophy"},
+		models.ItemDef{ID: "boost", Stackable: true, Lifetime: time.Hour},
+	)...)
+	return NewInventoryService(db, catalog), db
+}
+
+func TestInventoryService_GrantAndConsume(t *testing.T) {
+	ctx := context.Background()
+	s, db := newTestInventory(t)
+
+	if err := s.Grant(ctx, 1, ItemFreeSpinTicket, 2, "signup_bonus"); err != nil {
+		t.Fatalf("Failed to grant: %v", err)
+	}
+	if err := s.Grant(ctx, 1, ItemFreeSpinTicket, 1, "daily_bonus"); err != nil {
+		t.Fatalf("Failed to grant: %v", err)
+	}
+	// 不可堆叠的物品每个单独一格
+	if err := s.Grant(ctx, 1, "trophy", 2, "event"); err != nil {
+		t.Fatalf("Failed to grant: %v", err)
+	}
+
+	items, _ := s.ListItems(ctx, 1)
+	if len(items) != 3 || items[0].ItemID != ItemFreeSpinTicket || items[0].Quantity != 3 {
+		t.Fatalf("Expected one stack of 3 tickets and 2 trophies, got %+v", items)
+	}
+
+	def, err := s.Consume(ctx, 1, ItemFreeSpinTicket, 3, "slot_machine_spin")
+	if err != nil || def.EffectInt("spin_bet") != 10 {
+		t.Fatalf("Expected to consume the tickets, got %+v, %v", def, err)
+	}
+	if _, err := s.Consume(ctx, 1, ItemFreeSpinTicket, 1, "slot_machine_spin"); !errors.Is(err, persistence.ErrInsufficientItems) {
+		t.Errorf("Expected ErrInsufficientItems, got %v", err)
+	}
+
+	ledger, _ := db.Inventory().ListItemLedger(ctx, 1, 0)
+	if len(ledger) != 5 || ledger[0].Delta != -3 || ledger[0].Quantity != 0 || ledger[3].Quantity != 3 {
+		t.Errorf("Unexpected item ledger: %+v", ledger)
+	}
+
+	// 每次变动都写入 items.changed 事件
+	pending, _ := db.Outbox().ClaimEvents(ctx, 10, time.Minute)
+	if len(pending) != 5 || pending[0].Type != events.TypeItemsChanged {
+		t.Errorf("Expected 5 items.changed events, got %+v", pending)
+	}
+}
+
+func TestInventoryService_Validation(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestInventory(t)
+
+	if err := s.Grant(ctx, 1, "gold_bar", 1, "test"); err != ErrUnknownItem {
+		t.Errorf("Expected ErrUnknownItem, got %v", err)
+	}
+	if err := s.Grant(ctx, 1, ItemFreeSpinTicket, 0, "test"); err != ErrInvalidQuantity {
+		t.Errorf("Expected ErrInvalidQuantity, got %v", err)
+	}
+}
+
+func TestInventoryService_Expiry(t *testing.T) {
+	ctx := context.Background()
+	s, db := newTestInventory(t)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	s.Grant(ctx, 1, "boost", 2, "event")
+	now = now.Add(30 * time.Minute)
+	s.Grant(ctx, 1, "boost", 1, "event")
+
+	// 第一批过期后只剩后发放的一个
+	now = now.Add(45 * time.Minute)
+	if items, _ := s.ListItems(ctx, 1); len(items) != 1 || items[0].Quantity != 1 {
+		t.Fatalf("Expected only the later boost to be usable, got %+v", items)
+	}
+	if _, err := s.Consume(ctx, 1, "boost", 2, "test"); !errors.Is(err, persistence.ErrInsufficientItems) {
+		t.Errorf("Expected expired boosts not to be consumable, got %v", err)
+	}
+
+	expired, err := s.ExpireItems(ctx)
+	if err != nil || expired != 1 {
+		t.Fatalf("Expected one expired slot, got %d, %v", expired, err)
+	}
+	ledger, _ := db.Inventory().ListItemLedger(ctx, 1, 1)
+	if len(ledger) != 1 || ledger[0].Reason != persistence.ItemExpiredReason || ledger[0].Delta != -2 || ledger[0].Quantity != 1 {
+		t.Errorf("Expected an expiry ledger entry, got %+v", ledger)
+	}
+}
@@ -0,0 +1,121 @@
+// services/jackpot_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/wfunc/gameserver/events"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+// JackpotReason 领取累积奖池的金币流水原因
+const JackpotReason = "jackpot"
+
+// JackpotSettings 累积奖池的抽成比例和初始金额
+type JackpotSettings struct {
+	Contribution float64 // 每次下注计入奖池的比例，0 到 1 之间
+	Seed         int64   // 奖池创建时和被领取后的金额
+}
+
+// DefaultJackpotSettings 返回默认的奖池设置：抽取 1% 的下注，初始金额 1000
+func DefaultJackpotSettings() JackpotSettings {
+	return JackpotSettings{Contribution: 0.01, Seed: 1000}
+}
+
+// Validate 检查抽成比例和初始金额
+func (s JackpotSettings) Validate() error {
+	if s.Contribution < 0 || s.Contribution >= 1 {
+		return fmt.Errorf("jackpot contribution must be in [0, 1), got %v", s.Contribution)
+	}
+	if s.Seed < 0 {
+		return fmt.Errorf("jackpot seed must not be negative, got %d", s.Seed)
+	}
+	return nil
+}
+
+// JackpotService 多个房间共享的累积奖池。奖池金额保存在数据库中，
+// 多个节点的房间向同一奖池抽成，领取时在数据库中加锁，同一笔奖金只能被领取一次
+type JackpotService struct {
+	db         persistence.Database
+	players    *PlayerCache
+	settings   JackpotSettings
+	remainders map[string]float64 // 每个奖池抽成不足 1 金币的部分，累计到下一次下注
+	mutex      sync.Mutex
+}
+
+// NewJackpotService 创建累积奖池服务，领取的奖金经由玩家缓存计入金币
+func NewJackpotService(db persistence.Database, players *PlayerCache, settings JackpotSettings) *JackpotService {
+	return &JackpotService{
+		db:         db,
+		players:    players,
+		settings:   settings,
+		remainders: make(map[string]float64),
+	}
+}
+
+// Settings 返回奖池设置
+func (s *JackpotService) Settings() JackpotSettings {
+	return s.settings
+}
+
+// Contribute 按抽成比例将一次下注的一部分计入奖池
+func (s *JackpotService) Contribute(ctx context.Context, pool string, bet int64) error {
+	if bet <= 0 || s.settings.Contribution == 0 {
+		return nil
+	}
+
+	s.mutex.Lock()
+	share := s.remainders[pool] + float64(bet)*s.settings.Contribution
+	amount := int64(math.Floor(share))
+	s.remainders[pool] = share - float64(amount)
+	s.mutex.Unlock()
+	if amount == 0 {
+		return nil
+	}
+
+	if _, err := s.db.Jackpots().ContributeJackpot(ctx, pool, amount, s.settings.Seed); err != nil {
+		// 没有计入的部分留到下一次
+		s.mutex.Lock()
+		s.remainders[pool] += float64(amount)
+		s.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Claim 领取整个奖池并计入玩家的金币，奖池重置为初始金额。
+// 领取、金币变动和 jackpot.won 事件在同一事务中提交
+func (s *JackpotService) Claim(ctx context.Context, pool string, userID int64, roomID string) (*models.JackpotWin, error) {
+	var win *models.JackpotWin
+	_, err := s.players.AddCoinsWith(ctx, userID, JackpotReason, func(tx persistence.Tx) (int64, error) {
+		var err error
+		win, err = tx.Jackpots().ClaimJackpot(ctx, pool, s.settings.Seed, userID, roomID)
+		if err != nil {
+			return 0, err
+		}
+		return win.Amount, events.Append(ctx, tx, events.TypeJackpotWon, pool, win)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return win, nil
+}
+
+// Amount 返回奖池当前的金额，尚未有人下注的奖池为初始金额
+func (s *JackpotService) Amount(ctx context.Context, pool string) (int64, error) {
+	amount, err := s.db.Jackpots().GetJackpot(ctx, pool)
+	if errors.Is(err, persistence.ErrRecordNotFound) {
+		return s.settings.Seed, nil
+	}
+	return amount, err
+}
+
+// ListWins 返回奖池最近的中奖记录
+func (s *JackpotService) ListWins(ctx context.Context, pool string, limit int) ([]models.JackpotWin, error) {
+	return s.db.Jackpots().ListJackpotWins(ctx, pool, limit)
+}
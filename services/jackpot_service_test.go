@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/events"
+	"github.com/wfunc/gameserver/models"
+)
+
+func TestJackpotService_ContributeAndClaim(t *testing.T) {
+	ctx := context.Background()
+	cache, db := newTestPlayerCache(t)
+	s := NewJackpotService(db, cache, JackpotSettings{Contribution: 0.05, Seed: 500})
+
+	if amount, err := s.Amount(ctx, "slot"); err != nil || amount != 500 {
+		t.Fatalf("Expected a new pool to hold the seed, got %d, %v", amount, err)
+	}
+	// 不足 1 金币的抽成累计到下一次下注：10 * 0.05 * 3 = 1.5
+	for i := 0; i < 3; i++ {
+		if err := s.Contribute(ctx, "slot", 10); err != nil {
+			t.Fatalf("Failed to contribute: %v", err)
+		}
+	}
+	if amount, _ := s.Amount(ctx, "slot"); amount != 501 {
+		t.Fatalf("Expected 501 coins in the pool, got %d", amount)
+	}
+
+	win, err := s.Claim(ctx, "slot", 1, "room1")
+	if err != nil || win.Amount != 501 || win.UserID != 1 || win.RoomID != "room1" {
+		t.Fatalf("Expected to win 501 coins, got %+v, %v", win, err)
+	}
+	if amount, _ := s.Amount(ctx, "slot"); amount != 500 {
+		t.Errorf("Expected the pool to reset to the seed, got %d", amount)
+	}
+	if balance, _ := cache.Balance(ctx, 1); balance != 601 {
+		t.Errorf("Expected the win to be credited, got balance %d", balance)
+	}
+	ledger, _ := db.Wallet().ListLedger(ctx, 1, 1)
+	if len(ledger) != 1 || ledger[0].Reason != JackpotReason || ledger[0].Delta != 501 {
+		t.Errorf("Unexpected ledger: %+v", ledger)
+	}
+
+	pending, _ := db.Outbox().ClaimEvents(ctx, 10, time.Minute)
+	if len(pending) != 2 || pending[0].Type != events.TypeJackpotWon || pending[1].Type != events.TypeCoinsChanged {
+		t.Errorf("Expected jackpot.won and coins.changed events, got %+v", pending)
+	}
+}
+
+func TestJackpotService_ClaimIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	cache, db := newTestPlayerCache(t)
+	if err := db.Players().SavePlayer(ctx, &models.PlayerData{UserID: 2, Name: "bob", Coins: 100}); err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+	s := NewJackpotService(db, cache, JackpotSettings{Contribution: 0.5, Seed: 100})
+	if err := s.Contribute(ctx, "slot", 1000); err != nil {
+		t.Fatalf("Failed to contribute: %v", err)
+	}
+
+	// 两个房间同时中奖，只有一方得到累积的奖金，另一方得到重置后的初始金额
+	var wg sync.WaitGroup
+	wins := make([]*models.JackpotWin, 2)
+	for i := range wins {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			win, err := s.Claim(ctx, "slot", int64(i+1), "room")
+			if err != nil {
+				t.Errorf("Failed to claim: %v", err)
+				return
+			}
+			wins[i] = win
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	if total := wins[0].Amount + wins[1].Amount; total != 700 {
+		t.Errorf("Expected 600 and 100 coins to be won, got %d and %d", wins[0].Amount, wins[1].Amount)
+	}
+	history, _ := s.ListWins(ctx, "slot", 0)
+	if len(history) != 2 {
+		t.Errorf("Expected two wins in the history, got %+v", history)
+	}
+}
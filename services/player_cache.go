@@ -0,0 +1,480 @@
+// services/player_cache.go
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wfunc/gameserver/events"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+const (
+	// playerFlushInterval 定期将修改过的玩家资料写回数据库的间隔
+	playerFlushInterval = 5 * time.Second
+	// playerFlushBatch 待写回的玩家达到该数量时立即写回，不等下一个周期
+	playerFlushBatch = 100
+	// playerFlushTimeout 一次写回的超时时间
+	playerFlushTimeout = 5 * time.Second
+)
+
+// PlayerCache 在内存中缓存已登录玩家的资料(写回缓存)。
+// 资料修改只改内存，由后台协程批量写回，玩家下线或服务关闭时也会写回；
+// 金币变动必须落库，AddCoins 会先写回该玩家未保存的修改再同步修改金币。
+// 写回使用版本号做条件更新，其他节点先修改了同一玩家时以数据库为准，丢弃本地修改。
+type PlayerCache struct {
+	db            persistence.Database
+	players       map[int64]*cachedPlayer
+	mutex         sync.Mutex
+	flushMutex    sync.Mutex // 同一时间只有一次批量写回
+	flushInterval time.Duration
+	flushNow      chan struct{}
+	stop          chan struct{}
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+// cachedPlayer 一个缓存的玩家。changes 与 flushed 不相等时有未写回的修改
+type cachedPlayer struct {
+	data    models.PlayerData
+	refs    int // 持有该玩家的会话数，为 0 且没有未写回的修改时移出缓存
+	changes int
+	flushed int
+	writing sync.Mutex // 写数据库期间持有，保证同一玩家的写入按顺序进行
+}
+
+func (p *cachedPlayer) dirty() bool {
+	return p.changes != p.flushed
+}
+
+// NewPlayerCache 创建玩家缓存并启动写回协程
+func NewPlayerCache(db persistence.Database) *PlayerCache {
+	c := &PlayerCache{
+		db:            db,
+		players:       make(map[int64]*cachedPlayer),
+		flushInterval: playerFlushInterval,
+		flushNow:      make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Load 在玩家登录时调用，将资料载入缓存并增加引用，需要与 Release 成对调用
+func (c *PlayerCache) Load(ctx context.Context, userID int64) (*models.PlayerData, error) {
+	var data *models.PlayerData
+	err := c.withEntry(ctx, userID, func(player *cachedPlayer) {
+		player.refs++
+		data = clonePlayer(&player.data)
+	})
+	return data, err
+}
+
+// Release 在玩家下线时调用，最后一个引用释放时写回未保存的修改并移出缓存
+func (c *PlayerCache) Release(ctx context.Context, userID int64) error {
+	c.mutex.Lock()
+	player, exists := c.players[userID]
+	if !exists {
+		c.mutex.Unlock()
+		return nil
+	}
+	if player.refs > 0 {
+		player.refs--
+	}
+	last := player.refs == 0
+	c.mutex.Unlock()
+
+	if !last {
+		return nil
+	}
+	if err := c.flushPlayers(ctx, []int64{userID}); err != nil {
+		return err
+	}
+	c.evict(userID)
+	return nil
+}
+
+// Get 返回玩家资料的副本，未缓存的玩家直接从数据库读取且不放入缓存
+func (c *PlayerCache) Get(ctx context.Context, userID int64) (*models.PlayerData, error) {
+	c.mutex.Lock()
+	if player, exists := c.players[userID]; exists {
+		defer c.mutex.Unlock()
+		return clonePlayer(&player.data), nil
+	}
+	c.mutex.Unlock()
+
+	return c.db.Players().GetPlayer(ctx, userID)
+}
+
+// Balance 返回玩家的金币余额
+func (c *PlayerCache) Balance(ctx context.Context, userID int64) (int64, error) {
+	c.mutex.Lock()
+	if player, exists := c.players[userID]; exists {
+		defer c.mutex.Unlock()
+		return player.data.Coins, nil
+	}
+	c.mutex.Unlock()
+
+	return c.db.Wallet().GetBalance(ctx, userID)
+}
+
+// Update 在内存中修改玩家资料，修改稍后写回数据库。fn 在缓存的锁内执行，不能阻塞；
+// 金币和版本号不能通过 Update 修改
+func (c *PlayerCache) Update(ctx context.Context, userID int64, fn func(player *models.PlayerData)) error {
+	pending := 0
+	err := c.withEntry(ctx, userID, func(player *cachedPlayer) {
+		coins, version := player.data.Coins, player.data.Version
+		fn(&player.data)
+		player.data.UserID, player.data.Coins, player.data.Version = userID, coins, version
+		player.changes++
+		pending = c.dirtyCount()
+	})
+	if err != nil {
+		return err
+	}
+
+	if pending >= playerFlushBatch {
+		select {
+		case c.flushNow <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// AddCoins 增减玩家金币并返回余额，同一事务中写入 coins.changed 事件。
+// 先在同一事务中写回该玩家未保存的修改，保证金币流水与资料版本一致；
+// 写回遇到版本冲突时以数据库为准重新载入后重试一次
+func (c *PlayerCache) AddCoins(ctx context.Context, userID, delta int64, reason string) (int64, error) {
+	return c.AddCoinsWith(ctx, userID, reason, func(tx persistence.Tx) (int64, error) {
+		return delta, nil
+	})
+}
+
+// AddCoinsWith 与 AddCoins 相同，金币变动额由 fn 在同一事务中决定，
+// 用于领取奖励等需要与金币变动一起提交或回滚的修改。重试时 fn 会再次执行
+func (c *PlayerCache) AddCoinsWith(ctx context.Context, userID int64, reason string, fn func(tx persistence.Tx) (int64, error)) (int64, error) {
+	player := c.lockWriting(userID)
+	if player == nil {
+		var balance int64
+		err := c.db.Transaction(ctx, func(tx persistence.Tx) error {
+			delta, err := fn(tx)
+			if err != nil {
+				return err
+			}
+			balance, err = addCoins(ctx, tx, userID, delta, reason)
+			return err
+		})
+		return balance, err
+	}
+	defer player.writing.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		c.mutex.Lock()
+		snapshot, changes, dirty := clonePlayer(&player.data), player.changes, player.dirty()
+		c.mutex.Unlock()
+
+		var balance int64
+		var fresh *models.PlayerData
+		err := c.db.Transaction(ctx, func(tx persistence.Tx) error {
+			if dirty {
+				if err := tx.Players().UpdatePlayer(ctx, snapshot); err != nil {
+					return err
+				}
+			}
+			delta, err := fn(tx)
+			if err != nil {
+				return err
+			}
+			if balance, err = addCoins(ctx, tx, userID, delta, reason); err != nil {
+				return err
+			}
+			fresh, err = tx.Players().GetPlayer(ctx, userID)
+			return err
+		})
+		if errors.Is(err, persistence.ErrVersionConflict) && attempt == 1 {
+			logger.Log.Warnf("Player %d was modified elsewhere, discarding cached changes", userID)
+			if err := c.reload(ctx, player, userID); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		c.mutex.Lock()
+		if player.changes == changes {
+			player.data = *fresh
+		} else {
+			// 事务期间又有新的修改，保留内存中的资料，只更新金币和版本
+			player.data.Coins, player.data.Version = fresh.Coins, fresh.Version
+		}
+		player.flushed = changes
+		c.mutex.Unlock()
+		return balance, nil
+	}
+}
+
+// Flush 将所有未保存的修改写回数据库
+func (c *PlayerCache) Flush(ctx context.Context) error {
+	c.mutex.Lock()
+	var userIDs []int64
+	for userID, player := range c.players {
+		if player.dirty() || player.refs == 0 {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	c.mutex.Unlock()
+
+	if err := c.flushPlayers(ctx, userIDs); err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		c.evict(userID)
+	}
+	return nil
+}
+
+// Close 停止后台写回并写回剩余的修改
+func (c *PlayerCache) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+
+		ctx, cancel := context.WithTimeout(context.Background(), playerFlushTimeout)
+		defer cancel()
+		if err := c.Flush(ctx); err != nil {
+			logger.Log.Errorf("Failed to flush player cache on close: %v", err)
+		}
+	})
+}
+
+func (c *PlayerCache) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.flushNow:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), playerFlushTimeout)
+		if err := c.Flush(ctx); err != nil {
+			logger.Log.Errorf("Failed to flush player cache: %v", err)
+		}
+		cancel()
+	}
+}
+
+// addCoins 在 tx 中修改金币并写入金币变动事件
+func addCoins(ctx context.Context, tx persistence.Tx, userID, delta int64, reason string) (int64, error) {
+	balance, err := tx.Wallet().AddCoins(ctx, userID, delta, reason)
+	if err != nil {
+		return 0, err
+	}
+	err = events.Append(ctx, tx, events.TypeCoinsChanged, strconv.FormatInt(userID, 10), events.CoinsChanged{
+		UserID:  userID,
+		Delta:   delta,
+		Balance: balance,
+		Reason:  reason,
+	})
+	return balance, err
+}
+
+// lockWriting 返回缓存的玩家并持有其 writing 锁，未缓存时返回 nil
+func (c *PlayerCache) lockWriting(userID int64) *cachedPlayer {
+	for {
+		c.mutex.Lock()
+		player, cached := c.players[userID]
+		c.mutex.Unlock()
+		if !cached {
+			return nil
+		}
+
+		player.writing.Lock()
+		// 等待锁期间玩家可能已被移出缓存
+		c.mutex.Lock()
+		current := c.players[userID]
+		c.mutex.Unlock()
+		if current == player {
+			return player
+		}
+		player.writing.Unlock()
+	}
+}
+
+// withEntry 在缓存的锁内对玩家执行 fn，未缓存时先从数据库载入
+func (c *PlayerCache) withEntry(ctx context.Context, userID int64, fn func(player *cachedPlayer)) error {
+	c.mutex.Lock()
+	if player, exists := c.players[userID]; exists {
+		defer c.mutex.Unlock()
+		fn(player)
+		return nil
+	}
+	c.mutex.Unlock()
+
+	data, err := c.db.Players().GetPlayer(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// 载入期间可能已被其他调用放入缓存
+	player, exists := c.players[userID]
+	if !exists {
+		player = &cachedPlayer{data: *data}
+		c.players[userID] = player
+	}
+	fn(player)
+	return nil
+}
+
+// flushPlayers 在一个事务中写回指定玩家未保存的修改。版本冲突的玩家不会使事务失败，
+// 事务提交后以数据库为准重新载入
+func (c *PlayerCache) flushPlayers(ctx context.Context, userIDs []int64) error {
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	// 按用户 ID 顺序加锁，避免与其他批量写回互相等待
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	type pendingWrite struct {
+		player   *cachedPlayer
+		snapshot *models.PlayerData
+		changes  int
+	}
+	var writes []pendingWrite
+	c.mutex.Lock()
+	for _, userID := range userIDs {
+		if player, exists := c.players[userID]; exists && player.dirty() {
+			writes = append(writes, pendingWrite{player: player})
+		}
+	}
+	c.mutex.Unlock()
+	if len(writes) == 0 {
+		return nil
+	}
+
+	for i := range writes {
+		writes[i].player.writing.Lock()
+		defer writes[i].player.writing.Unlock()
+	}
+
+	// 加锁后再取快照，期间 AddCoins 可能已经写回了这些修改，此时 snapshot 为空
+	c.mutex.Lock()
+	for i := range writes {
+		player := writes[i].player
+		if player.dirty() {
+			writes[i].snapshot = clonePlayer(&player.data)
+			writes[i].changes = player.changes
+		}
+	}
+	c.mutex.Unlock()
+
+	conflicts := make(map[int64]bool)
+	err := c.db.Transaction(ctx, func(tx persistence.Tx) error {
+		for _, w := range writes {
+			if w.snapshot == nil {
+				continue
+			}
+			err := tx.Players().UpdatePlayer(ctx, w.snapshot)
+			if errors.Is(err, persistence.ErrVersionConflict) || errors.Is(err, persistence.ErrRecordNotFound) {
+				conflicts[w.snapshot.UserID] = true
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	for _, w := range writes {
+		if w.snapshot == nil || conflicts[w.snapshot.UserID] {
+			continue
+		}
+		w.player.data.Version = w.snapshot.Version
+		w.player.flushed = w.changes
+	}
+	c.mutex.Unlock()
+
+	for _, w := range writes {
+		if w.snapshot == nil || !conflicts[w.snapshot.UserID] {
+			continue
+		}
+		logger.Log.Warnf("Player %d was modified elsewhere, discarding cached changes", w.snapshot.UserID)
+		if err := c.reload(ctx, w.player, w.snapshot.UserID); err != nil {
+			logger.Log.Errorf("Failed to reload player %d: %v", w.snapshot.UserID, err)
+		}
+	}
+	return nil
+}
+
+// reload 丢弃玩家未保存的修改，重新从数据库载入。调用方需持有 player.writing
+func (c *PlayerCache) reload(ctx context.Context, player *cachedPlayer, userID int64) error {
+	data, err := c.db.Players().GetPlayer(ctx, userID)
+	if errors.Is(err, persistence.ErrRecordNotFound) {
+		c.mutex.Lock()
+		player.flushed = player.changes
+		c.mutex.Unlock()
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	player.data = *data
+	player.flushed = player.changes
+	c.mutex.Unlock()
+	return nil
+}
+
+// evict 移出没有会话引用且没有未保存修改的玩家
+func (c *PlayerCache) evict(userID int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if player, exists := c.players[userID]; exists && player.refs == 0 && !player.dirty() {
+		delete(c.players, userID)
+	}
+}
+
+// dirtyCount 返回有未保存修改的玩家数，调用方需持有 c.mutex
+func (c *PlayerCache) dirtyCount() int {
+	count := 0
+	for _, player := range c.players {
+		if player.dirty() {
+			count++
+		}
+	}
+	return count
+}
+
+// clonePlayer 复制玩家资料，Items 浅拷贝
+func clonePlayer(player *models.PlayerData) *models.PlayerData {
+	clone := *player
+	if player.Items != nil {
+		clone.Items = make(map[string]interface{}, len(player.Items))
+		for k, v := range player.Items {
+			clone.Items[k] = v
+		}
+	}
+	return &clone
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/events"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+func newTestPlayerCache(t *testing.T) (*PlayerCache, persistence.Database) {
+	t.Helper()
+	db := persistence.NewMemory()
+	err := db.Players().SavePlayer(context.Background(), &models.PlayerData{UserID: 1, Name: "alice", Level: 1, Coins: 100})
+	if err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+	cache := NewPlayerCache(db)
+	t.Cleanup(cache.Close)
+	return cache, db
+}
+
+func TestPlayerCache_UpdateIsWrittenBack(t *testing.T) {
+	ctx := context.Background()
+	cache, db := newTestPlayerCache(t)
+
+	if _, err := cache.Load(ctx, 1); err != nil {
+		t.Fatalf("Failed to load player: %v", err)
+	}
+	err := cache.Update(ctx, 1, func(p *models.PlayerData) {
+		p.Level = 2
+		p.Coins = 99999 // 金币不能通过 Update 修改
+	})
+	if err != nil {
+		t.Fatalf("Failed to update player: %v", err)
+	}
+
+	stored, _ := db.Players().GetPlayer(ctx, 1)
+	if stored.Level != 1 {
+		t.Fatalf("Expected the update to stay in memory until flushed, got level %d", stored.Level)
+	}
+	if cached, _ := cache.Get(ctx, 1); cached.Level != 2 || cached.Coins != 100 {
+		t.Errorf("Expected the cached player to have level 2 and 100 coins, got %+v", cached)
+	}
+
+	if err := cache.Flush(ctx); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	stored, _ = db.Players().GetPlayer(ctx, 1)
+	if stored.Level != 2 || stored.Coins != 100 || stored.Version != 1 {
+		t.Errorf("Expected level 2, 100 coins and version 1 after flush, got %+v", stored)
+	}
+}
+
+func TestPlayerCache_ConflictKeepsDatabaseVersion(t *testing.T) {
+	ctx := context.Background()
+	cache, db := newTestPlayerCache(t)
+
+	cache.Load(ctx, 1)
+	cache.Update(ctx, 1, func(p *models.PlayerData) { p.Name = "local" })
+
+	// 另一个节点先写入了该玩家
+	other, _ := db.Players().GetPlayer(ctx, 1)
+	other.Name = "remote"
+	if err := db.Players().UpdatePlayer(ctx, other); err != nil {
+		t.Fatalf("Failed to update player: %v", err)
+	}
+
+	if err := cache.Flush(ctx); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	stored, _ := db.Players().GetPlayer(ctx, 1)
+	cached, _ := cache.Get(ctx, 1)
+	if stored.Name != "remote" || cached.Name != "remote" || cached.Version != stored.Version {
+		t.Errorf("Expected the database write to win, got stored %+v, cached %+v", stored, cached)
+	}
+}
+
+func TestPlayerCache_AddCoinsFlushesPendingChanges(t *testing.T) {
+	ctx := context.Background()
+	cache, db := newTestPlayerCache(t)
+
+	cache.Load(ctx, 1)
+	cache.Update(ctx, 1, func(p *models.PlayerData) { p.Experience = 50 })
+
+	balance, err := cache.AddCoins(ctx, 1, -30, "bet")
+	if err != nil || balance != 70 {
+		t.Fatalf("Expected balance 70, got %d, %v", balance, err)
+	}
+
+	stored, _ := db.Players().GetPlayer(ctx, 1)
+	if stored.Experience != 50 || stored.Coins != 70 {
+		t.Errorf("Expected pending changes and coins to be written together, got %+v", stored)
+	}
+	if coins, _ := cache.Balance(ctx, 1); coins != 70 {
+		t.Errorf("Expected cached balance 70, got %d", coins)
+	}
+	if cached, _ := cache.Get(ctx, 1); cached.Version != stored.Version {
+		t.Errorf("Expected cached version %d, got %d", stored.Version, cached.Version)
+	}
+
+	if _, err := cache.AddCoins(ctx, 1, -100, "bet"); err != persistence.ErrInsufficientCoins {
+		t.Errorf("Expected ErrInsufficientCoins, got %v", err)
+	}
+
+	// 只有成功的金币变动会写入事件
+	pending, _ := db.Outbox().ClaimEvents(ctx, 10, time.Minute)
+	if len(pending) != 1 || pending[0].Type != events.TypeCoinsChanged {
+		t.Fatalf("Expected one coins.changed event, got %+v", pending)
+	}
+	var payload events.CoinsChanged
+	json.Unmarshal(pending[0].Payload, &payload)
+	if payload.UserID != 1 || payload.Delta != -30 || payload.Balance != 70 {
+		t.Errorf("Unexpected coins.changed payload: %+v", payload)
+	}
+}
+
+func TestPlayerCache_ReleaseFlushesAndEvicts(t *testing.T) {
+	ctx := context.Background()
+	cache, db := newTestPlayerCache(t)
+
+	// 同一用户的两个会话
+	cache.Load(ctx, 1)
+	cache.Load(ctx, 1)
+	cache.Update(ctx, 1, func(p *models.PlayerData) { p.Name = "bob" })
+
+	cache.Release(ctx, 1)
+	if _, cached := cache.players[1]; !cached {
+		t.Fatal("Expected the player to stay cached while a session holds it")
+	}
+
+	if err := cache.Release(ctx, 1); err != nil {
+		t.Fatalf("Failed to release: %v", err)
+	}
+	if _, cached := cache.players[1]; cached {
+		t.Error("Expected the player to be evicted after the last release")
+	}
+	if stored, _ := db.Players().GetPlayer(ctx, 1); stored.Name != "bob" {
+		t.Errorf("Expected the change to be written on release, got %q", stored.Name)
+	}
+}
@@ -2,79 +2,54 @@
 package services
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/wfunc/gameserver/models"
 	"github.com/wfunc/gameserver/persistence"
-	"gorm.io/gorm"
 )
 
+// PlayerService 玩家相关的查询和修改，玩家资料和金币经由 PlayerCache 读写
 type PlayerService struct {
-	db persistence.Database
+	db    persistence.Database
+	cache *PlayerCache
 }
 
-func NewPlayerService(db persistence.Database) *PlayerService {
-	return &PlayerService{db: db}
+func NewPlayerService(db persistence.Database, cache *PlayerCache) *PlayerService {
+	return &PlayerService{db: db, cache: cache}
 }
 
-// GetPlayerWithStats 获取玩家信息和统计
-func (s *PlayerService) GetPlayerWithStats(userID int64) (map[string]interface{}, error) {
-	var result map[string]interface{}
-
-	// 使用事务确保数据一致性
-	err := s.db.Transaction(func(tx *gorm.DB) error {
-		// 获取玩家基本信息
-		var player models.GormPlayer
-		if err := tx.Where("user_id = ?", userID).First(&player).Error; err != nil {
-			return err
-		}
-
-		// 获取玩家统计信息
-		stats, err := s.db.GetPlayerStats(userID)
-		if err != nil {
-			return err
-		}
-
-		result = map[string]interface{}{
-			"player": player,
-			"stats":  stats,
-		}
-
-		return nil
-	})
-
-	return result, err
+// GetPlayerWithStats 获取玩家信息和统计，已登录玩家的资料取自缓存
+func (s *PlayerService) GetPlayerWithStats(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	player, err := s.cache.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.db.Players().GetPlayerStats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"player": player,
+		"stats":  stats,
+	}, nil
 }
 
-// UpdatePlayerCoins 更新玩家金币数量（原子操作）
-func (s *PlayerService) UpdatePlayerCoins(userID int64, delta int64) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		var player models.GormPlayer
-		if err := tx.Where("user_id = ?", userID).First(&player).Error; err != nil {
-			return err
-		}
-
-		// 检查金币是否足够（如果是减少）
-		if delta < 0 && player.Coins+delta < 0 {
-			return fmt.Errorf("insufficient coins")
-		}
-
-		// 更新金币数量
-		if err := tx.Model(&player).Update("coins", gorm.Expr("coins + ?", delta)).Error; err != nil {
-			return err
-		}
-
-		// 更新统计信息
-		if err := tx.Model(&player).Update("stats", gorm.Expr(`
-            jsonb_set(
-                COALESCE(stats, '{}'::jsonb), 
-                '{total_coins}', 
-                to_jsonb(COALESCE((stats->>'total_coins')::int, 0) + ?)
-            )
-        `, delta)).Error; err != nil {
-			return err
-		}
+// UpdatePlayerCoins 更新玩家金币数量（原子操作），返回变动后的余额。
+// 金币变动会立即写回缓存中该玩家未保存的修改
+func (s *PlayerService) UpdatePlayerCoins(ctx context.Context, userID, delta int64, reason string) (int64, error) {
+	return s.cache.AddCoins(ctx, userID, delta, reason)
+}
 
-		return nil
-	})
+// GetGameHistory 查询玩家的历史对局，按结束时间从新到旧分页
+func (s *PlayerService) GetGameHistory(ctx context.Context, query *models.GameHistoryQuery) (*models.GameHistoryPage, error) {
+	if query.UserID == 0 {
+		return nil, fmt.Errorf("user id is required")
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return nil, fmt.Errorf("invalid time range")
+	}
+	return s.db.GameRecords().QueryGameHistory(ctx, query)
 }
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+func newTestPlayerService(t *testing.T) (*PlayerService, persistence.Database) {
+	t.Helper()
+	db := persistence.NewMemory()
+	err := db.Players().SavePlayer(context.Background(), &models.PlayerData{UserID: 1, Name: "alice", Coins: 100})
+	if err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+	cache := NewPlayerCache(db)
+	t.Cleanup(cache.Close)
+	return NewPlayerService(db, cache), db
+}
+
+func TestPlayerService_GetPlayerWithStats(t *testing.T) {
+	ctx := context.Background()
+	s, db := newTestPlayerService(t)
+	record := &models.GameRecord{RoomID: "room_1", GameType: "slot_machine", Players: []models.PlayerInfo{
+		{UserID: 1, Bet: 10, Payout: 100, Outcome: models.OutcomeWin},
+	}}
+	if err := db.GameRecords().SaveGameRecord(ctx, record); err != nil {
+		t.Fatalf("Failed to save record: %v", err)
+	}
+
+	result, err := s.GetPlayerWithStats(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to get player: %v", err)
+	}
+	player := result["player"].(*models.PlayerData)
+	stats := result["stats"].(*models.PlayerStats)
+	if player.Name != "alice" || stats.TotalGames != 1 || stats.Wins != 1 {
+		t.Errorf("Unexpected result: %+v, %+v", player, stats)
+	}
+
+	if _, err := s.GetPlayerWithStats(ctx, 2); err != persistence.ErrRecordNotFound {
+		t.Errorf("Expected ErrRecordNotFound for a missing player, got %v", err)
+	}
+}
+
+func TestPlayerService_UpdatePlayerCoins(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestPlayerService(t)
+
+	balance, err := s.UpdatePlayerCoins(ctx, 1, -40, "bet")
+	if err != nil || balance != 60 {
+		t.Fatalf("Expected balance 60, got %d, %v", balance, err)
+	}
+	if _, err := s.UpdatePlayerCoins(ctx, 1, -100, "bet"); err != persistence.ErrInsufficientCoins {
+		t.Errorf("Expected ErrInsufficientCoins, got %v", err)
+	}
+}
+
+func TestPlayerService_GetGameHistoryValidation(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestPlayerService(t)
+
+	if _, err := s.GetGameHistory(ctx, &models.GameHistoryQuery{}); err == nil {
+		t.Error("Expected an error without a user id")
+	}
+	page, err := s.GetGameHistory(ctx, &models.GameHistoryQuery{UserID: 1})
+	if err != nil || len(page.Entries) != 0 {
+		t.Errorf("Expected an empty history, got %+v, %v", page, err)
+	}
+}
@@ -0,0 +1,266 @@
+// services/profile_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+// maxNameLength 玩家名字的最大字符数
+const maxNameLength = 16
+
+// ErrInvalidName 名字为空、过长或包含不可见字符
+var ErrInvalidName = fmt.Errorf("name must be 1-%d printable characters", maxNameLength)
+
+// LevelCurve 等级曲线：从 n 级升到 n+1 级需要 BaseExp * Growth^(n-1) 经验，
+// 玩家的经验为累计值，等级由累计经验决定
+type LevelCurve struct {
+	BaseExp  int     // 从 1 级升到 2 级所需的经验
+	Growth   float64 // 每升一级所需经验的倍数
+	MaxLevel int
+}
+
+// ExpForLevel 返回达到 level 所需的累计经验
+func (c LevelCurve) ExpForLevel(level int) int {
+	total, step := 0.0, float64(c.BaseExp)
+	for l := 1; l < level && l < c.MaxLevel; l++ {
+		total += math.Round(step)
+		step *= c.Growth
+	}
+	if total > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(total)
+}
+
+// LevelFor 返回累计经验对应的等级
+func (c LevelCurve) LevelFor(exp int) int {
+	level := 1
+	for level < c.MaxLevel && exp >= c.ExpForLevel(level+1) {
+		level++
+	}
+	return level
+}
+
+// ProfileSettings 新玩家的初始资料和对局经验，零值字段使用 DefaultProfileSettings 中的值
+type ProfileSettings struct {
+	StartingCoins *int64 // 首次登录时发放的金币，nil 时使用默认值，0 表示不发放
+	ExpPerRound   int    // 每参与一局获得的经验
+	ExpPerWin     int    // 赢得一局额外获得的经验
+	Curve         LevelCurve
+}
+
+// DefaultProfileSettings 返回默认的玩家资料设置
+func DefaultProfileSettings() ProfileSettings {
+	startingCoins := int64(persistence.DefaultCoins)
+	return ProfileSettings{
+		StartingCoins: &startingCoins,
+		ExpPerRound:   10,
+		ExpPerWin:     20,
+		Curve:         LevelCurve{BaseExp: 100, Growth: 1.5, MaxLevel: 100},
+	}
+}
+
+// withDefaults 用默认值填充未设置的字段
+func (s ProfileSettings) withDefaults() ProfileSettings {
+	defaults := DefaultProfileSettings()
+	if s.StartingCoins == nil || *s.StartingCoins < 0 {
+		s.StartingCoins = defaults.StartingCoins
+	}
+	if s.ExpPerRound <= 0 {
+		s.ExpPerRound = defaults.ExpPerRound
+	}
+	if s.ExpPerWin <= 0 {
+		s.ExpPerWin = defaults.ExpPerWin
+	}
+	if s.Curve.BaseExp <= 0 {
+		s.Curve.BaseExp = defaults.Curve.BaseExp
+	}
+	if s.Curve.Growth < 1 {
+		s.Curve.Growth = defaults.Curve.Growth
+	}
+	if s.Curve.MaxLevel <= 0 {
+		s.Curve.MaxLevel = defaults.Curve.MaxLevel
+	}
+	return s
+}
+
+// RoundExp 返回一局结果为 outcome 的玩家获得的经验
+func (s ProfileSettings) RoundExp(outcome string) int {
+	if outcome == models.OutcomeWin {
+		return s.ExpPerRound + s.ExpPerWin
+	}
+	return s.ExpPerRound
+}
+
+// Profile 返回给客户端的玩家资料
+type Profile struct {
+	Player       *models.PlayerData  `json:"player"`
+	Stats        *models.PlayerStats `json:"stats,omitempty"`
+	NextLevelExp int                 `json:"next_level_exp"` // 升到下一级所需的累计经验，满级时为 0
+}
+
+// LevelChange 一次增加经验的结果
+type LevelChange struct {
+	UserID       int64 `json:"user_id"`
+	OldLevel     int   `json:"old_level"`
+	Level        int   `json:"level"`
+	Experience   int   `json:"experience"`
+	NextLevelExp int   `json:"next_level_exp"`
+}
+
+// LeveledUp 是否升级
+func (c LevelChange) LeveledUp() bool {
+	return c.Level > c.OldLevel
+}
+
+// ProfileService 玩家资料的创建、修改和经验等级，资料经由 PlayerCache 读写
+type ProfileService struct {
+	db       persistence.Database
+	cache    *PlayerCache
+	settings ProfileSettings
+}
+
+// NewProfileService 创建玩家资料服务
+func NewProfileService(db persistence.Database, cache *PlayerCache, settings ProfileSettings) *ProfileService {
+	return &ProfileService{db: db, cache: cache, settings: settings.withDefaults()}
+}
+
+// Settings 返回生效的设置
+func (s *ProfileService) Settings() ProfileSettings {
+	return s.settings
+}
+
+// Login 在玩家登录时调用，首次登录时创建资料并发放初始金币，然后将资料载入缓存。
+// created 表示本次调用创建了资料。需要与 PlayerCache.Release 成对调用
+func (s *ProfileService) Login(ctx context.Context, userID int64) (player *models.PlayerData, created bool, err error) {
+	player, err = s.cache.Load(ctx, userID)
+	if !errors.Is(err, persistence.ErrRecordNotFound) {
+		return player, false, err
+	}
+
+	err = s.db.Transaction(ctx, func(tx persistence.Tx) error {
+		var err error
+		created, err = tx.Players().CreatePlayer(ctx, &models.PlayerData{
+			UserID: userID,
+			Name:   fmt.Sprintf("player_%d", userID),
+			Level:  1,
+		})
+		if err != nil || !created || *s.settings.StartingCoins == 0 {
+			return err
+		}
+		_, err = addCoins(ctx, tx, userID, *s.settings.StartingCoins, "starting_coins")
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 并发登录时资料可能由其他请求创建，created 为 false
+	player, err = s.cache.Load(ctx, userID)
+	return player, created, err
+}
+
+// GetProfile 返回玩家资料、对局统计和等级进度
+func (s *ProfileService) GetProfile(ctx context.Context, userID int64) (*Profile, error) {
+	player, err := s.cache.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.db.Players().GetPlayerStats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Profile{Player: player, Stats: stats, NextLevelExp: s.nextLevelExp(player.Level)}, nil
+}
+
+// UpdateProfile 修改玩家可以自行修改的资料，目前只有名字
+func (s *ProfileService) UpdateProfile(ctx context.Context, userID int64, name string) (*Profile, error) {
+	name, err := validateName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var player *models.PlayerData
+	err = s.cache.Update(ctx, userID, func(p *models.PlayerData) {
+		p.Name = name
+		player = clonePlayer(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Profile{Player: player, NextLevelExp: s.nextLevelExp(player.Level)}, nil
+}
+
+// AddExperience 增加玩家经验并按等级曲线更新等级
+func (s *ProfileService) AddExperience(ctx context.Context, userID int64, exp int) (LevelChange, error) {
+	change := LevelChange{UserID: userID}
+	err := s.cache.Update(ctx, userID, func(p *models.PlayerData) {
+		change.OldLevel = p.Level
+		p.Experience += exp
+		// 不因等级曲线调整而降级
+		if level := s.settings.Curve.LevelFor(p.Experience); level > p.Level {
+			p.Level = level
+		}
+		change.Level, change.Experience = p.Level, p.Experience
+	})
+	if err != nil {
+		return change, err
+	}
+	change.NextLevelExp = s.nextLevelExp(change.Level)
+	return change, nil
+}
+
+// AwardRound 按一局的结果为参与的注册玩家增加经验，返回升级的玩家。
+// 资料不存在的玩家跳过，单个玩家失败不影响其他玩家
+func (s *ProfileService) AwardRound(ctx context.Context, record *models.GameRecord) ([]LevelChange, error) {
+	var levelUps []LevelChange
+	var errs []error
+	for _, info := range record.Players {
+		if info.UserID <= 0 {
+			continue
+		}
+		change, err := s.AddExperience(ctx, info.UserID, s.settings.RoundExp(info.Outcome))
+		if errors.Is(err, persistence.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("player %d: %w", info.UserID, err))
+			continue
+		}
+		if change.LeveledUp() {
+			levelUps = append(levelUps, change)
+		}
+	}
+	return levelUps, errors.Join(errs...)
+}
+
+// nextLevelExp 返回升到 level 的下一级所需的累计经验，满级时为 0
+func (s *ProfileService) nextLevelExp(level int) int {
+	if level >= s.settings.Curve.MaxLevel {
+		return 0
+	}
+	return s.settings.Curve.ExpForLevel(level + 1)
+}
+
+// validateName 去掉首尾空白后校验名字
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return "", ErrInvalidName
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return "", ErrInvalidName
+		}
+	}
+	return name, nil
+}
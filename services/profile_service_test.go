@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/persistence"
+)
+
+func newTestProfileService(t *testing.T, settings ProfileSettings) (*ProfileService, *PlayerCache, persistence.Database) {
+	t.Helper()
+	db := persistence.NewMemory()
+	cache := NewPlayerCache(db)
+	t.Cleanup(cache.Close)
+	return NewProfileService(db, cache, settings), cache, db
+}
+
+func TestLevelCurve(t *testing.T) {
+	curve := LevelCurve{BaseExp: 100, Growth: 2, MaxLevel: 4}
+	for level, exp := range map[int]int{1: 0, 2: 100, 3: 300, 4: 700, 5: 700} {
+		if got := curve.ExpForLevel(level); got != exp {
+			t.Errorf("ExpForLevel(%d) = %d, want %d", level, got, exp)
+		}
+	}
+	for exp, level := range map[int]int{0: 1, 99: 1, 100: 2, 299: 2, 300: 3, 10000: 4} {
+		if got := curve.LevelFor(exp); got != level {
+			t.Errorf("LevelFor(%d) = %d, want %d", exp, got, level)
+		}
+	}
+}
+
+func TestProfileService_LoginCreatesProfileOnce(t *testing.T) {
+	ctx := context.Background()
+	startingCoins := int64(500)
+	s, cache, db := newTestProfileService(t, ProfileSettings{StartingCoins: &startingCoins})
+
+	player, created, err := s.Login(ctx, 7)
+	if err != nil || !created {
+		t.Fatalf("Expected the profile to be created, got %v, %v", created, err)
+	}
+	if player.Name != "player_7" || player.Level != 1 || player.Coins != 500 {
+		t.Errorf("Unexpected new profile: %+v", player)
+	}
+
+	// 初始金币记入流水
+	ledger, _ := db.Wallet().ListLedger(ctx, 7, 10)
+	if len(ledger) != 1 || ledger[0].Delta != 500 || ledger[0].Reason != "starting_coins" {
+		t.Errorf("Expected one starting_coins ledger entry, got %+v", ledger)
+	}
+
+	cache.Release(ctx, 7)
+	if _, created, err := s.Login(ctx, 7); err != nil || created {
+		t.Errorf("Expected the existing profile to be loaded, got %v, %v", created, err)
+	}
+	if balance, _ := db.Wallet().GetBalance(ctx, 7); balance != 500 {
+		t.Errorf("Expected starting coins to be granted once, got balance %d", balance)
+	}
+}
+
+func TestProfileService_StartingCoinsSetting(t *testing.T) {
+	ctx := context.Background()
+	// 未配置时使用默认值
+	s, _, _ := newTestProfileService(t, ProfileSettings{})
+	if player, _, err := s.Login(ctx, 1); err != nil || player.Coins != persistence.DefaultCoins {
+		t.Errorf("Expected %d default starting coins, got %+v, %v", persistence.DefaultCoins, player, err)
+	}
+
+	// 配置为 0 时不发放，也不写流水
+	none := int64(0)
+	s, _, db := newTestProfileService(t, ProfileSettings{StartingCoins: &none})
+	if player, created, err := s.Login(ctx, 1); err != nil || !created || player.Coins != 0 {
+		t.Errorf("Expected a profile without starting coins, got %+v, %v, %v", player, created, err)
+	}
+	if ledger, _ := db.Wallet().ListLedger(ctx, 1, 10); len(ledger) != 0 {
+		t.Errorf("Expected no ledger entry, got %+v", ledger)
+	}
+}
+
+func TestProfileService_AwardRound(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestProfileService(t, ProfileSettings{
+		ExpPerRound: 10,
+		ExpPerWin:   40,
+		Curve:       LevelCurve{BaseExp: 50, Growth: 2, MaxLevel: 10},
+	})
+	s.Login(ctx, 1)
+	s.Login(ctx, 2)
+
+	record := &models.GameRecord{RoomID: "room_1", Players: []models.PlayerInfo{
+		{UserID: 1, Outcome: models.OutcomeWin},
+		{UserID: 2, Outcome: models.OutcomeLose},
+		{UserID: 0, Outcome: models.OutcomeWin}, // 游客
+		{UserID: 3, Outcome: models.OutcomeWin}, // 没有资料
+	}}
+	levelUps, err := s.AwardRound(ctx, record)
+	if err != nil {
+		t.Fatalf("Failed to award experience: %v", err)
+	}
+	if len(levelUps) != 1 || levelUps[0].UserID != 1 || levelUps[0].OldLevel != 1 || levelUps[0].Level != 2 || levelUps[0].NextLevelExp != 150 {
+		t.Fatalf("Expected user 1 to reach level 2, got %+v", levelUps)
+	}
+
+	profile, err := s.GetProfile(ctx, 2)
+	if err != nil || profile.Player.Experience != 10 || profile.Player.Level != 1 || profile.NextLevelExp != 50 {
+		t.Errorf("Expected user 2 to have 10 exp at level 1, got %+v, %v", profile, err)
+	}
+}
+
+func TestProfileService_UpdateProfile(t *testing.T) {
+	ctx := context.Background()
+	s, cache, db := newTestProfileService(t, ProfileSettings{})
+	s.Login(ctx, 1)
+
+	for _, name := range []string{"", "   ", strings.Repeat("x", maxNameLength+1), "bad\nname"} {
+		if _, err := s.UpdateProfile(ctx, 1, name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Expected %q to be rejected, got %v", name, err)
+		}
+	}
+
+	profile, err := s.UpdateProfile(ctx, 1, "  小明  ")
+	if err != nil || profile.Player.Name != "小明" {
+		t.Fatalf("Expected the name to be updated, got %+v, %v", profile, err)
+	}
+
+	// 修改写回数据库
+	cache.Release(ctx, 1)
+	if player, _ := db.Players().GetPlayer(ctx, 1); player.Name != "小明" {
+		t.Errorf("Expected the name to be written back, got %q", player.Name)
+	}
+}
@@ -11,7 +11,7 @@ import (
 type Session struct {
 	ID         string
 	Conn       network.Connection
-	UserID     int64
+	userID     int64 // 连接协程写入、房间协程读取，由 mutex 保护
 	RoomID     string
 	Data       map[string]interface{} // 自定义数据
 	CreatedAt  time.Time
@@ -51,6 +51,20 @@ func (s *Session) GetID() string {
 	return s.ID
 }
 
+// GetUserID 返回登录的用户ID，未登录时为 0
+func (s *Session) GetUserID() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.userID
+}
+
+// SetUserID 绑定登录的用户ID
+func (s *Session) SetUserID(userID int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.userID = userID
+}
+
 func (s *Session) Close() error {
 	return s.Conn.Close()
 }
@@ -92,7 +106,7 @@ func (m *Manager) GetByUserID(userID int64) []*Session {
 
 	var result []*Session
 	for _, session := range m.sessions {
-		if session.UserID == userID {
+		if session.GetUserID() == userID {
 			result = append(result, session)
 		}
 	}
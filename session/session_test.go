@@ -63,13 +63,13 @@ func TestManager_GetByUserID(t *testing.T) {
 	manager := NewManager()
 
 	sess1 := NewSession("session1", &MockConnection{})
-	sess1.UserID = 100
+	sess1.SetUserID(100)
 
 	sess2 := NewSession("session2", &MockConnection{})
-	sess2.UserID = 200
+	sess2.SetUserID(200)
 
 	sess3 := NewSession("session3", &MockConnection{})
-	sess3.UserID = 100
+	sess3.SetUserID(100)
 
 	manager.Add(sess1)
 	manager.Add(sess2)
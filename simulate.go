@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/wfunc/gameserver/config"
+	"github.com/wfunc/gameserver/fairness"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/state"
+)
+
+// defaultSimulationSpins simulate 子命令默认模拟的 spin 次数
+const defaultSimulationSpins = 1000000
+
+// slotPaytable 由配置生成老虎机赔付表，未配置时使用默认赔付表
+func slotPaytable(cfg config.GameConfig) (*state.Paytable, error) {
+	if cfg.Paytable == nil {
+		return state.DefaultPaytable(), nil
+	}
+	paytable := &state.Paytable{
+		Symbols:            cfg.Paytable.Symbols,
+		Pays:               cfg.Paytable.Pays,
+		JackpotSymbol:      cfg.Paytable.JackpotSymbol,
+		Scatter:            cfg.Paytable.Scatter,
+		FreeSpins:          cfg.Paytable.FreeSpins,
+		FreeSpinMultiplier: cfg.Paytable.FreeSpinMultiplier,
+	}
+	if err := paytable.Validate(); err != nil {
+		return nil, err
+	}
+	return paytable, nil
+}
+
+// runSimulate 执行 simulate 子命令，用生效的赔付表模拟 spin 并报告返奖率等统计：
+//
+//	simulate [spins] [seed]  spins 默认一百万次，seed 默认随机，指定后结果可以复现
+func runSimulate(paytable *state.Paytable, args []string) error {
+	spins := defaultSimulationSpins
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("usage: simulate [spins] [seed]")
+		}
+		spins = n
+	}
+	seed := fairness.NewCommitment().ServerSeed
+	if len(args) > 1 {
+		seed = args[1]
+	}
+
+	start := time.Now()
+	result := paytable.Simulate(seed, spins)
+	logger.Log.Infof("Simulated %d spins in %v (seed %s)", result.Spins, time.Since(start).Round(time.Millisecond), seed)
+	logger.Log.Infof("RTP:           %.4f%% (theoretical %.4f%%)", result.RTP*100, paytable.TheoreticalRTP()*100)
+	logger.Log.Infof("Hit frequency: %.4f%% (1 in %.1f)", result.HitFrequency*100, 1/max(result.HitFrequency, 1/float64(spins)))
+	logger.Log.Infof("Volatility:    %.4f (standard deviation of the win per unit bet)", result.Volatility)
+	logger.Log.Infof("Free spins:    %d (%.4f per spin)", result.FreeSpins, float64(result.FreeSpins)/float64(spins))
+	logger.Log.Infof("Max win:       %dx", result.MaxWin)
+	return nil
+}
@@ -3,20 +3,17 @@ package state
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
-	"sync"
+	"math/rand/v2"
 	"time"
 
+	"github.com/wfunc/gameserver/fairness"
 	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
 	"github.com/wfunc/gameserver/network"
 )
 
-// Action represents a player action that can be unmarshalled from a packet.
-type Action struct {
-	Type string `json:"type"`
-}
-
-// GamingState 游戏进行状态
+// GamingState 游戏进行状态，具体玩法由房间游戏类型对应的 GameModule 实现。
+// 所有方法都在房间协程中调用，因此不需要加锁。
 type GamingState struct {
 	RoomStateBase
 	GameDuration  time.Duration
@@ -24,12 +21,25 @@ type GamingState struct {
 	GameData      interface{}
 	Results       map[string]interface{}
 	TimerID       int64
-	dataMutex     sync.RWMutex // Mutex to protect GameData and Results
+	StartTime     time.Time            // 一局开始的时间，写入游戏记录
+	Fairness      *fairness.Commitment // 本局的服务器种子，哈希在开局时公布，种子在结束时公开
+	Rand          *rand.Rand           // 由服务器种子派生的随机数发生器，游戏模块不能使用全局随机数
+	Turns         *Turns               // 回合制游戏的行动顺序，游戏模块不是 TurnGame 时为 nil
+	module        GameModule
+	source        *rand.ChaCha8
+	actions       []LoggedAction      // 本局被接受的动作，与种子一起可以重放这一局
+	claims        []int64             // 正在处理的动作领取的奖池金额，随动作一起记录
+	subStates     map[string]SubState // 玩家ID -> 玩家所处的子状态
+	roster        []RoundPlayer       // 回合制游戏开局时房间内的玩家
+	ending        bool                // 游戏模块要求提前结束这一局
+	sync          *stateSync          // 状态同步模式下每个玩家已确认的状态
+	lastUpdate    time.Time           // 上一次 OnUpdate 的时间，用于按实际流逝时间倒计时
 }
 
-// NewGamingState 创建新的游戏状态
+// NewGamingState 创建新的游戏状态，房间实现 SeedSource 时使用房间指定的种子
 func NewGamingState(room RoomContext, duration time.Duration) *GamingState {
-	return &GamingState{
+	module, _ := GetGameModule(room.GetGameType())
+	s := &GamingState{
 		RoomStateBase: RoomStateBase{
 			ID:   "gaming",
 			Room: room,
@@ -37,30 +47,183 @@ func NewGamingState(room RoomContext, duration time.Duration) *GamingState {
 		GameDuration:  duration,
 		RemainingTime: duration,
 		Results:       make(map[string]interface{}),
+		module:        module,
+	}
+
+	var seed string
+	if source, ok := room.(SeedSource); ok {
+		seed = source.RoundSeed()
+	}
+	if seed == "" {
+		s.setSeed(fairness.NewCommitment())
+	} else {
+		s.setSeed(fairness.RestoreCommitment(seed))
+	}
+	return s
+}
+
+// setSeed 设置本局的服务器种子并重新派生随机数发生器
+func (s *GamingState) setSeed(commitment *fairness.Commitment) {
+	s.Fairness = commitment
+	s.source = rand.NewChaCha8(fairness.StreamKey(commitment.ServerSeed))
+	s.Rand = rand.New(s.source)
+}
+
+// NewRestoredGamingState 从房间快照恢复一局进行中的游戏，round 为本局的种子和动作记录。
+// 游戏模块不支持恢复、数据损坏或快照中没有种子时重新开始这一局，已扣除的下注由 abortRound 退还
+func NewRestoredGamingState(room RoomContext, duration, remaining time.Duration, raw json.RawMessage, round *RoundSnapshot) *GamingState {
+	s := NewGamingState(room, duration)
+	restorer, ok := s.module.(DataRestorer)
+	if len(raw) == 0 {
+		return s
+	}
+	if !ok || round == nil || round.Seed == "" {
+		s.abortRound(raw)
+		return s
+	}
+
+	commitment := s.Fairness
+	s.setSeed(fairness.RestoreCommitment(round.Seed))
+	data, err := restorer.RestoreData(s, raw)
+	if err == nil && len(round.RandState) > 0 {
+		err = s.source.UnmarshalBinary(round.RandState)
+	}
+	if err != nil {
+		logger.Log.Warnf("Room %s failed to restore game data, restarting round: %v", room.GetID(), err)
+		s.setSeed(commitment)
+		s.abortRound(raw)
+		return s
+	}
+	s.GameData = data
+	s.actions = round.Actions
+	s.roster = round.Players
+	if round.Turns != nil {
+		s.Turns = round.Turns
+		s.Turns.bind(s)
+	}
+	s.RemainingTime = remaining
+	// 按已进行的时长推算开局时间，使记录的时长包含重启前的部分
+	s.StartTime = time.Now().Add(remaining - duration)
+	return s
+}
+
+// abortRound 作废快照中无法恢复的一局：游戏模块退还已扣除的下注，
+// 退还结果记为一条作废的游戏记录，供与金币流水对账
+func (s *GamingState) abortRound(raw json.RawMessage) {
+	aborter, ok := s.module.(RoundAborter)
+	if !ok {
+		return
+	}
+	players := aborter.AbortRound(s, raw)
+	if len(players) == 0 {
+		return
 	}
+	logger.Log.Warnf("Room %s aborted a round that could not be restored, refunded %d players", s.Room.GetID(), len(players))
+	now := time.Now()
+	s.Room.RecordGame(&models.GameRecord{
+		RoomID:    s.Room.GetID(),
+		GameType:  s.Room.GetGameType(),
+		Result:    map[string]interface{}{"aborted": true},
+		Players:   players,
+		StartTime: now,
+		EndTime:   now,
+		CreatedAt: now,
+	})
 }
 
 // HandleAction handles actions from players.
 func (s *GamingState) HandleAction(player Player, actionData []byte) error {
-	var action Action
-	if err := json.Unmarshal(actionData, &action); err != nil {
+	action, err := ParseAction(actionData)
+	if err != nil {
 		return fmt.Errorf("failed to unmarshal action data: %w", err)
 	}
+	// 状态确认不是游戏动作，不交给游戏模块，也不记录
+	if action.Type == StateAckAction {
+		return s.ackState(player, actionData)
+	}
 
-	if s.Room.GetGameType() == "slot_machine" {
-		if action.Type == "spin" {
-			logger.Log.Infof("Player %s triggered a spin in room %s", player.GetID(), s.Room.GetID())
-			s.updateSlotMachineLogic(player)
-		}
+	if s.module == nil {
+		return nil
+	}
+	if s.Turns != nil && s.Turns.Current != player.GetID() {
+		return ErrNotYourTurn
+	}
+
+	if err := s.dispatch(player, action, actionData); err != nil {
+		return err
+	}
+	s.logAction(player, actionData)
+	if s.ending {
+		s.endGame()
 	}
 	return nil
 }
 
+// EndRound 由游戏模块在一局提前结束时调用，例如一手牌已经分出胜负；
+// 当前的动作记录之后结束这一局，在 InitData 中调用时在下一次心跳结束
+func (s *GamingState) EndRound() {
+	s.ending = true
+}
+
+// SendPrivate 只向一个玩家发送数据，例如只有自己能看到的底牌，房间不支持时不发送
+func (s *GamingState) SendPrivate(playerID string, v interface{}) {
+	messenger, ok := s.Room.(PlayerMessenger)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Log.Errorf("Failed to marshal private state: %v", err)
+		return
+	}
+	if err := messenger.SendToPlayer(playerID, network.MsgTypePrivateState, data); err != nil {
+		logger.Log.Warnf("Room %s failed to send private state to player %s: %v", s.Room.GetID(), playerID, err)
+	}
+}
+
+// dispatch 把动作交给游戏模块处理
+func (s *GamingState) dispatch(player Player, action Action, actionData []byte) error {
+	s.claims = nil
+	return s.module.HandleAction(s, player, action, actionData)
+}
+
+// OnPlayerJoin 交给游戏模块处理一局中途加入的玩家，并记入动作记录以便重放。
+// 回合制游戏中离开后又回到房间的玩家恢复自己行动，状态同步模式下玩家收到完整快照
+func (s *GamingState) OnPlayerJoin(player Player) {
+	if s.Turns != nil {
+		s.Turns.setAway(player.GetID(), false)
+	}
+	if handler, ok := s.module.(PlayerJoinHandler); ok && s.GameData != nil {
+		handler.OnPlayerJoin(s, player)
+		s.logJoin(player)
+	}
+	s.resyncPlayer(player.GetID())
+}
+
+// OnPlayerLeave 玩家离开时保留其游戏数据，重连后可以继续。
+// 回合制游戏中轮到离开的玩家时不再等待，立即由游戏模块代为行动
+func (s *GamingState) OnPlayerLeave(player Player) {
+	if s.Turns != nil {
+		s.Turns.setAway(player.GetID(), true)
+	}
+	s.dropPlayerSync(player.GetID())
+}
+
 // OnEnter 进入游戏状态
 func (s *GamingState) OnEnter() {
 	logger.Log.Infof("房间 %s 进入游戏状态，游戏时长: %v", s.Room.GetID(), s.GameDuration)
-	s.initializeGameData()
+	s.lastUpdate = time.Now()
+	if s.StartTime.IsZero() {
+		s.StartTime = s.lastUpdate
+	}
+	fresh := s.GameData == nil
+	if fresh {
+		s.initializeGameData()
+	}
 	s.notifyGameStart()
+	if fresh && s.Turns != nil && !s.ending {
+		s.Turns.start()
+	}
 }
 
 // OnExit 退出游戏状态
@@ -69,16 +232,21 @@ func (s *GamingState) OnExit() {
 	s.cleanupGameData()
 }
 
-// OnUpdate 游戏状态更新
+// OnUpdate 按两次心跳之间实际流逝的时间扣减剩余时间，心跳延迟不会拉长一局
 func (s *GamingState) OnUpdate() {
-	s.dataMutex.Lock()
-	defer s.dataMutex.Unlock()
-
-	s.RemainingTime -= 100 * time.Millisecond
-	if s.RemainingTime <= 0 {
+	now := time.Now()
+	s.RemainingTime -= now.Sub(s.lastUpdate)
+	s.lastUpdate = now
+	if s.RemainingTime <= 0 || s.ending {
 		s.endGame()
 		return
 	}
+	if s.Turns != nil && s.Turns.expired(now) {
+		s.timeoutTurn()
+		if s.ending {
+			s.endGame()
+		}
+	}
 }
 
 // GetID 获取状态ID
@@ -87,31 +255,22 @@ func (s *GamingState) GetID() string {
 }
 
 func (s *GamingState) initializeGameData() {
-	s.dataMutex.Lock()
-	defer s.dataMutex.Unlock()
-
-	switch s.Room.GetGameType() {
-	case "slot_machine":
-		s.GameData = s.initializeSlotMachineData()
-	default:
-		s.GameData = make(map[string]interface{})
+	if game := s.turnGame(); game != nil {
+		if s.roster == nil {
+			s.captureRoster()
+		}
+		s.Turns = newTurns(s, game.TurnOrder(s))
 	}
-}
-
-func (s *GamingState) initializeSlotMachineData() map[string]interface{} {
-	return map[string]interface{}{
-		"reels":       [3]int{0, 0, 0},
-		"spin_count":  0,
-		"last_result": nil,
+	if s.module != nil {
+		s.GameData = s.module.InitData(s)
+	} else {
+		s.GameData = make(map[string]interface{})
 	}
 }
 
 func (s *GamingState) notifyGameStart() {
-	s.dataMutex.RLock()
-	defer s.dataMutex.RUnlock()
-
 	logger.Log.Debugf("Data before marshal in notifyGameStart: %+v", s.GameData)
-	data, err := json.Marshal(s.GameData)
+	data, err := json.Marshal(s.publicData())
 	if err != nil {
 		logger.Log.Errorf("Failed to marshal game start data: %v", err)
 		return
@@ -120,31 +279,59 @@ func (s *GamingState) notifyGameStart() {
 	s.Room.Broadcast(network.MsgTypeGameStart, data)
 }
 
-func (s *GamingState) updateSlotMachineLogic(player Player) {
-	s.dataMutex.Lock()
-	defer s.dataMutex.Unlock()
+// Economy 返回房间的经济系统，房间没有提供时返回 nil
+func (s *GamingState) Economy() Economy {
+	if provider, ok := s.Room.(EconomyProvider); ok {
+		return provider.Economy()
+	}
+	return nil
+}
 
-	gameData, ok := s.GameData.(map[string]interface{})
+// Jackpot 返回房间共享的累积奖池，房间没有提供时返回 nil。
+// 领取的金额随动作记录，重放时得到相同的金额
+func (s *GamingState) Jackpot() Jackpot {
+	provider, ok := s.Room.(JackpotProvider)
 	if !ok {
-		return
+		return nil
 	}
+	jackpot := provider.Jackpot()
+	if jackpot == nil {
+		return nil
+	}
+	return &recordedJackpot{state: s, jackpot: jackpot}
+}
 
-	reels := [3]int{rand.Intn(8), rand.Intn(8), rand.Intn(8)}
-	gameData["reels"] = reels
-	gameData["spin_count"] = gameData["spin_count"].(int) + 1
-
-	result := s.calculateSlotResult(reels)
-	gameData["last_result"] = result
+// ObserveWager 报告一次下注和派奖，供游戏模块在每次下注结算后调用
+func (s *GamingState) ObserveWager(bet, payout int64) {
+	if observer, ok := s.Room.(WagerObserver); ok {
+		observer.ObserveWager(bet, payout)
+	}
+}
 
-	s.GameData = gameData
+// Checkpoint 立即保存房间快照，供游戏模块在扣除下注等重启后不能丢失的变化后调用
+func (s *GamingState) Checkpoint() {
+	if checkpointer, ok := s.Room.(Checkpointer); ok {
+		checkpointer.Checkpoint()
+	}
+}
 
-	s.syncGameState()
+// publicData 返回广播给房间的游戏数据，游戏模块实现 DataPublisher 时只广播公开的部分
+func (s *GamingState) publicData() interface{} {
+	if publisher, ok := s.module.(DataPublisher); ok && s.GameData != nil {
+		return publisher.PublicData(s)
+	}
+	return s.GameData
 }
 
-func (s *GamingState) syncGameState() {
-	// This function is called from within updateSlotMachineLogic, which already holds the lock.
+// SyncGameState 向房间广播当前游戏数据，供游戏模块在数据变化后调用。
+// 游戏模块实现 StateSyncer 时改为向每个玩家发送相对其已确认状态的增量
+func (s *GamingState) SyncGameState() {
+	if syncer := s.stateSyncer(); syncer != nil {
+		s.syncStates(syncer)
+		return
+	}
 	logger.Log.Debugf("Data before marshal in syncGameState: %+v", s.GameData)
-	data, err := json.Marshal(s.GameData)
+	data, err := json.Marshal(s.publicData())
 	if err != nil {
 		logger.Log.Errorf("Error marshalling sync message: %v", err)
 		return
@@ -154,38 +341,56 @@ func (s *GamingState) syncGameState() {
 }
 
 func (s *GamingState) endGame() {
-	// This function is called from OnUpdate, which already holds the lock.
 	logger.Log.Infof("房间 %s 游戏结束", s.Room.GetID())
 	s.calculateFinalResults()
 	s.notifyGameEnd()
+	s.Room.RecordGame(s.buildRecord())
 
-	waitingState := NewWaitingState(s.Room)
-	s.Room.ChangeState(waitingState)
+	s.Room.ChangeState(nextRoundState(s.Room))
 }
 
 func (s *GamingState) calculateFinalResults() {
-	switch s.Room.GetGameType() {
-	case "slot_machine":
-		s.Results = s.calculateSlotMachineResults()
+	if s.module != nil {
+		s.Results = s.module.Results(s)
 	}
 }
 
-func (s *GamingState) calculateSlotMachineResults() map[string]interface{} {
-	gameData, ok := s.GameData.(map[string]interface{})
-	if !ok {
-		return map[string]interface{}{"error": "invalid game data"}
+// buildRecord 生成本局的游戏记录，游戏模块没有统计下注时房间内的玩家都记为平局
+func (s *GamingState) buildRecord() *models.GameRecord {
+	now := time.Now()
+	record := &models.GameRecord{
+		RoomID:    s.Room.GetID(),
+		GameType:  s.Room.GetGameType(),
+		Result:    s.Results,
+		StartTime: s.StartTime,
+		EndTime:   now,
+		Duration:  int(now.Sub(s.StartTime).Seconds()),
+		CreatedAt: now,
 	}
 
-	finalResult := map[string]interface{}{
-		"final_spin_count": gameData["spin_count"],
-		"last_win":         nil,
+	if record.Result == nil {
+		record.Result = make(map[string]interface{})
 	}
-
-	if lastResult, ok := gameData["last_result"].(map[string]interface{}); ok {
-		finalResult["last_win"] = lastResult["win"]
+	record.Result[ReplayKey] = &ReplayLog{
+		Seed:    s.Fairness.ServerSeed,
+		Settled: s.Economy() != nil,
+		Jackpot: s.Jackpot() != nil,
+		Players: s.roster,
+		Actions: s.actions,
 	}
 
-	return finalResult
+	if recorder, ok := s.module.(RoundRecorder); ok {
+		record.Players = recorder.PlayerResults(s)
+		return record
+	}
+	for _, player := range s.Room.GetPlayers() {
+		info := models.PlayerInfo{Outcome: models.OutcomeDraw}
+		if user, ok := player.(UserPlayer); ok {
+			info.UserID = user.GetUserID()
+		}
+		record.Players = append(record.Players, info)
+	}
+	return record
 }
 
 func (s *GamingState) notifyGameEnd() {
@@ -200,26 +405,6 @@ func (s *GamingState) notifyGameEnd() {
 }
 
 func (s *GamingState) cleanupGameData() {
-	s.dataMutex.Lock()
-	defer s.dataMutex.Unlock()
 	s.GameData = nil
 	s.Results = nil
 }
-
-func (s *GamingState) calculateSlotResult(reels [3]int) map[string]interface{} {
-	win := reels[0] == reels[1] && reels[1] == reels[2]
-	payout := 0
-	if win {
-		switch reels[0] {
-		case 7: // 7-7-7
-			payout = 1000
-		default:
-			payout = 100
-		}
-	}
-	return map[string]interface{}{
-		"win":     win,
-		"payout":  payout,
-		"symbols": reels,
-	}
-}
@@ -0,0 +1,613 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/wfunc/gameserver/fairness"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+)
+
+const (
+	// DefaultSmallBlind 德州扑克默认的小盲注
+	DefaultSmallBlind = 5
+	// DefaultBigBlind 德州扑克默认的大盲注
+	DefaultBigBlind = 10
+	// DefaultBuyIn 德州扑克每手牌默认的带入筹码
+	DefaultBuyIn = 1000
+	// holdemMaxPlayers 一手牌最多的玩家数，一副牌发完底牌后还要发五张公共牌
+	holdemMaxPlayers = (deckSize - 5) / 2
+)
+
+// 德州扑克的下注轮
+const (
+	StreetPreflop  = "preflop"
+	StreetFlop     = "flop"
+	StreetTurn     = "turn"
+	StreetRiver    = "river"
+	StreetShowdown = "showdown"
+)
+
+var (
+	// ErrInvalidAction 当前不能执行的动作，例如面对下注时过牌
+	ErrInvalidAction = errors.New("invalid poker action")
+	// ErrInvalidRaise 加注额小于最小加注额、超过筹码，或行动没有被重新开放时加注
+	ErrInvalidRaise = errors.New("invalid raise")
+)
+
+func init() {
+	RegisterGameModule(&Holdem{})
+}
+
+// Holdem 无限注德州扑克游戏模块，一局为一手牌，按房间的座位顺序行动。
+// 每手牌开始时每个玩家带入筹码，结束时剩余的筹码全部退回。房间使用真实金币结算时
+// 带入和退回经由经济系统，余额不足 BuyIn 的玩家带入全部余额，不足一个大盲注的玩家不参与这一手
+type Holdem struct {
+	SmallBlind int64 // 为 0 时使用 DefaultSmallBlind
+	BigBlind   int64 // 为 0 时使用 DefaultBigBlind
+	BuyIn      int64 // 每手牌最多带入的筹码，为 0 时使用 DefaultBuyIn
+}
+
+// HoldemData 一手德州扑克的公开数据，底牌只发给玩家自己，摊牌时才写入
+type HoldemData struct {
+	SeedHash   string          `json:"server_seed_hash"`
+	Street     string          `json:"street"`
+	Button     string          `json:"button"` // 庄家的玩家ID
+	SmallBlind int64           `json:"small_blind"`
+	BigBlind   int64           `json:"big_blind"`
+	Players    []*HoldemPlayer `json:"players"` // 按行动顺序排列，从庄家的下一位开始
+	Board      []Card          `json:"board"`
+	CurrentBet int64           `json:"current_bet"` // 本轮的最高下注
+	MinRaise   int64           `json:"min_raise"`   // 本轮的最小加注额
+	Pot        int64           `json:"pot"`         // 所有玩家投入的总额
+	Pots       []HoldemPot     `json:"pots,omitempty"`
+	Finished   bool            `json:"finished"`
+	deck       []Card
+}
+
+// HoldemPlayer 一个玩家在一手牌中的筹码和下注
+type HoldemPlayer struct {
+	ID         string `json:"id"`
+	UserID     int64  `json:"user_id,omitempty"`
+	Seat       int    `json:"seat"`
+	Stack      int64  `json:"stack"`
+	Bet        int64  `json:"bet"`   // 本轮的下注
+	Total      int64  `json:"total"` // 本手牌投入的总额
+	Won        int64  `json:"won"`   // 从底池赢得的筹码
+	Folded     bool   `json:"folded,omitempty"`
+	AllIn      bool   `json:"all_in,omitempty"`
+	Acted      bool   `json:"acted,omitempty"` // 本轮已行动，被完整加注后重置
+	LastAction string `json:"last_action,omitempty"`
+	Cards      []Card `json:"cards,omitempty"` // 摊牌时公开的底牌
+	Hand       string `json:"hand,omitempty"`  // 摊牌时的牌型
+	hole       []Card
+}
+
+// holdemAction bet 和 raise 动作的参数，Amount 为本轮下注到的总额
+type holdemAction struct {
+	Amount int64 `json:"amount"`
+}
+
+// holdemPrivate 只发给玩家自己的底牌
+type holdemPrivate struct {
+	Cards []Card `json:"cards"`
+}
+
+// GameType 返回游戏类型
+func (m *Holdem) GameType() string {
+	return "holdem"
+}
+
+// Config 返回德州扑克的默认节奏参数，一手牌在分出胜负时提前结束
+func (m *Holdem) Config() GameConfig {
+	return GameConfig{
+		TickInterval:  100 * time.Millisecond,
+		RoundDuration: 10 * time.Minute,
+		StartRule:     StartRule{Mode: StartMinPlayers, MinPlayers: 2},
+		TurnTimeout:   30 * time.Second,
+	}
+}
+
+// Validate 检查盲注和带入
+func (m *Holdem) Validate() error {
+	sb, bb, buyIn := m.blinds()
+	if sb <= 0 || bb < sb {
+		return fmt.Errorf("holdem blinds must satisfy 0 < small blind <= big blind, got %d/%d", sb, bb)
+	}
+	if buyIn <= bb {
+		return fmt.Errorf("holdem buy-in %d must exceed the big blind %d", buyIn, bb)
+	}
+	return nil
+}
+
+// blinds 返回生效的小盲注、大盲注和带入
+func (m *Holdem) blinds() (sb, bb, buyIn int64) {
+	sb, bb, buyIn = m.SmallBlind, m.BigBlind, m.BuyIn
+	if sb == 0 {
+		sb = DefaultSmallBlind
+	}
+	if bb == 0 {
+		bb = DefaultBigBlind
+	}
+	if buyIn == 0 {
+		buyIn = DefaultBuyIn
+	}
+	return sb, bb, buyIn
+}
+
+// TurnOrder 按座位号排列开局时的玩家，InitData 再从庄家的下一位开始重新排列
+func (m *Holdem) TurnOrder(s *GamingState) []string {
+	roster := slices.Clone(s.Roster())
+	sort.SliceStable(roster, func(i, j int) bool { return roster[i].Seat < roster[j].Seat })
+	order := make([]string, len(roster))
+	for i, p := range roster {
+		order[i] = p.PlayerID
+	}
+	return order
+}
+
+// InitData 洗牌、带入筹码、随机决定庄家、下盲注并发底牌。
+// 洗牌必须是本局第一次使用 Rand，恢复时据此由种子重新得到同一副牌
+func (m *Holdem) InitData(s *GamingState) interface{} {
+	sb, bb, buyIn := m.blinds()
+	data := &HoldemData{
+		SeedHash:   s.Fairness.Hash,
+		Street:     StreetPreflop,
+		SmallBlind: sb,
+		BigBlind:   bb,
+		deck:       shuffledDeck(s.Rand),
+	}
+
+	roster := make(map[string]RoundPlayer)
+	for _, p := range s.Roster() {
+		roster[p.PlayerID] = p
+	}
+	economy := s.Economy()
+	var seated []*HoldemPlayer
+	for _, id := range s.Turns.Order {
+		// 重放时名单中已经记录了带入的筹码
+		p := roster[id]
+		if !p.SatOut && p.Chips == 0 && len(seated) < holdemMaxPlayers {
+			p.Chips = m.buyIn(s, economy, p.UserID, buyIn, bb)
+			s.SetChips(id, p.Chips)
+		}
+		if p.SatOut || p.Chips == 0 {
+			s.SitOut(id)
+			continue
+		}
+		seated = append(seated, &HoldemPlayer{ID: id, UserID: p.UserID, Seat: p.Seat, Stack: p.Chips})
+	}
+
+	if len(seated) < 2 {
+		// 不足两人时不发牌，退回带入
+		data.Players = seated
+		data.Finished = true
+		s.Turns.Order = nil
+		m.cashOut(s, data)
+		s.EndRound()
+		return data
+	}
+
+	button := s.Rand.IntN(len(seated))
+	data.Players = append(slices.Clone(seated[button+1:]), seated[:button+1]...)
+	data.Button = seated[button].ID
+	s.Turns.Order = make([]string, len(data.Players))
+	for i, p := range data.Players {
+		s.Turns.Order[i] = p.ID
+		p.hole = data.deck[2*i : 2*i+2]
+	}
+
+	// 两人时庄家下小盲注并在翻牌前先行动
+	n := len(data.Players)
+	small, big, first := data.Players[0], data.Players[1], data.Players[2%n]
+	if n == 2 {
+		small, big, first = data.Players[1], data.Players[0], data.Players[1]
+	}
+	m.commit(data, small, sb)
+	m.commit(data, big, bb)
+	data.CurrentBet, data.MinRaise = bb, bb
+	s.Turns.Current = first.ID
+
+	for _, p := range data.Players {
+		s.SendPrivate(p.ID, holdemPrivate{Cards: p.hole})
+	}
+	return data
+}
+
+// RestoreData 从快照恢复一手牌，底牌和公共牌由种子重新洗出的同一副牌得到
+func (m *Holdem) RestoreData(s *GamingState, raw json.RawMessage) (interface{}, error) {
+	data := &HoldemData{}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, err
+	}
+	if data.SeedHash != s.Fairness.Hash {
+		return nil, fairness.ErrSeedMismatch
+	}
+	data.deck = shuffledDeck(rand.New(rand.NewChaCha8(fairness.StreamKey(s.Fairness.ServerSeed))))
+	for i, p := range data.Players {
+		p.hole = data.deck[2*i : 2*i+2]
+	}
+	return data, nil
+}
+
+// HandleAction 处理 fold、check、call、bet、raise 和 all_in，bet 和 raise 的 amount 为下注到的总额
+func (m *Holdem) HandleAction(s *GamingState, player Player, action Action, actionData []byte) error {
+	data, ok := s.GameData.(*HoldemData)
+	if !ok || data.Finished {
+		return ErrInvalidAction
+	}
+	p := data.player(player.GetID())
+	if p == nil {
+		return ErrNotYourTurn
+	}
+	var params holdemAction
+	if err := json.Unmarshal(actionData, &params); err != nil {
+		return err
+	}
+
+	toCall := data.CurrentBet - p.Bet
+	switch action.Type {
+	case "fold":
+		p.Folded = true
+	case "check":
+		if toCall > 0 {
+			return ErrInvalidAction
+		}
+	case "call":
+		if toCall <= 0 {
+			return ErrInvalidAction
+		}
+		m.commit(data, p, toCall)
+	case "bet", "raise":
+		if err := m.raise(data, p, params.Amount); err != nil {
+			return err
+		}
+	case "all_in":
+		if all := p.Bet + p.Stack; all > data.CurrentBet {
+			if err := m.raise(data, p, all); err != nil {
+				return err
+			}
+		} else {
+			m.commit(data, p, p.Stack)
+		}
+	default:
+		return ErrInvalidAction
+	}
+
+	p.Acted = true
+	p.LastAction = action.Type
+	if p.Folded || p.AllIn {
+		s.Turns.Remove(p.ID)
+	}
+	m.advance(s, data)
+	s.SyncGameState()
+	return nil
+}
+
+// holdemSyncState 状态同步时的公开数据，玩家按ID索引，一个玩家行动后的增量只包含该玩家和底池
+type holdemSyncState struct {
+	*HoldemData
+	Players map[string]*HoldemPlayer `json:"players"`
+	Order   []string                 `json:"order"` // 行动顺序，从庄家的下一位开始
+}
+
+// SyncState 返回按玩家ID索引的公开数据。增量中数组整体替换，玩家列表若为数组，每个动作都会重发所有玩家
+func (m *Holdem) SyncState(s *GamingState) interface{} {
+	data, ok := s.GameData.(*HoldemData)
+	if !ok {
+		return s.GameData
+	}
+	view := holdemSyncState{
+		HoldemData: data,
+		Players:    make(map[string]*HoldemPlayer, len(data.Players)),
+		Order:      make([]string, 0, len(data.Players)),
+	}
+	for _, p := range data.Players {
+		view.Players[p.ID] = p
+		view.Order = append(view.Order, p.ID)
+	}
+	return view
+}
+
+// MaxPlayers 一副牌最多供 holdemMaxPlayers 个玩家发牌
+func (m *Holdem) MaxPlayers() int {
+	return holdemMaxPlayers
+}
+
+// AutoAction 超时或离开的玩家能过牌时过牌，否则弃牌
+func (m *Holdem) AutoAction(s *GamingState, playerID string) []byte {
+	data, ok := s.GameData.(*HoldemData)
+	if !ok {
+		return nil
+	}
+	if p := data.player(playerID); p != nil && p.Bet == data.CurrentBet {
+		return []byte(`{"type":"check"}`)
+	}
+	return []byte(`{"type":"fold"}`)
+}
+
+// OnPlayerJoin 玩家回到房间时重新发送底牌，用户以新的玩家ID重连时接替原来的位置
+func (m *Holdem) OnPlayerJoin(s *GamingState, player Player) {
+	data, ok := s.GameData.(*HoldemData)
+	if !ok || data.Finished {
+		return
+	}
+	var userID int64
+	if user, ok := player.(UserPlayer); ok {
+		userID = user.GetUserID()
+	}
+	for _, p := range data.Players {
+		if p.ID != player.GetID() && (userID == 0 || p.UserID != userID) {
+			continue
+		}
+		if p.ID != player.GetID() {
+			s.Turns.Replace(p.ID, player.GetID())
+			if data.Button == p.ID {
+				data.Button = player.GetID()
+			}
+			p.ID = player.GetID()
+			s.SyncGameState()
+		}
+		s.SendPrivate(p.ID, holdemPrivate{Cards: p.hole})
+		return
+	}
+}
+
+// raise 把玩家本轮的下注加到 to。加注额达到最小加注额时重新开放其他玩家的行动，
+// 不足最小加注额的全下不重新开放，已行动过的玩家只能跟注或弃牌
+func (m *Holdem) raise(data *HoldemData, p *HoldemPlayer, to int64) error {
+	all := p.Bet + p.Stack
+	increase := to - data.CurrentBet
+	if to <= data.CurrentBet || to > all || p.Acted {
+		return ErrInvalidRaise
+	}
+	if increase < data.MinRaise && to != all {
+		return ErrInvalidRaise
+	}
+
+	m.commit(data, p, to-p.Bet)
+	if increase >= data.MinRaise {
+		data.MinRaise = increase
+		for _, other := range data.Players {
+			if other != p {
+				other.Acted = false
+			}
+		}
+	}
+	data.CurrentBet = to
+	return nil
+}
+
+// commit 从玩家的筹码中下注 amount，筹码不足时全下
+func (m *Holdem) commit(data *HoldemData, p *HoldemPlayer, amount int64) {
+	amount = min(amount, p.Stack)
+	p.Stack -= amount
+	p.Bet += amount
+	p.Total += amount
+	data.Pot += amount
+	if p.Stack == 0 {
+		p.AllIn = true
+	}
+}
+
+// advance 在一个动作之后决定下一个行动的玩家：本轮还有玩家需要行动时轮到他，
+// 否则发下一轮的公共牌；只剩一个玩家或不再有人可以下注时直接结束这一手
+func (m *Holdem) advance(s *GamingState, data *HoldemData) {
+	if data.remaining() == 1 {
+		m.showdown(s, data)
+		return
+	}
+	if next := data.nextToAct(s.Turns.Current); next != nil {
+		s.Turns.SetCurrent(next.ID)
+		return
+	}
+
+	for data.Street != StreetRiver {
+		m.nextStreet(data)
+		if data.canAct() >= 2 {
+			s.Turns.SetCurrent(data.nextToAct(data.Button).ID)
+			return
+		}
+	}
+	m.showdown(s, data)
+}
+
+// nextStreet 结束本轮下注并发出下一轮的公共牌，从牌堆中发完底牌之后的位置依次发出
+func (m *Holdem) nextStreet(data *HoldemData) {
+	for _, p := range data.Players {
+		p.Bet = 0
+		p.Acted = false
+	}
+	data.CurrentBet, data.MinRaise = 0, data.BigBlind
+
+	cards := 1
+	switch data.Street {
+	case StreetPreflop:
+		data.Street, cards = StreetFlop, 3
+	case StreetFlop:
+		data.Street = StreetTurn
+	case StreetTurn:
+		data.Street = StreetRiver
+	}
+	start := 2*len(data.Players) + len(data.Board)
+	data.Board = append(data.Board, data.deck[start:start+cards]...)
+}
+
+// showdown 拆分底池并派给每个底池中牌型最大的玩家，平分时多出的筹码给庄家之后最先行动的赢家。
+// 只剩一个玩家时不公开底牌
+func (m *Holdem) showdown(s *GamingState, data *HoldemData) {
+	ranks := make(map[string]int)
+	if data.remaining() > 1 {
+		data.Street = StreetShowdown
+		for _, p := range data.Players {
+			if p.Folded {
+				continue
+			}
+			rank := EvaluateHand(append(slices.Clone(p.hole), data.Board...))
+			ranks[p.ID] = rank.Value
+			p.Cards, p.Hand = p.hole, rank.Category.String()
+		}
+	}
+
+	data.Pots = buildPots(data.Players)
+	for i := range data.Pots {
+		pot := &data.Pots[i]
+		best := -1
+		for _, id := range pot.Eligible {
+			if ranks[id] > best {
+				best, pot.Winners = ranks[id], nil
+			}
+			if ranks[id] == best {
+				pot.Winners = append(pot.Winners, id)
+			}
+		}
+		share, odd := pot.Amount/int64(len(pot.Winners)), pot.Amount%int64(len(pot.Winners))
+		for j, id := range pot.Winners {
+			won := share
+			if int64(j) < odd {
+				won++
+			}
+			p := data.player(id)
+			p.Won += won
+			p.Stack += won
+		}
+	}
+
+	data.Finished = true
+	s.Turns.Stop()
+	m.cashOut(s, data)
+	s.EndRound()
+}
+
+// buyIn 扣除玩家的带入并返回带入的筹码，不能参与时返回 0。房间没有经济系统时不扣费，
+// 否则带入 limit 和余额中较少的一方，余额不足 minimum 时不参与
+func (m *Holdem) buyIn(s *GamingState, economy Economy, userID, limit, minimum int64) int64 {
+	if economy == nil {
+		return limit
+	}
+	if userID == 0 {
+		return 0
+	}
+	balance, err := economy.Balance(userID)
+	if err == nil && balance < minimum {
+		err = fmt.Errorf("balance %d is below the big blind", balance)
+	}
+	if err == nil {
+		err = economy.Wager(userID, min(limit, balance), "holdem_buy_in")
+	}
+	if err != nil {
+		logger.Log.Infof("User %d sits out a hand in room %s: %v", userID, s.Room.GetID(), err)
+		return 0
+	}
+	return min(limit, balance)
+}
+
+// cashOut 退回每个玩家剩余的筹码。已经扣除带入，退回失败时只记录日志，由流水对账补发
+func (m *Holdem) cashOut(s *GamingState, data *HoldemData) {
+	economy := s.Economy()
+	if economy == nil {
+		return
+	}
+	for _, p := range data.Players {
+		if p.Stack <= 0 {
+			continue
+		}
+		if err := economy.Payout(p.UserID, p.Stack, "holdem_payout"); err != nil {
+			logger.Log.Errorf("Failed to return %d coins to user %d in room %s: %v", p.Stack, p.UserID, s.Room.GetID(), err)
+		}
+	}
+}
+
+// Results 返回一手牌的公共牌、底池和每个玩家的输赢。
+// 时间用完时仍未结束的一手牌作废，每个玩家取回自己投入的筹码
+func (m *Holdem) Results(s *GamingState) map[string]interface{} {
+	data, ok := s.GameData.(*HoldemData)
+	if !ok {
+		return map[string]interface{}{"error": "invalid game data"}
+	}
+	if !data.Finished {
+		for _, p := range data.Players {
+			p.Won = p.Total
+			p.Stack += p.Total
+		}
+		data.Finished = true
+		s.Turns.Stop()
+		m.cashOut(s, data)
+	}
+
+	return map[string]interface{}{
+		"street":  data.Street,
+		"button":  data.Button,
+		"board":   data.Board,
+		"pots":    data.Pots,
+		"players": data.Players,
+	}
+}
+
+// PlayerResults 返回参与这一手的玩家投入和赢得的筹码，按行动顺序排列
+func (m *Holdem) PlayerResults(s *GamingState) []models.PlayerInfo {
+	data, ok := s.GameData.(*HoldemData)
+	if !ok {
+		return nil
+	}
+	players := make([]models.PlayerInfo, 0, len(data.Players))
+	for _, p := range data.Players {
+		players = append(players, models.PlayerInfo{
+			UserID:  p.UserID,
+			Outcome: models.OutcomeOf(p.Total, p.Won),
+			Bet:     p.Total,
+			Payout:  p.Won,
+		})
+	}
+	return players
+}
+
+// player 返回玩家在这一手中的数据，没有参与时返回 nil
+func (d *HoldemData) player(id string) *HoldemPlayer {
+	for _, p := range d.Players {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// remaining 返回没有弃牌的玩家数
+func (d *HoldemData) remaining() int {
+	count := 0
+	for _, p := range d.Players {
+		if !p.Folded {
+			count++
+		}
+	}
+	return count
+}
+
+// canAct 返回还能下注的玩家数，即没有弃牌也没有全下的玩家
+func (d *HoldemData) canAct() int {
+	count := 0
+	for _, p := range d.Players {
+		if !p.Folded && !p.AllIn {
+			count++
+		}
+	}
+	return count
+}
+
+// nextToAct 返回 after 之后第一个本轮还需要行动的玩家：没有行动过，或下注少于本轮最高下注
+func (d *HoldemData) nextToAct(after string) *HoldemPlayer {
+	start := slices.IndexFunc(d.Players, func(p *HoldemPlayer) bool { return p.ID == after })
+	for i := 1; i <= len(d.Players); i++ {
+		p := d.Players[(start+i+len(d.Players))%len(d.Players)]
+		if !p.Folded && !p.AllIn && (!p.Acted || p.Bet < d.CurrentBet) {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	cardRanks = "23456789TJQKA"
+	cardSuits = "cdhs"
+	deckSize  = 52
+)
+
+// Card 一张扑克牌，0-51，点数为 Card/4(0 为 2，12 为 A)，花色为 Card%4。
+// JSON 中表示为点数加花色，例如 "As"、"Td"
+type Card uint8
+
+// Rank 返回点数，0 为 2，12 为 A
+func (c Card) Rank() int { return int(c) / 4 }
+
+// Suit 返回花色
+func (c Card) Suit() int { return int(c) % 4 }
+
+func (c Card) String() string {
+	return string([]byte{cardRanks[c.Rank()], cardSuits[c.Suit()]})
+}
+
+// ParseCard 解析 "As" 形式的牌
+func ParseCard(s string) (Card, error) {
+	if len(s) != 2 {
+		return 0, fmt.Errorf("invalid card %q", s)
+	}
+	rank, suit := strings.IndexByte(cardRanks, s[0]), strings.IndexByte(cardSuits, s[1])
+	if rank < 0 || suit < 0 {
+		return 0, fmt.Errorf("invalid card %q", s)
+	}
+	return Card(rank*4 + suit), nil
+}
+
+func (c Card) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+func (c *Card) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	card, err := ParseCard(s)
+	if err != nil {
+		return err
+	}
+	*c = card
+	return nil
+}
+
+// shuffledDeck 返回用 rng 洗好的一副牌
+func shuffledDeck(rng *rand.Rand) []Card {
+	deck := make([]Card, deckSize)
+	for i := range deck {
+		deck[i] = Card(i)
+	}
+	rng.Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+	return deck
+}
+
+// HandCategory 牌型，数值越大越强
+type HandCategory int
+
+const (
+	HighCard HandCategory = iota
+	OnePair
+	TwoPair
+	ThreeOfAKind
+	Straight
+	Flush
+	FullHouse
+	FourOfAKind
+	StraightFlush
+)
+
+var handCategoryNames = [...]string{
+	"high_card", "one_pair", "two_pair", "three_of_a_kind", "straight",
+	"flush", "full_house", "four_of_a_kind", "straight_flush",
+}
+
+func (h HandCategory) String() string { return handCategoryNames[h] }
+
+// HandRank 五张牌组成的最大牌型，Value 可以直接比较大小：
+// 牌型占最高位，其后依次为决定大小的点数，每个点数 4 位
+type HandRank struct {
+	Category HandCategory
+	Value    int
+	Cards    []Card // 组成牌型的五张牌
+}
+
+// EvaluateHand 返回 5 到 7 张牌中最大的五张牌型
+func EvaluateHand(cards []Card) HandRank {
+	best := HandRank{Value: -1}
+	n := len(cards)
+	hand := make([]Card, 5)
+	// 枚举去掉的牌，7 张牌共 21 种组合
+	for a := 0; a < n; a++ {
+		for b := a + 1; b < n; b++ {
+			for c := b + 1; c < n; c++ {
+				for d := c + 1; d < n; d++ {
+					for e := d + 1; e < n; e++ {
+						hand[0], hand[1], hand[2], hand[3], hand[4] = cards[a], cards[b], cards[c], cards[d], cards[e]
+						if rank := evaluateFive(hand); rank.Value > best.Value {
+							rank.Cards = append([]Card(nil), hand...)
+							best = rank
+						}
+					}
+				}
+			}
+		}
+	}
+	return best
+}
+
+// evaluateFive 计算五张牌的牌型
+func evaluateFive(hand []Card) HandRank {
+	var counts [13]int
+	flush := true
+	for i, card := range hand {
+		counts[card.Rank()]++
+		if i > 0 && card.Suit() != hand[0].Suit() {
+			flush = false
+		}
+	}
+
+	// 按张数再按点数从大到小排列，例如葫芦 KKK22 为 K,2
+	ranks := make([]int, 0, 5)
+	for rank := 12; rank >= 0; rank-- {
+		if counts[rank] > 0 {
+			ranks = append(ranks, rank)
+		}
+	}
+	sort.SliceStable(ranks, func(i, j int) bool { return counts[ranks[i]] > counts[ranks[j]] })
+
+	straightHigh := -1
+	if len(ranks) == 5 {
+		if ranks[0]-ranks[4] == 4 {
+			straightHigh = ranks[0]
+		} else if ranks[0] == 12 && ranks[1] == 3 {
+			// A2345，A 作 1
+			straightHigh, ranks = 3, []int{3, 2, 1, 0, 12}
+		}
+	}
+
+	var category HandCategory
+	switch {
+	case straightHigh >= 0 && flush:
+		category = StraightFlush
+	case counts[ranks[0]] == 4:
+		category = FourOfAKind
+	case counts[ranks[0]] == 3 && counts[ranks[1]] == 2:
+		category = FullHouse
+	case flush:
+		category = Flush
+	case straightHigh >= 0:
+		category = Straight
+	case counts[ranks[0]] == 3:
+		category = ThreeOfAKind
+	case counts[ranks[0]] == 2 && counts[ranks[1]] == 2:
+		category = TwoPair
+	case counts[ranks[0]] == 2:
+		category = OnePair
+	default:
+		category = HighCard
+	}
+
+	value := int(category)
+	for i := 0; i < 5; i++ {
+		value <<= 4
+		if i < len(ranks) {
+			value |= ranks[i]
+		}
+	}
+	if category == Straight || category == StraightFlush {
+		value = int(category)<<20 | straightHigh
+	}
+	return HandRank{Category: category, Value: value}
+}
+
+// HoldemPot 一个底池，只有 Eligible 中的玩家可以赢得
+type HoldemPot struct {
+	Amount   int64    `json:"amount"`
+	Eligible []string `json:"eligible"`
+	Winners  []string `json:"winners,omitempty"`
+}
+
+// buildPots 按每个玩家投入的总额拆分主池和边池。未弃牌玩家的每个投入额是一个层级，
+// 每层的底池包括所有玩家在该层以内的投入，投入达到该层且未弃牌的玩家才有资格赢得。
+// 没有人跟注的部分只有下注者自己有资格，即退回给下注者
+func buildPots(players []*HoldemPlayer) []HoldemPot {
+	var levels []int64
+	for _, p := range players {
+		if !p.Folded && p.Total > 0 && !slices.Contains(levels, p.Total) {
+			levels = append(levels, p.Total)
+		}
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+
+	var pots []HoldemPot
+	previous := int64(0)
+	for _, level := range levels {
+		pot := HoldemPot{}
+		for _, p := range players {
+			pot.Amount += min(p.Total, level) - min(p.Total, previous)
+			if !p.Folded && p.Total >= level {
+				pot.Eligible = append(pot.Eligible, p.ID)
+			}
+		}
+		// 资格相同的相邻底池合并
+		if n := len(pots); n > 0 && slices.Equal(pots[n-1].Eligible, pot.Eligible) {
+			pots[n-1].Amount += pot.Amount
+		} else {
+			pots = append(pots, pot)
+		}
+		previous = level
+	}
+	return pots
+}
@@ -0,0 +1,92 @@
+package state
+
+import (
+	"strings"
+	"testing"
+)
+
+func cards(t *testing.T, s string) []Card {
+	t.Helper()
+	var result []Card
+	for _, field := range strings.Fields(s) {
+		card, err := ParseCard(field)
+		if err != nil {
+			t.Fatalf("Bad card in test: %v", err)
+		}
+		result = append(result, card)
+	}
+	return result
+}
+
+func TestEvaluateHand_Categories(t *testing.T) {
+	tests := []struct {
+		cards    string
+		category HandCategory
+	}{
+		{"As Kd 9h 7c 4s 3d 2h", HighCard},
+		{"As Ad 9h 7c 4s 3d 2h", OnePair},
+		{"As Ad 9h 9c 4s 3d 2h", TwoPair},
+		{"As Ad Ah 9c 4s 3d 2h", ThreeOfAKind},
+		{"Ah 2d 3c 4s 5h Kd Qh", Straight}, // A 作 1
+		{"Th Jd Qc Ks Ah 2d 3h", Straight},
+		{"2h 7h 9h Jh Kh As Ad", Flush},
+		{"As Ad Ah 9c 9s 3d 2h", FullHouse},
+		{"As Ad Ah Ac 9s 3d 2h", FourOfAKind},
+		{"5h 6h 7h 8h 9h Ah Ad", StraightFlush},
+	}
+	for _, tt := range tests {
+		if got := EvaluateHand(cards(t, tt.cards)); got.Category != tt.category {
+			t.Errorf("%s: expected %s, got %s", tt.cards, tt.category, got.Category)
+		}
+	}
+}
+
+func TestEvaluateHand_Ordering(t *testing.T) {
+	// 每组中前者大于后者
+	tests := [][2]string{
+		{"2h 3d 4c 5s 6h", "Ah 2d 3c 4s 5h"}, // 6 高的顺子大于 A2345
+		{"As Ad Kh 9c 4s", "As Ad Qh Jc 9s"}, // 对子相同比较踢脚
+		{"Ks Kd 2h 2c As", "Qs Qd Jh Jc As"}, // 两对先比大的一对
+		{"3s 3d 3h 2c 2s", "2s 2d 2h As Ad"}, // 葫芦先比三条
+		{"2h 4h 6h 8h Th", "As Kd Qh Jc Ts"}, // 同花大于顺子
+		{"As Kd 9h 7c 5s", "As Kd 9h 7c 4s"}, // 高牌比到最后一张
+		{"9h Th Jh Qh Kh", "As Ad Ah Ac Ks"}, // 同花顺大于四条
+	}
+	for _, tt := range tests {
+		better, worse := EvaluateHand(cards(t, tt[0])), EvaluateHand(cards(t, tt[1]))
+		if better.Value <= worse.Value {
+			t.Errorf("Expected %s (%s) to beat %s (%s)", tt[0], better.Category, tt[1], worse.Category)
+		}
+	}
+
+	a, b := EvaluateHand(cards(t, "As Kd 9h 7c 5s 2d 3c")), EvaluateHand(cards(t, "Ah Kc 9d 7s 5h 2c 3d"))
+	if a.Value != b.Value {
+		t.Error("Expected hands that differ only in suits to tie")
+	}
+}
+
+func TestBuildPots_SidePots(t *testing.T) {
+	players := []*HoldemPlayer{
+		{ID: "a", Total: 100, AllIn: true},
+		{ID: "b", Total: 300, AllIn: true},
+		{ID: "c", Total: 500},
+		{ID: "d", Total: 200, Folded: true},
+	}
+	pots := buildPots(players)
+	if len(pots) != 3 {
+		t.Fatalf("Expected a main pot and two side pots, got %+v", pots)
+	}
+	expected := []struct {
+		amount   int64
+		eligible string
+	}{
+		{400, "a b c"}, // 每人 100，包括弃牌玩家的投入
+		{500, "b c"},   // b、c 各 200，d 的另外 100
+		{200, "c"},     // 没有人跟注的部分退回 c
+	}
+	for i, want := range expected {
+		if pots[i].Amount != want.amount || strings.Join(pots[i].Eligible, " ") != want.eligible {
+			t.Errorf("Pot %d: expected %d for %s, got %+v", i, want.amount, want.eligible, pots[i])
+		}
+	}
+}
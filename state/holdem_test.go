@@ -0,0 +1,262 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/network"
+)
+
+// holdemRoom is an economyRoom with seats playing Hold'em that records private messages and state updates.
+type holdemRoom struct {
+	*economyRoom
+	seats   map[string]int
+	private map[string][][]byte
+	updates map[string][]StateUpdate
+}
+
+func (r *holdemRoom) GetGameType() string         { return "holdem" }
+func (r *holdemRoom) RoundSeed() string           { return "holdem" }
+func (r *holdemRoom) GetSeat(playerID string) int { return r.seats[playerID] }
+
+func (r *holdemRoom) SendToPlayer(playerID string, msgID uint16, data []byte) error {
+	switch msgID {
+	case network.MsgTypePrivateState:
+		r.private[playerID] = append(r.private[playerID], data)
+	case network.MsgTypeStateUpdate:
+		var update StateUpdate
+		if err := json.Unmarshal(data, &update); err != nil {
+			return err
+		}
+		r.updates[playerID] = append(r.updates[playerID], update)
+	default:
+		return fmt.Errorf("unexpected private message %d", msgID)
+	}
+	return nil
+}
+
+// newHoldemGame 开始一手牌，玩家 p1、p2... 的用户ID为 1、2...，按 coins 的顺序入座
+func newHoldemGame(t *testing.T, coins ...int64) (*holdemRoom, *GamingState) {
+	t.Helper()
+	economy := &mockEconomy{coins: make(map[int64]int64)}
+	room := &holdemRoom{
+		economyRoom: &economyRoom{mockRoom: newMockRoom(DefaultStartRule()), economy: economy},
+		seats:       make(map[string]int),
+		private:     make(map[string][][]byte),
+		updates:     make(map[string][]StateUpdate),
+	}
+	room.config.TurnTimeout = time.Minute
+	for i, balance := range coins {
+		id := fmt.Sprintf("p%d", i+1)
+		room.players[id] = &userPlayer{mockPlayer: mockPlayer{id: id}, userID: int64(i + 1)}
+		room.seats[id] = i
+		economy.coins[int64(i+1)] = balance
+	}
+	s := NewGamingState(room, time.Minute)
+	room.stateMachine = NewBaseStateMachine(s)
+	s.OnEnter()
+	return room, s
+}
+
+// act 由当前行动的玩家执行动作
+func act(t *testing.T, room *holdemRoom, s *GamingState, action string) {
+	t.Helper()
+	if err := s.HandleAction(room.players[s.Turns.Current], []byte(action)); err != nil {
+		t.Fatalf("%s failed for %s: %v", action, s.Turns.Current, err)
+	}
+}
+
+func totalCoins(e *mockEconomy) int64 {
+	total := int64(0)
+	for _, coins := range e.coins {
+		total += coins
+	}
+	return total
+}
+
+func TestHoldem_BettingRounds(t *testing.T) {
+	room, s := newHoldemGame(t, 1000, 1000, 2000)
+	data := s.GameData.(*HoldemData)
+
+	// 庄家之后依次为小盲、大盲，大盲之后的玩家先行动，行动顺序按座位
+	small, big, first := data.Players[0], data.Players[1], data.Players[2]
+	if data.Button != first.ID || small.Bet != 5 || big.Bet != 10 || s.Turns.Current != first.ID {
+		t.Fatalf("Unexpected blinds: button %s, players %+v, current %s", data.Button, data.Players, s.Turns.Current)
+	}
+	seats := []int{small.Seat, big.Seat, first.Seat}
+	if seats[1] != (seats[0]+1)%3 || seats[2] != (seats[1]+1)%3 {
+		t.Errorf("Expected the action to follow the seats, got %v", seats)
+	}
+	if totalCoins(room.economy) != 4000-3000 {
+		t.Errorf("Expected every player to buy in %d, balances %v", DefaultBuyIn, room.economy.coins)
+	}
+
+	// 底牌只私下发给玩家自己，公开数据中没有底牌
+	for _, p := range data.Players {
+		var private holdemPrivate
+		if len(room.private[p.ID]) != 1 || json.Unmarshal(room.private[p.ID][0], &private) != nil || !slices.Equal(private.Cards, p.hole) {
+			t.Errorf("Expected %s to receive their hole cards %v, got %s", p.ID, p.hole, room.private[p.ID])
+		}
+	}
+	if raw, _ := json.Marshal(s.GameData); strings.Contains(string(raw), `"cards"`) {
+		t.Errorf("Hole cards leaked into the public game data: %s", raw)
+	}
+
+	if err := s.HandleAction(room.players[small.ID], []byte(`{"type":"call"}`)); !errors.Is(err, ErrNotYourTurn) {
+		t.Errorf("Expected ErrNotYourTurn, got %v", err)
+	}
+	current := room.players[s.Turns.Current]
+	if err := s.HandleAction(current, []byte(`{"type":"check"}`)); !errors.Is(err, ErrInvalidAction) {
+		t.Errorf("Expected check facing the big blind to fail, got %v", err)
+	}
+	if err := s.HandleAction(current, []byte(`{"type":"raise","amount":15}`)); !errors.Is(err, ErrInvalidRaise) {
+		t.Errorf("Expected a raise below the big blind to fail, got %v", err)
+	}
+	act(t, room, s, `{"type":"raise","amount":30}`)
+	act(t, room, s, `{"type":"raise","amount":50}`)
+	if data.MinRaise != 20 || data.CurrentBet != 50 {
+		t.Fatalf("Expected min raise 20 to 50, got %d to %d", data.MinRaise, data.CurrentBet)
+	}
+	act(t, room, s, `{"type":"fold"}`)
+	act(t, room, s, `{"type":"call"}`)
+
+	// 翻牌后由庄家之后第一个没有弃牌的玩家先行动
+	if data.Street != StreetFlop || len(data.Board) != 3 || s.Turns.Current != small.ID || data.Pot != 110 {
+		t.Fatalf("Expected the flop with %s to act, got %s %v, current %s, pot %d", small.ID, data.Street, data.Board, s.Turns.Current, data.Pot)
+	}
+	for !data.Finished {
+		act(t, room, s, `{"type":"check"}`)
+	}
+
+	if data.Street != StreetShowdown || len(data.Board) != 5 || big.Cards != nil || small.Hand == "" {
+		t.Fatalf("Expected a showdown between the players still in, got %+v", data)
+	}
+	won := int64(0)
+	for _, p := range data.Players {
+		won += p.Won
+	}
+	if won != 110 || totalCoins(room.economy) != 4000 {
+		t.Errorf("Expected the pot to be paid out in full, won %d, balances %v", won, room.economy.coins)
+	}
+	if len(room.records) != 1 || len(room.records[0].Players) != 3 {
+		t.Fatalf("Expected the hand to be recorded once it finished, got %d records", len(room.records))
+	}
+
+	// 重放时带入的筹码取自记录，不再查询余额
+	raw, _ := json.Marshal(room.records[0])
+	var record models.GameRecord
+	json.Unmarshal(raw, &record)
+	replayed, err := Replay(&record, &mockEconomy{coins: make(map[int64]int64)})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if original, result := normalizeJSON(record.Result), normalizeJSON(replayed.Result); original != result {
+		t.Errorf("Expected replay to reproduce the result\noriginal: %s\nreplayed: %s", original, result)
+	}
+	if original, players := normalizeJSON(record.Players), normalizeJSON(replayed.Players); original != players {
+		t.Errorf("Expected replay to reproduce the players\noriginal: %s\nreplayed: %s", original, players)
+	}
+}
+
+// rigDeck 把指定的底牌和公共牌放进牌堆
+func rigDeck(t *testing.T, data *HoldemData, holes map[string]string, board string) {
+	t.Helper()
+	var dealt []Card
+	for i, p := range data.Players {
+		p.hole = cards(t, holes[p.ID])
+		dealt = append(dealt, p.hole...)
+		copy(data.deck[2*i:], p.hole)
+	}
+	copy(data.deck[2*len(data.Players):], cards(t, board))
+	dealt = append(dealt, cards(t, board)...)
+	// 其余位置放没有用到的牌，保证牌堆中没有重复
+	rest := 2*len(data.Players) + 5
+	for card := Card(0); card < deckSize; card++ {
+		if !slices.Contains(dealt, card) {
+			data.deck[rest] = card
+			rest++
+		}
+	}
+}
+
+func TestHoldem_AllInSidePots(t *testing.T) {
+	room, s := newHoldemGame(t, 100, 300, 5000, 5)
+	data := s.GameData.(*HoldemData)
+
+	// 余额不足一个大盲注的玩家不参与，其他玩家最多带入 BuyIn
+	if len(data.Players) != 3 || data.player("p4") != nil || room.economy.coins[4] != 5 || room.economy.coins[3] != 4000 {
+		t.Fatalf("Expected p4 to sit out, got players %+v, balances %v", data.Players, room.economy.coins)
+	}
+	if roster := s.Roster(); !roster[3].SatOut || roster[0].Chips != 100 || roster[2].Chips != 1000 {
+		t.Errorf("Expected the buy-ins to be recorded in the roster, got %+v", roster)
+	}
+
+	rigDeck(t, data, map[string]string{"p1": "As Ah", "p2": "Ks Kh", "p3": "2c 7d"}, "Ad Kd 9s 5h 3c")
+	for !data.Finished {
+		act(t, room, s, `{"type":"all_in"}`)
+	}
+
+	// 主池 300 归 p1，边池 400 归 p2，没有人跟注的 700 退回 p3
+	if len(data.Pots) != 3 {
+		t.Fatalf("Expected a main pot and two side pots, got %+v", data.Pots)
+	}
+	for id, won := range map[string]int64{"p1": 300, "p2": 400, "p3": 700} {
+		if p := data.player(id); p.Won != won {
+			t.Errorf("Expected %s to win %d, got %d", id, won, p.Won)
+		}
+	}
+	expected := map[int64]int64{1: 300, 2: 400, 3: 4700, 4: 5}
+	for userID, coins := range expected {
+		if room.economy.coins[userID] != coins {
+			t.Errorf("Expected user %d to end with %d coins, got %d", userID, coins, room.economy.coins[userID])
+		}
+	}
+}
+
+func TestHoldem_HeadsUpReconnectAndRestore(t *testing.T) {
+	room, s := newHoldemGame(t, 1000, 1000)
+	data := s.GameData.(*HoldemData)
+
+	// 两人时庄家下小盲注并先行动
+	button := data.player(data.Button)
+	if button != data.Players[1] || button.Bet != 5 || s.Turns.Current != button.ID {
+		t.Fatalf("Expected the button to post the small blind and act first, got %+v, current %s", data.Players, s.Turns.Current)
+	}
+	if auto := (&Holdem{}).AutoAction(s, button.ID); string(auto) != `{"type":"fold"}` {
+		t.Errorf("Expected a timed out player facing a bet to fold, got %s", auto)
+	}
+
+	// 用户以新的玩家ID重连后接替原来的位置，重新收到底牌
+	oldID := button.ID
+	rejoined := &userPlayer{mockPlayer: mockPlayer{id: oldID + "-again"}, userID: button.UserID}
+	s.OnPlayerLeave(room.players[oldID])
+	delete(room.players, oldID)
+	room.players[rejoined.id] = rejoined
+	s.OnPlayerJoin(rejoined)
+	if data.Button != rejoined.id || s.Turns.Current != rejoined.id || len(room.private[rejoined.id]) != 1 {
+		t.Fatalf("Expected %s to take over the seat, got button %s, current %s", rejoined.id, data.Button, s.Turns.Current)
+	}
+	act(t, room, s, `{"type":"call"}`)
+
+	// 快照恢复后底牌和牌堆与原来一致
+	round, err := s.RoundSnapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot round: %v", err)
+	}
+	raw, _ := json.Marshal(s.GameData)
+	restored := NewRestoredGamingState(room, time.Minute, time.Minute, raw, round)
+	restored.OnEnter()
+	restoredData := restored.GameData.(*HoldemData)
+	if !slices.Equal(restoredData.deck, data.deck) || !slices.Equal(restoredData.Players[0].hole, data.Players[0].hole) {
+		t.Fatal("Expected the restored hand to deal from the same deck")
+	}
+	if auto := (&Holdem{}).AutoAction(restored, restored.Turns.Current); string(auto) != `{"type":"check"}` {
+		t.Errorf("Expected the big blind to check when not facing a bet, got %s", auto)
+	}
+}
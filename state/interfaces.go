@@ -1,6 +1,8 @@
 // state/interfaces.go
 package state
 
+import "github.com/wfunc/gameserver/models"
+
 // Player defines the minimal interface for a player entity that a state needs to interact with.
 type Player interface {
 	GetID() string
@@ -13,6 +15,91 @@ type RoomContext interface {
 	GetGameType() string
 	GetPlayers() map[string]Player
 	GetMaxPlayers() int
+	GetGameConfig() GameConfig
 	ChangeState(newState State) error
 	Broadcast(msgID uint16, data []byte) error
+	// RecordGame 保存一局结束时的游戏记录，不能阻塞房间协程
+	RecordGame(record *models.GameRecord)
+}
+
+// UserPlayer is an optional interface for players bound to a user account.
+// Game records use it to attribute bets and payouts to users.
+type UserPlayer interface {
+	GetUserID() int64
+}
+
+// Economy settles game actions against players' real coins and items. Calls are
+// synchronous and run on the room goroutine, so implementations must bound them
+// with a short timeout.
+type Economy interface {
+	// Wager 扣除下注的金币，余额不足时返回错误
+	Wager(userID, amount int64, reason string) error
+	// Payout 发放派奖的金币
+	Payout(userID, amount int64, reason string) error
+	// Balance 返回玩家的金币余额
+	Balance(userID int64) (int64, error)
+	// Item 返回物品定义，不存在时返回 false
+	Item(itemID string) (models.ItemDef, bool)
+	// ConsumeItem 消耗玩家的一个物品，没有可用的物品时返回错误
+	ConsumeItem(userID int64, itemID, reason string) error
+}
+
+// EconomyProvider is an optional interface for rooms that settle games with real
+// coins and items. Without it games only track bets in their own data.
+type EconomyProvider interface {
+	Economy() Economy
+}
+
+// Jackpot is a progressive pool shared by rooms, e.g. all slot rooms. Calls are
+// synchronous and run on the room goroutine like Economy.
+type Jackpot interface {
+	// Contribute 将一次下注按抽成比例计入奖池
+	Contribute(pool string, bet int64) error
+	// Claim 领取整个奖池并计入玩家的金币，返回领取的金额
+	Claim(pool string, userID int64, roomID string) (int64, error)
+}
+
+// JackpotProvider is an optional interface for rooms whose games contribute to
+// and pay out a shared jackpot.
+type JackpotProvider interface {
+	Jackpot() Jackpot
+}
+
+// SeedSource is an optional interface for rooms that choose the seed of each
+// round, e.g. to reproduce a round in tests or replays. Returning "" or not
+// implementing it gives every round a random seed.
+type SeedSource interface {
+	RoundSeed() string
+}
+
+// WagerObserver is an optional interface for rooms that export live betting
+// metrics, such as each game's actual return to player.
+type WagerObserver interface {
+	ObserveWager(bet, payout int64)
+}
+
+// Checkpointer is an optional interface for rooms that persist snapshots. Games
+// call it after changes that must survive a restart, such as stakes already debited.
+type Checkpointer interface {
+	Checkpoint()
+}
+
+// SeatProvider is an optional interface for rooms with numbered seats. Games that
+// act in seating order, such as poker, order their turns by it.
+type SeatProvider interface {
+	// GetSeat 返回玩家的座位号，不在座位上时返回 -1
+	GetSeat(playerID string) int
+}
+
+// PlayerMessenger is an optional interface for rooms that can send a message to a
+// single player, e.g. hole cards that only their owner may see.
+type PlayerMessenger interface {
+	SendToPlayer(playerID string, msgID uint16, data []byte) error
+}
+
+// PlayerListener is an optional interface for states that need to react to players
+// joining or leaving the room. The room calls it on the current state.
+type PlayerListener interface {
+	OnPlayerJoin(player Player)
+	OnPlayerLeave(player Player)
 }
@@ -0,0 +1,370 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/wfunc/gameserver/fairness"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/network"
+)
+
+const (
+	// DefaultInputDelay 输入未指定帧号时延后的帧数
+	DefaultInputDelay = 2
+	// DefaultMaxLateFrames 迟到不超过该帧数的输入并入当前帧，更早的输入丢弃
+	DefaultMaxLateFrames = 3
+	// DefaultHistoryFrames 保留供重连追帧的帧数
+	DefaultHistoryFrames = 1200
+	// maxInputAhead 输入最多可以提前的帧数
+	maxInputAhead = 64
+	// maxInputSize 一次输入 Data 的最大字节数
+	maxInputSize = 1024
+)
+
+var (
+	// ErrInputTooLate 输入的帧已经广播，且迟到超过 MaxLateFrames
+	ErrInputTooLate = errors.New("input is too late")
+	// ErrInputTooEarly 输入的帧超出当前帧 maxInputAhead 帧
+	ErrInputTooEarly = errors.New("input is too far ahead")
+	// ErrInputTooLarge 输入的 Data 超过 maxInputSize 字节
+	ErrInputTooLarge = errors.New("input is too large")
+	// ErrDuplicateInput 该位置在目标帧中已经有输入
+	ErrDuplicateInput = errors.New("slot already has an input for this frame")
+	// ErrNotInMatch 玩家不在本局的名单中，例如中途加入的观战者
+	ErrNotInMatch = errors.New("player is not in this match")
+	// ErrFramesExpired 请求的帧已经不在保留的历史中
+	ErrFramesExpired = errors.New("frames are no longer available")
+)
+
+// LockstepConfig 帧同步的参数，帧间隔即房间的心跳间隔
+type LockstepConfig struct {
+	InputDelay    int `json:"input_delay"`     // 为 0 时使用 DefaultInputDelay
+	MaxLateFrames int `json:"max_late_frames"` // 为 0 时使用 DefaultMaxLateFrames
+	HistoryFrames int `json:"history_frames"`  // 为 0 时使用 DefaultHistoryFrames
+}
+
+// withDefaults 返回零值字段替换为默认值后的参数
+func (c LockstepConfig) withDefaults() LockstepConfig {
+	if c.InputDelay <= 0 {
+		c.InputDelay = DefaultInputDelay
+	}
+	if c.MaxLateFrames <= 0 {
+		c.MaxLateFrames = DefaultMaxLateFrames
+	}
+	if c.HistoryFrames <= 0 {
+		c.HistoryFrames = DefaultHistoryFrames
+	}
+	return c
+}
+
+// LockstepSlot 本局的一个玩家位置，输入按位置记录，重连的用户以新的玩家ID接替原来的位置
+type LockstepSlot struct {
+	PlayerID string `json:"player_id"`
+	UserID   int64  `json:"user_id,omitempty"`
+}
+
+// FrameInput 一帧中一个位置的输入，Data 由客户端定义，服务端不解析
+type FrameInput struct {
+	Slot int             `json:"slot"`
+	Data json.RawMessage `json:"data"`
+	Late bool            `json:"late,omitempty"` // 迟到后并入这一帧
+}
+
+// Frame 一帧的全部输入，没有输入的帧也会广播，客户端据此推进
+type Frame struct {
+	Frame  uint32       `json:"frame"`
+	Inputs []FrameInput `json:"inputs"`
+}
+
+// LockstepStart 开局时广播、中途加入时单独发送的帧同步信息
+type LockstepStart struct {
+	Seed          string         `json:"seed"` // 客户端确定性模拟使用的随机种子
+	FrameInterval int64          `json:"frame_interval"`
+	InputDelay    int            `json:"input_delay"`
+	Frame         uint32         `json:"frame"` // 下一个广播的帧号，中途加入的客户端从历史中追上
+	Slots         []LockstepSlot `json:"slots"`
+}
+
+// FrameHistory 追帧请求的回复
+type FrameHistory struct {
+	Frames  []Frame `json:"frames"`
+	Current uint32  `json:"current"` // 下一个广播的帧号
+}
+
+// lockstepAction 帧同步状态接受的动作：input 提交输入，Frame 为 0 时延后 InputDelay 帧；
+// sync 请求从 From 开始已经广播的帧
+type lockstepAction struct {
+	Frame uint32          `json:"frame,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	From  uint32          `json:"from,omitempty"`
+}
+
+// LockstepState 帧同步状态，用于实时对战游戏，与 GamingState 并列：
+// 服务端不运行游戏逻辑，只按房间心跳收集每一帧的输入并广播，由客户端确定性地模拟。
+// 游戏配置了 Lockstep 时 WaitingState 开局进入此状态，时间用完或所有玩家离开时结束。
+// 帧同步状态不随房间快照恢复，重启后房间回到等待状态
+type LockstepState struct {
+	RoomStateBase
+	Config        LockstepConfig
+	GameDuration  time.Duration
+	RemainingTime time.Duration
+	Seed          string
+	Slots         []LockstepSlot
+	Frame         uint32 // 下一个广播的帧号，从 1 开始
+	StartTime     time.Time
+	pending       map[uint32][]FrameInput // 尚未广播的帧号 -> 输入
+	history       []Frame                 // 最近广播的帧，最多 Config.HistoryFrames 帧
+	inputs        int                     // 本局收到的输入数
+	lastUpdate    time.Time
+}
+
+// NewLockstepState 创建帧同步状态，房间实现 SeedSource 时使用房间指定的种子
+func NewLockstepState(room RoomContext, config LockstepConfig, duration time.Duration) *LockstepState {
+	s := &LockstepState{
+		RoomStateBase: RoomStateBase{
+			ID:   "lockstep",
+			Room: room,
+		},
+		Config:        config.withDefaults(),
+		GameDuration:  duration,
+		RemainingTime: duration,
+		Frame:         1,
+		pending:       make(map[uint32][]FrameInput),
+	}
+	if source, ok := room.(SeedSource); ok {
+		s.Seed = source.RoundSeed()
+	}
+	if s.Seed == "" {
+		s.Seed = fairness.NewCommitment().ServerSeed
+	}
+	return s
+}
+
+// OnEnter 按座位(房间没有座位时按玩家ID)为房间内的玩家分配位置并广播开局信息
+func (s *LockstepState) OnEnter() {
+	logger.Log.Infof("房间 %s 进入帧同步状态，游戏时长: %v", s.Room.GetID(), s.GameDuration)
+	s.StartTime = time.Now()
+	s.lastUpdate = s.StartTime
+
+	ids := SortedPlayerIDs(s.Room)
+	if seats, ok := s.Room.(SeatProvider); ok {
+		sort.SliceStable(ids, func(i, j int) bool { return seats.GetSeat(ids[i]) < seats.GetSeat(ids[j]) })
+	}
+	for _, id := range ids {
+		slot := LockstepSlot{PlayerID: id}
+		if user, ok := s.Room.GetPlayers()[id].(UserPlayer); ok {
+			slot.UserID = user.GetUserID()
+		}
+		s.Slots = append(s.Slots, slot)
+	}
+
+	data, err := json.Marshal(s.startInfo())
+	if err != nil {
+		logger.Log.Errorf("Failed to marshal lockstep start: %v", err)
+		return
+	}
+	s.Room.Broadcast(network.MsgTypeGameStart, data)
+}
+
+// OnExit 退出帧同步状态
+func (s *LockstepState) OnExit() {
+	logger.Log.Infof("房间 %s 退出帧同步状态，共 %d 帧", s.Room.GetID(), s.Frame-1)
+	s.pending = nil
+	s.history = nil
+}
+
+// OnUpdate 每次心跳广播一帧，时间用完或所有玩家都已离开时结束
+func (s *LockstepState) OnUpdate() {
+	now := time.Now()
+	s.RemainingTime -= now.Sub(s.lastUpdate)
+	s.lastUpdate = now
+
+	s.broadcastFrame()
+	if s.RemainingTime <= 0 || !s.anyPresent() {
+		s.endGame()
+	}
+}
+
+// HandleAction 处理 input 和 sync 动作
+func (s *LockstepState) HandleAction(player Player, actionData []byte) error {
+	action, err := ParseAction(actionData)
+	if err != nil {
+		return err
+	}
+	var params lockstepAction
+	if err := json.Unmarshal(actionData, &params); err != nil {
+		return err
+	}
+
+	switch action.Type {
+	case "input":
+		return s.input(player, params)
+	case "sync":
+		return s.sendHistory(player.GetID(), params.From)
+	}
+	return nil
+}
+
+// OnPlayerJoin 用户重连时以新的玩家ID接替原来的位置，并单独发送开局信息，客户端再通过 sync 追帧
+func (s *LockstepState) OnPlayerJoin(player Player) {
+	if user, ok := player.(UserPlayer); ok && user.GetUserID() != 0 {
+		for i := range s.Slots {
+			if s.Slots[i].UserID == user.GetUserID() {
+				s.Slots[i].PlayerID = player.GetID()
+			}
+		}
+	}
+
+	messenger, ok := s.Room.(PlayerMessenger)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(s.startInfo())
+	if err != nil {
+		logger.Log.Errorf("Failed to marshal lockstep start: %v", err)
+		return
+	}
+	if err := messenger.SendToPlayer(player.GetID(), network.MsgTypeGameStart, data); err != nil {
+		logger.Log.Warnf("Room %s failed to send lockstep start to player %s: %v", s.Room.GetID(), player.GetID(), err)
+	}
+}
+
+// OnPlayerLeave 离开的玩家保留位置，之后不再有输入
+func (s *LockstepState) OnPlayerLeave(player Player) {}
+
+// input 把输入放入目标帧：未指定帧号时延后 InputDelay 帧，迟到不超过 MaxLateFrames 的并入当前帧。
+// 每个位置每帧只接受一次输入
+func (s *LockstepState) input(player Player, params lockstepAction) error {
+	slot := slices.IndexFunc(s.Slots, func(slot LockstepSlot) bool { return slot.PlayerID == player.GetID() })
+	if slot < 0 {
+		return ErrNotInMatch
+	}
+	if len(params.Data) > maxInputSize {
+		return ErrInputTooLarge
+	}
+
+	target, late := params.Frame, false
+	switch {
+	case target == 0:
+		target = s.Frame + uint32(s.Config.InputDelay)
+	case target < s.Frame:
+		if s.Frame-target > uint32(s.Config.MaxLateFrames) {
+			return ErrInputTooLate
+		}
+		target, late = s.Frame, true
+	case target > s.Frame+maxInputAhead:
+		return ErrInputTooEarly
+	}
+
+	if slices.ContainsFunc(s.pending[target], func(input FrameInput) bool { return input.Slot == slot }) {
+		return ErrDuplicateInput
+	}
+	s.pending[target] = append(s.pending[target], FrameInput{Slot: slot, Data: params.Data, Late: late})
+	s.inputs++
+	return nil
+}
+
+// broadcastFrame 广播当前帧的输入并计入历史
+func (s *LockstepState) broadcastFrame() {
+	frame := Frame{Frame: s.Frame, Inputs: s.pending[s.Frame]}
+	if frame.Inputs == nil {
+		frame.Inputs = []FrameInput{}
+	}
+	delete(s.pending, s.Frame)
+	s.Frame++
+
+	s.history = append(s.history, frame)
+	if excess := len(s.history) - s.Config.HistoryFrames; excess > 0 {
+		s.history = slices.Delete(s.history, 0, excess)
+	}
+
+	data, err := json.Marshal(frame)
+	if err != nil {
+		logger.Log.Errorf("Failed to marshal frame %d: %v", frame.Frame, err)
+		return
+	}
+	s.Room.Broadcast(network.MsgTypeFrame, data)
+}
+
+// sendHistory 向玩家发送从 from 开始已经广播的帧，from 为 0 时从保留的第一帧开始
+func (s *LockstepState) sendHistory(playerID string, from uint32) error {
+	history := FrameHistory{Frames: []Frame{}, Current: s.Frame}
+	if len(s.history) > 0 {
+		first := s.history[0].Frame
+		if from == 0 {
+			from = first
+		}
+		if from < first {
+			return ErrFramesExpired
+		}
+		if from < s.Frame {
+			history.Frames = s.history[from-first:]
+		}
+	}
+
+	messenger, ok := s.Room.(PlayerMessenger)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return messenger.SendToPlayer(playerID, network.MsgTypeFrameHistory, data)
+}
+
+func (s *LockstepState) startInfo() LockstepStart {
+	return LockstepStart{
+		Seed:          s.Seed,
+		FrameInterval: s.Room.GetGameConfig().TickInterval.Milliseconds(),
+		InputDelay:    s.Config.InputDelay,
+		Frame:         s.Frame,
+		Slots:         s.Slots,
+	}
+}
+
+// anyPresent 返回是否还有本局的玩家在房间内
+func (s *LockstepState) anyPresent() bool {
+	players := s.Room.GetPlayers()
+	for _, slot := range s.Slots {
+		if _, ok := players[slot.PlayerID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// endGame 广播结束并记录本局。胜负由客户端模拟得出，记录中每个玩家都记为平局
+func (s *LockstepState) endGame() {
+	logger.Log.Infof("房间 %s 帧同步结束", s.Room.GetID())
+	results := map[string]interface{}{
+		"frames": s.Frame - 1,
+		"inputs": s.inputs,
+		"seed":   s.Seed,
+	}
+	if data, err := json.Marshal(results); err == nil {
+		s.Room.Broadcast(network.MsgTypeGameEnd, data)
+	}
+
+	now := time.Now()
+	record := &models.GameRecord{
+		RoomID:    s.Room.GetID(),
+		GameType:  s.Room.GetGameType(),
+		Result:    results,
+		StartTime: s.StartTime,
+		EndTime:   now,
+		Duration:  int(now.Sub(s.StartTime).Seconds()),
+		CreatedAt: now,
+	}
+	for _, slot := range s.Slots {
+		record.Players = append(record.Players, models.PlayerInfo{UserID: slot.UserID, Outcome: models.OutcomeDraw})
+	}
+	s.Room.RecordGame(record)
+
+	s.Room.ChangeState(nextRoundState(s.Room))
+}
@@ -0,0 +1,167 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/wfunc/gameserver/network"
+)
+
+// lockstepRoom is a mockRoom with frame sync that keeps broadcast frames and private messages.
+type lockstepRoom struct {
+	*mockRoom
+	frames  []Frame
+	private map[string][]uint16
+	history map[string]FrameHistory
+}
+
+func (r *lockstepRoom) Broadcast(msgID uint16, data []byte) error {
+	if msgID == network.MsgTypeFrame {
+		var frame Frame
+		json.Unmarshal(data, &frame)
+		r.frames = append(r.frames, frame)
+	}
+	return r.mockRoom.Broadcast(msgID, data)
+}
+
+func (r *lockstepRoom) SendToPlayer(playerID string, msgID uint16, data []byte) error {
+	r.private[playerID] = append(r.private[playerID], msgID)
+	if msgID == network.MsgTypeFrameHistory {
+		var history FrameHistory
+		json.Unmarshal(data, &history)
+		r.history[playerID] = history
+	}
+	return nil
+}
+
+// newLockstepGame 从等待状态开始一局帧同步，p1、p2 的用户ID为 1、2
+func newLockstepGame(t *testing.T, config LockstepConfig) (*lockstepRoom, *LockstepState) {
+	t.Helper()
+	room := &lockstepRoom{
+		mockRoom: newMockRoom(DefaultStartRule()),
+		private:  make(map[string][]uint16),
+		history:  make(map[string]FrameHistory),
+	}
+	room.config.Lockstep = &config
+	for i, id := range []string{"p1", "p2"} {
+		room.players[id] = &userPlayer{mockPlayer: mockPlayer{id: id}, userID: int64(i + 1)}
+	}
+	waiting := NewWaitingState(room)
+	room.stateMachine = NewBaseStateMachine(waiting)
+	if err := waiting.StartGame(); err != nil {
+		t.Fatalf("Failed to start game: %v", err)
+	}
+	s, ok := room.stateMachine.GetCurrentState().(*LockstepState)
+	if !ok {
+		t.Fatalf("Expected the lockstep state, got %s", room.stateMachine.GetCurrentState().GetID())
+	}
+	return room, s
+}
+
+func TestLockstep_FramesAndInputs(t *testing.T) {
+	room, s := newLockstepGame(t, LockstepConfig{})
+	if len(s.Slots) != 2 || s.Slots[0].PlayerID != "p1" || room.broadcasts[network.MsgTypeGameStart] != 1 {
+		t.Fatalf("Expected two slots and a start broadcast, got %+v", s.Slots)
+	}
+	p1, p2 := room.players["p1"], room.players["p2"]
+	input := func(player Player, action string) error {
+		return s.HandleAction(player, []byte(action))
+	}
+
+	// 未指定帧号的输入延后 InputDelay 帧
+	if err := input(p1, `{"type":"input","data":{"move":"left"}}`); err != nil {
+		t.Fatalf("Input failed: %v", err)
+	}
+	if err := input(p2, `{"type":"input","frame":1,"data":{"move":"up"}}`); err != nil {
+		t.Fatalf("Input failed: %v", err)
+	}
+	s.OnUpdate()
+	s.OnUpdate()
+	// 迟到两帧的输入并入当前帧，每个位置每帧只有一次输入
+	if err := input(p2, `{"type":"input","frame":1,"data":{"fire":true}}`); err != nil {
+		t.Fatalf("Late input failed: %v", err)
+	}
+	if err := input(p1, `{"type":"input","frame":3,"data":{"move":"right"}}`); !errors.Is(err, ErrDuplicateInput) {
+		t.Fatalf("Expected a second input for frame 3 to be rejected, got %v", err)
+	}
+	s.OnUpdate()
+
+	if len(room.frames) != 3 || len(room.frames[1].Inputs) != 0 {
+		t.Fatalf("Expected a broadcast per tick including empty frames, got %+v", room.frames)
+	}
+	if inputs := room.frames[0].Inputs; len(inputs) != 1 || inputs[0].Slot != 1 {
+		t.Errorf("Expected p2's input in frame 1, got %+v", inputs)
+	}
+	if inputs := room.frames[2].Inputs; len(inputs) != 2 || inputs[0].Late || !inputs[1].Late || string(inputs[1].Data) != `{"fire":true}` {
+		t.Errorf("Expected the delayed and the late input in frame 3, got %+v", inputs)
+	}
+
+	for i := 0; i < 3; i++ {
+		s.OnUpdate()
+	}
+	for _, tt := range []struct {
+		player Player
+		action string
+		err    error
+	}{
+		{p2, `{"type":"input","frame":2}`, ErrInputTooLate},
+		{p2, `{"type":"input","frame":100}`, ErrInputTooEarly},
+		{p2, `{"type":"input","data":"` + strings.Repeat("x", maxInputSize) + `"}`, ErrInputTooLarge},
+		{&mockPlayer{id: "spectator"}, `{"type":"input"}`, ErrNotInMatch},
+	} {
+		if err := input(tt.player, tt.action); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.action, tt.err, err)
+		}
+	}
+
+	// 所有玩家离开后结束并回到等待状态
+	delete(room.players, "p1")
+	delete(room.players, "p2")
+	s.OnUpdate()
+	if id := room.stateMachine.GetCurrentState().GetID(); id != "waiting" || len(room.records) != 1 {
+		t.Fatalf("Expected the match to end once everyone left, got %s with %d records", id, len(room.records))
+	}
+	if record := room.records[0]; len(record.Players) != 2 || record.Result["frames"] != uint32(7) {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+}
+
+func TestLockstep_ReconnectCatchUp(t *testing.T) {
+	room, s := newLockstepGame(t, LockstepConfig{HistoryFrames: 5})
+	for i := 0; i < 8; i++ {
+		s.OnUpdate()
+	}
+
+	// 用户以新的玩家ID重连后接替原来的位置，收到开局信息后追帧
+	s.OnPlayerLeave(room.players["p1"])
+	delete(room.players, "p1")
+	rejoined := &userPlayer{mockPlayer: mockPlayer{id: "p1-again"}, userID: 1}
+	room.players[rejoined.id] = rejoined
+	s.OnPlayerJoin(rejoined)
+	if s.Slots[0].PlayerID != rejoined.id || len(room.private[rejoined.id]) != 1 || room.private[rejoined.id][0] != network.MsgTypeGameStart {
+		t.Fatalf("Expected %s to take over slot 0 and receive the start info, got %+v", rejoined.id, s.Slots)
+	}
+	if err := s.HandleAction(rejoined, []byte(`{"type":"input"}`)); err != nil {
+		t.Errorf("Expected the rejoined player to send input, got %v", err)
+	}
+
+	if err := s.HandleAction(rejoined, []byte(`{"type":"sync","from":6}`)); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	history := room.history[rejoined.id]
+	if len(history.Frames) != 3 || history.Frames[0].Frame != 6 || history.Current != 9 {
+		t.Errorf("Expected frames 6-8 before frame 9, got %+v", history)
+	}
+	// 只保留最近 5 帧
+	if err := s.HandleAction(rejoined, []byte(`{"type":"sync","from":2}`)); !errors.Is(err, ErrFramesExpired) {
+		t.Errorf("Expected ErrFramesExpired, got %v", err)
+	}
+
+	s.RemainingTime = 0
+	s.OnUpdate()
+	if id := room.stateMachine.GetCurrentState().GetID(); id != "waiting" || len(room.records) != 1 {
+		t.Errorf("Expected the match to end when time runs out, got %s with %d records", id, len(room.records))
+	}
+}
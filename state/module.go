@@ -0,0 +1,206 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+// ErrUnknownGameType is returned when creating a room of a game type that has
+// neither a registered game module nor a lockstep configuration.
+var ErrUnknownGameType = errors.New("unknown game type")
+
+// DefaultMaxPlayers 创建房间时没有指定人数上限的默认值
+const DefaultMaxPlayers = 4
+
+// GameConfig 一种游戏的节奏参数
+type GameConfig struct {
+	TickInterval   time.Duration   // 房间心跳间隔
+	RoundDuration  time.Duration   // 一局游戏的时长
+	StartRule      StartRule       // 等待状态的开局规则，Countdown 即等待时间
+	TurnTimeout    time.Duration   // 回合制游戏中每次行动的时限
+	SettlementTime time.Duration   // 一局结束后结算状态的时长，为 0 时直接回到等待状态
+	Lockstep       *LockstepConfig // 不为 nil 时以帧同步进行，帧间隔即 TickInterval
+}
+
+// DefaultGameConfig 返回没有任何游戏模块或配置覆盖时使用的参数
+func DefaultGameConfig() GameConfig {
+	return GameConfig{
+		TickInterval:  100 * time.Millisecond, // 10 FPS
+		RoundDuration: 5 * time.Second,
+		StartRule:     DefaultStartRule(),
+		TurnTimeout:   30 * time.Second,
+	}
+}
+
+// merge 用 other 中的非零字段覆盖 c
+func (c GameConfig) merge(other GameConfig) GameConfig {
+	if other.TickInterval > 0 {
+		c.TickInterval = other.TickInterval
+	}
+	if other.RoundDuration > 0 {
+		c.RoundDuration = other.RoundDuration
+	}
+	if other.StartRule.Mode != "" {
+		c.StartRule.Mode = other.StartRule.Mode
+	}
+	if other.StartRule.MinPlayers > 0 {
+		c.StartRule.MinPlayers = other.StartRule.MinPlayers
+	}
+	if other.StartRule.Countdown > 0 {
+		c.StartRule.Countdown = other.StartRule.Countdown
+	}
+	if other.TurnTimeout > 0 {
+		c.TurnTimeout = other.TurnTimeout
+	}
+	if other.SettlementTime > 0 {
+		c.SettlementTime = other.SettlementTime
+	}
+	if other.Lockstep != nil {
+		c.Lockstep = other.Lockstep
+	}
+	return c
+}
+
+// GameModule 一种游戏的玩法实现，GamingState 把具体的游戏逻辑委托给它
+type GameModule interface {
+	// GameType 返回游戏类型，与房间的 GameType 对应
+	GameType() string
+	// Config 返回该游戏的默认节奏参数，零值字段使用 DefaultGameConfig
+	Config() GameConfig
+	// InitData 在一局开始时创建游戏数据
+	InitData(s *GamingState) interface{}
+	// HandleAction 处理玩家在游戏中的动作
+	HandleAction(s *GamingState, player Player, action Action, actionData []byte) error
+	// Results 在一局结束时计算结算结果
+	Results(s *GamingState) map[string]interface{}
+}
+
+// DataRestorer is an optional interface for game modules whose game data can be
+// rebuilt from a persisted room snapshot. Modules without it restart the round
+// from InitData when a room is restored.
+type DataRestorer interface {
+	RestoreData(s *GamingState, raw json.RawMessage) (interface{}, error)
+}
+
+// DataPublisher is an optional interface for game modules whose game data holds
+// inputs that other players must not see before the server seed is revealed.
+// Game start and sync broadcasts send PublicData; snapshots keep the full data.
+type DataPublisher interface {
+	PublicData(s *GamingState) interface{}
+}
+
+// RoundAborter is an optional interface for game modules that debit stakes before
+// a round ends. When a snapshot's round cannot be restored, AbortRound refunds the
+// stakes found in its game data and returns them for the aborted round's record.
+type RoundAborter interface {
+	AbortRound(s *GamingState, raw json.RawMessage) []models.PlayerInfo
+}
+
+// PlayerJoinHandler is an optional interface for game modules that react to
+// players joining mid-round, e.g. to resume a reconnecting user's bonus round.
+// Joins are logged with the round's actions so that replays see them too.
+type PlayerJoinHandler interface {
+	OnPlayerJoin(s *GamingState, player Player)
+}
+
+// TurnGame is an optional interface for game modules in which players act one
+// at a time, such as card and board games. GamingState keeps their Turns, rejects
+// actions from anyone but the current player, and asks for an AutoAction when the
+// current player times out or has left the room.
+type TurnGame interface {
+	// TurnOrder 返回一局的行动顺序，在 InitData 之前调用
+	TurnOrder(s *GamingState) []string
+	// AutoAction 返回代为行动的动作数据，例如弃牌或过牌；返回 nil 时直接轮到下一个玩家
+	AutoAction(s *GamingState, playerID string) []byte
+}
+
+// SeatLimiter is an optional interface for game modules that can only seat a
+// limited number of players, e.g. card games dealt from a single deck. Rooms of
+// these games are created with at most MaxPlayers seats.
+type SeatLimiter interface {
+	MaxPlayers() int
+}
+
+// RoundRecorder is an optional interface for game modules that track per-player
+// bets and payouts. Without it the round is recorded with every player in the
+// room as a draw.
+type RoundRecorder interface {
+	PlayerResults(s *GamingState) []models.PlayerInfo
+}
+
+// Action represents a player action that can be unmarshalled from a packet.
+type Action struct {
+	Type string `json:"type"`
+}
+
+// ParseAction 解析动作的类型字段，具体参数由游戏模块自行解析
+func ParseAction(actionData []byte) (Action, error) {
+	var action Action
+	err := json.Unmarshal(actionData, &action)
+	return action, err
+}
+
+var (
+	modules         = make(map[string]GameModule)
+	configOverrides = make(map[string]GameConfig)
+	registryMutex   sync.RWMutex
+)
+
+// RegisterGameModule 注册一个游戏模块，同类型重复注册时后者覆盖前者
+func RegisterGameModule(module GameModule) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	modules[module.GameType()] = module
+}
+
+// GetGameModule 获取游戏模块
+func GetGameModule(gameType string) (GameModule, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	module, exists := modules[gameType]
+	return module, exists
+}
+
+// RoomMaxPlayers 返回创建 gameType 房间时的人数上限：requested 为 0 时使用 DefaultMaxPlayers，
+// 超过游戏模块的上限时取上限。既没有游戏模块也没有配置帧同步的游戏类型返回 ErrUnknownGameType
+func RoomMaxPlayers(gameType string, requested int) (int, error) {
+	module, exists := GetGameModule(gameType)
+	if !exists && GetGameConfig(gameType).Lockstep == nil {
+		return 0, ErrUnknownGameType
+	}
+	maxPlayers := requested
+	if maxPlayers <= 0 {
+		maxPlayers = DefaultMaxPlayers
+	}
+	if limiter, ok := module.(SeatLimiter); ok && maxPlayers > limiter.MaxPlayers() {
+		maxPlayers = limiter.MaxPlayers()
+	}
+	return maxPlayers, nil
+}
+
+// SetGameConfig 设置某种游戏的配置覆盖（通常来自配置文件），零值字段不覆盖
+func SetGameConfig(gameType string, config GameConfig) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	configOverrides[gameType] = config
+}
+
+// GetGameConfig 返回某种游戏最终生效的配置：
+// 默认值 <- 游戏模块的默认配置 <- 配置覆盖
+func GetGameConfig(gameType string) GameConfig {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	config := DefaultGameConfig()
+	if module, exists := modules[gameType]; exists {
+		config = config.merge(module.Config())
+	}
+	if override, exists := configOverrides[gameType]; exists {
+		config = config.merge(override)
+	}
+	return config
+}
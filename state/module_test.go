@@ -0,0 +1,93 @@
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// configModule is a minimal GameModule used to test config resolution.
+type configModule struct {
+	SlotMachine
+	config GameConfig
+}
+
+func (m *configModule) GameType() string   { return "config_test_game" }
+func (m *configModule) Config() GameConfig { return m.config }
+
+func TestGetGameConfig_Defaults(t *testing.T) {
+	config := GetGameConfig("unknown_game")
+	if config != DefaultGameConfig() {
+		t.Errorf("Expected defaults for an unregistered game, got %+v", config)
+	}
+}
+
+func TestGetGameConfig_ModuleAndOverride(t *testing.T) {
+	RegisterGameModule(&configModule{config: GameConfig{
+		TickInterval:  50 * time.Millisecond,
+		RoundDuration: time.Minute,
+	}})
+
+	config := GetGameConfig("config_test_game")
+	if config.TickInterval != 50*time.Millisecond || config.RoundDuration != time.Minute {
+		t.Errorf("Expected module defaults to apply, got %+v", config)
+	}
+	if config.StartRule != DefaultStartRule() {
+		t.Errorf("Expected unset start rule to fall back to the default, got %+v", config.StartRule)
+	}
+
+	SetGameConfig("config_test_game", GameConfig{
+		RoundDuration: 2 * time.Minute,
+		StartRule:     StartRule{MinPlayers: 3},
+	})
+
+	config = GetGameConfig("config_test_game")
+	if config.TickInterval != 50*time.Millisecond {
+		t.Errorf("Override without a tick interval should keep the module value, got %v", config.TickInterval)
+	}
+	if config.RoundDuration != 2*time.Minute {
+		t.Errorf("Expected overridden round duration, got %v", config.RoundDuration)
+	}
+	if config.StartRule.MinPlayers != 3 || config.StartRule.Mode != StartAllReady {
+		t.Errorf("Expected partially overridden start rule, got %+v", config.StartRule)
+	}
+}
+
+func TestRoomMaxPlayers(t *testing.T) {
+	SetGameConfig("lockstep_test_game", GameConfig{Lockstep: &LockstepConfig{}})
+	tests := []struct {
+		gameType  string
+		requested int
+		expected  int
+		err       error
+	}{
+		{"slot_machine", 0, DefaultMaxPlayers, nil},
+		{"slot_machine", 8, 8, nil},
+		{"holdem", 6, 6, nil},
+		{"holdem", 100, holdemMaxPlayers, nil},
+		{"lockstep_test_game", 2, 2, nil},
+		{"unknown_game", 2, 0, ErrUnknownGameType},
+	}
+	for _, tt := range tests {
+		maxPlayers, err := RoomMaxPlayers(tt.gameType, tt.requested)
+		if maxPlayers != tt.expected || !errors.Is(err, tt.err) {
+			t.Errorf("%s with %d requested: expected %d (%v), got %d (%v)", tt.gameType, tt.requested, tt.expected, tt.err, maxPlayers, err)
+		}
+	}
+}
+
+func TestGamingState_UsesElapsedTime(t *testing.T) {
+	room := newMockRoom(DefaultStartRule(), "p1")
+	gs := NewGamingState(room, time.Minute)
+	if err := room.ChangeState(gs); err != nil {
+		t.Fatalf("ChangeState failed: %v", err)
+	}
+
+	// 模拟一次迟到的心跳：距上次更新已过去2秒
+	gs.lastUpdate = time.Now().Add(-2 * time.Second)
+	gs.OnUpdate()
+
+	if gs.RemainingTime > time.Minute-2*time.Second {
+		t.Errorf("Expected at least 2s to be deducted for a late tick, remaining %v", gs.RemainingTime)
+	}
+}
@@ -0,0 +1,264 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wfunc/gameserver/fairness"
+)
+
+const (
+	// slotReels 老虎机的转轴数
+	slotReels = 3
+	// simulationChunk 模拟时每段的付费 spin 数，每段使用独立的客户端种子，结果与并行度无关
+	simulationChunk = 10000
+)
+
+// Paytable 老虎机赔付表：三个转轴显示同一个符号时按该符号的倍数派奖，
+// 各符号在每个转轴上等概率出现。分散符号出现在任意转轴上即计数，
+// 个数达到要求时奖励免费 spin，免费 spin 的派奖乘以 FreeSpinMultiplier，其中也可以再次奖励免费 spin
+type Paytable struct {
+	Symbols int           `json:"symbols"` // 每个转轴上的符号数
+	Pays    map[int]int64 `json:"pays"`    // 三连的符号 -> 下注倍数，未列出的符号三连不派奖
+	// JackpotSymbol 三连时另外赢得累积奖池的符号，为 nil 时没有奖池
+	JackpotSymbol *int `json:"jackpot_symbol,omitempty"`
+	// Scatter 分散符号，为 nil 时没有免费 spin
+	Scatter *int `json:"scatter,omitempty"`
+	// FreeSpins 分散符号个数 -> 奖励的免费 spin 次数
+	FreeSpins map[int]int `json:"free_spins,omitempty"`
+	// FreeSpinMultiplier 免费 spin 派奖的倍数，0 视为 1
+	FreeSpinMultiplier int64 `json:"free_spin_multiplier,omitempty"`
+}
+
+// DefaultPaytable 返回默认赔付表：8 个符号，7-7-7 赢得 100 倍下注和累积奖池，其他三连赢得 10 倍；
+// 0 为分散符号，2 个奖励 3 次免费 spin，3 个奖励 10 次，免费 spin 派奖翻倍
+func DefaultPaytable() *Paytable {
+	jackpot, scatter := 7, 0
+	p := &Paytable{
+		Symbols:            8,
+		Pays:               make(map[int]int64),
+		JackpotSymbol:      &jackpot,
+		Scatter:            &scatter,
+		FreeSpins:          map[int]int{2: 3, 3: 10},
+		FreeSpinMultiplier: 2,
+	}
+	for symbol := 0; symbol < 7; symbol++ {
+		p.Pays[symbol] = 10
+	}
+	p.Pays[7] = 100
+	return p
+}
+
+// Validate 检查符号数和倍数
+func (p *Paytable) Validate() error {
+	if p.Symbols < 1 {
+		return fmt.Errorf("paytable needs at least one symbol, got %d", p.Symbols)
+	}
+	for symbol, multiplier := range p.Pays {
+		if symbol < 0 || symbol >= p.Symbols {
+			return fmt.Errorf("paytable pays symbol %d outside 0-%d", symbol, p.Symbols-1)
+		}
+		if multiplier < 0 {
+			return fmt.Errorf("paytable multiplier for symbol %d is negative", symbol)
+		}
+	}
+	if p.JackpotSymbol != nil && (*p.JackpotSymbol < 0 || *p.JackpotSymbol >= p.Symbols) {
+		return fmt.Errorf("paytable jackpot symbol %d outside 0-%d", *p.JackpotSymbol, p.Symbols-1)
+	}
+	if p.Scatter != nil && (*p.Scatter < 0 || *p.Scatter >= p.Symbols) {
+		return fmt.Errorf("paytable scatter %d outside 0-%d", *p.Scatter, p.Symbols-1)
+	}
+	for count, spins := range p.FreeSpins {
+		if count < 1 || count > slotReels || spins < 0 {
+			return fmt.Errorf("paytable awards %d free spins for %d scatters", spins, count)
+		}
+	}
+	if p.FreeSpinMultiplier < 0 {
+		return fmt.Errorf("paytable free spin multiplier is negative")
+	}
+	// 每次 spin 期望奖励的免费 spin 不少于 1 次时免费 spin 永远不会结束
+	if p.expectedFreeSpins() >= 1 {
+		return fmt.Errorf("paytable awards %.2f free spins per spin on average, must be below 1", p.expectedFreeSpins())
+	}
+	return nil
+}
+
+// Multiplier 返回转轴结果的派奖倍数
+func (p *Paytable) Multiplier(reels [slotReels]int) int64 {
+	for _, symbol := range reels[1:] {
+		if symbol != reels[0] {
+			return 0
+		}
+	}
+	return p.Pays[reels[0]]
+}
+
+// IsJackpot 返回转轴结果是否赢得累积奖池
+func (p *Paytable) IsJackpot(reels [slotReels]int) bool {
+	if p.JackpotSymbol == nil {
+		return false
+	}
+	for _, symbol := range reels {
+		if symbol != *p.JackpotSymbol {
+			return false
+		}
+	}
+	return true
+}
+
+// Scatters 返回转轴结果中分散符号的个数
+func (p *Paytable) Scatters(reels [slotReels]int) int {
+	if p.Scatter == nil {
+		return 0
+	}
+	count := 0
+	for _, symbol := range reels {
+		if symbol == *p.Scatter {
+			count++
+		}
+	}
+	return count
+}
+
+// FreeSpinsFor 返回转轴结果奖励的免费 spin 次数
+func (p *Paytable) FreeSpinsFor(reels [slotReels]int) int {
+	if p.Scatter == nil {
+		return 0
+	}
+	return p.FreeSpins[p.Scatters(reels)]
+}
+
+// BonusMultiplier 返回免费 spin 派奖的倍数
+func (p *Paytable) BonusMultiplier() int64 {
+	if p.FreeSpinMultiplier == 0 {
+		return 1
+	}
+	return p.FreeSpinMultiplier
+}
+
+// TheoreticalRTP 返回理论返奖率，不含累积奖池。每次 spin 的三连返奖为 base，
+// 期望奖励 r 次免费 spin，免费 spin 又会再奖励，平均每次付费 spin 带来 r/(1-r) 次免费 spin
+func (p *Paytable) TheoreticalRTP() float64 {
+	probability := math.Pow(1/float64(p.Symbols), slotReels)
+	base := 0.0
+	for _, multiplier := range p.Pays {
+		base += probability * float64(multiplier)
+	}
+	r := p.expectedFreeSpins()
+	return base + r/(1-r)*base*float64(p.BonusMultiplier())
+}
+
+// expectedFreeSpins 返回每次 spin 期望奖励的免费 spin 次数
+func (p *Paytable) expectedFreeSpins() float64 {
+	if p.Scatter == nil {
+		return 0
+	}
+	q := 1 / float64(p.Symbols)
+	expected := 0.0
+	for count, spins := range p.FreeSpins {
+		if count < 0 || count > slotReels {
+			continue
+		}
+		// 恰好 count 个转轴出现分散符号的概率
+		ways := binomial(slotReels, count)
+		expected += ways * math.Pow(q, float64(count)) * math.Pow(1-q, float64(slotReels-count)) * float64(spins)
+	}
+	return expected
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+// SimulationResult 赔付表模拟的统计结果，每次付费 spin 下注 1，
+// 一次付费 spin 的派奖包含它触发的全部免费 spin 的派奖
+type SimulationResult struct {
+	Spins        int
+	FreeSpins    int // 触发的免费 spin 总数
+	TotalPayout  int64
+	RTP          float64 // 总派奖 / 总下注
+	HitFrequency float64 // 有派奖的付费 spin 所占比例
+	Volatility   float64 // 每次付费 spin 派奖倍数的标准差
+	MaxWin       int64   // 单次付费 spin 的最大派奖倍数
+}
+
+// simulationTotals 一段 spin 的累计值
+type simulationTotals struct {
+	payout, squares int64
+	hits, freeSpins int
+	maxWin          int64
+}
+
+// Simulate 以与真实 spin 相同的方式由 seed 和递增的 nonce 生成 spins 次付费 spin 并统计。
+// spin 按 simulationChunk 分段，每段以段号作为玩家ID和客户端种子，由 CPU 数个协程并行计算，结果只取决于 seed 和 spins
+func (p *Paytable) Simulate(seed string, spins int) SimulationResult {
+	chunks := (spins + simulationChunk - 1) / simulationChunk
+	totals := make([]simulationTotals, chunks)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), chunks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := int(next.Add(1)) - 1; c < chunks; c = int(next.Add(1)) - 1 {
+				n := min(simulationChunk, spins-c*simulationChunk)
+				totals[c] = p.simulateChunk(seed, fmt.Sprintf("simulation-%d", c), n)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var sum simulationTotals
+	for _, t := range totals {
+		sum.payout += t.payout
+		sum.squares += t.squares
+		sum.hits += t.hits
+		sum.freeSpins += t.freeSpins
+		sum.maxWin = max(sum.maxWin, t.maxWin)
+	}
+
+	result := SimulationResult{Spins: spins, FreeSpins: sum.freeSpins, TotalPayout: sum.payout, MaxWin: sum.maxWin}
+	if spins > 0 {
+		n := float64(spins)
+		result.RTP = float64(sum.payout) / n
+		result.HitFrequency = float64(sum.hits) / n
+		result.Volatility = math.Sqrt(max(float64(sum.squares)/n-result.RTP*result.RTP, 0))
+	}
+	return result
+}
+
+// simulateChunk 模拟一段付费 spin，触发的免费 spin 接着使用后面的 nonce，与真实游戏中同一玩家的 spin 一致
+func (p *Paytable) simulateChunk(seed, playerID string, spins int) simulationTotals {
+	var t simulationTotals
+	nonce := uint64(0)
+	reels := func() [slotReels]int {
+		nonce++
+		return [slotReels]int(fairness.Ints(seed, playerID, playerID, nonce, slotReels, p.Symbols))
+	}
+
+	for i := 0; i < spins; i++ {
+		outcome := reels()
+		win := p.Multiplier(outcome)
+		for remaining := p.FreeSpinsFor(outcome); remaining > 0; remaining-- {
+			t.freeSpins++
+			outcome = reels()
+			win += p.Multiplier(outcome) * p.BonusMultiplier()
+			remaining += p.FreeSpinsFor(outcome)
+		}
+		if win == 0 {
+			continue
+		}
+		t.hits++
+		t.payout += win
+		t.squares += win * win
+		t.maxWin = max(t.maxWin, win)
+	}
+	return t
+}
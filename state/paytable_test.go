@@ -0,0 +1,183 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/wfunc/gameserver/fairness"
+)
+
+func TestPaytable_TheoreticalRTP(t *testing.T) {
+	// 每个符号三连的概率为 1/512：7 个符号 10 倍，7-7-7 100 倍
+	p := DefaultPaytable()
+	p.Scatter = nil
+	if rtp := p.TheoreticalRTP(); math.Abs(rtp-170.0/512) > 1e-12 {
+		t.Errorf("Expected theoretical RTP 170/512 without free spins, got %v", rtp)
+	}
+	// 每次 spin 期望奖励 73/512 次免费 spin：2 个分散符号 3*7/512 的概率奖励 3 次，3 个 1/512 的概率奖励 10 次。
+	// 平均每次付费 spin 带来 73/439 次双倍派奖的免费 spin
+	if rtp, want := DefaultPaytable().TheoreticalRTP(), 170.0/512*(1+2*73.0/439); math.Abs(rtp-want) > 1e-12 {
+		t.Errorf("Expected theoretical RTP %v with free spins, got %v", want, rtp)
+	}
+
+	scatter := 0
+	invalid := []*Paytable{
+		{Symbols: 0},
+		{Symbols: 4, Pays: map[int]int64{4: 10}},
+		{Symbols: 4, Pays: map[int]int64{1: -1}},
+		{Symbols: 4, Scatter: &scatter, FreeSpins: map[int]int{4: 10}},
+		// 每次 spin 期望奖励 3 * 1/2 * 2 = 3 次免费 spin，永远不会结束
+		{Symbols: 2, Scatter: &scatter, FreeSpins: map[int]int{1: 2, 2: 2, 3: 2}},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected paytable %+v to be invalid", p)
+		}
+	}
+}
+
+func TestPaytable_Simulate(t *testing.T) {
+	p := DefaultPaytable()
+	result := p.Simulate("seed", 200000)
+	if again := p.Simulate("seed", 200000); again != result {
+		t.Fatalf("Expected the same seed to give the same result, got %+v and %+v", result, again)
+	}
+	if math.Abs(result.RTP-p.TheoreticalRTP()) > 0.03 {
+		t.Errorf("Expected simulated RTP near %.4f, got %.4f", p.TheoreticalRTP(), result.RTP)
+	}
+	if perSpin := float64(result.FreeSpins) / float64(result.Spins); math.Abs(perSpin-73.0/439) > 0.01 {
+		t.Errorf("Expected about 73/439 free spins per spin, got %.4f", perSpin)
+	}
+	if result.MaxWin < 100 || result.Volatility <= 0 {
+		t.Errorf("Unexpected max win or volatility: %+v", result)
+	}
+
+	p.Scatter = nil
+	if result := p.Simulate("seed", 100000); math.Abs(result.HitFrequency-1.0/64) > 0.003 || result.FreeSpins != 0 {
+		t.Errorf("Expected hit frequency near 1/64 without free spins, got %+v", result)
+	}
+}
+
+// wagerRoom is an economyRoom that records observed wagers.
+type wagerRoom struct {
+	*economyRoom
+	bets, payouts int64
+	wagers        int
+}
+
+func (r *wagerRoom) ObserveWager(bet, payout int64) {
+	r.wagers++
+	r.bets += bet
+	r.payouts += payout
+}
+
+func TestSlotMachine_ObservesWagers(t *testing.T) {
+	economy := &mockEconomy{
+		coins: map[int64]int64{42: 100},
+		items: map[int64]map[string]int64{42: {"free_spin_ticket": 1}},
+	}
+	room := &wagerRoom{economyRoom: &economyRoom{mockRoom: newMockRoom(DefaultStartRule()), economy: economy}}
+	alice := &userPlayer{mockPlayer: mockPlayer{id: "alice"}, userID: 42}
+
+	s := NewGamingState(room, 0)
+	s.module = slotMachineWithoutBonus()
+	s.OnEnter()
+	s.HandleAction(alice, []byte(`{"type":"spin","bet":20}`))
+	s.HandleAction(alice, []byte(`{"type":"spin","item":"free_spin_ticket"}`))
+	s.HandleAction(alice, []byte(`{"type":"spin","bet":1000}`)) // 余额不足，不计入
+
+	// 使用物品的 spin 按物品的下注额计入
+	if room.wagers != 2 || room.bets != 25 {
+		t.Errorf("Expected 2 wagers totalling 25, got %d totalling %d", room.wagers, room.bets)
+	}
+}
+
+// mockJackpot is a pool that takes a tenth of each bet and resets to 100 when claimed.
+type mockJackpot struct {
+	pool, contributed int64
+	claims            int
+}
+
+func (j *mockJackpot) Contribute(pool string, bet int64) error {
+	j.contributed += bet
+	j.pool += bet / 10
+	return nil
+}
+
+func (j *mockJackpot) Claim(pool string, userID int64, roomID string) (int64, error) {
+	j.claims++
+	won := j.pool
+	j.pool = 100
+	return won, nil
+}
+
+// jackpotRoom is an economyRoom playing the registered slot machine with a mockJackpot.
+type jackpotRoom struct {
+	*economyRoom
+	jackpot *mockJackpot
+}
+
+func (r *jackpotRoom) GetGameType() string { return "slot_machine" }
+func (r *jackpotRoom) Jackpot() Jackpot    { return r.jackpot }
+
+func TestSlotMachine_Jackpot(t *testing.T) {
+	economy := &mockEconomy{
+		coins: map[int64]int64{42: 100},
+		items: map[int64]map[string]int64{42: {"free_spin_ticket": 1}},
+	}
+	jackpot := &mockJackpot{pool: 1000}
+	room := &jackpotRoom{
+		economyRoom: &economyRoom{mockRoom: newMockRoom(DefaultStartRule()), economy: economy},
+		jackpot:     jackpot,
+	}
+	alice := &userPlayer{mockPlayer: mockPlayer{id: "alice"}, userID: 42}
+	room.players["alice"] = alice
+
+	s := NewGamingState(room, 0)
+	room.stateMachine = NewBaseStateMachine(s)
+	s.OnEnter()
+
+	// 免费 spin 使用 nonce 1，找到本局种子下以 nonce 2 转出 7-7-7 的客户端种子
+	seed := 0
+	for [slotReels]int(fairness.Ints(s.Fairness.ServerSeed, "alice", fmt.Sprint(seed), 2, slotReels, 8)) != [slotReels]int{7, 7, 7} {
+		seed++
+	}
+
+	if err := s.HandleAction(alice, []byte(`{"type":"spin","item":"free_spin_ticket"}`)); err != nil {
+		t.Fatalf("Free spin failed: %v", err)
+	}
+	if jackpot.contributed != 0 {
+		t.Errorf("Expected free spins not to contribute, got %d", jackpot.contributed)
+	}
+	before := s.GameData.(*SlotData).Players["alice"].Payout
+	action := fmt.Sprintf(`{"type":"spin","bet":10,"client_seed":"%d"}`, seed)
+	if err := s.HandleAction(alice, []byte(action)); err != nil {
+		t.Fatalf("Spin failed: %v", err)
+	}
+
+	data := s.GameData.(*SlotData)
+	if jackpot.contributed != 10 || jackpot.claims != 1 || data.LastResult["jackpot"] != int64(1001) {
+		t.Fatalf("Expected the 7-7-7 spin to contribute and win 1001, got %+v and %+v", jackpot, data.LastResult)
+	}
+	// 奖池由奖池服务计入金币，经济系统只发放赔付表的派奖
+	if stats := data.Players["alice"]; stats.Payout != before+1000+1001 || economy.coins[42] != 90+before+1000 {
+		t.Errorf("Unexpected stats %+v or balance %d", stats, economy.coins[42])
+	}
+
+	// 重放使用记录的领取金额，不再访问奖池
+	s.OnUpdate()
+	replayed, err := Replay(room.records[0], &mockEconomy{
+		coins: map[int64]int64{42: 100},
+		items: map[int64]map[string]int64{42: {"free_spin_ticket": 1}},
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if original, result := normalizeJSON(room.records[0].Players), normalizeJSON(replayed.Players); original != result {
+		t.Errorf("Expected replay to reproduce the jackpot\noriginal: %s\nreplayed: %s", original, result)
+	}
+	if jackpot.claims != 1 {
+		t.Errorf("Expected replay not to claim the real jackpot, got %d claims", jackpot.claims)
+	}
+}
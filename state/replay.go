@@ -0,0 +1,256 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+// ReplayKey 游戏记录 Result 中保存重放数据的键
+const ReplayKey = "replay"
+
+// ErrNoReplay 游戏记录中没有种子和动作记录
+var ErrNoReplay = errors.New("record has no replay log")
+
+// errNoJackpotClaim 原局中该动作没有领取到奖池，例如领取时数据库出错
+var errNoJackpotClaim = errors.New("no jackpot claim recorded for action")
+
+// LoggedAction 一个被接受的玩家动作
+type LoggedAction struct {
+	PlayerID string          `json:"player_id"`
+	UserID   int64           `json:"user_id,omitempty"`
+	Data     json.RawMessage `json:"data"`
+	Jackpots []int64         `json:"jackpots,omitempty"` // 该动作领取的奖池金额
+	Join     bool            `json:"join,omitempty"`     // 玩家在一局中途加入，没有动作数据
+	Timeout  bool            `json:"timeout,omitempty"`  // 回合制游戏中玩家超时，由游戏模块代为行动
+}
+
+// ReplayLog 随游戏记录保存的本局种子和动作，按顺序重新执行可以得到相同的结果
+type ReplayLog struct {
+	Seed    string         `json:"seed"`
+	Settled bool           `json:"settled,omitempty"` // 本局是否经由经济系统结算
+	Jackpot bool           `json:"jackpot,omitempty"` // 本局是否接入累积奖池
+	Players []RoundPlayer  `json:"players,omitempty"` // 回合制游戏开局时的玩家
+	Actions []LoggedAction `json:"actions"`
+}
+
+// RoundSnapshot 房间快照中进行中的一局的种子、随机数发生器状态、动作记录和行动顺序，只保存在服务端
+type RoundSnapshot struct {
+	Seed      string         `json:"seed"`
+	RandState []byte         `json:"rand_state,omitempty"`
+	Actions   []LoggedAction `json:"actions,omitempty"`
+	Players   []RoundPlayer  `json:"players,omitempty"`
+	Turns     *Turns         `json:"turns,omitempty"`
+}
+
+// RoundSnapshot 返回本局的种子、随机数发生器状态、动作记录和行动顺序，必须在房间协程中调用
+func (s *GamingState) RoundSnapshot() (*RoundSnapshot, error) {
+	state, err := s.source.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	round := &RoundSnapshot{Seed: s.Fairness.ServerSeed, RandState: state, Actions: s.actions, Players: s.roster}
+	if s.Turns != nil {
+		// 快照在房间协程之外编码，复制一份
+		turns := *s.Turns
+		turns.Order = slices.Clone(s.Turns.Order)
+		turns.Out = maps.Clone(s.Turns.Out)
+		turns.Away = maps.Clone(s.Turns.Away)
+		round.Turns = &turns
+	}
+	return round, nil
+}
+
+// logAction 记录一个被接受的动作
+func (s *GamingState) logAction(player Player, actionData []byte) {
+	action := LoggedAction{
+		PlayerID: player.GetID(),
+		Data:     append(json.RawMessage(nil), actionData...),
+		Jackpots: s.claims,
+	}
+	s.claims = nil
+	if user, ok := player.(UserPlayer); ok {
+		action.UserID = user.GetUserID()
+	}
+	s.actions = append(s.actions, action)
+}
+
+// logJoin 记录玩家在一局中途加入
+func (s *GamingState) logJoin(player Player) {
+	action := LoggedAction{PlayerID: player.GetID(), Join: true}
+	if user, ok := player.(UserPlayer); ok {
+		action.UserID = user.GetUserID()
+	}
+	s.actions = append(s.actions, action)
+}
+
+// logTimeout 记录玩家超时，代为执行的动作在重放时重新生成
+func (s *GamingState) logTimeout(player Player) {
+	action := LoggedAction{PlayerID: player.GetID(), Timeout: true}
+	if user, ok := player.(UserPlayer); ok {
+		action.UserID = user.GetUserID()
+	}
+	s.actions = append(s.actions, action)
+}
+
+// ReplayLogFromRecord 从游戏记录中取出重放数据
+func ReplayLogFromRecord(record *models.GameRecord) (*ReplayLog, error) {
+	raw, ok := record.Result[ReplayKey]
+	if !ok || raw == nil {
+		return nil, ErrNoReplay
+	}
+	// 从数据库读出的记录中重放数据是 map，重新编码后解析
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	log := &ReplayLog{}
+	if err := json.Unmarshal(data, log); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// Replay 用游戏记录中的种子和动作重新模拟一局，返回模拟得到的游戏记录，
+// 其 Result 和 Players 与原记录一致。economy 在原局经由经济系统结算时使用，
+// 应总是接受扣费，并能查到原局使用过的物品定义
+func Replay(record *models.GameRecord, economy Economy) (*models.GameRecord, error) {
+	log, err := ReplayLogFromRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	if !log.Settled {
+		economy = nil
+	}
+	if _, ok := GetGameModule(record.GameType); !ok {
+		return nil, fmt.Errorf("unknown game type %q", record.GameType)
+	}
+
+	room := &replayRoom{
+		id:       record.RoomID,
+		gameType: record.GameType,
+		seed:     log.Seed,
+		economy:  economy,
+		players:  make(map[string]Player),
+		seats:    make(map[string]int),
+	}
+	if log.Jackpot {
+		room.jackpot = &replayJackpot{}
+	}
+	for _, player := range log.Players {
+		room.players[player.PlayerID] = &loggedPlayer{id: player.PlayerID, userID: player.UserID}
+		room.seats[player.PlayerID] = player.Seat
+	}
+	for _, action := range log.Actions {
+		room.players[action.PlayerID] = &loggedPlayer{id: action.PlayerID, userID: action.UserID}
+	}
+
+	s := NewGamingState(room, 0)
+	s.StartTime = record.StartTime
+	s.roster = slices.Clone(log.Players)
+	s.OnEnter()
+	for i, action := range log.Actions {
+		if action.Join {
+			s.OnPlayerJoin(room.players[action.PlayerID])
+			continue
+		}
+		if action.Timeout {
+			if s.Turns == nil || s.Turns.Current != action.PlayerID {
+				return nil, fmt.Errorf("action %d: player %s timed out out of turn", i, action.PlayerID)
+			}
+			s.timeoutTurn()
+			continue
+		}
+		if room.jackpot != nil {
+			room.jackpot.claims = action.Jackpots
+		}
+		if err := s.HandleAction(room.players[action.PlayerID], action.Data); err != nil {
+			return nil, fmt.Errorf("action %d of player %s: %w", i, action.PlayerID, err)
+		}
+	}
+	s.calculateFinalResults()
+	return s.buildRecord(), nil
+}
+
+// replayRoom 重放时使用的房间，不广播也不保存记录
+type replayRoom struct {
+	id       string
+	gameType string
+	seed     string
+	economy  Economy
+	jackpot  *replayJackpot
+	players  map[string]Player
+	seats    map[string]int
+}
+
+func (r *replayRoom) GetID() string                             { return r.id }
+func (r *replayRoom) GetGameType() string                       { return r.gameType }
+func (r *replayRoom) GetPlayers() map[string]Player             { return r.players }
+func (r *replayRoom) GetMaxPlayers() int                        { return len(r.players) }
+func (r *replayRoom) GetGameConfig() GameConfig                 { return GetGameConfig(r.gameType) }
+func (r *replayRoom) ChangeState(newState State) error          { return nil }
+func (r *replayRoom) Broadcast(msgID uint16, data []byte) error { return nil }
+func (r *replayRoom) RecordGame(record *models.GameRecord)      {}
+func (r *replayRoom) RoundSeed() string                         { return r.seed }
+func (r *replayRoom) Economy() Economy                          { return r.economy }
+
+func (r *replayRoom) GetSeat(playerID string) int {
+	if seat, ok := r.seats[playerID]; ok {
+		return seat
+	}
+	return -1
+}
+
+func (r *replayRoom) Jackpot() Jackpot {
+	if r.jackpot == nil {
+		return nil
+	}
+	return r.jackpot
+}
+
+// recordedJackpot 记录领取的奖池金额，写入当前动作的记录
+type recordedJackpot struct {
+	state   *GamingState
+	jackpot Jackpot
+}
+
+func (j *recordedJackpot) Contribute(pool string, bet int64) error {
+	return j.jackpot.Contribute(pool, bet)
+}
+
+func (j *recordedJackpot) Claim(pool string, userID int64, roomID string) (int64, error) {
+	amount, err := j.jackpot.Claim(pool, userID, roomID)
+	if err == nil {
+		j.state.claims = append(j.state.claims, amount)
+	}
+	return amount, err
+}
+
+// replayJackpot 重放时按顺序返回原局中当前动作领取的奖池金额，不修改真实的奖池
+type replayJackpot struct {
+	claims []int64
+}
+
+func (j *replayJackpot) Contribute(pool string, bet int64) error { return nil }
+
+func (j *replayJackpot) Claim(pool string, userID int64, roomID string) (int64, error) {
+	if len(j.claims) == 0 {
+		return 0, errNoJackpotClaim
+	}
+	amount := j.claims[0]
+	j.claims = j.claims[1:]
+	return amount, nil
+}
+
+// loggedPlayer 代表记录中的一个玩家，用于重放和为已离开的玩家代为行动
+type loggedPlayer struct {
+	id     string
+	userID int64
+}
+
+func (p *loggedPlayer) GetID() string    { return p.id }
+func (p *loggedPlayer) GetUserID() int64 { return p.userID }
@@ -0,0 +1,98 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+// slotRoom is a mockRoom playing the registered slot machine with a fixed seed.
+type slotRoom struct {
+	*mockRoom
+	seed string
+}
+
+func (r *slotRoom) GetGameType() string { return "slot_machine" }
+func (r *slotRoom) RoundSeed() string   { return r.seed }
+
+func TestGamingState_SeededRand(t *testing.T) {
+	a := NewGamingState(&slotRoom{mockRoom: newMockRoom(DefaultStartRule()), seed: "seed"}, 0)
+	b := NewGamingState(&slotRoom{mockRoom: newMockRoom(DefaultStartRule()), seed: "seed"}, 0)
+	if a.Fairness.ServerSeed != "seed" {
+		t.Fatalf("Expected the room's seed to be used, got %q", a.Fairness.ServerSeed)
+	}
+	for i := 0; i < 10; i++ {
+		if x, y := a.Rand.Uint64(), b.Rand.Uint64(); x != y {
+			t.Fatalf("Expected the same seed to give the same sequence, got %d and %d", x, y)
+		}
+	}
+
+	// 从快照恢复后随机数序列接着原来的位置继续
+	a.OnEnter()
+	round, err := a.RoundSnapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot round: %v", err)
+	}
+	raw, _ := json.Marshal(a.GameData)
+	restored := NewRestoredGamingState(a.Room, 0, 0, raw, round)
+	if x, y := a.Rand.Uint64(), restored.Rand.Uint64(); x != y {
+		t.Errorf("Expected the restored rand to continue the sequence, got %d and %d", x, y)
+	}
+}
+
+func TestReplay_ReproducesRound(t *testing.T) {
+	room := &slotRoom{mockRoom: newMockRoom(DefaultStartRule()), seed: "disputed"}
+	alice := &userPlayer{mockPlayer: mockPlayer{id: "alice"}, userID: 42}
+	room.players["alice"] = alice
+	room.players["bob"] = &mockPlayer{id: "bob"}
+
+	s := NewGamingState(room, 0)
+	room.stateMachine = NewBaseStateMachine(s)
+	s.OnEnter()
+	for _, action := range []string{
+		`{"type":"spin","bet":20,"client_seed":"lucky"}`,
+		`{"type":"spin","bet":-1}`, // 被拒绝的动作不记录
+		`{"type":"spin","client_seed":"lucky"}`,
+		`{"type":"spin","bet":5}`,
+	} {
+		s.HandleAction(alice, []byte(action))
+	}
+	s.HandleAction(room.players["bob"], []byte(`{"type":"spin","bet":50}`))
+	s.OnUpdate()
+
+	// 记录经 JSON 保存后重放
+	data, _ := json.Marshal(room.records[0])
+	var record models.GameRecord
+	json.Unmarshal(data, &record)
+
+	log, err := ReplayLogFromRecord(&record)
+	if err != nil || log.Seed != "disputed" || len(log.Actions) != 4 || log.Actions[0].UserID != 42 {
+		t.Fatalf("Unexpected replay log: %+v (err: %v)", log, err)
+	}
+
+	replayed, err := Replay(&record, nil)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if original, result := normalizeJSON(record.Result), normalizeJSON(replayed.Result); original != result {
+		t.Errorf("Expected replay to reproduce the result\noriginal: %s\nreplayed: %s", original, result)
+	}
+	if original, players := normalizeJSON(record.Players), normalizeJSON(replayed.Players); original != players {
+		t.Errorf("Expected replay to reproduce the players\noriginal: %s\nreplayed: %s", original, players)
+	}
+
+	if _, err := Replay(&models.GameRecord{GameType: "slot_machine"}, nil); !errors.Is(err, ErrNoReplay) {
+		t.Errorf("Expected ErrNoReplay, got %v", err)
+	}
+}
+
+// normalizeJSON encodes v with map keys sorted so that structs and decoded maps compare equal.
+func normalizeJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	var decoded interface{}
+	json.Unmarshal(data, &decoded)
+	data, _ = json.Marshal(decoded)
+	return string(data)
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+)
+
+// ErrRoundSettling is returned when a game action arrives while the last round is being settled.
+var ErrRoundSettling = errors.New("round is settling")
+
+// SettlementState 一局结束后的结算阶段，GameConfig.SettlementTime 为 0 时跳过。
+// 结算结果在进入前已随 GameEnd 广播，客户端在此期间展示结果，结束后回到等待状态
+type SettlementState struct {
+	RoomStateBase
+	Duration      time.Duration
+	RemainingTime time.Duration
+	lastUpdate    time.Time
+}
+
+// NewSettlementState 创建持续 duration 的结算状态
+func NewSettlementState(room RoomContext, duration time.Duration) *SettlementState {
+	return &SettlementState{
+		RoomStateBase: RoomStateBase{
+			ID:   "settlement",
+			Room: room,
+		},
+		Duration:      duration,
+		RemainingTime: duration,
+	}
+}
+
+// nextRoundState 返回一局结束后的状态：配置了结算时间时先进入结算状态展示结果，否则直接回到等待状态
+func nextRoundState(room RoomContext) State {
+	if settlement := room.GetGameConfig().SettlementTime; settlement > 0 {
+		return NewSettlementState(room, settlement)
+	}
+	return NewWaitingState(room)
+}
+
+// OnEnter 进入结算状态
+func (s *SettlementState) OnEnter() {
+	logger.Log.Infof("房间 %s 进入结算状态，结算时长: %v", s.Room.GetID(), s.Duration)
+	s.lastUpdate = time.Now()
+}
+
+// OnUpdate 结算时间用完后回到等待状态
+func (s *SettlementState) OnUpdate() {
+	now := time.Now()
+	s.RemainingTime -= now.Sub(s.lastUpdate)
+	s.lastUpdate = now
+	if s.RemainingTime > 0 {
+		return
+	}
+	if err := s.Room.ChangeState(NewWaitingState(s.Room)); err != nil {
+		logger.Log.Errorf("Room %s failed to leave settlement: %v", s.Room.GetID(), err)
+	}
+}
+
+// HandleAction 结算阶段不接受游戏动作
+func (s *SettlementState) HandleAction(player Player, actionData []byte) error {
+	return ErrRoundSettling
+}
@@ -0,0 +1,395 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/wfunc/gameserver/fairness"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+)
+
+const (
+	// sicBoDice 骰宝每局掷出的骰子数
+	sicBoDice = 3
+	// sicBoFaces 骰子的面数
+	sicBoFaces = 6
+)
+
+// 骰宝的下注类型
+const (
+	SicBoBig         = "big"         // 总点数 11-17，围骰不中
+	SicBoSmall       = "small"       // 总点数 4-10，围骰不中
+	SicBoTotal       = "total"       // 指定总点数 4-17
+	SicBoAnyTriple   = "any_triple"  // 任意围骰
+	SicBoTriple      = "triple"      // 指定围骰
+	SicBoDouble      = "double"      // 指定点数至少出现两次
+	SicBoCombination = "combination" // 指定两个不同的点数同时出现
+	SicBoSingle      = "single"      // 指定点数出现一到三次，按出现次数派奖
+)
+
+// ErrInvalidBetType 未知的下注类型，或下注的点数不符合该类型
+var ErrInvalidBetType = errors.New("invalid bet type")
+
+func init() {
+	RegisterGameModule(&SicBo{})
+}
+
+// SicBoPaytable 骰宝赔付表，赔率为赢时每 1 下注赢得的金额，派奖包括退回的下注
+type SicBoPaytable struct {
+	BigSmall    int64            `json:"big_small"`
+	Totals      map[int]int64    `json:"totals"` // 总点数 -> 赔率，未列出的总点数不能下注
+	AnyTriple   int64            `json:"any_triple"`
+	Triple      int64            `json:"triple"`
+	Double      int64            `json:"double"`
+	Combination int64            `json:"combination"`
+	Single      [sicBoDice]int64 `json:"single"` // 出现一次、两次、三次的赔率
+}
+
+// DefaultSicBoPaytable 返回常见的骰宝赔付表
+func DefaultSicBoPaytable() *SicBoPaytable {
+	return &SicBoPaytable{
+		BigSmall: 1,
+		Totals: map[int]int64{
+			4: 50, 5: 18, 6: 14, 7: 12, 8: 8, 9: 6, 10: 6,
+			11: 6, 12: 6, 13: 8, 14: 12, 15: 14, 16: 18, 17: 50,
+		},
+		AnyTriple:   24,
+		Triple:      150,
+		Double:      8,
+		Combination: 5,
+		Single:      [sicBoDice]int64{1, 2, 3},
+	}
+}
+
+// Validate 检查赔率都是正数，总点数在 4-17 之间
+func (p *SicBoPaytable) Validate() error {
+	odds := map[string]int64{
+		SicBoBig:         p.BigSmall,
+		SicBoAnyTriple:   p.AnyTriple,
+		SicBoTriple:      p.Triple,
+		SicBoDouble:      p.Double,
+		SicBoCombination: p.Combination,
+	}
+	for i, single := range p.Single {
+		odds[fmt.Sprintf("single x%d", i+1)] = single
+	}
+	for total, o := range p.Totals {
+		if total < 4 || total > 17 {
+			return fmt.Errorf("sic bo paytable has odds for total %d outside 4-17", total)
+		}
+		odds[fmt.Sprintf("total %d", total)] = o
+	}
+	for bet, o := range odds {
+		if o <= 0 {
+			return fmt.Errorf("sic bo paytable odds for %s must be positive, got %d", bet, o)
+		}
+	}
+	return nil
+}
+
+// Check 检查下注类型和点数，组合的两个点数按从小到大排列
+func (p *SicBoPaytable) Check(betType string, numbers []int) error {
+	face := func(n int) bool { return n >= 1 && n <= sicBoFaces }
+	var ok bool
+	switch betType {
+	case SicBoBig, SicBoSmall, SicBoAnyTriple:
+		ok = len(numbers) == 0
+	case SicBoTotal:
+		if len(numbers) == 1 {
+			_, ok = p.Totals[numbers[0]]
+		}
+	case SicBoTriple, SicBoDouble, SicBoSingle:
+		ok = len(numbers) == 1 && face(numbers[0])
+	case SicBoCombination:
+		ok = len(numbers) == 2 && face(numbers[0]) && face(numbers[1]) && numbers[0] != numbers[1]
+		slices.Sort(numbers)
+	}
+	if !ok {
+		return ErrInvalidBetType
+	}
+	return nil
+}
+
+// Payout 返回一注在 dice 下的派奖，包括退回的下注，没有赢时返回 0
+func (p *SicBoPaytable) Payout(betType string, numbers []int, amount int64, dice [sicBoDice]int) int64 {
+	var counts [sicBoFaces + 1]int
+	total := 0
+	for _, d := range dice {
+		counts[d]++
+		total += d
+	}
+	triple := counts[dice[0]] == sicBoDice
+
+	var odds int64
+	switch betType {
+	case SicBoBig:
+		if !triple && total >= 11 {
+			odds = p.BigSmall
+		}
+	case SicBoSmall:
+		if !triple && total <= 10 {
+			odds = p.BigSmall
+		}
+	case SicBoTotal:
+		if total == numbers[0] {
+			odds = p.Totals[total]
+		}
+	case SicBoAnyTriple:
+		if triple {
+			odds = p.AnyTriple
+		}
+	case SicBoTriple:
+		if triple && dice[0] == numbers[0] {
+			odds = p.Triple
+		}
+	case SicBoDouble:
+		if counts[numbers[0]] >= 2 {
+			odds = p.Double
+		}
+	case SicBoCombination:
+		if counts[numbers[0]] > 0 && counts[numbers[1]] > 0 {
+			odds = p.Combination
+		}
+	case SicBoSingle:
+		if n := counts[numbers[0]]; n > 0 {
+			odds = p.Single[n-1]
+		}
+	}
+	if odds == 0 {
+		return 0
+	}
+	return amount * (odds + 1)
+}
+
+// RTP 返回一种下注的理论返奖率，枚举全部 216 种骰子结果
+func (p *SicBoPaytable) RTP(betType string, numbers []int) float64 {
+	returned := int64(0)
+	outcomes := 0
+	for a := 1; a <= sicBoFaces; a++ {
+		for b := 1; b <= sicBoFaces; b++ {
+			for c := 1; c <= sicBoFaces; c++ {
+				returned += p.Payout(betType, numbers, 1, [sicBoDice]int{a, b, c})
+				outcomes++
+			}
+		}
+	}
+	return float64(returned) / float64(outcomes)
+}
+
+// SicBo 骰宝游戏模块：一局的时长即下注时间，房间内的玩家都可以下注，
+// 下注结束时由本局的随机数掷出三颗骰子并按赔付表结算所有下注
+type SicBo struct {
+	Paytable *SicBoPaytable // 为 nil 时使用 DefaultSicBoPaytable
+}
+
+// SicBoData 一局骰宝的游戏数据
+type SicBoData struct {
+	SeedHash string      `json:"server_seed_hash"`
+	Bets     []*SicBoBet `json:"bets"`
+	Dice     []int       `json:"dice,omitempty"` // 下注结束后掷出
+	Total    int         `json:"total,omitempty"`
+}
+
+// SicBoBet 一注，Payout 在掷骰后写入
+type SicBoBet struct {
+	PlayerID string `json:"player_id"`
+	UserID   int64  `json:"user_id,omitempty"`
+	Type     string `json:"type"`
+	Numbers  []int  `json:"numbers,omitempty"`
+	Amount   int64  `json:"amount"`
+	Payout   int64  `json:"payout"`
+}
+
+// sicBoAction bet 动作的参数
+type sicBoAction struct {
+	BetType string `json:"bet_type"`
+	Numbers []int  `json:"numbers,omitempty"`
+	Amount  int64  `json:"amount"`
+}
+
+// GameType 返回游戏类型
+func (m *SicBo) GameType() string {
+	return "sic_bo"
+}
+
+// Config 返回骰宝的默认节奏参数：有一人准备即开局，下注 20 秒，结算展示 5 秒
+func (m *SicBo) Config() GameConfig {
+	return GameConfig{
+		TickInterval:   100 * time.Millisecond,
+		RoundDuration:  20 * time.Second,
+		StartRule:      StartRule{Mode: StartMinPlayers, MinPlayers: 1},
+		SettlementTime: 5 * time.Second,
+	}
+}
+
+// InitData 开始一局的下注
+func (m *SicBo) InitData(s *GamingState) interface{} {
+	return &SicBoData{SeedHash: s.Fairness.Hash}
+}
+
+// RestoreData 从快照恢复下注，骰子在一局结束时才掷出，不需要恢复
+func (m *SicBo) RestoreData(s *GamingState, raw json.RawMessage) (interface{}, error) {
+	data := &SicBoData{}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, err
+	}
+	if data.SeedHash != s.Fairness.Hash {
+		return nil, fairness.ErrSeedMismatch
+	}
+	return data, nil
+}
+
+// HandleAction 处理 bet 动作，下注立即从余额中扣除并保存房间快照
+func (m *SicBo) HandleAction(s *GamingState, player Player, action Action, actionData []byte) error {
+	if action.Type != "bet" {
+		return nil
+	}
+	data, ok := s.GameData.(*SicBoData)
+	if !ok {
+		return nil
+	}
+
+	var params sicBoAction
+	if err := json.Unmarshal(actionData, &params); err != nil {
+		return err
+	}
+	if params.Amount <= 0 {
+		return ErrInvalidBet
+	}
+	if err := m.paytable().Check(params.BetType, params.Numbers); err != nil {
+		return err
+	}
+
+	var userID int64
+	if user, ok := player.(UserPlayer); ok {
+		userID = user.GetUserID()
+	}
+	if economy := s.Economy(); economy != nil {
+		if userID == 0 {
+			return ErrNoAccount
+		}
+		if err := economy.Wager(userID, params.Amount, "sic_bo_bet"); err != nil {
+			return err
+		}
+	}
+
+	data.Bets = append(data.Bets, &SicBoBet{
+		PlayerID: player.GetID(),
+		UserID:   userID,
+		Type:     params.BetType,
+		Numbers:  params.Numbers,
+		Amount:   params.Amount,
+	})
+	// 下注已经扣款，立即保存快照，重启后可以继续这一局或退还下注
+	s.Checkpoint()
+	s.SyncGameState()
+	return nil
+}
+
+// Results 下注结束，掷骰并结算每一注。派奖失败时只记录日志，由流水对账补发
+func (m *SicBo) Results(s *GamingState) map[string]interface{} {
+	data, ok := s.GameData.(*SicBoData)
+	if !ok {
+		return map[string]interface{}{"error": "invalid game data"}
+	}
+
+	var dice [sicBoDice]int
+	data.Dice, data.Total = make([]int, sicBoDice), 0
+	for i := range dice {
+		dice[i] = s.Rand.IntN(sicBoFaces) + 1
+		data.Dice[i] = dice[i]
+		data.Total += dice[i]
+	}
+
+	economy := s.Economy()
+	for _, bet := range data.Bets {
+		bet.Payout = m.paytable().Payout(bet.Type, bet.Numbers, bet.Amount, dice)
+		s.ObserveWager(bet.Amount, bet.Payout)
+		if economy == nil || bet.Payout == 0 {
+			continue
+		}
+		if err := economy.Payout(bet.UserID, bet.Payout, "sic_bo_payout"); err != nil {
+			logger.Log.Errorf("Failed to pay %d coins to user %d in room %s: %v", bet.Payout, bet.UserID, s.Room.GetID(), err)
+		}
+	}
+
+	return map[string]interface{}{
+		"dice":             data.Dice,
+		"total":            data.Total,
+		"bets":             data.Bets,
+		"server_seed_hash": data.SeedHash,
+	}
+}
+
+// PlayerResults 按第一次下注的顺序返回每个玩家本局的下注和派奖，用户重连前后的下注合并计算
+func (m *SicBo) PlayerResults(s *GamingState) []models.PlayerInfo {
+	data, ok := s.GameData.(*SicBoData)
+	if !ok {
+		return nil
+	}
+	return sicBoPlayers(data.Bets)
+}
+
+// AbortRound 退还快照中已扣除的下注，按原下注金额派还，作废的一局每个玩家都记为平局
+func (m *SicBo) AbortRound(s *GamingState, raw json.RawMessage) []models.PlayerInfo {
+	economy := s.Economy()
+	if economy == nil {
+		return nil
+	}
+	data := &SicBoData{}
+	if err := json.Unmarshal(raw, data); err != nil {
+		logger.Log.Errorf("Room %s cannot refund bets of an unreadable round %s: %v", s.Room.GetID(), raw, err)
+		return nil
+	}
+
+	var refunded []*SicBoBet
+	for _, bet := range data.Bets {
+		if bet.UserID == 0 || bet.Amount <= 0 {
+			continue
+		}
+		if err := economy.Payout(bet.UserID, bet.Amount, "sic_bo_refund"); err != nil {
+			logger.Log.Errorf("Failed to refund %d coins to user %d in room %s: %v", bet.Amount, bet.UserID, s.Room.GetID(), err)
+			continue
+		}
+		bet.Payout = bet.Amount
+		refunded = append(refunded, bet)
+	}
+	return sicBoPlayers(refunded)
+}
+
+// sicBoPlayers 按第一次下注的顺序合计每个玩家的下注和派奖
+func sicBoPlayers(bets []*SicBoBet) []models.PlayerInfo {
+	var players []models.PlayerInfo
+	index := make(map[string]int)
+	for _, bet := range bets {
+		key := bet.PlayerID
+		if bet.UserID != 0 {
+			key = fmt.Sprintf("user:%d", bet.UserID)
+		}
+		i, exists := index[key]
+		if !exists {
+			i = len(players)
+			index[key] = i
+			players = append(players, models.PlayerInfo{UserID: bet.UserID})
+		}
+		players[i].Points++
+		players[i].Bet += bet.Amount
+		players[i].Payout += bet.Payout
+	}
+	for i := range players {
+		players[i].Outcome = models.OutcomeOf(players[i].Bet, players[i].Payout)
+	}
+	return players
+}
+
+// paytable 返回生效的赔付表
+func (m *SicBo) paytable() *SicBoPaytable {
+	if m.Paytable == nil {
+		return DefaultSicBoPaytable()
+	}
+	return m.Paytable
+}
@@ -0,0 +1,203 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/models"
+)
+
+func TestSicBoPaytable_Payout(t *testing.T) {
+	p := DefaultSicBoPaytable()
+	tests := []struct {
+		betType string
+		numbers []int
+		dice    [3]int
+		payout  int64
+	}{
+		{SicBoBig, nil, [3]int{4, 5, 6}, 20},
+		{SicBoBig, nil, [3]int{1, 2, 3}, 0},
+		{SicBoBig, nil, [3]int{6, 6, 6}, 0}, // 围骰通杀大小
+		{SicBoSmall, nil, [3]int{1, 2, 3}, 20},
+		{SicBoTotal, []int{4}, [3]int{1, 1, 2}, 510},
+		{SicBoTotal, []int{10}, [3]int{1, 4, 5}, 70},
+		{SicBoAnyTriple, nil, [3]int{2, 2, 2}, 250},
+		{SicBoTriple, []int{2}, [3]int{2, 2, 2}, 1510},
+		{SicBoTriple, []int{3}, [3]int{2, 2, 2}, 0},
+		{SicBoDouble, []int{5}, [3]int{5, 1, 5}, 90},
+		{SicBoDouble, []int{5}, [3]int{5, 1, 4}, 0},
+		{SicBoCombination, []int{1, 4}, [3]int{4, 2, 1}, 60},
+		{SicBoCombination, []int{1, 4}, [3]int{4, 2, 4}, 0},
+		{SicBoSingle, []int{3}, [3]int{3, 1, 2}, 20},
+		{SicBoSingle, []int{3}, [3]int{3, 3, 3}, 40},
+	}
+	for _, tt := range tests {
+		if got := p.Payout(tt.betType, tt.numbers, 10, tt.dice); got != tt.payout {
+			t.Errorf("%s %v on %v: expected %d, got %d", tt.betType, tt.numbers, tt.dice, tt.payout, got)
+		}
+	}
+
+	// 大小押中 105 种结果，返奖率 210/216
+	if rtp := p.RTP(SicBoBig, nil); math.Abs(rtp-210.0/216) > 1e-9 {
+		t.Errorf("Expected big to return 97.22%%, got %.4f", rtp)
+	}
+	if err := p.Check(SicBoCombination, []int{2, 2}); !errors.Is(err, ErrInvalidBetType) {
+		t.Errorf("Expected a combination of one number to be rejected, got %v", err)
+	}
+	delete(p.Totals, 4)
+	if err := p.Check(SicBoTotal, []int{4}); !errors.Is(err, ErrInvalidBetType) {
+		t.Errorf("Expected a total missing from the paytable to be rejected, got %v", err)
+	}
+	p.Totals[3] = 100
+	if err := p.Validate(); err == nil {
+		t.Error("Expected odds for total 3 to be rejected")
+	}
+}
+
+// sicBoRoom is an economyRoom playing Sic Bo with a settlement phase.
+type sicBoRoom struct {
+	*economyRoom
+}
+
+func (r *sicBoRoom) GetGameType() string { return "sic_bo" }
+func (r *sicBoRoom) RoundSeed() string   { return "sic_bo" }
+
+func TestSicBo_BettingRoundAndSettlement(t *testing.T) {
+	economy := &mockEconomy{coins: map[int64]int64{42: 500, 43: 500}}
+	room := &sicBoRoom{economyRoom: &economyRoom{mockRoom: newMockRoom(DefaultStartRule()), economy: economy}}
+	room.config.SettlementTime = time.Minute
+	alice := &userPlayer{mockPlayer: mockPlayer{id: "alice"}, userID: 42}
+	bob := &userPlayer{mockPlayer: mockPlayer{id: "bob"}, userID: 43}
+	guest := &mockPlayer{id: "guest"}
+	room.players["alice"], room.players["bob"], room.players["guest"] = alice, bob, guest
+
+	s := NewGamingState(room, time.Minute)
+	room.stateMachine = NewBaseStateMachine(s)
+	for _, bet := range []struct {
+		player Player
+		action string
+		err    error
+	}{
+		{alice, `{"type":"bet","bet_type":"big","amount":100}`, nil},
+		{alice, `{"type":"bet","bet_type":"combination","numbers":[3,1],"amount":20}`, nil},
+		{bob, `{"type":"bet","bet_type":"small","amount":200}`, nil},
+		{bob, `{"type":"bet","bet_type":"single","numbers":[6],"amount":50}`, nil},
+		{bob, `{"type":"bet","bet_type":"triple","numbers":[7],"amount":50}`, ErrInvalidBetType},
+		{bob, `{"type":"bet","bet_type":"big","amount":0}`, ErrInvalidBet},
+		{guest, `{"type":"bet","bet_type":"big","amount":10}`, ErrNoAccount},
+	} {
+		if err := s.HandleAction(bet.player, []byte(bet.action)); !errors.Is(err, bet.err) {
+			t.Fatalf("%s: expected %v, got %v", bet.action, bet.err, err)
+		}
+	}
+	if err := s.HandleAction(bob, []byte(`{"type":"bet","bet_type":"big","amount":1000}`)); err == nil {
+		t.Fatal("Expected a bet above the balance to be rejected")
+	}
+	data := s.GameData.(*SicBoData)
+	if economy.coins[42] != 380 || economy.coins[43] != 250 || !slices.Equal(data.Bets[1].Numbers, []int{1, 3}) {
+		t.Fatalf("Expected bets to be charged when placed, balances %v, bets %+v", economy.coins, data.Bets)
+	}
+
+	// 下注时间结束后掷骰结算，进入结算状态
+	s.RemainingTime = 0
+	s.OnUpdate()
+	settlement, ok := room.stateMachine.GetCurrentState().(*SettlementState)
+	if !ok {
+		t.Fatalf("Expected the settlement state after the round, got %s", room.stateMachine.GetCurrentState().GetID())
+	}
+	if len(data.Dice) != 3 || data.Total != data.Dice[0]+data.Dice[1]+data.Dice[2] {
+		t.Fatalf("Expected three dice to be rolled, got %v (total %d)", data.Dice, data.Total)
+	}
+	paytable := DefaultSicBoPaytable()
+	dice := [3]int(data.Dice)
+	payouts := map[int64]int64{}
+	for _, bet := range data.Bets {
+		if expected := paytable.Payout(bet.Type, bet.Numbers, bet.Amount, dice); bet.Payout != expected {
+			t.Errorf("Expected %s on %v to pay %d, got %d", bet.Type, dice, expected, bet.Payout)
+		}
+		payouts[bet.UserID] += bet.Payout
+	}
+	if economy.coins[42] != 380+payouts[42] || economy.coins[43] != 250+payouts[43] {
+		t.Errorf("Expected payouts %v to be credited, balances %v", payouts, economy.coins)
+	}
+	record := room.records[0]
+	if len(record.Players) != 2 || record.Players[0].UserID != 42 || record.Players[0].Bet != 120 || record.Players[1].Points != 2 {
+		t.Errorf("Unexpected player results: %+v", record.Players)
+	}
+
+	// 结算期间不接受下注，结束后回到等待状态
+	if err := settlement.HandleAction(alice, []byte(`{"type":"bet","bet_type":"big","amount":10}`)); !errors.Is(err, ErrRoundSettling) {
+		t.Errorf("Expected ErrRoundSettling, got %v", err)
+	}
+	settlement.OnUpdate()
+	if room.stateMachine.GetCurrentState() != settlement {
+		t.Fatal("Expected the settlement to last its configured time")
+	}
+	settlement.RemainingTime = 0
+	settlement.OnUpdate()
+	if id := room.stateMachine.GetCurrentState().GetID(); id != "waiting" {
+		t.Fatalf("Expected the room to wait for the next round, got %s", id)
+	}
+
+	// 重放得到相同的骰子和派奖
+	raw, _ := json.Marshal(record)
+	var stored models.GameRecord
+	json.Unmarshal(raw, &stored)
+	replayed, err := Replay(&stored, &mockEconomy{coins: map[int64]int64{42: 500, 43: 500}})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if original, result := normalizeJSON(stored.Result), normalizeJSON(replayed.Result); original != result {
+		t.Errorf("Expected replay to reproduce the result\noriginal: %s\nreplayed: %s", original, result)
+	}
+}
+
+func TestSicBo_RestoreOrRefundBets(t *testing.T) {
+	economy := &mockEconomy{coins: map[int64]int64{42: 500}}
+	room := &sicBoRoom{economyRoom: &economyRoom{mockRoom: newMockRoom(DefaultStartRule()), economy: economy}}
+	alice := &userPlayer{mockPlayer: mockPlayer{id: "alice"}, userID: 42}
+	room.players["alice"] = alice
+
+	s := NewGamingState(room, time.Minute)
+	room.stateMachine = NewBaseStateMachine(s)
+	for _, action := range []string{
+		`{"type":"bet","bet_type":"big","amount":100}`,
+		`{"type":"bet","bet_type":"single","numbers":[2],"amount":50}`,
+	} {
+		if err := s.HandleAction(alice, []byte(action)); err != nil {
+			t.Fatalf("%s: %v", action, err)
+		}
+	}
+	raw, _ := json.Marshal(s.GameData)
+	round, err := s.RoundSnapshot()
+	if err != nil {
+		t.Fatalf("RoundSnapshot failed: %v", err)
+	}
+
+	// 快照完整时继续这一局，不重复扣款也不退款
+	restored := NewRestoredGamingState(room, time.Minute, 30*time.Second, raw, round)
+	if bets := restored.GameData.(*SicBoData).Bets; len(bets) != 2 || economy.coins[42] != 350 {
+		t.Fatalf("Expected the bets to be restored, got %+v with balance %d", bets, economy.coins[42])
+	}
+
+	// 无法恢复的一局退还下注，并记录为作废的一局
+	aborted := NewRestoredGamingState(room, time.Minute, 30*time.Second, raw, nil)
+	if aborted.GameData != nil {
+		t.Fatalf("Expected a new round after the abort, got %+v", aborted.GameData)
+	}
+	if economy.coins[42] != 500 {
+		t.Errorf("Expected the stakes to be refunded, balance %d", economy.coins[42])
+	}
+	if len(room.records) != 1 {
+		t.Fatalf("Expected the aborted round to be recorded, got %d records", len(room.records))
+	}
+	record := room.records[0]
+	player := record.Players[0]
+	if record.Result["aborted"] != true || len(record.Players) != 1 || player.UserID != 42 || player.Bet != 150 || player.Payout != 150 || player.Outcome != models.OutcomeDraw {
+		t.Errorf("Unexpected aborted round record: %+v", record)
+	}
+}
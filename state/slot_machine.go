@@ -0,0 +1,494 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wfunc/gameserver/fairness"
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+)
+
+const (
+	// DefaultSlotBet spin 动作未指定下注额时的下注
+	DefaultSlotBet = 10
+	// SlotJackpotPool 所有老虎机房间共享的累积奖池
+	SlotJackpotPool = "slot_machine"
+)
+
+var (
+	// ErrInvalidBet 下注额不是正数
+	ErrInvalidBet = errors.New("invalid bet")
+	// ErrItemNotUsable 物品不存在或不能用于 spin
+	ErrItemNotUsable = errors.New("item cannot be used to spin")
+	// ErrNoAccount 房间使用真实金币结算时，未登录的玩家不能下注
+	ErrNoAccount = errors.New("login required to bet")
+	// ErrNonceUsed 客户端种子和分配的 nonce 在本局中已经被其他玩家使用过
+	ErrNonceUsed = errors.New("client seed and nonce already used")
+)
+
+func init() {
+	RegisterGameModule(&SlotMachine{})
+}
+
+// SlotMachine 老虎机游戏模块，房间内每个玩家都可以随时 spin。
+// 使用其他赔付表时以新的实例重新注册
+type SlotMachine struct {
+	Paytable *Paytable // 为 nil 时使用 DefaultPaytable
+}
+
+// SlotData 一局老虎机的游戏数据
+type SlotData struct {
+	Reels      [slotReels]int         `json:"reels"`
+	SpinCount  int                    `json:"spin_count"`
+	LastResult map[string]interface{} `json:"last_result"`
+	Players    map[string]*SlotPlayer `json:"players"` // 按玩家ID统计本局的下注和派奖
+	SeedHash   string                 `json:"server_seed_hash"`
+	Spins      []fairness.Spin        `json:"spins"`            // 本局每次 spin 的种子、nonce 和转轴结果
+	Nonces     map[string]uint64      `json:"nonces,omitempty"` // 每个用户本局上一次分配的 nonce，重连后接着使用
+}
+
+// slotPublicData 广播给房间的老虎机数据，服务器种子公开前不包含每次 spin 的客户端种子和 nonce
+type slotPublicData struct {
+	*SlotData
+	Spins  []fairness.Spin   `json:"spins,omitempty"`
+	Nonces map[string]uint64 `json:"nonces,omitempty"`
+}
+
+// slotPrivate 只发给 spin 的玩家自己的种子和 nonce，一局结束后用于校验
+type slotPrivate struct {
+	Spin fairness.Spin `json:"spin"`
+}
+
+// SlotPlayer 一个玩家在本局老虎机中的累计下注和派奖
+type SlotPlayer struct {
+	UserID     int64      `json:"user_id"`
+	Spins      int        `json:"spins"`
+	FreeSpins  int        `json:"free_spins,omitempty"`  // 使用物品的 spin 次数，不计入 Bet
+	BonusSpins int        `json:"bonus_spins,omitempty"` // 分散符号奖励的免费 spin 次数，不计入 Bet
+	Bet        int64      `json:"bet"`
+	Payout     int64      `json:"payout"`
+	Nonce      uint64     `json:"nonce"`           // 本局上一次 spin 使用的 nonce
+	Bonus      *SlotBonus `json:"bonus,omitempty"` // 进行中的免费 spin 回合
+}
+
+// SlotBonus 分散符号触发的免费 spin 回合，是玩家在 GamingState 中的子状态。
+// 回合中的 spin 不扣费，以触发时的下注额计算派奖并乘以倍数，再次出现分散符号时追加次数
+type SlotBonus struct {
+	Remaining  int   `json:"remaining"`
+	Awarded    int   `json:"awarded"` // 包括追加在内奖励的总次数
+	Played     int   `json:"played"`
+	Bet        int64 `json:"bet"`
+	Multiplier int64 `json:"multiplier"`
+	Payout     int64 `json:"payout"` // 回合中累计的派奖
+}
+
+// GetID 返回子状态ID
+func (b *SlotBonus) GetID() string {
+	return "free_spins"
+}
+
+// spinAction spin 动作的参数。ClientSeed 默认为玩家ID，Nonce 由服务端分配，客户端不能指定
+type spinAction struct {
+	Bet        int64  `json:"bet"`
+	Item       string `json:"item,omitempty"` // 使用物品代替金币下注，例如 free_spin_ticket
+	ClientSeed string `json:"client_seed,omitempty"`
+	Nonce      uint64 `json:"-"`
+}
+
+// GameType 返回游戏类型
+func (m *SlotMachine) GameType() string {
+	return "slot_machine"
+}
+
+// Config 返回老虎机的默认节奏参数
+func (m *SlotMachine) Config() GameConfig {
+	return GameConfig{
+		TickInterval:  100 * time.Millisecond,
+		RoundDuration: 5 * time.Second,
+	}
+}
+
+// InitData 初始化一局老虎机的游戏数据
+func (m *SlotMachine) InitData(s *GamingState) interface{} {
+	return &SlotData{Players: make(map[string]*SlotPlayer), Nonces: make(map[string]uint64), SeedHash: s.Fairness.Hash}
+}
+
+// RestoreData 从快照恢复老虎机的游戏数据
+func (m *SlotMachine) RestoreData(s *GamingState, raw json.RawMessage) (interface{}, error) {
+	data := &SlotData{}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, err
+	}
+	if data.Players == nil {
+		data.Players = make(map[string]*SlotPlayer)
+	}
+	if data.Nonces == nil {
+		data.Nonces = make(map[string]uint64)
+	}
+	if data.SeedHash != s.Fairness.Hash {
+		return nil, fairness.ErrSeedMismatch
+	}
+	for id, stats := range data.Players {
+		if stats.Bonus != nil {
+			s.RestoreSubState(id, stats.Bonus)
+		}
+	}
+	return data, nil
+}
+
+// HandleAction 处理 spin 动作。玩家处于免费 spin 回合时不扣费，忽略下注额和物品
+func (m *SlotMachine) HandleAction(s *GamingState, player Player, action Action, actionData []byte) error {
+	if action.Type != "spin" {
+		return nil
+	}
+
+	var spin spinAction
+	if err := json.Unmarshal(actionData, &spin); err != nil {
+		return err
+	}
+	if spin.Bet == 0 {
+		spin.Bet = DefaultSlotBet
+	}
+	if spin.Bet < 0 {
+		return ErrInvalidBet
+	}
+
+	logger.Log.Infof("Player %s triggered a spin in room %s", player.GetID(), s.Room.GetID())
+	gameData, ok := s.GameData.(*SlotData)
+	if !ok {
+		return nil
+	}
+
+	var userID int64
+	if user, ok := player.(UserPlayer); ok {
+		userID = user.GetUserID()
+	}
+	stats, exists := gameData.Players[player.GetID()]
+	if !exists {
+		stats = &SlotPlayer{UserID: userID}
+	}
+	// nonce 由服务端按用户递增分配，同一组客户端种子和 nonce 在本局中只能使用一次
+	spin.Nonce = gameData.nextNonce(player.GetID(), stats.UserID)
+	if spin.ClientSeed == "" {
+		spin.ClientSeed = player.GetID()
+	}
+	if gameData.spinUsed(spin.ClientSeed, spin.Nonce) {
+		return ErrNonceUsed
+	}
+
+	if stats.Bonus == nil {
+		economy := s.Economy()
+		if err := m.charge(economy, userID, &spin); err != nil {
+			return err
+		}
+		// 奖池只与真实金币结算的房间共享，使用物品的 spin 不抽成
+		if jackpot := m.jackpot(s); jackpot != nil && spin.Item == "" {
+			if err := jackpot.Contribute(SlotJackpotPool, spin.Bet); err != nil {
+				logger.Log.Errorf("Failed to contribute to jackpot in room %s: %v", s.Room.GetID(), err)
+			}
+		}
+	}
+
+	gameData.Players[player.GetID()] = stats
+	m.play(s, gameData, player.GetID(), stats, spin)
+	// 广播不包含 spin 的输入，玩家从私有消息中得到自己的种子和 nonce
+	s.SendPrivate(player.GetID(), slotPrivate{Spin: gameData.Spins[len(gameData.Spins)-1]})
+	s.SyncGameState()
+	return nil
+}
+
+// PublicData 广播时隐藏本局 spin 的输入，服务器种子在一局结束时随公平性证明一起公开
+func (m *SlotMachine) PublicData(s *GamingState) interface{} {
+	data, ok := s.GameData.(*SlotData)
+	if !ok {
+		return s.GameData
+	}
+	return slotPublicData{SlotData: data}
+}
+
+// slotNonceKey 已登录的用户按 UserID 分配 nonce，重连后接着使用；游客按玩家ID分配
+func slotNonceKey(playerID string, userID int64) string {
+	if userID != 0 {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	return playerID
+}
+
+// nextNonce 返回玩家下一次 spin 的 nonce
+func (d *SlotData) nextNonce(playerID string, userID int64) uint64 {
+	return d.Nonces[slotNonceKey(playerID, userID)] + 1
+}
+
+// spinUsed 判断本局是否已有 spin 使用过这组客户端种子和 nonce
+func (d *SlotData) spinUsed(clientSeed string, nonce uint64) bool {
+	for _, spin := range d.Spins {
+		if spin.ClientSeed == clientSeed && spin.Nonce == nonce {
+			return true
+		}
+	}
+	return false
+}
+
+// play 转出一次已扣费的 spin 并结算：发放派奖和累积奖池，更新玩家的统计和免费 spin 回合
+func (m *SlotMachine) play(s *GamingState, gameData *SlotData, playerID string, stats *SlotPlayer, spin spinAction) {
+	paytable := m.paytable()
+	bonus := stats.Bonus
+	multiplier := int64(1)
+	if bonus != nil {
+		spin.Bet, spin.Item, multiplier = bonus.Bet, "", bonus.Multiplier
+	}
+
+	outcome := fairness.Ints(s.Fairness.ServerSeed, playerID, spin.ClientSeed, spin.Nonce, slotReels, paytable.Symbols)
+	reels := [slotReels]int(outcome)
+	gameData.Spins = append(gameData.Spins, fairness.Spin{
+		PlayerID:   playerID,
+		ClientSeed: spin.ClientSeed,
+		Nonce:      spin.Nonce,
+		Outcome:    outcome,
+	})
+	gameData.Reels = reels
+	gameData.SpinCount++
+	gameData.LastResult = m.calculateResult(reels, spin.Bet, multiplier)
+	payout := gameData.LastResult["payout"].(int64)
+	if spin.Item != "" {
+		gameData.LastResult["item"] = spin.Item
+	}
+	if bonus != nil {
+		gameData.LastResult["free_spin"] = true
+		// 免费 spin 不下注，只计入派奖，与包含免费 spin 的理论返奖率口径一致
+		s.ObserveWager(0, payout)
+	} else {
+		// 使用物品的 spin 按物品的下注额计入，与理论返奖率的口径一致，不含累积奖池
+		s.ObserveWager(spin.Bet, payout)
+	}
+
+	// 已经扣费，派奖失败时仍然记录本次结果，由流水对账补发
+	economy := s.Economy()
+	if economy != nil && payout > 0 {
+		reason := "slot_machine_payout"
+		if bonus != nil {
+			reason = "slot_machine_free_spin"
+		}
+		if err := economy.Payout(stats.UserID, payout, reason); err != nil {
+			logger.Log.Errorf("Failed to pay %d coins to user %d in room %s: %v", payout, stats.UserID, s.Room.GetID(), err)
+		}
+	}
+	won := m.claimJackpot(s, m.jackpot(s), stats.UserID, reels)
+	if won > 0 {
+		gameData.LastResult["jackpot"] = won
+	}
+
+	stats.Nonce = spin.Nonce
+	gameData.Nonces[slotNonceKey(playerID, stats.UserID)] = spin.Nonce
+	stats.Spins++
+	switch {
+	case bonus != nil:
+		stats.BonusSpins++
+		bonus.Played++
+		bonus.Remaining--
+		bonus.Payout += payout + won
+	case spin.Item != "":
+		stats.FreeSpins++
+	default:
+		stats.Bet += spin.Bet
+	}
+	stats.Payout += payout + won
+
+	if awarded := paytable.FreeSpinsFor(reels); awarded > 0 {
+		gameData.LastResult["free_spins_awarded"] = awarded
+		triggered := bonus == nil
+		if triggered {
+			bonus = &SlotBonus{Bet: spin.Bet, Multiplier: paytable.BonusMultiplier()}
+			stats.Bonus = bonus
+		}
+		bonus.Remaining += awarded
+		bonus.Awarded += awarded
+		if triggered {
+			s.EnterSubState(playerID, bonus)
+		}
+	}
+	if bonus != nil && bonus.Remaining == 0 {
+		stats.Bonus = nil
+		s.ExitSubState(playerID)
+	}
+}
+
+// OnPlayerJoin 用户重连后以新的玩家ID加入时，继续其在本局中未完成的免费 spin 回合
+func (m *SlotMachine) OnPlayerJoin(s *GamingState, player Player) {
+	gameData, ok := s.GameData.(*SlotData)
+	user, isUser := player.(UserPlayer)
+	if !ok || !isUser || user.GetUserID() == 0 {
+		return
+	}
+	if _, exists := gameData.Players[player.GetID()]; exists {
+		return
+	}
+
+	ids := make([]string, 0, len(gameData.Players))
+	for id := range gameData.Players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		previous := gameData.Players[id]
+		if previous.UserID != user.GetUserID() || previous.Bonus == nil {
+			continue
+		}
+		gameData.Players[player.GetID()] = &SlotPlayer{UserID: previous.UserID, Bonus: previous.Bonus}
+		previous.Bonus = nil
+		s.MoveSubState(id, player.GetID())
+		s.SyncGameState()
+		return
+	}
+}
+
+// jackpot 返回房间的累积奖池，奖池只在使用真实金币结算的房间中生效
+func (m *SlotMachine) jackpot(s *GamingState) Jackpot {
+	if s.Economy() == nil {
+		return nil
+	}
+	return s.Jackpot()
+}
+
+// charge 扣除一次 spin 的费用：使用物品时消耗一个物品，下注额取物品的 spin_bet 效果，
+// 否则扣除下注的金币。房间没有经济系统时不扣费，也不能使用物品
+func (m *SlotMachine) charge(economy Economy, userID int64, spin *spinAction) error {
+	if economy == nil {
+		if spin.Item != "" {
+			return ErrItemNotUsable
+		}
+		return nil
+	}
+	if userID == 0 {
+		return ErrNoAccount
+	}
+
+	if spin.Item == "" {
+		return economy.Wager(userID, spin.Bet, "slot_machine_bet")
+	}
+	def, ok := economy.Item(spin.Item)
+	bet := def.EffectInt("spin_bet")
+	if !ok || bet <= 0 {
+		return ErrItemNotUsable
+	}
+	if err := economy.ConsumeItem(userID, spin.Item, "slot_machine_spin"); err != nil {
+		return err
+	}
+	spin.Bet = bet
+	return nil
+}
+
+// claimJackpot 转轴结果赢得累积奖池时领取奖池，返回领取的金额。
+// 奖池由奖池服务直接计入玩家的金币，领取失败时只记录日志
+func (m *SlotMachine) claimJackpot(s *GamingState, jackpot Jackpot, userID int64, reels [slotReels]int) int64 {
+	if jackpot == nil || !m.paytable().IsJackpot(reels) {
+		return 0
+	}
+	won, err := jackpot.Claim(SlotJackpotPool, userID, s.Room.GetID())
+	if err != nil {
+		logger.Log.Errorf("Failed to claim jackpot for user %d in room %s: %v", userID, s.Room.GetID(), err)
+		return 0
+	}
+	logger.Log.Infof("User %d won the %s jackpot of %d coins in room %s", userID, SlotJackpotPool, won, s.Room.GetID())
+	return won
+}
+
+// Results 计算一局老虎机的结算结果。一局结束时未用完的免费 spin 按玩家ID顺序自动完成
+func (m *SlotMachine) Results(s *GamingState) map[string]interface{} {
+	gameData, ok := s.GameData.(*SlotData)
+	if !ok {
+		return map[string]interface{}{"error": "invalid game data"}
+	}
+	m.finishBonuses(s, gameData)
+
+	finalResult := map[string]interface{}{
+		"final_spin_count": gameData.SpinCount,
+		"last_win":         nil,
+	}
+
+	if gameData.LastResult != nil {
+		finalResult["last_win"] = gameData.LastResult["win"]
+	}
+	// 一局结束后公开服务器种子，随游戏记录保存
+	finalResult[fairness.ResultKey] = &fairness.Proof{
+		ServerSeed:     s.Fairness.ServerSeed,
+		ServerSeedHash: s.Fairness.Hash,
+		Range:          m.paytable().Symbols,
+		Spins:          gameData.Spins,
+	}
+
+	return finalResult
+}
+
+// PlayerResults 返回本局每个 spin 过的玩家的下注和派奖，按玩家ID排序
+func (m *SlotMachine) PlayerResults(s *GamingState) []models.PlayerInfo {
+	gameData, ok := s.GameData.(*SlotData)
+	if !ok {
+		return nil
+	}
+
+	ids := make([]string, 0, len(gameData.Players))
+	for id := range gameData.Players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	players := make([]models.PlayerInfo, 0, len(ids))
+	for _, id := range ids {
+		stats := gameData.Players[id]
+		players = append(players, models.PlayerInfo{
+			UserID:  stats.UserID,
+			Outcome: models.OutcomeOf(stats.Bet, stats.Payout),
+			Points:  stats.Spins,
+			Bet:     stats.Bet,
+			Payout:  stats.Payout,
+		})
+	}
+	return players
+}
+
+// finishBonuses 以玩家ID为客户端种子、接着分配 nonce 完成所有未用完的免费 spin，跳过本局已使用过的组合
+func (m *SlotMachine) finishBonuses(s *GamingState, gameData *SlotData) {
+	ids := make([]string, 0, len(gameData.Players))
+	for id := range gameData.Players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		stats := gameData.Players[id]
+		for stats.Bonus != nil {
+			nonce := gameData.nextNonce(id, stats.UserID)
+			for gameData.spinUsed(id, nonce) {
+				nonce++
+			}
+			m.play(s, gameData, id, stats, spinAction{ClientSeed: id, Nonce: nonce})
+		}
+	}
+}
+
+// paytable 返回生效的赔付表
+func (m *SlotMachine) paytable() *Paytable {
+	if m.Paytable == nil {
+		return DefaultPaytable()
+	}
+	return m.Paytable
+}
+
+// calculateResult 按赔付表计算一次 spin 的派奖，multiplier 为免费 spin 的派奖倍数
+func (m *SlotMachine) calculateResult(reels [slotReels]int, bet, multiplier int64) map[string]interface{} {
+	payout := m.paytable().Multiplier(reels) * bet * multiplier
+	result := map[string]interface{}{
+		"win":     payout > 0,
+		"bet":     bet,
+		"payout":  payout,
+		"symbols": reels,
+	}
+	if multiplier > 1 {
+		result["multiplier"] = multiplier
+	}
+	return result
+}
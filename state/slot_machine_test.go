@@ -0,0 +1,353 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/wfunc/gameserver/fairness"
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/network"
+)
+
+// userPlayer is a mockPlayer bound to a user account.
+type userPlayer struct {
+	mockPlayer
+	userID int64
+}
+
+func (p *userPlayer) GetUserID() int64 { return p.userID }
+
+func TestSlotMachine_CalculateResult(t *testing.T) {
+	m := &SlotMachine{}
+	tests := []struct {
+		reels      [3]int
+		multiplier int64
+		payout     int64
+	}{
+		{[3]int{7, 7, 7}, 1, 2000},
+		{[3]int{1, 1, 1}, 1, 200},
+		{[3]int{1, 1, 1}, 2, 400},
+		{[3]int{1, 2, 3}, 2, 0},
+	}
+	for _, tt := range tests {
+		result := m.calculateResult(tt.reels, 20, tt.multiplier)
+		if result["payout"] != tt.payout {
+			t.Errorf("Reels %v: expected payout %d, got %v", tt.reels, tt.payout, result["payout"])
+		}
+	}
+}
+
+// slotMachineWithoutBonus 使用没有分散符号的默认赔付表，随机种子不会触发免费 spin
+func slotMachineWithoutBonus() *SlotMachine {
+	paytable := DefaultPaytable()
+	paytable.Scatter = nil
+	return &SlotMachine{Paytable: paytable}
+}
+
+func TestSlotMachine_InvalidBet(t *testing.T) {
+	room := newMockRoom(DefaultStartRule(), "p1")
+	s := NewGamingState(room, 0)
+	s.module = &SlotMachine{}
+	s.OnEnter()
+
+	err := s.HandleAction(room.players["p1"], []byte(`{"type":"spin","bet":-5}`))
+	if err != ErrInvalidBet {
+		t.Errorf("Expected ErrInvalidBet, got %v", err)
+	}
+}
+
+func TestGamingState_RecordsRoundOnEnd(t *testing.T) {
+	room := newMockRoom(DefaultStartRule())
+	alice := &userPlayer{mockPlayer: mockPlayer{id: "alice"}, userID: 42}
+	room.players["alice"] = alice
+
+	s := NewGamingState(room, 0)
+	s.module = slotMachineWithoutBonus()
+	room.stateMachine = NewBaseStateMachine(s)
+	s.OnEnter()
+
+	if err := s.HandleAction(alice, []byte(`{"type":"spin","bet":20}`)); err != nil {
+		t.Fatalf("Spin failed: %v", err)
+	}
+	if err := s.HandleAction(alice, []byte(`{"type":"spin"}`)); err != nil {
+		t.Fatalf("Spin failed: %v", err)
+	}
+	s.OnUpdate()
+
+	if len(room.records) != 1 {
+		t.Fatalf("Expected one game record, got %d", len(room.records))
+	}
+	record := room.records[0]
+	if record.RoomID != "mock_room" || record.StartTime.IsZero() || record.EndTime.Before(record.StartTime) {
+		t.Errorf("Unexpected record header: %+v", record)
+	}
+	if len(record.Players) != 1 {
+		t.Fatalf("Expected one player in the record, got %d", len(record.Players))
+	}
+	info := record.Players[0]
+	if info.UserID != 42 || info.Bet != 20+DefaultSlotBet || info.Points != 2 {
+		t.Errorf("Unexpected player info: %+v", info)
+	}
+	if info.Outcome != models.OutcomeOf(info.Bet, info.Payout) {
+		t.Errorf("Outcome %s does not match bet %d and payout %d", info.Outcome, info.Bet, info.Payout)
+	}
+}
+
+// mockEconomy keeps coins and items in memory.
+type mockEconomy struct {
+	coins map[int64]int64
+	items map[int64]map[string]int64
+}
+
+func (e *mockEconomy) Wager(userID, amount int64, reason string) error {
+	if e.coins[userID] < amount {
+		return errors.New("insufficient coins")
+	}
+	e.coins[userID] -= amount
+	return nil
+}
+
+func (e *mockEconomy) Payout(userID, amount int64, reason string) error {
+	e.coins[userID] += amount
+	return nil
+}
+
+func (e *mockEconomy) Balance(userID int64) (int64, error) {
+	return e.coins[userID], nil
+}
+
+func (e *mockEconomy) Item(itemID string) (models.ItemDef, bool) {
+	if itemID != "free_spin_ticket" {
+		return models.ItemDef{}, false
+	}
+	return models.ItemDef{ID: itemID, Effects: map[string]interface{}{"spin_bet": 5}}, true
+}
+
+func (e *mockEconomy) ConsumeItem(userID int64, itemID, reason string) error {
+	if e.items[userID][itemID] == 0 {
+		return errors.New("insufficient items")
+	}
+	e.items[userID][itemID]--
+	return nil
+}
+
+// economyRoom is a mockRoom that settles spins through a mockEconomy.
+type economyRoom struct {
+	*mockRoom
+	economy *mockEconomy
+}
+
+func (r *economyRoom) Economy() Economy { return r.economy }
+
+// RoundSeed fixes the reels so that none of the spins in these tests wins.
+func (r *economyRoom) RoundSeed() string { return "economy_room" }
+
+func TestSlotMachine_SpinsAreCharged(t *testing.T) {
+	economy := &mockEconomy{
+		coins: map[int64]int64{42: 15},
+		items: map[int64]map[string]int64{42: {"free_spin_ticket": 1}},
+	}
+	room := &economyRoom{mockRoom: newMockRoom(DefaultStartRule()), economy: economy}
+	alice := &userPlayer{mockPlayer: mockPlayer{id: "alice"}, userID: 42}
+	guest := &mockPlayer{id: "guest"}
+
+	s := NewGamingState(room, 0)
+	s.module = slotMachineWithoutBonus()
+	s.OnEnter()
+	data := s.GameData.(*SlotData)
+
+	if err := s.HandleAction(alice, []byte(`{"type":"spin","bet":10}`)); err != nil {
+		t.Fatalf("Spin failed: %v", err)
+	}
+	if want := 5 + data.Players["alice"].Payout; economy.coins[42] != want {
+		t.Errorf("Expected balance %d after the bet and payout, got %d", want, economy.coins[42])
+	}
+
+	// 余额不足时用免费券 spin，券只能用一次
+	if err := s.HandleAction(alice, []byte(`{"type":"spin","bet":1000}`)); err == nil {
+		t.Error("Expected a spin without enough coins to fail")
+	}
+	if err := s.HandleAction(alice, []byte(`{"type":"spin","item":"free_spin_ticket"}`)); err != nil {
+		t.Fatalf("Free spin failed: %v", err)
+	}
+	if err := s.HandleAction(alice, []byte(`{"type":"spin","item":"free_spin_ticket"}`)); err == nil {
+		t.Error("Expected a second free spin without a ticket to fail")
+	}
+	stats := data.Players["alice"]
+	if stats.Spins != 2 || stats.FreeSpins != 1 || stats.Bet != 10 {
+		t.Errorf("Expected 2 spins, 1 free and 10 coins bet, got %+v", stats)
+	}
+
+	if err := s.HandleAction(alice, []byte(`{"type":"spin","item":"gold_bar"}`)); err != ErrItemNotUsable {
+		t.Errorf("Expected ErrItemNotUsable for an unknown item, got %v", err)
+	}
+	if err := s.HandleAction(guest, []byte(`{"type":"spin"}`)); err != ErrNoAccount {
+		t.Errorf("Expected ErrNoAccount for a guest, got %v", err)
+	}
+}
+
+func TestSlotMachine_ItemsNeedEconomy(t *testing.T) {
+	room := newMockRoom(DefaultStartRule(), "p1")
+	s := NewGamingState(room, 0)
+	s.module = &SlotMachine{}
+	s.OnEnter()
+
+	err := s.HandleAction(room.players["p1"], []byte(`{"type":"spin","item":"free_spin_ticket"}`))
+	if err != ErrItemNotUsable {
+		t.Errorf("Expected ErrItemNotUsable without an economy, got %v", err)
+	}
+}
+
+// privateRoom is a mockRoom that keeps the last synced game data and each player's private messages.
+type privateRoom struct {
+	*mockRoom
+	synced  []byte
+	private map[string][]byte
+}
+
+func (r *privateRoom) Broadcast(msgID uint16, data []byte) error {
+	if msgID == network.MsgTypeGameSync {
+		r.synced = data
+	}
+	return r.mockRoom.Broadcast(msgID, data)
+}
+
+func (r *privateRoom) SendToPlayer(playerID string, msgID uint16, data []byte) error {
+	r.private[playerID] = data
+	return nil
+}
+
+func TestSlotMachine_ProvablyFair(t *testing.T) {
+	room := &privateRoom{mockRoom: newMockRoom(DefaultStartRule(), "p1", "p2"), private: make(map[string][]byte)}
+	s := NewGamingState(room, 0)
+	s.module = slotMachineWithoutBonus()
+	room.stateMachine = NewBaseStateMachine(s)
+	s.OnEnter()
+
+	data := s.GameData.(*SlotData)
+	if data.SeedHash != fairness.HashSeed(s.Fairness.ServerSeed) {
+		t.Fatalf("Expected the seed hash to be published at round start")
+	}
+	// 找到让 p1 第一次 spin 中奖的客户端种子
+	paytable := DefaultPaytable()
+	lucky := 0
+	for paytable.Multiplier([slotReels]int(fairness.Ints(s.Fairness.ServerSeed, "p1", fmt.Sprint(lucky), 1, slotReels, 8))) == 0 {
+		lucky++
+	}
+	winning := fmt.Sprintf(`{"type":"spin","client_seed":"%d"}`, lucky)
+	if err := s.HandleAction(room.players["p1"], []byte(winning)); err != nil {
+		t.Fatalf("Spin failed: %v", err)
+	}
+	if !data.LastResult["win"].(bool) {
+		t.Fatalf("Expected p1 to win with client seed %d", lucky)
+	}
+
+	// 其他玩家不能重放中奖的客户端种子和 nonce
+	if err := s.HandleAction(room.players["p2"], []byte(winning)); !errors.Is(err, ErrNonceUsed) {
+		t.Errorf("Expected ErrNonceUsed for a replayed pair, got %v", err)
+	}
+	// nonce 由服务端分配，客户端指定的 nonce 被忽略
+	if err := s.HandleAction(room.players["p2"], []byte(`{"type":"spin","nonce":7}`)); err != nil {
+		t.Fatalf("Spin failed: %v", err)
+	}
+	if err := s.HandleAction(room.players["p1"], []byte(`{"type":"spin"}`)); err != nil {
+		t.Fatalf("Spin failed: %v", err)
+	}
+	if spins := data.Spins; len(spins) != 3 || spins[1].Nonce != 1 || spins[2].Nonce != 2 || spins[2].ClientSeed != "p1" {
+		t.Fatalf("Expected server-assigned nonces and the default client seed, got %+v", spins)
+	}
+
+	// 广播不包含 spin 的输入，spin 的玩家私下收到自己的种子和 nonce
+	if strings.Contains(string(room.synced), "client_seed") || strings.Contains(string(room.synced), "nonces") {
+		t.Errorf("Expected spin inputs to stay out of the broadcast, got %s", room.synced)
+	}
+	var private slotPrivate
+	if err := json.Unmarshal(room.private["p2"], &private); err != nil || private.Spin.PlayerID != "p2" || private.Spin.Nonce != 1 {
+		t.Errorf("Expected p2 to receive its own spin, got %s (err: %v)", room.private["p2"], err)
+	}
+	s.OnUpdate()
+
+	proof, err := fairness.VerifyRecord(room.records[0])
+	if err != nil {
+		t.Fatalf("Expected the round record to verify, got %v", err)
+	}
+	if len(proof.Spins) != 3 || proof.Spins[0].ClientSeed != fmt.Sprint(lucky) || proof.Spins[0].Nonce != 1 {
+		t.Errorf("Unexpected proof: %+v", proof)
+	}
+}
+
+func TestSlotMachine_FreeSpins(t *testing.T) {
+	economy := &mockEconomy{coins: map[int64]int64{42: 100}}
+	room := &jackpotRoom{
+		economyRoom: &economyRoom{mockRoom: newMockRoom(DefaultStartRule()), economy: economy},
+		jackpot:     &mockJackpot{},
+	}
+	alice := &userPlayer{mockPlayer: mockPlayer{id: "alice"}, userID: 42}
+	room.players["alice"] = alice
+
+	s := NewGamingState(room, 0)
+	room.stateMachine = NewBaseStateMachine(s)
+	s.OnEnter()
+	data := s.GameData.(*SlotData)
+	paytable := DefaultPaytable()
+
+	// 找到本局种子下第一次 spin 转出分散符号的客户端种子
+	seed := 0
+	for paytable.FreeSpinsFor([slotReels]int(fairness.Ints(s.Fairness.ServerSeed, "alice", fmt.Sprint(seed), 1, slotReels, 8))) == 0 {
+		seed++
+	}
+	if err := s.HandleAction(alice, []byte(fmt.Sprintf(`{"type":"spin","bet":10,"client_seed":"%d"}`, seed))); err != nil {
+		t.Fatalf("Spin failed: %v", err)
+	}
+	bonus := data.Players["alice"].Bonus
+	if bonus == nil || bonus.Remaining < 3 || bonus.Bet != 10 || bonus.Multiplier != 2 {
+		t.Fatalf("Expected the scatters to start a free spin round, got %+v", bonus)
+	}
+	if s.SubState("alice") != bonus || room.broadcasts[network.MsgTypeSubStateEnter] != 1 {
+		t.Errorf("Expected alice to enter the free_spins sub state")
+	}
+
+	// 免费 spin 不扣费，忽略下注额
+	balance := economy.coins[42]
+	if err := s.HandleAction(alice, []byte(`{"type":"spin","bet":1000}`)); err != nil {
+		t.Fatalf("Free spin failed: %v", err)
+	}
+	stats := data.Players["alice"]
+	if stats.Bet != 10 || stats.BonusSpins != 1 || bonus.Played != 1 || data.LastResult["bet"] != int64(10) {
+		t.Errorf("Expected a free spin at the triggering bet, got %+v and %+v", stats, data.LastResult)
+	}
+	if economy.coins[42] != balance+data.LastResult["payout"].(int64) {
+		t.Errorf("Expected only the free spin payout to change the balance")
+	}
+
+	// 重连后以新的玩家ID继续免费 spin
+	again := &userPlayer{mockPlayer: mockPlayer{id: "alice-2"}, userID: 42}
+	room.players["alice-2"] = again
+	s.OnPlayerJoin(again)
+	if data.Players["alice"].Bonus != nil || data.Players["alice-2"].Bonus != bonus || s.SubState("alice-2") != bonus {
+		t.Fatalf("Expected the free spin round to move to the new session")
+	}
+	if err := s.HandleAction(again, []byte(`{"type":"spin"}`)); err != nil {
+		t.Fatalf("Free spin failed: %v", err)
+	}
+
+	// 一局结束时自动完成剩余的免费 spin
+	s.OnUpdate()
+	if data.Players["alice-2"].Bonus != nil || room.broadcasts[network.MsgTypeSubStateExit] != 1 {
+		t.Errorf("Expected the remaining free spins to finish at round end")
+	}
+	if bonus.Remaining != 0 || bonus.Played < bonus.Awarded {
+		t.Errorf("Expected every awarded free spin to be played, got %+v", bonus)
+	}
+
+	replayed, err := Replay(room.records[0], &mockEconomy{coins: map[int64]int64{42: 100}})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if original, result := normalizeJSON(room.records[0].Result), normalizeJSON(replayed.Result); original != result {
+		t.Errorf("Expected replay to reproduce the free spins\noriginal: %s\nreplayed: %s", original, result)
+	}
+}
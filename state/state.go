@@ -3,9 +3,6 @@ package state
 import (
 	"errors"
 	"sync"
-	"time"
-
-	"github.com/wfunc/gameserver/logger"
 )
 
 // 状态机接口
@@ -43,25 +40,29 @@ func NewBaseStateMachine(initialState State) *BaseStateMachine {
 	return machine
 }
 
+// ChangeState 切换状态。OnExit/OnEnter 在锁外调用，
+// 状态可以在回调中读取当前状态或再次切换，而不会死锁。
 func (sm *BaseStateMachine) ChangeState(newState State) error {
 	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
-
-	currentID := sm.currentState.GetID()
+	oldState := sm.currentState
+	currentID := oldState.GetID()
 	newID := newState.GetID()
 
 	// 检查是否有转换条件
 	if conditions, exists := sm.transitions[currentID]; exists {
 		if condition, exists := conditions[newID]; exists {
 			if condition != nil && !condition() {
+				sm.mutex.Unlock()
 				return ErrTransitionNotAllowed
 			}
 		}
 	}
 
-	sm.currentState.OnExit()
 	sm.currentState = newState
-	sm.currentState.OnEnter()
+	sm.mutex.Unlock()
+
+	oldState.OnExit()
+	newState.OnEnter()
 
 	return nil
 }
@@ -113,55 +114,3 @@ func (s *RoomStateBase) HandleAction(player Player, actionData []byte) error {
 	// 默认实现，具体状态可以覆盖此方法
 	return nil
 }
-
-// NewWaitingState creates a new waiting state.
-func NewWaitingState(room RoomContext) *WaitingState {
-	return &WaitingState{
-		RoomStateBase: RoomStateBase{
-			ID:   "waiting",
-			Room: room,
-		},
-	}
-}
-
-// 等待状态
-type WaitingState struct {
-	RoomStateBase
-	timer int
-}
-
-func (s *WaitingState) OnEnter() {
-	s.timer = 100 // 10 seconds at 10fps
-}
-
-func (s *WaitingState) OnUpdate() {
-	s.timer--
-	if s.timer <= 0 {
-		// 切换到游戏状态
-		gamingState := NewGamingState(s.Room, 5*time.Second) // 假设游戏时长30秒
-		s.Room.ChangeState(gamingState)
-	}
-
-	// 如果房间已满，立即开始游戏
-	if len(s.Room.GetPlayers()) >= s.Room.GetMaxPlayers() {
-		gamingState := NewGamingState(s.Room, 5*time.Second) // 假设游戏时长5秒
-		s.Room.ChangeState(gamingState)
-	}
-}
-
-// HandleAction 处理玩家在等待状态的动作
-func (s *WaitingState) HandleAction(player Player, actionData []byte) error {
-	logger.Log.Infof("WaitingState received action from player %s, transitioning to GamingState", player.GetID())
-	
-	// 当玩家发送游戏动作时，立即开始游戏
-	// 这解决了玩家在等待期间发送动作被忽略的问题
-	gamingState := NewGamingState(s.Room, 5*time.Second)
-	if err := s.Room.ChangeState(gamingState); err != nil {
-		logger.Log.Errorf("Failed to change state to GamingState: %v", err)
-		return err
-	}
-	
-	logger.Log.Info("Successfully transitioned to GamingState, forwarding action")
-	// 将动作转发给新的游戏状态处理
-	return gamingState.HandleAction(player, actionData)
-}
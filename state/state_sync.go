@@ -0,0 +1,230 @@
+package state
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/network"
+)
+
+const (
+	// StateAckAction 客户端确认收到状态的动作类型，参数为 seq
+	StateAckAction = "state_ack"
+	// stateSyncWindow 每个玩家保留的未确认状态数，确认落后更多时改为发送完整快照
+	stateSyncWindow = 32
+)
+
+// StateSyncer is an optional interface for game modules that use state sync:
+// instead of broadcasting the whole GameData, SyncGameState sends every player
+// a delta against the last state that player acknowledged. It needs a room that
+// implements PlayerMessenger; otherwise the full GameData is broadcast as before.
+type StateSyncer interface {
+	// SyncState 返回同步给客户端的状态，必须能编码为 JSON 对象
+	SyncState(s *GamingState) interface{}
+}
+
+// StateUpdate 状态同步的消息。Full 时 State 为完整状态，否则为相对第 Base 次状态的
+// JSON merge patch(RFC 7386)：变化的字段给出新值，删除的字段为 null，数组整体替换。
+// 客户端需要保留收到的状态直到确认了更新的状态，并以 state_ack 确认 Seq
+type StateUpdate struct {
+	Seq   uint64      `json:"seq"`
+	Base  uint64      `json:"base,omitempty"`
+	Full  bool        `json:"full,omitempty"`
+	State interface{} `json:"state"`
+}
+
+// stateAck state_ack 动作的参数
+type stateAck struct {
+	Seq uint64 `json:"seq"`
+}
+
+// stateSync 记录每个玩家已确认的状态，作为下一次增量的基准
+type stateSync struct {
+	seq     uint64
+	clients map[string]*syncClient
+}
+
+// syncClient 一个玩家已发送但未确认的状态和最近确认的状态
+type syncClient struct {
+	sent  []syncedState
+	acked *syncedState
+}
+
+type syncedState struct {
+	seq   uint64
+	state interface{} // 解码后的 JSON，可以直接比较
+}
+
+// stateSyncer 返回实现 StateSyncer 的游戏模块，房间不能单独发送消息时返回 nil
+func (s *GamingState) stateSyncer() StateSyncer {
+	syncer, ok := s.module.(StateSyncer)
+	if _, canSend := s.Room.(PlayerMessenger); !ok || !canSend {
+		return nil
+	}
+	return syncer
+}
+
+// syncStates 向房间内的每个玩家发送状态：已确认过且未落后太多的玩家收到增量，其他玩家收到完整快照
+func (s *GamingState) syncStates(syncer StateSyncer) {
+	current, err := normalizeState(syncer.SyncState(s))
+	if err != nil {
+		logger.Log.Errorf("Failed to encode sync state: %v", err)
+		return
+	}
+	if s.sync == nil {
+		s.sync = &stateSync{clients: make(map[string]*syncClient)}
+	}
+	s.sync.seq++
+	for id := range s.Room.GetPlayers() {
+		s.sendState(id, current)
+	}
+}
+
+// sendState 向一个玩家发送第 s.sync.seq 次状态
+func (s *GamingState) sendState(playerID string, current interface{}) {
+	client, ok := s.sync.clients[playerID]
+	if !ok {
+		client = &syncClient{}
+		s.sync.clients[playerID] = client
+	}
+
+	update := StateUpdate{Seq: s.sync.seq, Full: true, State: current}
+	if base := client.acked; base != nil && s.sync.seq-base.seq <= stateSyncWindow {
+		update = StateUpdate{Seq: s.sync.seq, Base: base.seq, State: mergePatch(base.state, current)}
+	}
+	client.sent = append(client.sent, syncedState{seq: s.sync.seq, state: current})
+	if len(client.sent) > stateSyncWindow {
+		client.sent = client.sent[len(client.sent)-stateSyncWindow:]
+	}
+
+	data, err := json.Marshal(update)
+	if err != nil {
+		logger.Log.Errorf("Failed to marshal state update: %v", err)
+		return
+	}
+	if err := s.Room.(PlayerMessenger).SendToPlayer(playerID, network.MsgTypeStateUpdate, data); err != nil {
+		logger.Log.Warnf("Room %s failed to send state to player %s: %v", s.Room.GetID(), playerID, err)
+	}
+}
+
+// ackState 记录玩家确认的状态，之后的增量以它为基准。确认的状态已不在保留范围内时忽略
+func (s *GamingState) ackState(player Player, actionData []byte) error {
+	var ack stateAck
+	if err := json.Unmarshal(actionData, &ack); err != nil {
+		return err
+	}
+	if s.sync == nil {
+		return nil
+	}
+	client, ok := s.sync.clients[player.GetID()]
+	if !ok {
+		return nil
+	}
+	for i, sent := range client.sent {
+		if sent.seq == ack.Seq {
+			client.acked = &sent
+			client.sent = client.sent[i+1:]
+			return nil
+		}
+	}
+	return nil
+}
+
+// resyncPlayer 丢弃玩家的基准并立即发送完整快照，用于玩家加入或重连
+func (s *GamingState) resyncPlayer(playerID string) {
+	syncer := s.stateSyncer()
+	if syncer == nil || s.GameData == nil {
+		return
+	}
+	current, err := normalizeState(syncer.SyncState(s))
+	if err != nil {
+		logger.Log.Errorf("Failed to encode sync state: %v", err)
+		return
+	}
+	if s.sync == nil {
+		s.sync = &stateSync{clients: make(map[string]*syncClient)}
+	}
+	delete(s.sync.clients, playerID)
+	s.sendState(playerID, current)
+}
+
+// dropPlayerSync 玩家离开后不再为其保留基准
+func (s *GamingState) dropPlayerSync(playerID string) {
+	if s.sync != nil {
+		delete(s.sync.clients, playerID)
+	}
+}
+
+// normalizeState 把状态编码为 JSON 再解码，得到可以逐字段比较的 map
+func normalizeState(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var state interface{}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// mergePatch 返回把 base 变为 current 的 JSON merge patch，两者都不是对象时 patch 为 current
+func mergePatch(base, current interface{}) interface{} {
+	baseMap, ok1 := base.(map[string]interface{})
+	currentMap, ok2 := current.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return current
+	}
+
+	patch := make(map[string]interface{})
+	for key, value := range currentMap {
+		old, exists := baseMap[key]
+		if !exists {
+			patch[key] = value
+			continue
+		}
+		if reflect.DeepEqual(old, value) {
+			continue
+		}
+		_, oldIsMap := old.(map[string]interface{})
+		_, newIsMap := value.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			patch[key] = mergePatch(old, value)
+		} else {
+			patch[key] = value
+		}
+	}
+	for key := range baseMap {
+		if _, exists := currentMap[key]; !exists {
+			patch[key] = nil
+		}
+	}
+	return patch
+}
+
+// ApplyStatePatch 把 JSON merge patch 应用到解码后的状态上并返回新的状态，不修改 base。
+// 供 Go 客户端和测试还原增量同步的状态
+func ApplyStatePatch(base, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	baseMap, ok := base.(map[string]interface{})
+	result := make(map[string]interface{}, len(baseMap))
+	if ok {
+		for key, value := range baseMap {
+			result[key] = value
+		}
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		if _, isMap := value.(map[string]interface{}); isMap {
+			result[key] = ApplyStatePatch(result[key], value)
+		} else {
+			result[key] = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package state
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergePatch_RoundTrip(t *testing.T) {
+	decode := func(raw string) interface{} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(raw), &v); err != nil {
+			t.Fatalf("Invalid JSON %s: %v", raw, err)
+		}
+		return v
+	}
+	base := decode(`{"pot":10,"board":["As"],"players":{"p1":{"bet":5,"stack":95},"p2":{"bet":10}},"winner":"p1"}`)
+	current := decode(`{"pot":30,"board":["As","Kd"],"players":{"p1":{"bet":20,"stack":95},"p2":{"bet":10}},"street":"flop"}`)
+
+	patch := mergePatch(base, current)
+	expected := decode(`{"pot":30,"board":["As","Kd"],"players":{"p1":{"bet":20}},"street":"flop","winner":null}`)
+	if !reflect.DeepEqual(patch, expected) {
+		t.Errorf("Expected only changed fields in the patch, got %v", patch)
+	}
+	if result := ApplyStatePatch(base, patch); !reflect.DeepEqual(result, current) {
+		t.Errorf("Expected the patch to rebuild the current state, got %v", result)
+	}
+	if base.(map[string]interface{})["winner"] != "p1" {
+		t.Error("ApplyStatePatch modified the base state")
+	}
+	if patch := mergePatch(current, current); len(patch.(map[string]interface{})) != 0 {
+		t.Errorf("Expected an empty patch for an unchanged state, got %v", patch)
+	}
+}
+
+// syncTestClient 按收到的状态更新还原每个 seq 的状态，模拟客户端
+type syncTestClient struct {
+	t      *testing.T
+	states map[uint64]interface{}
+}
+
+// apply 应用 updates 中的新消息，返回最后一条
+func (c *syncTestClient) apply(updates []StateUpdate) StateUpdate {
+	c.t.Helper()
+	for _, update := range updates {
+		if _, seen := c.states[update.Seq]; seen {
+			continue
+		}
+		if update.Full {
+			c.states[update.Seq] = update.State
+			continue
+		}
+		base, ok := c.states[update.Base]
+		if !ok {
+			c.t.Fatalf("Delta %d is based on unknown state %d", update.Seq, update.Base)
+		}
+		c.states[update.Seq] = ApplyStatePatch(base, update.State)
+	}
+	return updates[len(updates)-1]
+}
+
+func TestStateSync_DeltasAndFallback(t *testing.T) {
+	room, s := newHoldemGame(t, 1000, 1000, 1000)
+	clients := map[string]*syncTestClient{}
+	for id := range room.players {
+		clients[id] = &syncTestClient{t: t, states: make(map[uint64]interface{})}
+	}
+	// check 还原出的状态与服务端一致，返回玩家收到的最后一条更新
+	check := func(id string) StateUpdate {
+		t.Helper()
+		last := clients[id].apply(room.updates[id])
+		expected, _ := normalizeState(s.stateSyncer().SyncState(s))
+		if !reflect.DeepEqual(clients[id].states[last.Seq], expected) {
+			t.Fatalf("%s rebuilt a different state at %d", id, last.Seq)
+		}
+		return last
+	}
+	ack := func(id string, seq uint64) {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]interface{}{"type": StateAckAction, "seq": seq})
+		if err := s.HandleAction(room.players[id], raw); err != nil {
+			t.Fatalf("Ack from %s failed: %v", id, err)
+		}
+	}
+
+	act(t, room, s, `{"type":"call"}`)
+	if first := check("p1"); !first.Full || first.Seq != 1 {
+		t.Fatalf("Expected a full snapshot before any ack, got %+v", first)
+	}
+
+	// 不轮到的玩家也能确认，确认后收到相对确认状态的增量
+	if s.Turns.Current == "p2" {
+		t.Fatal("Expected p2 not to be the current player")
+	}
+	ack("p2", 1)
+	caller := s.Turns.Current
+	act(t, room, s, `{"type":"call"}`)
+	update := check("p2")
+	if update.Full || update.Base != 1 {
+		t.Fatalf("Expected a delta against state 1, got %+v", update)
+	}
+	// 一次跟注的增量只包含跟注的玩家和底池
+	patch := update.State.(map[string]interface{})
+	for key := range patch {
+		if key != "players" && key != "pot" && key != "current_bet" {
+			t.Errorf("Expected only players and pot in the delta, got %q", key)
+		}
+	}
+	if players := patch["players"].(map[string]interface{}); len(players) != 1 || players[caller] == nil {
+		t.Errorf("Expected only %s in the delta, got %v", caller, players)
+	}
+	if update := check("p3"); !update.Full {
+		t.Errorf("Expected a player without acks to keep receiving snapshots, got %+v", update)
+	}
+	raw, _ := json.Marshal(room.updates["p2"][1])
+	full, _ := json.Marshal(room.updates["p3"][1])
+	if len(raw) >= len(full) {
+		t.Errorf("Expected the delta to be smaller than the snapshot: %d >= %d bytes", len(raw), len(full))
+	}
+
+	// 确认丢失超过窗口后回到完整快照
+	for i := 0; i < stateSyncWindow; i++ {
+		s.SyncGameState()
+	}
+	if update := check("p2"); !update.Full {
+		t.Errorf("Expected a snapshot after %d unacknowledged states, got %+v", stateSyncWindow, update)
+	}
+	ack("p2", 1) // 已不在保留范围内的确认被忽略
+	s.SyncGameState()
+	if update := check("p2"); !update.Full {
+		t.Errorf("Expected an expired ack to be ignored, got %+v", update)
+	}
+
+	// 重连的玩家立即收到完整快照
+	last := check("p2")
+	ack("p2", last.Seq)
+	s.OnPlayerLeave(room.players["p2"])
+	s.OnPlayerJoin(room.players["p2"])
+	if update := check("p2"); !update.Full || update.Seq != last.Seq {
+		t.Errorf("Expected a snapshot on reconnect, got %+v", update)
+	}
+	for _, logged := range s.actions {
+		if strings.Contains(string(logged.Data), StateAckAction) {
+			t.Errorf("Expected acks to stay out of the action log, got %s", logged.Data)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package state
+
+import (
+	"encoding/json"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/network"
+)
+
+// SubState 一局中某个玩家所处的子状态，例如老虎机的免费 spin 回合。
+// 子状态的数据由游戏模块保存在游戏数据中，随房间快照恢复
+type SubState interface {
+	GetID() string
+}
+
+// SubStateEvent 玩家进入或结束子状态时广播的消息，结束时 Data 为子状态最终的数据
+type SubStateEvent struct {
+	PlayerID string   `json:"player_id"`
+	State    string   `json:"state"`
+	Data     SubState `json:"data"`
+}
+
+// EnterSubState 使玩家进入子状态并广播，玩家已处于子状态时替换
+func (s *GamingState) EnterSubState(playerID string, sub SubState) {
+	s.RestoreSubState(playerID, sub)
+	s.notifySubState(network.MsgTypeSubStateEnter, playerID, sub)
+}
+
+// RestoreSubState 从游戏数据恢复玩家的子状态，不广播
+func (s *GamingState) RestoreSubState(playerID string, sub SubState) {
+	if s.subStates == nil {
+		s.subStates = make(map[string]SubState)
+	}
+	s.subStates[playerID] = sub
+}
+
+// ExitSubState 结束玩家的子状态并广播
+func (s *GamingState) ExitSubState(playerID string) {
+	sub, ok := s.subStates[playerID]
+	if !ok {
+		return
+	}
+	delete(s.subStates, playerID)
+	s.notifySubState(network.MsgTypeSubStateExit, playerID, sub)
+}
+
+// MoveSubState 玩家重连后以新的玩家ID继续原来的子状态，并以新的玩家ID广播进入
+func (s *GamingState) MoveSubState(from, to string) {
+	sub, ok := s.subStates[from]
+	if !ok {
+		return
+	}
+	delete(s.subStates, from)
+	s.EnterSubState(to, sub)
+}
+
+// SubState 返回玩家当前的子状态，不在子状态中时返回 nil
+func (s *GamingState) SubState(playerID string) SubState {
+	return s.subStates[playerID]
+}
+
+func (s *GamingState) notifySubState(msgID uint16, playerID string, sub SubState) {
+	data, err := json.Marshal(SubStateEvent{PlayerID: playerID, State: sub.GetID(), Data: sub})
+	if err != nil {
+		logger.Log.Errorf("Failed to marshal sub state %s: %v", sub.GetID(), err)
+		return
+	}
+	s.Room.Broadcast(msgID, data)
+}
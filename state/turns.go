@@ -0,0 +1,275 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/network"
+)
+
+// ErrNotYourTurn 回合制游戏中不是当前行动玩家的动作
+var ErrNotYourTurn = errors.New("not your turn")
+
+// RoundPlayer 一局开始时房间内的玩家，回合制游戏按此名单重放
+type RoundPlayer struct {
+	PlayerID string `json:"player_id"`
+	UserID   int64  `json:"user_id,omitempty"`
+	Seat     int    `json:"seat"`              // 座位号，房间没有座位时为 -1
+	SatOut   bool   `json:"sat_out,omitempty"` // 没有参与这一局，例如带入筹码失败
+	Chips    int64  `json:"chips,omitempty"`   // 带入这一局的筹码
+}
+
+// Turns 回合制游戏的行动顺序和当前行动的玩家，由 GamingState 为实现 TurnGame 的游戏模块创建。
+// InitData 中可以直接修改 Order 和 Current，开局广播之后才开始计时；
+// 之后游戏模块处理完一个动作后调用 Pass 或 SetCurrent 交出行动权，每次交出都会广播并重新计时
+type Turns struct {
+	Order   []string        `json:"order"`
+	Current string          `json:"current,omitempty"` // 当前行动的玩家，为空时没有人行动
+	Turn    int             `json:"turn"`              // 行动权交换的次数
+	Out     map[string]bool `json:"out,omitempty"`     // 移出行动顺序的玩家，例如已经弃牌
+	Away    map[string]bool `json:"away,omitempty"`    // 已离开房间的玩家，轮到时立即代为行动
+
+	state    *GamingState
+	deadline time.Time
+}
+
+// TurnEvent 行动权变化时广播的消息
+type TurnEvent struct {
+	PlayerID string   `json:"player_id"`
+	Turn     int      `json:"turn"`
+	Timeout  int64    `json:"timeout"` // 行动的时限(毫秒)
+	Order    []string `json:"order"`
+}
+
+func newTurns(s *GamingState, order []string) *Turns {
+	return &Turns{Order: order, state: s}
+}
+
+// SortedPlayerIDs 返回按ID排序的房间内玩家，可作为没有座位概念的游戏的行动顺序
+func SortedPlayerIDs(room RoomContext) []string {
+	ids := make([]string, 0, len(room.GetPlayers()))
+	for id := range room.GetPlayers() {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Active 返回仍在行动顺序中的玩家
+func (t *Turns) Active() []string {
+	active := make([]string, 0, len(t.Order))
+	for _, id := range t.Order {
+		if !t.Out[id] {
+			active = append(active, id)
+		}
+	}
+	return active
+}
+
+// Pass 把行动权交给顺序中的下一个玩家并返回其ID，没有其他玩家可以行动时结束行动
+func (t *Turns) Pass() string {
+	start := slices.Index(t.Order, t.Current)
+	for i := 1; i <= len(t.Order); i++ {
+		id := t.Order[(start+i+len(t.Order))%len(t.Order)]
+		if !t.Out[id] && id != t.Current {
+			t.SetCurrent(id)
+			return id
+		}
+	}
+	t.Stop()
+	return ""
+}
+
+// SetCurrent 把行动权交给指定的玩家，例如新一轮从庄家之后的玩家开始
+func (t *Turns) SetCurrent(playerID string) {
+	t.Current = playerID
+	t.Turn++
+	t.resetDeadline()
+	t.notify()
+}
+
+// Replace 玩家重连后以新的玩家ID接替原来的位置
+func (t *Turns) Replace(from, to string) {
+	index := slices.Index(t.Order, from)
+	if index < 0 {
+		return
+	}
+	t.Order[index] = to
+	if t.Out[from] {
+		delete(t.Out, from)
+		t.Out[to] = true
+	}
+	delete(t.Away, from)
+	if t.Current == from {
+		t.Current = to
+		t.notify()
+	}
+}
+
+// Remove 把玩家移出行动顺序，之后 Pass 会跳过该玩家；不会交出当前的行动权
+func (t *Turns) Remove(playerID string) {
+	if t.Out == nil {
+		t.Out = make(map[string]bool)
+	}
+	t.Out[playerID] = true
+}
+
+// Stop 结束行动，例如一轮下注完成等待发牌时
+func (t *Turns) Stop() {
+	if t.Current == "" {
+		return
+	}
+	t.Current = ""
+	t.Turn++
+	t.notify()
+}
+
+// Remaining 返回当前行动玩家剩余的时间
+func (t *Turns) Remaining() time.Duration {
+	if t.Current == "" {
+		return 0
+	}
+	return max(time.Until(t.deadline), 0)
+}
+
+// start 开局广播后开始第一个玩家的回合，InitData 没有指定时由顺序中第一个仍在行动的玩家开始
+func (t *Turns) start() {
+	current := t.Current
+	if current == "" {
+		active := t.Active()
+		if len(active) == 0 {
+			return
+		}
+		current = active[0]
+	}
+	t.SetCurrent(current)
+}
+
+// expired 返回当前行动的玩家是否已超时或已离开
+func (t *Turns) expired(now time.Time) bool {
+	return t.Current != "" && (t.Away[t.Current] || !now.Before(t.deadline))
+}
+
+// bind 恢复后关联游戏状态，当前行动的玩家重新计时
+func (t *Turns) bind(s *GamingState) {
+	t.state = s
+	t.resetDeadline()
+}
+
+func (t *Turns) resetDeadline() {
+	t.deadline = time.Now().Add(t.state.Room.GetGameConfig().TurnTimeout)
+}
+
+func (t *Turns) setAway(playerID string, away bool) {
+	if !slices.Contains(t.Order, playerID) {
+		return
+	}
+	if t.Away == nil {
+		t.Away = make(map[string]bool)
+	}
+	if away {
+		t.Away[playerID] = true
+	} else {
+		delete(t.Away, playerID)
+	}
+}
+
+func (t *Turns) notify() {
+	event := TurnEvent{
+		PlayerID: t.Current,
+		Turn:     t.Turn,
+		Order:    t.Active(),
+	}
+	if t.Current != "" {
+		event.Timeout = t.state.Room.GetGameConfig().TurnTimeout.Milliseconds()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		logger.Log.Errorf("Failed to marshal turn change: %v", err)
+		return
+	}
+	t.state.Room.Broadcast(network.MsgTypeTurnChange, data)
+}
+
+// turnGame 返回实现 TurnGame 的游戏模块
+func (s *GamingState) turnGame() TurnGame {
+	game, _ := s.module.(TurnGame)
+	return game
+}
+
+// timeoutTurn 当前行动的玩家超时或已离开时由游戏模块代为行动，模块没有交出行动权时轮到下一个玩家。
+// 超时与动作一起记录，重放时在同一位置代为行动
+func (s *GamingState) timeoutTurn() {
+	playerID := s.Turns.Current
+	player := s.rosterPlayer(playerID)
+	turn := s.Turns.Turn
+	if data := s.turnGame().AutoAction(s, playerID); data != nil {
+		action, err := ParseAction(data)
+		if err == nil {
+			err = s.dispatch(player, action, data)
+		}
+		if err != nil {
+			logger.Log.Warnf("Room %s auto action for player %s failed: %v", s.Room.GetID(), playerID, err)
+		}
+	}
+	if s.Turns.Turn == turn {
+		s.Turns.Pass()
+	}
+	s.logTimeout(player)
+}
+
+// rosterPlayer 返回房间内或开局名单中的玩家，离开房间的玩家仍可由游戏模块代为行动
+func (s *GamingState) rosterPlayer(playerID string) Player {
+	if player, ok := s.Room.GetPlayers()[playerID]; ok {
+		return player
+	}
+	player := &loggedPlayer{id: playerID}
+	for _, p := range s.roster {
+		if p.PlayerID == playerID {
+			player.userID = p.UserID
+		}
+	}
+	return player
+}
+
+// captureRoster 记录一局开始时房间内的玩家及其座位
+func (s *GamingState) captureRoster() {
+	seats, _ := s.Room.(SeatProvider)
+	for _, id := range SortedPlayerIDs(s.Room) {
+		p := RoundPlayer{PlayerID: id, Seat: -1}
+		if user, ok := s.Room.GetPlayers()[id].(UserPlayer); ok {
+			p.UserID = user.GetUserID()
+		}
+		if seats != nil {
+			p.Seat = seats.GetSeat(id)
+		}
+		s.roster = append(s.roster, p)
+	}
+}
+
+// Roster 返回回合制游戏开局时的玩家，按玩家ID排序
+func (s *GamingState) Roster() []RoundPlayer {
+	return s.roster
+}
+
+// SitOut 记录玩家没有参与这一局，供 InitData 中带入失败等情况使用，重放时名单中的玩家同样不参与
+func (s *GamingState) SitOut(playerID string) {
+	for i := range s.roster {
+		if s.roster[i].PlayerID == playerID {
+			s.roster[i].SatOut = true
+		}
+	}
+}
+
+// SetChips 记录玩家带入这一局的筹码，重放时 InitData 从名单中取得带入的筹码，不再查询余额
+func (s *GamingState) SetChips(playerID string, chips int64) {
+	for i := range s.roster {
+		if s.roster[i].PlayerID == playerID {
+			s.roster[i].Chips = chips
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/models"
+	"github.com/wfunc/gameserver/network"
+)
+
+// turnModule is a minimal TurnGame: "move" records the move and passes the turn,
+// "fold" leaves the turn order, and timed out players fold.
+type turnModule struct{}
+
+type turnData struct {
+	Moves []string `json:"moves"`
+}
+
+func (m *turnModule) GameType() string                    { return "turn_test_game" }
+func (m *turnModule) Config() GameConfig                  { return GameConfig{} }
+func (m *turnModule) InitData(s *GamingState) interface{} { return &turnData{} }
+func (m *turnModule) TurnOrder(s *GamingState) []string   { return SortedPlayerIDs(s.Room) }
+
+func (m *turnModule) AutoAction(s *GamingState, playerID string) []byte {
+	return []byte(`{"type":"fold"}`)
+}
+
+func (m *turnModule) HandleAction(s *GamingState, player Player, action Action, actionData []byte) error {
+	data := s.GameData.(*turnData)
+	switch action.Type {
+	case "move":
+		data.Moves = append(data.Moves, player.GetID())
+	case "fold":
+		data.Moves = append(data.Moves, player.GetID()+" folds")
+		s.Turns.Remove(player.GetID())
+	default:
+		return errors.New("unknown action")
+	}
+	s.Turns.Pass()
+	return nil
+}
+
+func (m *turnModule) RestoreData(s *GamingState, raw json.RawMessage) (interface{}, error) {
+	data := &turnData{}
+	return data, json.Unmarshal(raw, data)
+}
+
+func (m *turnModule) Results(s *GamingState) map[string]interface{} {
+	return map[string]interface{}{"moves": s.GameData.(*turnData).Moves}
+}
+
+// turnRoom is a mockRoom playing the turn test game.
+type turnRoom struct {
+	*mockRoom
+}
+
+func (r *turnRoom) GetGameType() string { return "turn_test_game" }
+func (r *turnRoom) RoundSeed() string   { return "turns" }
+
+func newTurnGame(t *testing.T, timeout time.Duration) (*turnRoom, *GamingState) {
+	t.Helper()
+	RegisterGameModule(&turnModule{})
+	room := &turnRoom{mockRoom: newMockRoom(DefaultStartRule(), "p1", "p2", "p3")}
+	room.config.TurnTimeout = timeout
+	s := NewGamingState(room, time.Minute)
+	room.stateMachine = NewBaseStateMachine(s)
+	s.OnEnter()
+	return room, s
+}
+
+func TestTurns_EnforcesOrder(t *testing.T) {
+	room, s := newTurnGame(t, time.Minute)
+	if s.Turns.Current != "p1" || room.broadcasts[network.MsgTypeTurnChange] != 1 {
+		t.Fatalf("Expected p1 to act first after one broadcast, got %q (%d broadcasts)", s.Turns.Current, room.broadcasts[network.MsgTypeTurnChange])
+	}
+
+	if err := s.HandleAction(room.players["p2"], []byte(`{"type":"move"}`)); !errors.Is(err, ErrNotYourTurn) {
+		t.Fatalf("Expected ErrNotYourTurn, got %v", err)
+	}
+	for _, id := range []string{"p1", "p2"} {
+		action := `{"type":"move"}`
+		if id == "p2" {
+			action = `{"type":"fold"}`
+		}
+		if err := s.HandleAction(room.players[id], []byte(action)); err != nil {
+			t.Fatalf("Action of %s failed: %v", id, err)
+		}
+	}
+	if s.Turns.Current != "p3" {
+		t.Fatalf("Expected p3 to act after p2 folded, got %q", s.Turns.Current)
+	}
+	s.HandleAction(room.players["p3"], []byte(`{"type":"move"}`))
+	if s.Turns.Current != "p1" || !slices.Equal(s.Turns.Active(), []string{"p1", "p3"}) {
+		t.Errorf("Expected the folded player to be skipped, got %q of %v", s.Turns.Current, s.Turns.Active())
+	}
+	if room.broadcasts[network.MsgTypeTurnChange] != 4 {
+		t.Errorf("Expected a broadcast per turn change, got %d", room.broadcasts[network.MsgTypeTurnChange])
+	}
+}
+
+func TestTurns_TimeoutAndLeave(t *testing.T) {
+	room, s := newTurnGame(t, 20*time.Millisecond)
+
+	// p1 超时被代为弃牌
+	time.Sleep(30 * time.Millisecond)
+	s.OnUpdate()
+	if s.Turns.Current != "p2" {
+		t.Fatalf("Expected p1 to time out, got current player %q", s.Turns.Current)
+	}
+
+	// 轮到已离开的玩家时立即代为行动，不等待超时
+	s.HandleAction(room.players["p2"], []byte(`{"type":"move"}`))
+	s.OnPlayerLeave(room.players["p3"])
+	delete(room.players, "p3")
+	s.OnUpdate()
+	if s.Turns.Current != "p2" || !slices.Equal(s.Turns.Active(), []string{"p2"}) {
+		t.Fatalf("Expected the absent p3 to fold at once, got %q of %v", s.Turns.Current, s.Turns.Active())
+	}
+
+	// 快照恢复后仍由原来的玩家行动
+	round, err := s.RoundSnapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot round: %v", err)
+	}
+	raw, _ := json.Marshal(s.GameData)
+	restored := NewRestoredGamingState(room, time.Minute, time.Minute, raw, round)
+	restored.OnEnter()
+	if restored.Turns.Current != "p2" || restored.Turns.Remaining() <= 0 {
+		t.Fatalf("Expected p2 to keep the turn after restore, got %+v", restored.Turns)
+	}
+	room.stateMachine = NewBaseStateMachine(restored)
+	if err := restored.HandleAction(room.players["p2"], []byte(`{"type":"move"}`)); err != nil {
+		t.Fatalf("Action after restore failed: %v", err)
+	}
+	restored.RemainingTime = 0
+	restored.OnUpdate()
+
+	// 记录经 JSON 保存后重放，超时的位置和代为执行的动作与原局一致
+	data, _ := json.Marshal(room.records[0])
+	var record models.GameRecord
+	json.Unmarshal(data, &record)
+	log, err := ReplayLogFromRecord(&record)
+	if err != nil || len(log.Players) != 3 || len(log.Actions) != 4 || !log.Actions[0].Timeout || !log.Actions[2].Timeout {
+		t.Fatalf("Unexpected replay log: %+v (err: %v)", log, err)
+	}
+	replayed, err := Replay(&record, nil)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if original, result := normalizeJSON(record.Result), normalizeJSON(replayed.Result); original != result {
+		t.Errorf("Expected replay to reproduce the result\noriginal: %s\nreplayed: %s", original, result)
+	}
+}
@@ -0,0 +1,189 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/network"
+)
+
+// ErrGameNotStarted is returned when a game action arrives before the game has started.
+var ErrGameNotStarted = errors.New("game has not started")
+
+// StartMode 决定等待状态在什么条件下开始倒计时
+type StartMode string
+
+const (
+	// StartAllReady 房间人数达到 MinPlayers 且所有人都已准备
+	StartAllReady StartMode = "all_ready"
+	// StartMinPlayers 已准备的人数达到 MinPlayers，未准备的玩家不阻塞开局
+	StartMinPlayers StartMode = "min_players"
+)
+
+// StartRule 等待状态的开局规则
+type StartRule struct {
+	Mode       StartMode     `json:"mode" mapstructure:"mode"`
+	MinPlayers int           `json:"min_players" mapstructure:"min_players"`
+	Countdown  time.Duration `json:"countdown" mapstructure:"countdown"` // 条件满足后到开局的倒计时
+}
+
+// DefaultStartRule 返回默认开局规则：所有人准备后倒计时3秒
+func DefaultStartRule() StartRule {
+	return StartRule{
+		Mode:       StartAllReady,
+		MinPlayers: 1,
+		Countdown:  3 * time.Second,
+	}
+}
+
+// NewWaitingState creates a new waiting state.
+func NewWaitingState(room RoomContext) *WaitingState {
+	return &WaitingState{
+		RoomStateBase: RoomStateBase{
+			ID:   "waiting",
+			Room: room,
+		},
+	}
+}
+
+// 等待状态，玩家在此阶段准备，满足开局规则后倒计时进入游戏
+type WaitingState struct {
+	RoomStateBase
+	rule          StartRule
+	ready         map[string]bool // playerID -> 是否已准备
+	deadline      time.Time       // 倒计时结束时间，零值表示未在倒计时
+	lastCountdown int             // 上次广播的剩余秒数
+}
+
+func (s *WaitingState) OnEnter() {
+	s.rule = s.Room.GetGameConfig().StartRule
+	if s.rule.MinPlayers < 1 {
+		s.rule.MinPlayers = 1
+	}
+	s.ready = make(map[string]bool)
+	s.deadline = time.Time{}
+}
+
+func (s *WaitingState) OnUpdate() {
+	if !s.canStart() {
+		s.cancelCountdown()
+		return
+	}
+
+	now := time.Now()
+	if s.deadline.IsZero() {
+		s.deadline = now.Add(s.rule.Countdown)
+		s.lastCountdown = -1
+	}
+
+	remaining := s.deadline.Sub(now)
+	if remaining > 0 {
+		s.notifyCountdown(remaining)
+		return
+	}
+	s.deadline = time.Time{}
+	if err := s.StartGame(); err != nil {
+		logger.Log.Errorf("Room %s failed to start game: %v", s.Room.GetID(), err)
+	}
+}
+
+// SetReady 设置玩家的准备状态并广播给房间
+func (s *WaitingState) SetReady(player Player, ready bool) {
+	if ready {
+		s.ready[player.GetID()] = true
+	} else {
+		delete(s.ready, player.GetID())
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"session_id": player.GetID(),
+		"ready":      ready,
+	})
+	if err != nil {
+		return
+	}
+	s.Room.Broadcast(network.MsgTypeReady, data)
+}
+
+// IsReady 返回玩家是否已准备
+func (s *WaitingState) IsReady(playerID string) bool {
+	return s.ready[playerID]
+}
+
+// CountingDown 返回是否正在开局倒计时
+func (s *WaitingState) CountingDown() bool {
+	return !s.deadline.IsZero()
+}
+
+// OnPlayerJoin 新玩家默认未准备，all_ready 规则下倒计时会在下一帧取消
+func (s *WaitingState) OnPlayerJoin(player Player) {}
+
+// OnPlayerLeave 玩家离开时清除其准备状态并取消正在进行的倒计时
+func (s *WaitingState) OnPlayerLeave(player Player) {
+	delete(s.ready, player.GetID())
+	s.cancelCountdown()
+}
+
+// StartGame 结束等待，立即切换到游戏状态，配置了帧同步的游戏进入帧同步状态
+func (s *WaitingState) StartGame() error {
+	config := s.Room.GetGameConfig()
+	if config.Lockstep != nil {
+		return s.Room.ChangeState(NewLockstepState(s.Room, *config.Lockstep, config.RoundDuration))
+	}
+	gamingState := NewGamingState(s.Room, config.RoundDuration)
+	return s.Room.ChangeState(gamingState)
+}
+
+// HandleAction 等待阶段不接受游戏动作，准备请通过准备消息发送
+func (s *WaitingState) HandleAction(player Player, actionData []byte) error {
+	return ErrGameNotStarted
+}
+
+// canStart 判断当前是否满足开局规则
+func (s *WaitingState) canStart() bool {
+	players := s.Room.GetPlayers()
+	readyCount := 0
+	for id := range players {
+		if s.ready[id] {
+			readyCount++
+		}
+	}
+
+	switch s.rule.Mode {
+	case StartMinPlayers:
+		return readyCount >= s.rule.MinPlayers
+	default:
+		return len(players) >= s.rule.MinPlayers && readyCount == len(players)
+	}
+}
+
+// notifyCountdown 每当剩余秒数变化时广播一次
+func (s *WaitingState) notifyCountdown(remaining time.Duration) {
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	if seconds == s.lastCountdown {
+		return
+	}
+	s.lastCountdown = seconds
+
+	data, err := json.Marshal(map[string]interface{}{"seconds": seconds})
+	if err != nil {
+		return
+	}
+	s.Room.Broadcast(network.MsgTypeCountdown, data)
+}
+
+// cancelCountdown 取消倒计时并通知房间
+func (s *WaitingState) cancelCountdown() {
+	if s.deadline.IsZero() {
+		return
+	}
+	s.deadline = time.Time{}
+
+	data, err := json.Marshal(map[string]interface{}{"seconds": 0, "cancelled": true})
+	if err != nil {
+		return
+	}
+	s.Room.Broadcast(network.MsgTypeCountdown, data)
+}
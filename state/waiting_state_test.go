@@ -0,0 +1,139 @@
+package state
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/wfunc/gameserver/logger"
+	"github.com/wfunc/gameserver/models"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	os.Exit(m.Run())
+}
+
+// mockPlayer is a test double for the Player interface.
+type mockPlayer struct {
+	id string
+}
+
+func (p *mockPlayer) GetID() string { return p.id }
+
+// mockRoom is a test double for the RoomContext interface backed by a real state machine.
+type mockRoom struct {
+	players      map[string]Player
+	maxPlayers   int
+	config       GameConfig
+	stateMachine StateMachine
+	broadcasts   map[uint16]int
+	records      []*models.GameRecord
+}
+
+func newMockRoom(rule StartRule, players ...string) *mockRoom {
+	room := &mockRoom{
+		players:    make(map[string]Player),
+		maxPlayers: 4,
+		config:     GameConfig{RoundDuration: time.Minute, StartRule: rule},
+		broadcasts: make(map[uint16]int),
+	}
+	for _, id := range players {
+		room.players[id] = &mockPlayer{id: id}
+	}
+	room.stateMachine = NewBaseStateMachine(NewWaitingState(room))
+	return room
+}
+
+func (r *mockRoom) GetID() string                    { return "mock_room" }
+func (r *mockRoom) GetGameType() string              { return "test_game" }
+func (r *mockRoom) GetPlayers() map[string]Player    { return r.players }
+func (r *mockRoom) GetMaxPlayers() int               { return r.maxPlayers }
+func (r *mockRoom) GetGameConfig() GameConfig        { return r.config }
+func (r *mockRoom) ChangeState(newState State) error { return r.stateMachine.ChangeState(newState) }
+func (r *mockRoom) Broadcast(msgID uint16, data []byte) error {
+	r.broadcasts[msgID]++
+	return nil
+}
+
+func (r *mockRoom) RecordGame(record *models.GameRecord) {
+	r.records = append(r.records, record)
+}
+
+func (r *mockRoom) waitingState(t *testing.T) *WaitingState {
+	t.Helper()
+	ws, ok := r.stateMachine.GetCurrentState().(*WaitingState)
+	if !ok {
+		t.Fatalf("Expected current state to be waiting, got %s", r.stateMachine.GetCurrentState().GetID())
+	}
+	return ws
+}
+
+func TestWaitingState_AllReadyStartsGame(t *testing.T) {
+	room := newMockRoom(StartRule{Mode: StartAllReady, MinPlayers: 2}, "p1", "p2")
+	ws := room.waitingState(t)
+
+	ws.SetReady(room.players["p1"], true)
+	ws.OnUpdate()
+	if room.stateMachine.GetCurrentState() != ws {
+		t.Fatal("Game should not start until every player is ready")
+	}
+
+	ws.SetReady(room.players["p2"], true)
+	ws.OnUpdate()
+	if room.stateMachine.GetCurrentState().GetID() != "gaming" {
+		t.Errorf("Expected gaming state once all players are ready, got %s", room.stateMachine.GetCurrentState().GetID())
+	}
+}
+
+func TestWaitingState_UnreadyCancelsCountdown(t *testing.T) {
+	room := newMockRoom(StartRule{Mode: StartAllReady, MinPlayers: 1, Countdown: time.Hour}, "p1")
+	ws := room.waitingState(t)
+
+	ws.SetReady(room.players["p1"], true)
+	ws.OnUpdate()
+	if !ws.CountingDown() {
+		t.Fatal("Expected countdown to start once all players are ready")
+	}
+
+	ws.SetReady(room.players["p1"], false)
+	ws.OnUpdate()
+	if ws.CountingDown() {
+		t.Error("Expected countdown to be cancelled after the player unreadied")
+	}
+}
+
+func TestWaitingState_PlayerLeaveCancelsCountdown(t *testing.T) {
+	room := newMockRoom(StartRule{Mode: StartMinPlayers, MinPlayers: 2, Countdown: time.Hour}, "p1", "p2", "p3")
+	ws := room.waitingState(t)
+
+	for _, id := range []string{"p1", "p2", "p3"} {
+		ws.SetReady(room.players[id], true)
+	}
+	ws.OnUpdate()
+	if !ws.CountingDown() {
+		t.Fatal("Expected countdown to start once enough players are ready")
+	}
+
+	leaving := room.players["p3"]
+	delete(room.players, "p3")
+	ws.OnPlayerLeave(leaving)
+	if ws.CountingDown() {
+		t.Error("Expected countdown to be cancelled when a player leaves")
+	}
+	if ws.IsReady("p3") {
+		t.Error("Leaving player's ready flag should be cleared")
+	}
+}
+
+func TestWaitingState_RejectsActions(t *testing.T) {
+	room := newMockRoom(DefaultStartRule(), "p1")
+	ws := room.waitingState(t)
+
+	if err := ws.HandleAction(room.players["p1"], []byte(`{"type":"spin"}`)); err != ErrGameNotStarted {
+		t.Errorf("Expected ErrGameNotStarted, got %v", err)
+	}
+	if room.stateMachine.GetCurrentState() != ws {
+		t.Error("An action must not start the game")
+	}
+}
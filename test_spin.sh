@@ -10,11 +10,11 @@ SERVER_PID=$!
 sleep 2
 
 echo ""
-echo "2. 启动客户端并发送 spin..."
+echo "2. 启动客户端，准备后发送 spin..."
 echo ""
 
 # 运行客户端，自动发送 spin
-echo "spin" | go run client/main.go &
+(echo "ready"; sleep 4; echo "spin") | go run client/main.go &
 CLIENT_PID=$!
 
 # 等待测试完成
@@ -28,6 +28,6 @@ kill $CLIENT_PID 2>/dev/null
 echo ""
 echo "=== 测试完成 ==="
 echo "检查日志以验证："
-echo "  - WaitingState 应该收到动作并转换到 GamingState"
+echo "  - 玩家准备后 WaitingState 应该倒计时并转换到 GamingState"
 echo "  - spin_count 应该大于 0"
 echo "  - 应该有 GameSync 消息广播"
\ No newline at end of file